@@ -11,9 +11,11 @@ import (
 
 	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/weiawesome/wes-io-live/media-service/internal/config"
 	"github.com/weiawesome/wes-io-live/media-service/internal/service"
 	"github.com/weiawesome/wes-io-live/media-service/internal/webrtc"
+	"github.com/weiawesome/wes-io-live/pkg/hlskey"
 	"github.com/weiawesome/wes-io-live/pkg/pubsub"
 	"github.com/weiawesome/wes-io-live/pkg/storage"
 )
@@ -57,10 +59,49 @@ func main() {
 	logger.Info().Int("count", len(iceServers)).Msg("ice servers configured")
 
 	// Initialize peer manager
-	peerMgr := webrtc.NewPeerManager(iceServers)
+	// In passthrough mode keyframes are requested once per segment so segments stay close to the target duration
+	var pliInterval time.Duration
+	if cfg.FFmpeg.Passthrough {
+		pliInterval = time.Duration(cfg.HLS.SegmentDuration) * time.Second
+	}
+	peerMgr := webrtc.NewPeerManager(iceServers, cfg.WebRTC.Simulcast.Enabled, pliInterval)
 
 	// Initialize transcoder
-	transcoder := service.NewTranscoder(cfg.HLS, cfg.FFmpeg)
+	encoders, err := service.NewEncoderRegistry(cfg.FFmpeg, cfg.HLS)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid encoder profiles")
+	}
+	if err := encoders.Validate(context.Background()); err != nil {
+		logger.Fatal().Err(err).Msg("failed to validate encoder profiles")
+	}
+
+	// Initialize content encryption, keys are shared with the playback-service key server
+	var keyStore *hlskey.Store
+	var contentKeys *service.ContentKeys
+	if cfg.HLS.Encryption.Enabled {
+		redisCfg := cfg.HLS.Encryption.Redis
+		// If address is not set, use pubsub redis settings
+		if redisCfg.Address == "" {
+			redisCfg.Address = cfg.PubSub.Redis.Address
+			redisCfg.Password = cfg.PubSub.Redis.Password
+		}
+
+		keyStore, err = hlskey.NewRedisStore(hlskey.RedisConfig{
+			Address:   redisCfg.Address,
+			Password:  redisCfg.Password,
+			DB:        redisCfg.DB,
+			KeyPrefix: redisCfg.KeyPrefix,
+		})
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to create content key store")
+		}
+		defer keyStore.Close()
+
+		contentKeys = service.NewContentKeys(cfg.HLS.Encryption, keyStore)
+		logger.Info().Str("method", cfg.HLS.Encryption.Method).Strs("rooms", cfg.HLS.Encryption.Rooms).Int("rotation_seconds", cfg.HLS.Encryption.RotationSeconds).Msg("hls encryption enabled")
+	}
+
+	transcoder := service.NewTranscoder(cfg.HLS, cfg.FFmpeg, encoders, contentKeys)
 
 	// Create context for initialization
 	initCtx := context.Background()
@@ -117,10 +158,49 @@ func main() {
 			VODConfig:      cfg.Storage.VOD,
 			TargetDuration: cfg.HLS.SegmentDuration,
 			SessionStore:   sessionStore,
+			DASHEnabled:    cfg.HLS.DASHEnabled,
+			Codecs:         transcoder.CodecString(),
+			InstanceID:     cfg.Server.InstanceID,
 		})
 		vodManager.Start()
 		defer vodManager.Stop()
 		logger.Info().Msg("vod manager initialized")
+
+		// Finalize sessions left behind by a crash before accepting new broadcasts
+		reconcileCtx, reconcileCancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		if err := vodManager.ReconcileOrphanedSessions(reconcileCtx); err != nil {
+			logger.Error().Err(err).Msg("failed to reconcile orphaned vod sessions")
+		}
+		reconcileCancel()
+	}
+
+	// Start VOD retention sweeper if VOD recordings are stored
+	if vodManager != nil && s3Storage != nil && cfg.Storage.VOD.Retention.Enabled {
+		var sweepLock *service.RedisSweepLock
+		if lockCfg := cfg.Storage.VOD.Retention.Lock; lockCfg.Enabled {
+			// If address is not set, use pubsub redis settings
+			if lockCfg.Address == "" {
+				lockCfg.Address = cfg.PubSub.Redis.Address
+				lockCfg.Password = cfg.PubSub.Redis.Password
+			}
+			sweepLock, err = service.NewRedisSweepLock(lockCfg, cfg.Server.InstanceID)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to create retention lock")
+			}
+			defer sweepLock.Close()
+		}
+
+		sweeper := service.NewRetentionSweeper(service.RetentionSweeperConfig{
+			VODManager:    vodManager,
+			Storage:       s3Storage,
+			SessionStore:  sessionStore,
+			KeyStore:      keyStore,
+			Lock:          sweepLock,
+			Retention:     cfg.Storage.VOD.Retention,
+			RetentionDays: cfg.Storage.VOD.RetentionDays,
+		})
+		sweeper.Start()
+		defer sweeper.Stop()
 	}
 
 	// Initialize thumbnail service if enabled and VOD manager has uploader
@@ -130,13 +210,41 @@ func main() {
 			PreviewConfig: cfg.Preview,
 			HLSOutputDir:  cfg.HLS.OutputDir,
 			Uploader:      vodManager.GetUploader(),
+			Keys:          contentKeys,
 		})
 		defer thumbnailService.Stop()
 		logger.Info().Msg("thumbnail service initialized")
 	}
 
+	// Initialize sprite sheet generation for VOD seek previews
+	if cfg.Preview.Sprites.Enabled && vodManager != nil && vodManager.GetUploader() != nil {
+		spriteGenerator := service.NewSpriteGenerator(service.SpriteGeneratorConfig{
+			SpriteConfig: cfg.Preview.Sprites,
+			HLSOutputDir: cfg.HLS.OutputDir,
+			Uploader:     vodManager.GetUploader(),
+			Keys:         contentKeys,
+		})
+		vodManager.SetSegmentObserver(spriteGenerator)
+		defer spriteGenerator.Stop()
+		logger.Info().Msg("sprite generator initialized")
+	}
+
+	// Initialize stream health telemetry
+	var healthMonitor *service.StreamHealthMonitor
+	if cfg.Health.Enabled {
+		healthMonitor = service.NewStreamHealthMonitor(service.StreamHealthMonitorConfig{
+			HealthConfig:    cfg.Health,
+			Transcoder:      transcoder,
+			PubSub:          ps,
+			SegmentDuration: cfg.HLS.SegmentDuration,
+		})
+		healthMonitor.Start()
+		defer healthMonitor.Stop()
+		logger.Info().Msg("stream health monitor initialized")
+	}
+
 	// Initialize media service
-	mediaSvc := service.NewMediaService(peerMgr, transcoder, ps, vodManager, thumbnailService)
+	mediaSvc := service.NewMediaService(peerMgr, transcoder, ps, vodManager, thumbnailService, healthMonitor, cfg.WebRTC.Simulcast, cfg.Reconnect)
 
 	// Start service (subscribes to events)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -156,6 +264,9 @@ func main() {
 		w.Write([]byte("OK"))
 	})
 
+	// Prometheus metrics (upload queue depth, failures, ...)
+	mux.Handle("/metrics", promhttp.Handler())
+
 	handler := pkglog.HTTPMiddleware(logger)(mux)
 
 	server := &http.Server{
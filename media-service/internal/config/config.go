@@ -15,14 +15,16 @@ import (
 )
 
 type Config struct {
-	Server  ServerConfig
-	HLS     HLSConfig
-	WebRTC  WebRTCConfig
-	PubSub  pubsub.Config
-	FFmpeg  FFmpegConfig
-	Log     LogConfig
-	Storage StorageConfig
-	Preview PreviewConfig
+	Server    ServerConfig
+	HLS       HLSConfig
+	WebRTC    WebRTCConfig
+	PubSub    pubsub.Config
+	FFmpeg    FFmpegConfig
+	Log       LogConfig
+	Storage   StorageConfig
+	Preview   PreviewConfig
+	Health    HealthConfig
+	Reconnect ReconnectConfig
 }
 
 type PreviewConfig struct {
@@ -33,6 +35,39 @@ type PreviewConfig struct {
 	Height              int    `mapstructure:"height"`
 	Format              string `mapstructure:"format"`
 	Quality             int    `mapstructure:"quality"`
+
+	Sprites  SpriteConfig          `mapstructure:"sprites"`
+	Animated AnimatedPreviewConfig `mapstructure:"animated"`
+}
+
+type SpriteConfig struct {
+	Enabled         bool `mapstructure:"enabled"`
+	IntervalSeconds int  `mapstructure:"interval_seconds"` // Recording time between tiles
+	Width           int  `mapstructure:"width"`            // Tile width
+	Height          int  `mapstructure:"height"`           // Tile height
+	Columns         int  `mapstructure:"columns"`          // Tiles per row of a sheet
+	Rows            int  `mapstructure:"rows"`             // Rows of a sheet
+	Quality         int  `mapstructure:"quality"`          // JPEG quality (1-100)
+}
+
+type AnimatedPreviewConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	Format          string `mapstructure:"format"`           // "webp" or "mp4"
+	DurationSeconds int    `mapstructure:"duration_seconds"` // Length of the loop
+	Width           int    `mapstructure:"width"`
+	Height          int    `mapstructure:"height"`
+	FPS             int    `mapstructure:"fps"`
+	Quality         int    `mapstructure:"quality"` // 0-100, higher is better
+}
+
+type HealthConfig struct {
+	Enabled         bool `mapstructure:"enabled"`
+	IntervalSeconds int  `mapstructure:"interval_seconds"` // How often stream health is published
+}
+
+type ReconnectConfig struct {
+	Enabled            bool `mapstructure:"enabled"`
+	GracePeriodSeconds int  `mapstructure:"grace_period_seconds"` // How long a dropped broadcast can be resumed
 }
 
 type StorageConfig struct {
@@ -71,15 +106,46 @@ type S3StorageConfig struct {
 }
 
 type VODConfig struct {
-	Enabled       bool `mapstructure:"enabled"`
-	AsyncUpload   bool `mapstructure:"async_upload"`
-	UploadWorkers int  `mapstructure:"upload_workers"`
-	RetentionDays int  `mapstructure:"retention_days"`
+	Enabled       bool              `mapstructure:"enabled"`
+	AsyncUpload   bool              `mapstructure:"async_upload"`
+	UploadWorkers int               `mapstructure:"upload_workers"`
+	UploadQueue   UploadQueueConfig `mapstructure:"upload_queue"`
+	RetentionDays int               `mapstructure:"retention_days"` // 0 = keep forever
+	Retention     RetentionConfig   `mapstructure:"retention"`
+}
+
+type UploadQueueConfig struct {
+	JournalDir       string `mapstructure:"journal_dir"`         // On-disk upload journal, empty = in-memory queue only
+	HighWaterMark    int    `mapstructure:"high_water_mark"`     // Pending uploads above which Upload signals backpressure
+	MaxPending       int    `mapstructure:"max_pending"`         // Pending uploads above which new uploads are rejected
+	MaxRetries       int    `mapstructure:"max_retries"`         // Attempts before a task is moved to the dead-letter list
+	MaxRequeues      int    `mapstructure:"max_requeues"`        // Restarts a dead letter is retried on before it is kept for inspection
+	RetryBaseDelayMs int    `mapstructure:"retry_base_delay_ms"` // First retry delay, doubled on every attempt
+	RetryMaxDelayMs  int    `mapstructure:"retry_max_delay_ms"`  // Upper bound of the retry delay
+}
+
+type RetentionConfig struct {
+	Enabled         bool                `mapstructure:"enabled"`
+	IntervalMinutes int                 `mapstructure:"interval_minutes"`
+	DryRun          bool                `mapstructure:"dry_run"`         // Only report what would be deleted
+	RoomOverrides   map[string]int      `mapstructure:"room_overrides"`  // roomID -> retention days, 0 = never expire
+	PinnedSessions  []string            `mapstructure:"pinned_sessions"` // "roomID/sessionID" entries that never expire
+	Lock            RetentionLockConfig `mapstructure:"lock"`
+}
+
+// RetentionLockConfig holds the Redis lock that lets a single replica sweep per interval.
+type RetentionLockConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Address  string `mapstructure:"address"` // empty = use pubsub.redis
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+	Key      string `mapstructure:"key"`
 }
 
 type ServerConfig struct {
-	Host string
-	Port int
+	Host       string
+	Port       int
+	InstanceID string `mapstructure:"instance_id"` // Stable per-instance ID owning VOD sessions, defaults to hostname
 }
 
 type HLSConfig struct {
@@ -87,12 +153,89 @@ type HLSConfig struct {
 	SegmentDuration int    `mapstructure:"segment_duration"`
 	PlaylistSize    int    `mapstructure:"playlist_size"`
 	DeleteSegments  bool   `mapstructure:"delete_segments"`
+	SegmentType     string `mapstructure:"segment_type"` // "mpegts" or "fmp4"
+	DASHEnabled     bool   `mapstructure:"dash_enabled"` // Also publish an MPD manifest (requires fmp4)
+
+	Encryption EncryptionConfig `mapstructure:"encryption"`
+	AudioOnly  AudioOnlyConfig  `mapstructure:"audio_only"`
+}
+
+// AudioOnlyConfig holds the audio-only AAC rendition published alongside the video of rooms
+// people listen to in the background, e.g. talk shows. It is written to the "audio" subdirectory
+// of the session and listed in the session's master playlist.
+type AudioOnlyConfig struct {
+	Enabled bool     `mapstructure:"enabled"`
+	Bitrate string   `mapstructure:"bitrate"` // AAC bitrate of the rendition
+	Rooms   []string `mapstructure:"rooms"`   // Rooms with an audio-only rendition, empty = every room
+}
+
+// Publishes returns true if an audio-only rendition is published for a room.
+func (c AudioOnlyConfig) Publishes(roomID string) bool {
+	return c.Enabled && listsRoom(c.Rooms, roomID)
+}
+
+// EncryptionConfig holds HLS content encryption. Keys are generated per session, rotated
+// while it is live and shared with the playback-service key server through Redis.
+type EncryptionConfig struct {
+	Enabled         bool                `mapstructure:"enabled"`
+	Method          string              `mapstructure:"method"`           // "AES-128"
+	KeyURI          string              `mapstructure:"key_uri"`          // Key server base URI written to playlists
+	KeyDir          string              `mapstructure:"key_dir"`          // Local key files read by FFmpeg, must not be served
+	RotationSeconds int                 `mapstructure:"rotation_seconds"` // Key lifetime, 0 = one key per connection
+	Rooms           []string            `mapstructure:"rooms"`            // Encrypted rooms, empty = every room
+	Redis           KeyStoreRedisConfig `mapstructure:"redis"`
+}
+
+// KeyStoreRedisConfig holds the Redis store of content keys, shared with playback-service.
+type KeyStoreRedisConfig struct {
+	Address   string `mapstructure:"address"` // empty = use pubsub.redis
+	Password  string `mapstructure:"password"`
+	DB        int    `mapstructure:"db"`
+	KeyPrefix string `mapstructure:"key_prefix"`
+}
+
+// Encrypts returns true if the segments of a room are encrypted.
+func (c EncryptionConfig) Encrypts(roomID string) bool {
+	return c.Enabled && listsRoom(c.Rooms, roomID)
+}
+
+// listsRoom returns true if a room is in a room list, an empty list includes every room.
+func listsRoom(rooms []string, roomID string) bool {
+	if len(rooms) == 0 {
+		return true
+	}
+	for _, room := range rooms {
+		if room == roomID {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFMP4 returns true if segments are written as fragmented MP4 (CMAF) with an init segment.
+func (c HLSConfig) IsFMP4() bool {
+	return c.SegmentType == "fmp4"
+}
+
+// SegmentExtension returns the file extension used for media segments.
+func (c HLSConfig) SegmentExtension() string {
+	if c.IsFMP4() {
+		return ".m4s"
+	}
+	return ".ts"
 }
 
 type WebRTCConfig struct {
 	ICEServers []ICEServerConfig `mapstructure:"ice_servers"`
 	TurnKeyID  string            `mapstructure:"turn_key_id"`
 	TurnKey    string            `mapstructure:"turn_key"`
+	Simulcast  SimulcastConfig   `mapstructure:"simulcast"`
+}
+
+type SimulcastConfig struct {
+	Enabled      bool   `mapstructure:"enabled"`       // Accept simulcast layers (rid) from the broadcaster
+	PrimaryLayer string `mapstructure:"primary_layer"` // Layer fed to the HLS transcoder, e.g. "h"
+	Passthrough  bool   `mapstructure:"passthrough"`   // Publish the other layers as HLS renditions without re-encoding
 }
 
 type ICEServerConfig struct {
@@ -112,6 +255,28 @@ type FFmpegConfig struct {
 	AudioCodec   string `mapstructure:"audio_codec"`
 	AudioBitrate string `mapstructure:"audio_bitrate"` // e.g., "128k"
 	AudioSample  int    `mapstructure:"audio_sample"`  // e.g., 48000
+	Passthrough  bool   `mapstructure:"passthrough"`   // Remux HLS-compatible H.264 ingest without re-encoding
+
+	// Named encoder profiles. If empty, the video settings above form the "default" x264 profile.
+	Profiles       map[string]EncoderProfileConfig `mapstructure:"profiles"`
+	DefaultProfile string                          `mapstructure:"default_profile"`
+	RoomProfiles   map[string]string               `mapstructure:"room_profiles"` // roomID -> profile name
+}
+
+// EncoderProfileConfig configures a named video encoder profile.
+type EncoderProfileConfig struct {
+	Type      string `mapstructure:"type"`      // "x264", "x265", "svtav1" or "vp9"
+	Encoder   string `mapstructure:"encoder"`   // FFmpeg encoder name, empty = default for type
+	Preset    string `mapstructure:"preset"`    // Encoder speed preset (vp9: deadline)
+	Tune      string `mapstructure:"tune"`      // e.g., "zerolatency" (x264/x265)
+	Profile   string `mapstructure:"profile"`   // H.264 profile: "baseline", "main" or "high"
+	Level     string `mapstructure:"level"`     // e.g., "3.1"
+	Bitrate   string `mapstructure:"bitrate"`   // e.g., "2M", empty for CRF mode
+	CRF       int    `mapstructure:"crf"`       // 0 means use bitrate instead
+	Width     int    `mapstructure:"width"`     // 0 for original resolution
+	Height    int    `mapstructure:"height"`    // 0 for original resolution
+	Framerate int    `mapstructure:"framerate"` // 0 for original framerate
+	GOP       int    `mapstructure:"gop"`       // Keyframe interval in frames, 0 = framerate or 30
 }
 
 type LogConfig struct {
@@ -131,6 +296,21 @@ func Load() (*Config, error) {
 	v.SetDefault("hls.segment_duration", 2)
 	v.SetDefault("hls.playlist_size", 5)
 	v.SetDefault("hls.delete_segments", true)
+	v.SetDefault("hls.segment_type", "mpegts")
+	v.SetDefault("hls.dash_enabled", false)
+	v.SetDefault("hls.encryption.enabled", false)
+	v.SetDefault("hls.encryption.method", "AES-128")
+	v.SetDefault("hls.encryption.key_uri", "/keys")
+	v.SetDefault("hls.encryption.key_dir", "./data/hls-keys")
+	v.SetDefault("hls.encryption.rotation_seconds", 600)
+	v.SetDefault("hls.encryption.redis.address", "") // empty = use pubsub.redis
+	v.SetDefault("hls.encryption.redis.db", 1)
+	v.SetDefault("hls.encryption.redis.key_prefix", "hls:key:")
+	v.SetDefault("hls.audio_only.enabled", false)
+	v.SetDefault("hls.audio_only.bitrate", "64k")
+	v.SetDefault("webrtc.simulcast.enabled", false)
+	v.SetDefault("webrtc.simulcast.primary_layer", "h")
+	v.SetDefault("webrtc.simulcast.passthrough", false)
 	v.SetDefault("ffmpeg.video_codec", "libx264")
 	v.SetDefault("ffmpeg.video_preset", "ultrafast")
 	v.SetDefault("ffmpeg.video_bitrate", "")    // empty = use CRF
@@ -141,6 +321,8 @@ func Load() (*Config, error) {
 	v.SetDefault("ffmpeg.audio_codec", "aac")
 	v.SetDefault("ffmpeg.audio_bitrate", "128k")
 	v.SetDefault("ffmpeg.audio_sample", 48000)
+	v.SetDefault("ffmpeg.passthrough", false)
+	v.SetDefault("ffmpeg.default_profile", "default")
 	v.SetDefault("preview.enabled", true)
 	v.SetDefault("preview.interval_seconds", 60)
 	v.SetDefault("preview.initial_delay_seconds", 10) // Wait before first capture for better quality
@@ -148,6 +330,24 @@ func Load() (*Config, error) {
 	v.SetDefault("preview.height", 720)
 	v.SetDefault("preview.format", "jpeg")
 	v.SetDefault("preview.quality", 80)
+	v.SetDefault("preview.sprites.enabled", true)
+	v.SetDefault("preview.sprites.interval_seconds", 10)
+	v.SetDefault("preview.sprites.width", 160)
+	v.SetDefault("preview.sprites.height", 90)
+	v.SetDefault("preview.sprites.columns", 10)
+	v.SetDefault("preview.sprites.rows", 10)
+	v.SetDefault("preview.sprites.quality", 75)
+	v.SetDefault("preview.animated.enabled", false)
+	v.SetDefault("preview.animated.format", "webp")
+	v.SetDefault("preview.animated.duration_seconds", 4)
+	v.SetDefault("preview.animated.width", 480)
+	v.SetDefault("preview.animated.height", 270)
+	v.SetDefault("preview.animated.fps", 10)
+	v.SetDefault("preview.animated.quality", 60)
+	v.SetDefault("health.enabled", true)
+	v.SetDefault("health.interval_seconds", 5)
+	v.SetDefault("reconnect.enabled", true)
+	v.SetDefault("reconnect.grace_period_seconds", 60) // Same as presence-service kafka.grace_period
 	v.SetDefault("pubsub.driver", "kafka")
 	v.SetDefault("pubsub.redis.address", "localhost:6379")
 	v.SetDefault("pubsub.kafka.brokers", "localhost:9092")
@@ -163,7 +363,21 @@ func Load() (*Config, error) {
 	v.SetDefault("storage.vod.enabled", false)
 	v.SetDefault("storage.vod.async_upload", true)
 	v.SetDefault("storage.vod.upload_workers", 4)
+	v.SetDefault("storage.vod.upload_queue.journal_dir", "./data/upload-journal")
+	v.SetDefault("storage.vod.upload_queue.high_water_mark", 200)
+	v.SetDefault("storage.vod.upload_queue.max_pending", 5000)
+	v.SetDefault("storage.vod.upload_queue.max_retries", 10)
+	v.SetDefault("storage.vod.upload_queue.max_requeues", 3)
+	v.SetDefault("storage.vod.upload_queue.retry_base_delay_ms", 1000)
+	v.SetDefault("storage.vod.upload_queue.retry_max_delay_ms", 120000)
 	v.SetDefault("storage.vod.retention_days", 30)
+	v.SetDefault("storage.vod.retention.enabled", false) // Deleting recordings is opt-in
+	v.SetDefault("storage.vod.retention.interval_minutes", 60)
+	v.SetDefault("storage.vod.retention.dry_run", false)
+	v.SetDefault("storage.vod.retention.lock.enabled", true)
+	v.SetDefault("storage.vod.retention.lock.address", "") // empty = use pubsub.redis
+	v.SetDefault("storage.vod.retention.lock.db", 1)
+	v.SetDefault("storage.vod.retention.lock.key", "vod:retention:lock")
 
 	// Session store defaults
 	v.SetDefault("storage.session.type", "memory")
@@ -174,7 +388,16 @@ func Load() (*Config, error) {
 
 	// Override from environment
 	v.BindEnv("server.port", "PORT")
+	v.BindEnv("server.instance_id", "INSTANCE_ID")
 	v.BindEnv("hls.output_dir", "HLS_OUTPUT_DIR")
+	v.BindEnv("hls.segment_type", "HLS_SEGMENT_TYPE")
+	v.BindEnv("hls.encryption.enabled", "HLS_ENCRYPTION_ENABLED")
+	v.BindEnv("hls.encryption.key_dir", "HLS_ENCRYPTION_KEY_DIR")
+	v.BindEnv("hls.audio_only.enabled", "HLS_AUDIO_ONLY_ENABLED")
+	v.BindEnv("webrtc.simulcast.enabled", "WEBRTC_SIMULCAST_ENABLED")
+	v.BindEnv("ffmpeg.passthrough", "FFMPEG_PASSTHROUGH")
+	v.BindEnv("ffmpeg.default_profile", "FFMPEG_DEFAULT_PROFILE")
+	v.BindEnv("reconnect.grace_period_seconds", "RECONNECT_GRACE_PERIOD_SECONDS")
 	v.BindEnv("webrtc.turn_key_id", "CF_TURN_ID")
 	v.BindEnv("webrtc.turn_key", "CF_TURN_KEY")
 	v.BindEnv("pubsub.redis.address", "REDIS_ADDRESS")
@@ -190,12 +413,45 @@ func Load() (*Config, error) {
 	v.BindEnv("storage.s3.secret_access_key", "S3_SECRET_ACCESS_KEY")
 	v.BindEnv("storage.s3.public_url", "S3_PUBLIC_URL")
 	v.BindEnv("storage.vod.enabled", "VOD_ENABLED")
+	v.BindEnv("storage.vod.retention_days", "VOD_RETENTION_DAYS")
+	v.BindEnv("storage.vod.retention.dry_run", "VOD_RETENTION_DRY_RUN")
+	v.BindEnv("storage.vod.retention.enabled", "VOD_RETENTION_ENABLED")
+	v.BindEnv("storage.vod.upload_queue.journal_dir", "VOD_UPLOAD_JOURNAL_DIR")
 
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, err
 	}
 
+	// DASH shares the CMAF segments produced for HLS, MPEG-TS cannot be referenced from an MPD
+	if cfg.HLS.DASHEnabled && !cfg.HLS.IsFMP4() {
+		return nil, fmt.Errorf("hls.dash_enabled requires hls.segment_type \"fmp4\" (got %q)", cfg.HLS.SegmentType)
+	}
+
+	if cfg.HLS.Encryption.Enabled {
+		switch cfg.HLS.Encryption.Method {
+		case "AES-128":
+		case "SAMPLE-AES":
+			return nil, fmt.Errorf("hls.encryption.method \"SAMPLE-AES\" is not supported by the FFmpeg HLS muxer, use \"AES-128\"")
+		default:
+			return nil, fmt.Errorf("unsupported hls.encryption.method %q", cfg.HLS.Encryption.Method)
+		}
+		// HLS allows whole-segment AES-128 with fMP4 too, but fMP4 (CMAF) segments are shared with
+		// the DASH manifest, which can only signal CENC sample encryption the FFmpeg HLS muxer can't write
+		if cfg.HLS.IsFMP4() {
+			return nil, fmt.Errorf("hls.encryption requires hls.segment_type \"mpegts\" (got %q), fMP4 segments are shared with DASH which can't play AES-128 encrypted segments", cfg.HLS.SegmentType)
+		}
+	}
+
+	// Sessions are reconciled on restart by the instance that recorded them
+	if cfg.Server.InstanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("server.instance_id not set and hostname unavailable: %w", err)
+		}
+		cfg.Server.InstanceID = hostname
+	}
+
 	// Load TURN credentials from environment if available
 	if cfg.WebRTC.TurnKeyID == "" {
 		cfg.WebRTC.TurnKeyID = os.Getenv("CF_TURN_ID")
@@ -11,10 +11,11 @@ import (
 type StreamState string
 
 const (
-	StreamStateIdle       StreamState = "idle"
-	StreamStateConnecting StreamState = "connecting"
-	StreamStateLive       StreamState = "live"
-	StreamStateStopping   StreamState = "stopping"
+	StreamStateIdle         StreamState = "idle"
+	StreamStateConnecting   StreamState = "connecting"
+	StreamStateLive         StreamState = "live"
+	StreamStateReconnecting StreamState = "reconnecting" // session kept while the broadcaster reconnects
+	StreamStateStopping     StreamState = "stopping"
 )
 
 // Stream represents an active stream for a room.
@@ -25,7 +26,10 @@ type Stream struct {
 	PeerConnection *webrtc.PeerConnection
 	VideoTrack     *webrtc.TrackRemote
 	AudioTrack     *webrtc.TrackRemote
+	LayerTracks    map[string]*webrtc.TrackRemote // simulcast layers by rid, excluding the primary video track
+	SessionID      string
 	HLSUrl         string
+	Resumed        bool // continues the session of a dropped connection
 	CreatedAt      time.Time
 	StartedAt      *time.Time
 	mu             sync.RWMutex
@@ -87,6 +91,41 @@ func (s *Stream) GetAudioTrack() *webrtc.TrackRemote {
 	return s.AudioTrack
 }
 
+// SetLayerTrack sets a simulcast layer track by rid.
+func (s *Stream) SetLayerTrack(rid string, track *webrtc.TrackRemote) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.LayerTracks == nil {
+		s.LayerTracks = make(map[string]*webrtc.TrackRemote)
+	}
+	s.LayerTracks[rid] = track
+}
+
+// GetLayerTracks returns a copy of the simulcast layer tracks by rid.
+func (s *Stream) GetLayerTracks() map[string]*webrtc.TrackRemote {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tracks := make(map[string]*webrtc.TrackRemote, len(s.LayerTracks))
+	for rid, track := range s.LayerTracks {
+		tracks[rid] = track
+	}
+	return tracks
+}
+
+// SetSessionID sets the VOD session ID the stream is recorded under.
+func (s *Stream) SetSessionID(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.SessionID = sessionID
+}
+
+// GetSessionID returns the VOD session ID, empty if the stream is not recorded.
+func (s *Stream) GetSessionID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.SessionID
+}
+
 // SetHLSUrl sets the HLS URL.
 func (s *Stream) SetHLSUrl(url string) {
 	s.mu.Lock()
@@ -101,6 +140,20 @@ func (s *Stream) GetHLSUrl() string {
 	return s.HLSUrl
 }
 
+// SetResumed marks the stream as resuming the session of a dropped connection.
+func (s *Stream) SetResumed(resumed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Resumed = resumed
+}
+
+// IsResumed returns whether the stream resumes the session of a dropped connection.
+func (s *Stream) IsResumed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.Resumed
+}
+
 // Close cleans up the stream resources.
 func (s *Stream) Close() error {
 	s.mu.Lock()
@@ -113,6 +166,7 @@ func (s *Stream) Close() error {
 
 	s.VideoTrack = nil
 	s.AudioTrack = nil
+	s.LayerTracks = nil
 	s.State = StreamStateIdle
 
 	return nil
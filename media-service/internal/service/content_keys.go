@@ -0,0 +1,273 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weiawesome/wes-io-live/media-service/internal/config"
+	"github.com/weiawesome/wes-io-live/pkg/hlskey"
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+)
+
+// keyInfoFilename is the FFmpeg key info file of a session. With periodic_rekey FFmpeg re-reads
+// it before every segment, so replacing it rotates the key.
+const keyInfoFilename = "key_info"
+
+// ContentKeys generates and rotates the AES-128 keys of encrypted HLS output.
+// Keys are stored for the key server before FFmpeg can reference them, and kept as local files
+// under the key directory for FFmpeg and preview capture until the session's output is removed.
+type ContentKeys struct {
+	cfg   config.EncryptionConfig
+	store *hlskey.Store
+}
+
+// keyRotation rotates the key of a running transcoder process.
+type keyRotation struct {
+	infoFile string
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// Stop stops rotating the key. The last key stays in use until FFmpeg exits.
+// Safe to call on a nil rotation.
+func (r *keyRotation) Stop() {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() { close(r.stop) })
+}
+
+// NewContentKeys creates a new content key generator.
+func NewContentKeys(cfg config.EncryptionConfig, store *hlskey.Store) *ContentKeys {
+	return &ContentKeys{
+		cfg:   cfg,
+		store: store,
+	}
+}
+
+// Encrypts returns true if the segments of a room are encrypted.
+func (k *ContentKeys) Encrypts(roomID string) bool {
+	return k.cfg.Encrypts(roomID)
+}
+
+// dir returns the local key directory of a room/session.
+func (k *ContentKeys) dir(roomID, sessionID string) string {
+	if sessionID != "" {
+		return filepath.Join(k.cfg.KeyDir, "room_"+roomID, sessionID)
+	}
+	return filepath.Join(k.cfg.KeyDir, "room_"+roomID)
+}
+
+// Start writes a new key for a room/session and rotates it every rotation_seconds until stopped.
+// A resumed broadcast starts with a new key, earlier segments keep theirs.
+func (k *ContentKeys) Start(roomID, sessionID string) (*keyRotation, error) {
+	dir := k.dir(roomID, sessionID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := k.rotate(roomID, sessionID); err != nil {
+		return nil, err
+	}
+
+	rotation := &keyRotation{
+		infoFile: filepath.Join(dir, keyInfoFilename),
+		stop:     make(chan struct{}),
+	}
+	if k.cfg.RotationSeconds > 0 {
+		go k.rotateLoop(roomID, sessionID, rotation)
+	}
+	return rotation, nil
+}
+
+// rotateLoop rotates the key of a room/session until the rotation is stopped.
+// A failed rotation keeps the previous key in use.
+func (k *ContentKeys) rotateLoop(roomID, sessionID string, rotation *keyRotation) {
+	ticker := time.NewTicker(time.Duration(k.cfg.RotationSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rotation.stop:
+			return
+		case <-ticker.C:
+			if err := k.rotate(roomID, sessionID); err != nil {
+				l := pkglog.L()
+				l.Warn().Err(err).Str("room_id", roomID).Str("session_id", sessionID).Msg("failed to rotate content key")
+			}
+		}
+	}
+}
+
+// rotate generates a key, stores it and points the key info file at it.
+func (k *ContentKeys) rotate(roomID, sessionID string) error {
+	key, err := hlskey.Generate()
+	if err != nil {
+		keyRotations.WithLabelValues("error").Inc()
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := k.store.Put(ctx, roomID, sessionID, key); err != nil {
+		keyRotations.WithLabelValues("error").Inc()
+		return err
+	}
+
+	dir := k.dir(roomID, sessionID)
+	keyPath, err := filepath.Abs(filepath.Join(dir, key.ID+".key"))
+	if err != nil {
+		keyRotations.WithLabelValues("error").Inc()
+		return fmt.Errorf("failed to resolve key path: %w", err)
+	}
+	if err := os.WriteFile(keyPath, key.Bytes, 0600); err != nil {
+		keyRotations.WithLabelValues("error").Inc()
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	// Key info file: key URI written to the playlist, key file read by FFmpeg, IV
+	info := fmt.Sprintf("%s\n%s\n%s\n", hlskey.URI(k.cfg.KeyURI, roomID, sessionID, key.ID), keyPath, hex.EncodeToString(key.IV))
+
+	// Replaced atomically, FFmpeg may read it at any segment boundary
+	tmpPath := filepath.Join(dir, keyInfoFilename+".tmp")
+	if err := os.WriteFile(tmpPath, []byte(info), 0600); err != nil {
+		keyRotations.WithLabelValues("error").Inc()
+		return fmt.Errorf("failed to write key info file: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(dir, keyInfoFilename)); err != nil {
+		keyRotations.WithLabelValues("error").Inc()
+		return fmt.Errorf("failed to replace key info file: %w", err)
+	}
+
+	keyRotations.WithLabelValues("success").Inc()
+	l := pkglog.L()
+	l.Debug().Str("room_id", roomID).Str("session_id", sessionID).Str("key_id", key.ID).Msg("content key rotated")
+	return nil
+}
+
+// Key returns a key of a room/session from its local key file.
+func (k *ContentKeys) Key(roomID, sessionID, keyID string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(k.dir(roomID, sessionID), filepath.Base(keyID)+".key"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content key: %w", err)
+	}
+	if len(data) != hlskey.Size {
+		return nil, fmt.Errorf("invalid content key %s", keyID)
+	}
+	return data, nil
+}
+
+// Cleanup removes the local key files of a room/session (all sessions if sessionID is empty).
+// The key server keeps serving the stored keys.
+func (k *ContentKeys) Cleanup(roomID, sessionID string) error {
+	return os.RemoveAll(k.dir(roomID, sessionID))
+}
+
+// parseKeyTag returns the attributes of an #EXT-X-KEY tag, empty for METHOD=NONE.
+func parseKeyTag(line string) string {
+	attrs := strings.TrimPrefix(line, "#EXT-X-KEY:")
+	if strings.Contains(attrs, "METHOD=NONE") {
+		return ""
+	}
+	return attrs
+}
+
+// keyTagAttr returns an attribute of an EXT-X-KEY attribute list, without quotes.
+func keyTagAttr(attrs, name string) string {
+	idx := strings.Index(attrs, name+"=")
+	if idx < 0 {
+		return ""
+	}
+	value := attrs[idx+len(name)+1:]
+	if strings.HasPrefix(value, `"`) {
+		value = value[1:]
+		if end := strings.Index(value, `"`); end >= 0 {
+			return value[:end]
+		}
+		return value
+	}
+	if end := strings.Index(value, ","); end >= 0 {
+		return value[:end]
+	}
+	return value
+}
+
+// segmentFile is a local segment file and the EXT-X-KEY attributes it is encrypted with, empty if clear.
+type segmentFile struct {
+	path string
+	key  string
+}
+
+// ffmpegSegmentInput returns an FFmpeg input reading segment files in order. Clear segments are
+// read directly (joined by the concat protocol), encrypted ones are decrypted with the session's
+// local keys and fed through stdin, returned as the second value.
+func ffmpegSegmentInput(keys *ContentKeys, roomID, sessionID string, files []segmentFile) (string, io.Reader, error) {
+	encrypted := false
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.path
+		encrypted = encrypted || file.key != ""
+	}
+	if !encrypted {
+		if len(paths) == 1 {
+			return paths[0], nil, nil
+		}
+		return "concat:" + strings.Join(paths, "|"), nil, nil
+	}
+	if keys == nil {
+		return "", nil, fmt.Errorf("segments are encrypted but no content keys are configured")
+	}
+
+	var buf bytes.Buffer
+	for _, file := range files {
+		data, err := os.ReadFile(file.path)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read segment: %w", err)
+		}
+		if file.key != "" {
+			keyID := strings.TrimSuffix(filepath.Base(keyTagAttr(file.key, "URI")), ".key")
+			key, err := keys.Key(roomID, sessionID, keyID)
+			if err != nil {
+				return "", nil, err
+			}
+			iv, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(keyTagAttr(file.key, "IV"), "0x"), "0X"))
+			if err != nil || len(iv) != aes.BlockSize {
+				return "", nil, fmt.Errorf("segment %s has no valid IV", filepath.Base(file.path))
+			}
+			if data, err = decryptSegment(data, key, iv); err != nil {
+				return "", nil, fmt.Errorf("failed to decrypt %s: %w", filepath.Base(file.path), err)
+			}
+		}
+		buf.Write(data)
+	}
+	return "pipe:0", &buf, nil
+}
+
+// decryptSegment decrypts an AES-128 encrypted HLS segment (CBC with PKCS#7 padding).
+func decryptSegment(data, key, iv []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("ciphertext is not a multiple of the block size")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return plain[:len(plain)-padding], nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// dashTimescale is the timescale (units per second) used for segment timing in the MPD.
+const dashTimescale = 1000
+
+// mpd is the root element of a DASH Media Presentation Description.
+type mpd struct {
+	XMLName                   xml.Name `xml:"MPD"`
+	Xmlns                     string   `xml:"xmlns,attr"`
+	Profiles                  string   `xml:"profiles,attr"`
+	Type                      string   `xml:"type,attr"`
+	MinBufferTime             string   `xml:"minBufferTime,attr"`
+	MediaPresentationDuration string   `xml:"mediaPresentationDuration,attr,omitempty"`
+	AvailabilityStartTime     string   `xml:"availabilityStartTime,attr,omitempty"`
+	PublishTime               string   `xml:"publishTime,attr,omitempty"`
+	MinimumUpdatePeriod       string   `xml:"minimumUpdatePeriod,attr,omitempty"`
+	Periods                   []mpdPeriod
+}
+
+type mpdPeriod struct {
+	XMLName       xml.Name `xml:"Period"`
+	ID            string   `xml:"id,attr"`
+	Start         string   `xml:"start,attr"`
+	AdaptationSet mpdAdaptationSet
+}
+
+type mpdAdaptationSet struct {
+	XMLName          xml.Name `xml:"AdaptationSet"`
+	ID               int      `xml:"id,attr"`
+	MimeType         string   `xml:"mimeType,attr"`
+	SegmentAlignment bool     `xml:"segmentAlignment,attr"`
+	Representation   mpdRepresentation
+}
+
+type mpdRepresentation struct {
+	XMLName     xml.Name `xml:"Representation"`
+	ID          string   `xml:"id,attr"`
+	Codecs      string   `xml:"codecs,attr,omitempty"`
+	Bandwidth   int64    `xml:"bandwidth,attr"`
+	SegmentList mpdSegmentList
+}
+
+// mpdSegmentList lists segments explicitly so that gaps from failed uploads
+// don't shift the numbering of the segments that follow.
+type mpdSegmentList struct {
+	XMLName         xml.Name `xml:"SegmentList"`
+	Timescale       int      `xml:"timescale,attr"`
+	Initialization  mpdURL   `xml:"Initialization"`
+	SegmentTimeline mpdSegmentTimeline
+	SegmentURLs     []mpdSegmentURL `xml:"SegmentURL"`
+}
+
+type mpdURL struct {
+	SourceURL string `xml:"sourceURL,attr"`
+}
+
+type mpdSegmentTimeline struct {
+	XMLName xml.Name `xml:"SegmentTimeline"`
+	S       []mpdS   `xml:"S"`
+}
+
+type mpdS struct {
+	T int64 `xml:"t,attr"`
+	D int64 `xml:"d,attr"`
+}
+
+type mpdSegmentURL struct {
+	Media string `xml:"media,attr"`
+}
+
+// GenerateMPD generates a DASH manifest for the uploaded fMP4 segments.
+// If finalized is true, a static (VOD) manifest is produced; otherwise a dynamic (live) one.
+// The codecs parameter is the RFC 6381 codecs string of the muxed stream (e.g. "avc1.42C01E,mp4a.40.2").
+// Returns an error if the init segment has not been uploaded yet.
+func (b *VODPlaylistBuilder) GenerateMPD(finalized bool, codecs string) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.initSegment == "" {
+		return nil, fmt.Errorf("init segment not uploaded for room %s", b.roomID)
+	}
+
+	// Every connection's init segment starts a period. Segment start times follow the full
+	// recording timeline, including segments that are not uploaded (yet), so that presentation
+	// time stays wall-clock aligned.
+	manifest := mpd{
+		Xmlns:         "urn:mpeg:dash:schema:mpd:2011",
+		Profiles:      "urn:mpeg:dash:profile:isoff-live:2011",
+		MinBufferTime: formatISODuration(float64(2 * b.targetDuration)),
+	}
+	var period *mpdPeriod
+	var elapsed, periodStart int64
+	for _, seg := range b.segments {
+		duration := int64(seg.Duration * dashTimescale)
+		if init := b.segmentInit(seg); period == nil || init != period.AdaptationSet.Representation.SegmentList.Initialization.SourceURL {
+			manifest.Periods = append(manifest.Periods, b.newPeriod(len(manifest.Periods), init, elapsed, codecs))
+			period = &manifest.Periods[len(manifest.Periods)-1]
+			periodStart = elapsed
+		}
+		if seg.Uploaded && !b.awaitingInit(seg) {
+			list := &period.AdaptationSet.Representation.SegmentList
+			list.SegmentTimeline.S = append(list.SegmentTimeline.S, mpdS{T: elapsed - periodStart, D: duration})
+			list.SegmentURLs = append(list.SegmentURLs, mpdSegmentURL{Media: seg.Filename})
+		}
+		elapsed += duration
+	}
+
+	if finalized {
+		manifest.Type = "static"
+		manifest.MediaPresentationDuration = formatISODuration(float64(elapsed) / dashTimescale)
+	} else {
+		manifest.Type = "dynamic"
+		manifest.AvailabilityStartTime = b.startTime.UTC().Format(time.RFC3339)
+		manifest.PublishTime = time.Now().UTC().Format(time.RFC3339)
+		manifest.MinimumUpdatePeriod = formatISODuration(float64(b.targetDuration))
+	}
+
+	data, err := xml.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal MPD: %w", err)
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
+
+// newPeriod creates the period of the segments sharing an init segment, starting at start (in dashTimescale units).
+func (b *VODPlaylistBuilder) newPeriod(index int, init string, start int64, codecs string) mpdPeriod {
+	return mpdPeriod{
+		ID:    strconv.Itoa(index),
+		Start: formatISODuration(float64(start) / dashTimescale),
+		AdaptationSet: mpdAdaptationSet{
+			ID:               0,
+			MimeType:         "video/mp4",
+			SegmentAlignment: true,
+			Representation: mpdRepresentation{
+				ID:        "0",
+				Codecs:    codecs,
+				Bandwidth: b.peakBandwidthLocked(),
+				SegmentList: mpdSegmentList{
+					Timescale:      dashTimescale,
+					Initialization: mpdURL{SourceURL: init},
+				},
+			},
+		},
+	}
+}
+
+// formatISODuration formats seconds as an ISO 8601 duration (e.g. "PT12.345S").
+func formatISODuration(seconds float64) string {
+	return fmt.Sprintf("PT%.3fS", seconds)
+}
@@ -0,0 +1,417 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/weiawesome/wes-io-live/media-service/internal/config"
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+)
+
+// Encoder produces the FFmpeg video encoding arguments for a named profile.
+type Encoder interface {
+	// Name returns the profile name from config.
+	Name() string
+	// FFmpegEncoder returns the FFmpeg encoder name (e.g. "libx264").
+	FFmpegEncoder() string
+	// VideoArgs returns the FFmpeg video encoding arguments.
+	VideoArgs() []string
+	// CodecString returns the RFC 6381 codecs string of the encoded video.
+	CodecString() string
+	// RequiresFMP4 returns true if the codec can only be carried in fMP4 (CMAF) HLS segments.
+	RequiresFMP4() bool
+}
+
+// Encoder profile types.
+const (
+	EncoderTypeX264   = "x264"
+	EncoderTypeX265   = "x265"
+	EncoderTypeSVTAV1 = "svtav1"
+	EncoderTypeVP9    = "vp9"
+)
+
+// defaultProfileName is the profile synthesized from the top-level ffmpeg video settings
+// when no profiles are configured.
+const defaultProfileName = "default"
+
+// NewEncoder creates an Encoder for a named profile.
+func NewEncoder(name string, cfg config.EncoderProfileConfig) (Encoder, error) {
+	base := baseEncoder{name: name, cfg: cfg}
+
+	switch cfg.Type {
+	case EncoderTypeX264, "":
+		base.defaultEncoder = "libx264"
+		return &x264Encoder{base}, nil
+	case EncoderTypeX265:
+		base.defaultEncoder = "libx265"
+		return &x265Encoder{base}, nil
+	case EncoderTypeSVTAV1:
+		base.defaultEncoder = "libsvtav1"
+		return &svtAV1Encoder{base}, nil
+	case EncoderTypeVP9:
+		base.defaultEncoder = "libvpx-vp9"
+		return &vp9Encoder{base}, nil
+	default:
+		return nil, fmt.Errorf("encoder profile %s: unknown type %q", name, cfg.Type)
+	}
+}
+
+// baseEncoder holds the options shared by all encoder types.
+type baseEncoder struct {
+	name           string
+	cfg            config.EncoderProfileConfig
+	defaultEncoder string
+}
+
+func (e *baseEncoder) Name() string {
+	return e.name
+}
+
+func (e *baseEncoder) FFmpegEncoder() string {
+	if e.cfg.Encoder != "" {
+		return e.cfg.Encoder
+	}
+	return e.defaultEncoder
+}
+
+func (e *baseEncoder) RequiresFMP4() bool {
+	return false
+}
+
+// rateControlArgs returns bitrate or CRF arguments.
+func (e *baseEncoder) rateControlArgs() []string {
+	if e.cfg.Bitrate != "" {
+		return []string{"-b:v", e.cfg.Bitrate}
+	} else if e.cfg.CRF > 0 {
+		return []string{"-crf", fmt.Sprintf("%d", e.cfg.CRF)}
+	}
+	return nil
+}
+
+// outputArgs returns scaling, framerate and GOP arguments.
+func (e *baseEncoder) outputArgs() []string {
+	var args []string
+
+	// Resolution scaling
+	if e.cfg.Width > 0 && e.cfg.Height > 0 {
+		// Scale to exact resolution
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:%d", e.cfg.Width, e.cfg.Height))
+	} else if e.cfg.Width > 0 {
+		// Scale width, keep aspect ratio
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:-2", e.cfg.Width))
+	} else if e.cfg.Height > 0 {
+		// Scale height, keep aspect ratio
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:%d", e.cfg.Height))
+	}
+
+	// Framerate
+	if e.cfg.Framerate > 0 {
+		args = append(args, "-r", fmt.Sprintf("%d", e.cfg.Framerate))
+	}
+
+	// GOP size (keyframe interval) - explicit, framerate or default to 30
+	gop := 30
+	if e.cfg.GOP > 0 {
+		gop = e.cfg.GOP
+	} else if e.cfg.Framerate > 0 {
+		gop = e.cfg.Framerate
+	}
+	args = append(args, "-g", fmt.Sprintf("%d", gop))
+
+	return args
+}
+
+// level returns the configured level as a number times ten (e.g. "3.1" -> 31), or def if unset.
+func (e *baseEncoder) level(def int) int {
+	if f, err := strconv.ParseFloat(e.cfg.Level, 64); err == nil && f > 0 {
+		return int(f*10 + 0.5)
+	}
+	return def
+}
+
+// x264Encoder encodes H.264 with libx264.
+type x264Encoder struct{ baseEncoder }
+
+func (e *x264Encoder) VideoArgs() []string {
+	args := []string{"-c:v", e.FFmpegEncoder()}
+	if e.cfg.Preset != "" {
+		args = append(args, "-preset", e.cfg.Preset)
+	}
+	if e.cfg.Tune != "" {
+		args = append(args, "-tune", e.cfg.Tune)
+	}
+	if e.cfg.Profile != "" {
+		args = append(args, "-profile:v", e.cfg.Profile)
+	}
+	if e.cfg.Level != "" {
+		args = append(args, "-level", e.cfg.Level)
+	}
+	args = append(args, "-pix_fmt", "yuv420p")
+	args = append(args, e.rateControlArgs()...)
+	return append(args, e.outputArgs()...)
+}
+
+func (e *x264Encoder) CodecString() string {
+	// profile_idc + constraint flags
+	profile := "42C0" // constrained baseline
+	switch e.cfg.Profile {
+	case "main":
+		profile = "4D40"
+	case "high":
+		profile = "6400"
+	}
+	return fmt.Sprintf("avc1.%s%02X", profile, e.level(31))
+}
+
+// x265Encoder encodes HEVC with libx265.
+type x265Encoder struct{ baseEncoder }
+
+func (e *x265Encoder) VideoArgs() []string {
+	args := []string{"-c:v", e.FFmpegEncoder(), "-tag:v", "hvc1"} // hvc1 sample entry required by Apple players
+	if e.cfg.Preset != "" {
+		args = append(args, "-preset", e.cfg.Preset)
+	}
+	if e.cfg.Tune != "" {
+		args = append(args, "-tune", e.cfg.Tune)
+	}
+	args = append(args, "-profile:v", "main", "-pix_fmt", "yuv420p")
+	if e.cfg.Level != "" {
+		args = append(args, "-x265-params", "level-idc="+e.cfg.Level)
+	}
+	args = append(args, e.rateControlArgs()...)
+	return append(args, e.outputArgs()...)
+}
+
+func (e *x265Encoder) CodecString() string {
+	// Main profile, main tier; HEVC level_idc is the level times 30
+	return fmt.Sprintf("hvc1.1.6.L%d.B0", e.level(31)*3)
+}
+
+func (e *x265Encoder) RequiresFMP4() bool {
+	return true
+}
+
+// svtAV1Encoder encodes AV1 with SVT-AV1.
+type svtAV1Encoder struct{ baseEncoder }
+
+func (e *svtAV1Encoder) VideoArgs() []string {
+	args := []string{"-c:v", e.FFmpegEncoder(), "-pix_fmt", "yuv420p"}
+	if e.cfg.Preset != "" {
+		// SVT-AV1 presets are numeric (0-13), higher is faster
+		args = append(args, "-preset", e.cfg.Preset)
+	}
+	args = append(args, e.rateControlArgs()...)
+	return append(args, e.outputArgs()...)
+}
+
+func (e *svtAV1Encoder) CodecString() string {
+	// Main profile, 8-bit; seq_level_idx 8 is level 4.0
+	seqLevel := 8
+	if l := e.level(40); l >= 20 {
+		seqLevel = (l/10-2)*4 + l%10
+	}
+	return fmt.Sprintf("av01.0.%02dM.08", seqLevel)
+}
+
+func (e *svtAV1Encoder) RequiresFMP4() bool {
+	return true
+}
+
+// vp9Encoder encodes VP9 with libvpx.
+type vp9Encoder struct{ baseEncoder }
+
+func (e *vp9Encoder) VideoArgs() []string {
+	args := []string{"-c:v", e.FFmpegEncoder(), "-pix_fmt", "yuv420p", "-row-mt", "1"}
+	if e.cfg.Preset != "" {
+		// libvpx speed via -deadline (realtime, good, best)
+		args = append(args, "-deadline", e.cfg.Preset)
+	}
+	if e.cfg.Bitrate == "" && e.cfg.CRF > 0 {
+		// Constant quality mode requires an explicit zero bitrate
+		args = append(args, "-b:v", "0")
+	}
+	args = append(args, e.rateControlArgs()...)
+	return append(args, e.outputArgs()...)
+}
+
+func (e *vp9Encoder) CodecString() string {
+	// Profile 0, 8-bit
+	return fmt.Sprintf("vp09.00.%02d.08", e.level(31))
+}
+
+func (e *vp9Encoder) RequiresFMP4() bool {
+	return true
+}
+
+// EncoderRegistry holds the configured encoder profiles and selects one per room.
+type EncoderRegistry struct {
+	profiles       map[string]Encoder
+	defaultProfile string
+	roomProfiles   map[string]string
+}
+
+// NewEncoderRegistry creates the encoder profiles from config.
+// If no profiles are configured, a "default" x264 profile is built from the top-level video settings.
+// Codecs that need fMP4 segments are rejected when hls.segment_type is MPEG-TS.
+func NewEncoderRegistry(ffmpegCfg config.FFmpegConfig, hlsCfg config.HLSConfig) (*EncoderRegistry, error) {
+	profiles := ffmpegCfg.Profiles
+	defaultProfile := ffmpegCfg.DefaultProfile
+	if len(profiles) == 0 {
+		profiles = map[string]config.EncoderProfileConfig{
+			defaultProfileName: legacyProfile(ffmpegCfg),
+		}
+		defaultProfile = defaultProfileName
+	}
+
+	r := &EncoderRegistry{
+		profiles:       make(map[string]Encoder, len(profiles)),
+		defaultProfile: defaultProfile,
+		roomProfiles:   ffmpegCfg.RoomProfiles,
+	}
+
+	for name, profileCfg := range profiles {
+		encoder, err := NewEncoder(name, profileCfg)
+		if err != nil {
+			return nil, err
+		}
+		if encoder.RequiresFMP4() && !hlsCfg.IsFMP4() {
+			return nil, fmt.Errorf("encoder profile %s (%s) requires hls.segment_type \"fmp4\"", name, profileCfg.Type)
+		}
+		r.profiles[name] = encoder
+	}
+
+	if _, exists := r.profiles[r.defaultProfile]; !exists {
+		return nil, fmt.Errorf("ffmpeg.default_profile %q is not a configured profile", r.defaultProfile)
+	}
+	for roomID, name := range r.roomProfiles {
+		if _, exists := r.profiles[name]; !exists {
+			return nil, fmt.Errorf("ffmpeg.room_profiles: room %s uses unknown profile %q", roomID, name)
+		}
+	}
+
+	return r, nil
+}
+
+// legacyProfile builds an x264 profile from the top-level ffmpeg video settings.
+func legacyProfile(cfg config.FFmpegConfig) config.EncoderProfileConfig {
+	return config.EncoderProfileConfig{
+		Type:      EncoderTypeX264,
+		Encoder:   cfg.VideoCodec,
+		Preset:    cfg.VideoPreset,
+		Tune:      "zerolatency",
+		Profile:   "baseline",
+		Level:     "3.0",
+		Bitrate:   cfg.VideoBitrate,
+		CRF:       cfg.VideoCRF,
+		Width:     cfg.Width,
+		Height:    cfg.Height,
+		Framerate: cfg.Framerate,
+	}
+}
+
+// Validate checks that FFmpeg provides the encoder of every profile by probing `ffmpeg -encoders`,
+// then encodes a test frame with each profile's arguments, so an invalid preset, profile or level
+// fails at startup instead of when a stream starts.
+func (r *EncoderRegistry) Validate(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	available, err := probeFFmpegEncoders(ctx)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for name, encoder := range r.profiles {
+		if !available[encoder.FFmpegEncoder()] {
+			missing = append(missing, fmt.Sprintf("%s (%s)", name, encoder.FFmpegEncoder()))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("ffmpeg does not provide encoders for profiles: %s", strings.Join(missing, ", "))
+	}
+
+	names := make([]string, 0, len(r.profiles))
+	for name := range r.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := probeEncoderOptions(ctx, r.profiles[name]); err != nil {
+			return fmt.Errorf("encoder profile %s: %w", name, err)
+		}
+	}
+
+	l := pkglog.L()
+	l.Info().Int("profiles", len(r.profiles)).Str("default", r.defaultProfile).Msg("encoder profiles validated")
+	return nil
+}
+
+// probeEncoderOptions encodes a single generated frame with the video arguments of a profile.
+// FFmpeg rejects unknown presets, profiles and levels when the encoder is opened.
+func probeEncoderOptions(ctx context.Context, encoder Encoder) error {
+	args := []string{
+		"-hide_banner", "-loglevel", "error",
+		"-f", "lavfi", "-i", "color=c=black:s=640x360:r=30",
+		"-frames:v", "1",
+	}
+	args = append(args, encoder.VideoArgs()...)
+	args = append(args, "-f", "null", "-")
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("ffmpeg rejected the encoder options: %s", msg)
+		}
+		return fmt.Errorf("failed to probe encoder options: %w", err)
+	}
+	return nil
+}
+
+// probeFFmpegEncoders returns the names of the encoders FFmpeg was built with.
+func probeFFmpegEncoders(ctx context.Context) (map[string]bool, error) {
+	out, err := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe ffmpeg encoders: %w", err)
+	}
+
+	// Lines look like " V....D libx264    libx264 H.264 / AVC ...", after a " ------" separator
+	encoders := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	listing := false
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		if !listing {
+			listing = strings.HasPrefix(fields[0], "---")
+			continue
+		}
+		encoders[fields[1]] = true
+	}
+	return encoders, nil
+}
+
+// ForRoom returns the encoder configured for a room, or the default profile.
+func (r *EncoderRegistry) ForRoom(roomID string) Encoder {
+	if name, exists := r.roomProfiles[roomID]; exists {
+		return r.profiles[name]
+	}
+	return r.profiles[r.defaultProfile]
+}
+
+// Default returns the default encoder profile.
+func (r *EncoderRegistry) Default() Encoder {
+	return r.profiles[r.defaultProfile]
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ffmpegProgress holds the latest values FFmpeg reported with -progress.
+// It is used as the process's stdout and parses the key=value lines as they arrive.
+type ffmpegProgress struct {
+	fps     float64
+	speed   float64
+	updated time.Time
+	partial []byte // Incomplete trailing line of the last write
+	mu      sync.RWMutex
+}
+
+// Write implements io.Writer.
+func (p *ffmpegProgress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	data := append(p.partial, b...)
+	for {
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			break
+		}
+		p.parseLine(string(data[:idx]))
+		data = data[idx+1:]
+	}
+	p.partial = append(p.partial[:0], data...)
+
+	return len(b), nil
+}
+
+// parseLine applies a single key=value line. Caller must hold p.mu.
+func (p *ffmpegProgress) parseLine(line string) {
+	key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+	if !ok {
+		return
+	}
+
+	switch key {
+	case "fps":
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			p.fps = f
+		}
+	case "speed":
+		// e.g. "1.01x", "N/A" before the first frame
+		if f, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "x"), 64); err == nil {
+			p.speed = f
+		}
+	case "progress":
+		p.updated = time.Now()
+	}
+}
+
+// get returns the latest output frame rate and speed, ok is false before the first report.
+func (p *ffmpegProgress) get() (fps, speed float64, ok bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.fps, p.speed, !p.updated.IsZero()
+}
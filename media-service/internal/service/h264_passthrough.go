@@ -0,0 +1,128 @@
+package service
+
+import (
+	"io"
+	"strings"
+
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+)
+
+// H.264 NAL unit types (RFC 6184) relevant for keyframe detection.
+const (
+	h264NALUIDR   = 5
+	h264NALUSPS   = 7
+	h264NALUSTAPA = 24
+	h264NALUFUA   = 28
+)
+
+// isH264Keyframe returns true if the RTP payload starts an IDR picture or carries an SPS.
+func isH264Keyframe(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+
+	switch naluType := payload[0] & 0x1F; naluType {
+	case h264NALUIDR, h264NALUSPS:
+		return true
+	case h264NALUSTAPA:
+		// Aggregation packet: 16-bit size followed by each NAL unit
+		for offset := 1; offset+2 < len(payload); {
+			size := int(payload[offset])<<8 | int(payload[offset+1])
+			offset += 2
+			if offset >= len(payload) {
+				break
+			}
+			if t := payload[offset] & 0x1F; t == h264NALUIDR || t == h264NALUSPS {
+				return true
+			}
+			offset += size
+		}
+	case h264NALUFUA:
+		// Fragmentation unit: only the start fragment of an IDR counts
+		if len(payload) < 2 {
+			return false
+		}
+		return payload[1]&0x80 != 0 && payload[1]&0x1F == h264NALUIDR
+	}
+	return false
+}
+
+// h264CodecString builds the RFC 6381 codecs string from an H.264 fmtp line's profile-level-id.
+func h264CodecString(fmtp string) string {
+	if profileLevelID := h264ProfileLevelID(fmtp); len(profileLevelID) == 6 {
+		return "avc1." + strings.ToUpper(profileLevelID)
+	}
+	// Constrained baseline, level 3.1
+	return "avc1.42E01F"
+}
+
+// hlsCompatibleH264Profiles lists the profile_idc values (first byte of profile-level-id)
+// that HLS players decode: baseline/constrained baseline, main and high.
+var hlsCompatibleH264Profiles = map[string]bool{
+	"42": true,
+	"4d": true,
+	"64": true,
+}
+
+// isHLSCompatibleH264 returns true if the negotiated codec is H.264 with a profile that can be
+// remuxed into HLS segments without re-encoding.
+func isHLSCompatibleH264(codec webrtc.RTPCodecParameters) bool {
+	if codec.MimeType != webrtc.MimeTypeH264 {
+		return false
+	}
+	profileLevelID := h264ProfileLevelID(codec.SDPFmtpLine)
+	return len(profileLevelID) == 6 && hlsCompatibleH264Profiles[strings.ToLower(profileLevelID[:2])]
+}
+
+// h264ProfileLevelID returns the profile-level-id parameter of an H.264 fmtp line.
+func h264ProfileLevelID(fmtp string) string {
+	for _, param := range strings.Split(fmtp, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && key == "profile-level-id" {
+			return value
+		}
+	}
+	return ""
+}
+
+// writeH264Passthrough writes an H.264 track as an Annex B elementary stream for remuxing with
+// -c:v copy. Output starts at the first keyframe so the first segment is decodable, and the
+// HLS muxer cuts segments on the keyframes the broadcaster sends.
+func (t *Transcoder) writeH264Passthrough(roomID string, track *webrtc.TrackRemote, w io.Writer) {
+	l := pkglog.L()
+	depacketizer := &codecs.H264Packet{}
+	startCode := []byte{0x00, 0x00, 0x00, 0x01}
+	waitingForKeyframe := true
+
+	for {
+		rtpPacket, _, err := track.ReadRTP()
+		if err != nil {
+			l.Error().Err(err).Str("room_id", roomID).Str("rid", track.RID()).Msg("rtp read error")
+			return
+		}
+
+		if waitingForKeyframe {
+			if !isH264Keyframe(rtpPacket.Payload) {
+				continue
+			}
+			waitingForKeyframe = false
+			l.Info().Str("room_id", roomID).Str("rid", track.RID()).Msg("h264 keyframe received, passthrough started")
+		}
+
+		payload, err := depacketizer.Unmarshal(rtpPacket.Payload)
+		if err != nil || len(payload) == 0 {
+			continue
+		}
+
+		if _, err := w.Write(startCode); err != nil {
+			l.Error().Err(err).Str("room_id", roomID).Msg("h264 write error")
+			return
+		}
+		if _, err := w.Write(payload); err != nil {
+			l.Error().Err(err).Str("room_id", roomID).Msg("h264 write error")
+			return
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// masterStream is a single variant stream listed in an HLS master playlist.
+type masterStream struct {
+	URI       string // media playlist URI, relative to the master playlist
+	Bandwidth int64  // peak bitrate in bits per second
+	Codecs    string // RFC 6381 codecs string
+}
+
+// generateMasterPlaylist generates an HLS master playlist for the given variant streams.
+// Streams without a known bandwidth are skipped since BANDWIDTH is a required attribute.
+func generateMasterPlaylist(streams []masterStream) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	buf.WriteString("#EXT-X-VERSION:3\n")
+
+	for _, stream := range streams {
+		if stream.Bandwidth <= 0 {
+			continue
+		}
+		attrs := fmt.Sprintf("BANDWIDTH=%d", stream.Bandwidth)
+		if stream.Codecs != "" {
+			attrs += fmt.Sprintf(",CODECS=\"%s\"", stream.Codecs)
+		}
+		buf.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:%s\n", attrs))
+		buf.WriteString(stream.URI + "\n")
+	}
+
+	return buf.Bytes()
+}
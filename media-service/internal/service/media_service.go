@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/pion/webrtc/v4"
+	"github.com/weiawesome/wes-io-live/media-service/internal/config"
 	"github.com/weiawesome/wes-io-live/media-service/internal/domain"
 	peerManager "github.com/weiawesome/wes-io-live/media-service/internal/webrtc"
 	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
@@ -20,9 +22,13 @@ type mediaService struct {
 	pubsub            pubsub.PubSub
 	vodManager        *VODManager
 	thumbnailService  *ThumbnailService
+	healthMonitor     *StreamHealthMonitor
+	simulcast         config.SimulcastConfig
+	reconnectGrace    time.Duration // 0 = dropped connections end the stream
 
-	streams map[string]*domain.Stream
-	mu      sync.RWMutex
+	streams         map[string]*domain.Stream
+	reconnectTimers map[string]*time.Timer // roomID -> grace period of a dropped connection
+	mu              sync.RWMutex
 
 	cancel context.CancelFunc
 }
@@ -34,14 +40,26 @@ func NewMediaService(
 	ps pubsub.PubSub,
 	vodManager *VODManager,
 	thumbnailService *ThumbnailService,
+	healthMonitor *StreamHealthMonitor,
+	simulcast config.SimulcastConfig,
+	reconnect config.ReconnectConfig,
 ) MediaService {
+	var reconnectGrace time.Duration
+	if reconnect.Enabled {
+		reconnectGrace = time.Duration(reconnect.GracePeriodSeconds) * time.Second
+	}
+
 	return &mediaService{
 		peerManager:      pm,
 		transcoder:       transcoder,
 		pubsub:           ps,
 		vodManager:       vodManager,
 		thumbnailService: thumbnailService,
+		healthMonitor:    healthMonitor,
+		simulcast:        simulcast,
+		reconnectGrace:   reconnectGrace,
 		streams:          make(map[string]*domain.Stream),
+		reconnectTimers:  make(map[string]*time.Timer),
 	}
 }
 
@@ -60,33 +78,52 @@ func (s *mediaService) HandleStartBroadcast(ctx context.Context, roomID, userID,
 
 	s.mu.Lock()
 
+	// Create new stream
+	stream := domain.NewStream(roomID, userID)
+
 	// Check if stream already exists
 	if existing, exists := s.streams[roomID]; exists {
-		s.mu.Unlock()
-		if existing.GetState() == domain.StreamStateLive {
+		state := existing.GetState()
+		if state == domain.StreamStateLive {
+			s.mu.Unlock()
 			return fmt.Errorf("stream already active for room %s", roomID)
 		}
-		// Clean up existing stream
-		s.cleanupStream(roomID)
+		if state == domain.StreamStateReconnecting && existing.UserID == userID {
+			// Resume the dropped session: same HLS output and VOD recording
+			s.stopReconnectTimerLocked(roomID)
+			stream.SetSessionID(existing.GetSessionID())
+			stream.SetHLSUrl(existing.GetHLSUrl())
+			stream.SetResumed(true)
+		} else {
+			// Clean up existing stream
+			s.cleanupStreamLocked(roomID)
+		}
 	}
 
-	// Create new stream
-	stream := domain.NewStream(roomID, userID)
 	stream.SetState(domain.StreamStateConnecting)
 	s.streams[roomID] = stream
 	s.mu.Unlock()
 
+	// Observe inbound RTP for stream health telemetry
+	var onRTP peerManager.RTPObserver
+	if s.healthMonitor != nil {
+		s.healthMonitor.Register(roomID)
+		onRTP = s.healthMonitor.RTPObserver(roomID)
+	}
+
 	// Create peer connection with handlers
+	var pc *webrtc.PeerConnection
 	pc, err := s.peerManager.CreatePeerConnection(
 		func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
 			s.handleTrack(roomID, track)
 		},
 		func(state webrtc.PeerConnectionState) {
-			s.handleConnectionState(roomID, state)
+			s.handleConnectionState(roomID, pc, state)
 		},
 		func(candidate *webrtc.ICECandidate) {
 			s.handleICECandidate(roomID, candidate)
 		},
+		onRTP,
 	)
 	if err != nil {
 		s.cleanupStream(roomID)
@@ -94,6 +131,9 @@ func (s *mediaService) HandleStartBroadcast(ctx context.Context, roomID, userID,
 	}
 
 	stream.PeerConnection = pc
+	if s.healthMonitor != nil {
+		s.healthMonitor.SetPeerConnection(roomID, pc)
+	}
 
 	// Handle the offer and create answer
 	answerSDP, err := s.peerManager.HandleOffer(pc, offer.SDP)
@@ -164,17 +204,97 @@ func (s *mediaService) HandleICECandidate(ctx context.Context, roomID, candidate
 func (s *mediaService) HandleStopBroadcast(ctx context.Context, roomID, reason string) error {
 	l := pkglog.L()
 	l.Info().Str("room_id", roomID).Str("reason", reason).Msg("stopping broadcast")
+
+	// A dropped connection keeps the session for the grace period so the broadcaster can resume it
+	if isConnectionLoss(reason) && s.suspendStream(roomID) {
+		return nil
+	}
+
 	s.cleanupStream(roomID)
+	s.publishStreamEnded(ctx, roomID)
+
+	return nil
+}
 
-	// Notify Signal Service
+// publishStreamEnded notifies Signal Service that a room's stream has ended.
+func (s *mediaService) publishStreamEnded(ctx context.Context, roomID string) {
 	event, _ := pubsub.NewEvent(pubsub.EventStreamEnded, roomID, &pubsub.StreamEndedPayload{
 		RoomID: roomID,
 	})
 
 	channel := pubsub.MediaToSignalChannel(roomID)
 	s.pubsub.Publish(ctx, channel, event)
+}
 
-	return nil
+// isConnectionLoss returns true if a stop reason is a dropped connection rather than the broadcaster ending the stream.
+func isConnectionLoss(reason string) bool {
+	return reason == "disconnect" || strings.HasPrefix(reason, "connection_")
+}
+
+// suspendStream keeps the session of a live stream whose connection dropped and closes the connection.
+// The tracks end with it, so FFmpeg flushes its last segment and exits while the HLS output, the VOD
+// recording and the previews are kept. Returns false if the stream cannot be resumed.
+func (s *mediaService) suspendStream(roomID string) bool {
+	if s.reconnectGrace <= 0 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stream, exists := s.streams[roomID]
+	if !exists {
+		return false
+	}
+	switch stream.GetState() {
+	case domain.StreamStateReconnecting:
+		return true
+	case domain.StreamStateLive:
+	default:
+		return false // Nothing to resume before the stream went live
+	}
+
+	stream.SetState(domain.StreamStateReconnecting)
+	if stream.PeerConnection != nil {
+		stream.PeerConnection.Close()
+		stream.PeerConnection = nil
+	}
+	if s.healthMonitor != nil {
+		s.healthMonitor.Unregister(roomID)
+	}
+
+	s.stopReconnectTimerLocked(roomID)
+	s.reconnectTimers[roomID] = time.AfterFunc(s.reconnectGrace, func() {
+		s.expireReconnect(roomID, stream)
+	})
+
+	l := pkglog.L()
+	l.Info().Str("room_id", roomID).Str("session_id", stream.GetSessionID()).Dur("grace_period", s.reconnectGrace).Msg("broadcast connection lost, waiting for reconnect")
+	return true
+}
+
+// expireReconnect ends a suspended stream whose broadcaster did not reconnect within the grace period.
+func (s *mediaService) expireReconnect(roomID string, stream *domain.Stream) {
+	s.mu.Lock()
+	if current, exists := s.streams[roomID]; !exists || current != stream {
+		// Resumed or replaced in the meantime
+		s.mu.Unlock()
+		return
+	}
+	s.cleanupStreamLocked(roomID)
+	s.mu.Unlock()
+
+	l := pkglog.L()
+	l.Info().Str("room_id", roomID).Msg("reconnect grace period expired, broadcast ended")
+	s.publishStreamEnded(context.Background(), roomID)
+}
+
+// stopReconnectTimerLocked cancels the grace period of a room. Caller must hold the lock.
+func (s *mediaService) stopReconnectTimerLocked(roomID string) {
+	if timer, exists := s.reconnectTimers[roomID]; exists {
+		timer.Stop()
+		delete(s.reconnectTimers, roomID)
+	}
 }
 
 func (s *mediaService) Start(ctx context.Context) error {
@@ -260,6 +380,12 @@ func (s *mediaService) processSignalEvent(ctx context.Context, event *pubsub.Eve
 }
 
 func (s *mediaService) handleTrack(roomID string, track *webrtc.TrackRemote) {
+	// Simulcast layers other than the primary one don't feed the transcoder
+	if track.Kind() == webrtc.RTPCodecTypeVideo && track.RID() != "" && track.RID() != s.simulcast.PrimaryLayer {
+		s.handleLayerTrack(roomID, track)
+		return
+	}
+
 	s.mu.Lock()
 	stream, exists := s.streams[roomID]
 	if !exists {
@@ -269,6 +395,9 @@ func (s *mediaService) handleTrack(roomID string, track *webrtc.TrackRemote) {
 
 	if track.Kind() == webrtc.RTPCodecTypeVideo {
 		stream.SetVideoTrack(track)
+		if s.healthMonitor != nil {
+			s.healthMonitor.SetVideoTrack(roomID, uint32(track.SSRC()))
+		}
 	} else if track.Kind() == webrtc.RTPCodecTypeAudio {
 		stream.SetAudioTrack(track)
 	}
@@ -285,11 +414,82 @@ func (s *mediaService) handleTrack(roomID string, track *webrtc.TrackRemote) {
 	}
 }
 
+// handleLayerTrack handles a non-primary simulcast layer.
+// With passthrough enabled the layer is published as an HLS rendition once the primary stream is live.
+func (s *mediaService) handleLayerTrack(roomID string, track *webrtc.TrackRemote) {
+	l := pkglog.L()
+	if !s.simulcast.Passthrough {
+		l.Debug().Str("room_id", roomID).Str("rid", track.RID()).Msg("ignoring simulcast layer")
+		return
+	}
+
+	s.mu.Lock()
+	stream, exists := s.streams[roomID]
+	if !exists {
+		s.mu.Unlock()
+		return
+	}
+	stream.SetLayerTrack(track.RID(), track)
+	live := stream.GetState() == domain.StreamStateLive
+	sessionID := stream.GetSessionID()
+	s.mu.Unlock()
+
+	// Otherwise started by startHLSTranscoding when the stream goes live
+	if live {
+		go s.startRendition(roomID, sessionID, track)
+	}
+}
+
+// startRendition publishes a simulcast layer as a passthrough HLS rendition and records it for VOD.
+func (s *mediaService) startRendition(roomID, sessionID string, track *webrtc.TrackRemote) {
+	l := pkglog.L()
+	rid := track.RID()
+
+	codecs, err := s.transcoder.StartRendition(roomID, sessionID, rid, track)
+	if err != nil {
+		l.Warn().Err(err).Str("room_id", roomID).Str("rid", rid).Msg("failed to start simulcast rendition")
+		return
+	}
+
+	if s.vodManager != nil && sessionID != "" {
+		if err := s.vodManager.AddVariant(roomID, sessionID, rid, codecs); err != nil {
+			l.Error().Err(err).Str("room_id", roomID).Str("rid", rid).Msg("failed to start vod variant tracking")
+		}
+	}
+}
+
+// startAudioRendition publishes the audio-only rendition of a stream and records it for VOD.
+func (s *mediaService) startAudioRendition(roomID, sessionID string) {
+	l := pkglog.L()
+
+	codecs, err := s.transcoder.StartAudioRendition(roomID, sessionID)
+	if err != nil {
+		l.Warn().Err(err).Str("room_id", roomID).Msg("failed to start audio rendition")
+		return
+	}
+
+	if s.vodManager != nil && sessionID != "" {
+		if err := s.vodManager.AddVariant(roomID, sessionID, audioRendition, codecs); err != nil {
+			l.Error().Err(err).Str("room_id", roomID).Msg("failed to start vod audio rendition tracking")
+		}
+	}
+}
+
 func (s *mediaService) startHLSTranscoding(roomID string, videoTrack, audioTrack *webrtc.TrackRemote) {
 	l := pkglog.L()
-	// Start VOD tracking if enabled - this determines the sessionID
+
+	// A resumed stream continues its session, otherwise VOD tracking determines the sessionID
 	var sessionID string
-	if s.vodManager != nil {
+	resumed := false
+	s.mu.RLock()
+	if stream, exists := s.streams[roomID]; exists && stream.IsResumed() {
+		resumed = true
+		sessionID = stream.GetSessionID()
+	}
+	s.mu.RUnlock()
+
+	// Start VOD tracking if enabled - this determines the sessionID
+	if s.vodManager != nil && !resumed {
 		ctx := context.Background()
 		session, err := s.vodManager.StartRoom(ctx, roomID)
 		if err != nil {
@@ -301,32 +501,59 @@ func (s *mediaService) startHLSTranscoding(roomID string, videoTrack, audioTrack
 	}
 
 	// Start HLS immediately - don't delay, we don't want to miss keyframes
-	hlsUrl, err := s.transcoder.StartHLS(roomID, sessionID, videoTrack, audioTrack)
+	startHLS := s.transcoder.StartHLS
+	if resumed {
+		startHLS = s.transcoder.ResumeHLS
+	}
+	hlsUrl, err := startHLS(roomID, sessionID, videoTrack, audioTrack)
 	if err != nil {
 		l.Error().Err(err).Str("room_id", roomID).Msg("failed to start hls")
 		return
 	}
 
+	// Passthrough streams advertise the broadcaster's codec instead of the encoder's
+	if s.vodManager != nil && sessionID != "" {
+		s.vodManager.SetSessionCodecs(roomID, sessionID, s.transcoder.StreamCodecString(roomID, sessionID))
+	}
+
+	var layers map[string]*webrtc.TrackRemote
 	s.mu.Lock()
 	if stream, exists := s.streams[roomID]; exists {
+		stream.SetSessionID(sessionID)
 		stream.SetState(domain.StreamStateLive)
 		stream.SetHLSUrl(hlsUrl)
+		layers = stream.GetLayerTracks()
 	}
 	s.mu.Unlock()
 
+	if s.healthMonitor != nil {
+		s.healthMonitor.SetLive(roomID, sessionID)
+	}
+
+	// Publish simulcast layers received before the stream went live
+	for _, layer := range layers {
+		go s.startRendition(roomID, sessionID, layer)
+	}
+
+	// Publish the audio-only rendition of rooms listened to in the background
+	if audioTrack != nil && s.transcoder.PublishesAudioOnly(roomID) {
+		go s.startAudioRendition(roomID, sessionID)
+	}
+
 	// Wait for first HLS segment to be created before notifying stream is ready
 	time.Sleep(time.Duration(3) * time.Second)
 
-	// Start thumbnail capture if enabled (captures from HLS stream)
-	if s.thumbnailService != nil && sessionID != "" {
+	// Start thumbnail capture if enabled (captures from HLS stream), kept running while reconnecting
+	if s.thumbnailService != nil && sessionID != "" && !resumed {
 		s.thumbnailService.StartCapture(roomID, sessionID)
 	}
 
 	// Notify Signal Service that stream is ready
 	ctx := context.Background()
 	event, _ := pubsub.NewEvent(pubsub.EventStreamReady, roomID, &pubsub.StreamReadyPayload{
-		RoomID: roomID,
-		HLSUrl: hlsUrl,
+		RoomID:    roomID,
+		SessionID: sessionID,
+		HLSUrl:    hlsUrl,
 	})
 
 	channel := pubsub.MediaToSignalChannel(roomID)
@@ -334,11 +561,20 @@ func (s *mediaService) startHLSTranscoding(roomID string, videoTrack, audioTrack
 		l.Error().Err(err).Str("room_id", roomID).Msg("failed to publish stream ready")
 	}
 
-	l.Info().Str("room_id", roomID).Str("hls_url", hlsUrl).Msg("hls stream ready")
+	l.Info().Str("room_id", roomID).Str("hls_url", hlsUrl).Bool("resumed", resumed).Msg("hls stream ready")
 }
 
-func (s *mediaService) handleConnectionState(roomID string, state webrtc.PeerConnectionState) {
+func (s *mediaService) handleConnectionState(roomID string, pc *webrtc.PeerConnection, state webrtc.PeerConnectionState) {
 	if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+		// Ignore connections that were already suspended or replaced
+		s.mu.RLock()
+		stream, exists := s.streams[roomID]
+		current := exists && stream.PeerConnection == pc
+		s.mu.RUnlock()
+		if !current {
+			return
+		}
+
 		l := pkglog.L()
 		l.Info().Str("room_id", roomID).Str("state", state.String()).Msg("connection state changed")
 		ctx := context.Background()
@@ -374,6 +610,7 @@ func (s *mediaService) cleanupStreamLocked(roomID string) {
 	if !exists {
 		return
 	}
+	s.stopReconnectTimerLocked(roomID)
 
 	// Get active session for sessionID
 	ctx := context.Background()
@@ -393,6 +630,10 @@ func (s *mediaService) cleanupStreamLocked(roomID string) {
 	// Stop transcoder
 	s.transcoder.StopHLS(roomID, sessionID)
 
+	if s.healthMonitor != nil {
+		s.healthMonitor.Unregister(roomID)
+	}
+
 	// Finalize VOD if enabled
 	if s.vodManager != nil && s.vodManager.IsRoomTracking(roomID) {
 		go func() {
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Upload queue metrics, exposed on the service's /metrics endpoint.
+var (
+	uploadQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "media",
+		Subsystem: "upload",
+		Name:      "queue_depth",
+		Help:      "Uploads queued, in flight or waiting for a retry.",
+	})
+
+	uploadAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "media",
+		Subsystem: "upload",
+		Name:      "attempts_total",
+		Help:      "Upload attempts by result (success, error).",
+	}, []string{"result"})
+
+	uploadFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "media",
+		Subsystem: "upload",
+		Name:      "failures_total",
+		Help:      "Uploads given up on by reason (dead_letter, rejected).",
+	}, []string{"reason"})
+
+	uploadBackpressure = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "media",
+		Subsystem: "upload",
+		Name:      "backpressure_total",
+		Help:      "Uploads queued while the queue was above its high-water mark.",
+	})
+
+	uploadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "media",
+		Subsystem: "upload",
+		Name:      "duration_seconds",
+		Help:      "Duration of successful uploads.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+// Stream health metrics by room, removed when the stream ends.
+var (
+	streamIngestBitrate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "media",
+		Subsystem: "stream",
+		Name:      "ingest_bitrate_bps",
+		Help:      "Bitrate of all RTP streams received from the broadcaster.",
+	}, []string{"room_id"})
+
+	streamIngestFPS = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "media",
+		Subsystem: "stream",
+		Name:      "ingest_fps",
+		Help:      "Frame rate of the primary video track.",
+	}, []string{"room_id"})
+
+	streamPacketLoss = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "media",
+		Subsystem: "stream",
+		Name:      "packet_loss_ratio",
+		Help:      "Fraction of primary video packets lost during the last report interval.",
+	}, []string{"room_id"})
+
+	streamJitter = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "media",
+		Subsystem: "stream",
+		Name:      "jitter_seconds",
+		Help:      "Interarrival jitter of the primary video track.",
+	}, []string{"room_id"})
+
+	streamKeyframeInterval = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "media",
+		Subsystem: "stream",
+		Name:      "keyframe_interval_seconds",
+		Help:      "Time between the last two keyframes of the primary video track.",
+	}, []string{"room_id"})
+
+	streamEncoderSpeed = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "media",
+		Subsystem: "stream",
+		Name:      "encoder_speed",
+		Help:      "FFmpeg processing speed relative to realtime.",
+	}, []string{"room_id"})
+
+	streamSegmentLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "media",
+		Subsystem: "stream",
+		Name:      "segment_lag_seconds",
+		Help:      "Time since the live playlist was last updated.",
+	}, []string{"room_id"})
+)
+
+// Content encryption metrics.
+var (
+	keyRotations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "media",
+		Subsystem: "encryption",
+		Name:      "key_rotations_total",
+		Help:      "Content keys generated for encrypted HLS output by result (success, error).",
+	}, []string{"result"})
+)
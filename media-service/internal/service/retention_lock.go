@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/weiawesome/wes-io-live/media-service/internal/config"
+)
+
+// RedisSweepLock elects the replica that runs a retention sweep. The lock is taken with a TTL
+// of the sweep interval and never released early, so one sweep runs per interval across replicas.
+type RedisSweepLock struct {
+	client *redis.Client
+	key    string
+	owner  string
+}
+
+// NewRedisSweepLock creates a new Redis-backed sweep lock owned by an instance.
+func NewRedisSweepLock(cfg config.RetentionLockConfig, instanceID string) (*RedisSweepLock, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisSweepLock{
+		client: client,
+		key:    cfg.Key,
+		owner:  instanceID,
+	}, nil
+}
+
+// Acquire takes the lock for ttl. Returns false if another instance holds it.
+func (l *RedisSweepLock) Acquire(ctx context.Context, ttl time.Duration) (bool, error) {
+	ok, err := l.client.SetNX(ctx, l.key, l.owner, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire retention lock: %w", err)
+	}
+	return ok, nil
+}
+
+// Close closes the Redis connection.
+func (l *RedisSweepLock) Close() error {
+	return l.client.Close()
+}
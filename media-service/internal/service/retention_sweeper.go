@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/weiawesome/wes-io-live/media-service/internal/config"
+	"github.com/weiawesome/wes-io-live/pkg/hlskey"
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/pkg/storage"
+)
+
+// RetentionSweeper periodically deletes VOD recordings older than the retention period,
+// together with their previews, content keys and stale session-store entries.
+type RetentionSweeper struct {
+	vodManager    *VODManager
+	storage       storage.Storage
+	sessionStore  SessionStore
+	keyStore      *hlskey.Store
+	lock          *RedisSweepLock // nil when a single instance sweeps
+	cfg           config.RetentionConfig
+	retentionDays int
+	pinned        map[string]bool // "roomID/sessionID"
+
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// RetentionSweeperConfig holds configuration for the retention sweeper.
+type RetentionSweeperConfig struct {
+	VODManager    *VODManager
+	Storage       storage.Storage // Same storage the VOD manager uploads to
+	SessionStore  SessionStore
+	KeyStore      *hlskey.Store   // Content keys of encrypted recordings, nil if encryption is disabled
+	Lock          *RedisSweepLock // Shared by replicas so only one sweeps per interval, nil to always sweep
+	Retention     config.RetentionConfig
+	RetentionDays int // Default retention, 0 = keep forever
+}
+
+// ExpiredVOD describes a VOD session selected for deletion.
+type ExpiredVOD struct {
+	RoomID    string    `json:"room_id"`
+	SessionID string    `json:"session_id"`
+	StartTime time.Time `json:"start_time"`
+}
+
+// SweepReport summarizes a retention sweep.
+type SweepReport struct {
+	Checked int          `json:"checked"`
+	Expired []ExpiredVOD `json:"expired"`
+	Deleted int          `json:"deleted"`
+	DryRun  bool         `json:"dry_run"`
+}
+
+// NewRetentionSweeper creates a new retention sweeper.
+func NewRetentionSweeper(cfg RetentionSweeperConfig) *RetentionSweeper {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	pinned := make(map[string]bool, len(cfg.Retention.PinnedSessions))
+	for _, entry := range cfg.Retention.PinnedSessions {
+		pinned[entry] = true
+	}
+
+	return &RetentionSweeper{
+		vodManager:    cfg.VODManager,
+		storage:       cfg.Storage,
+		sessionStore:  cfg.SessionStore,
+		keyStore:      cfg.KeyStore,
+		lock:          cfg.Lock,
+		cfg:           cfg.Retention,
+		retentionDays: cfg.RetentionDays,
+		pinned:        pinned,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Start begins periodic sweeping. The first sweep runs immediately.
+func (s *RetentionSweeper) Start() {
+	interval := time.Duration(s.cfg.IntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			s.runSweep(interval)
+
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	l := pkglog.L()
+	l.Info().Dur("interval", interval).Int("retention_days", s.retentionDays).Bool("dry_run", s.cfg.DryRun).Msg("vod retention sweeper started")
+}
+
+// Stop stops the sweeper and waits for a running sweep to finish.
+func (s *RetentionSweeper) Stop() {
+	s.stopOnce.Do(func() {
+		s.cancel()
+		s.wg.Wait()
+		l := pkglog.L()
+		l.Info().Msg("vod retention sweeper stopped")
+	})
+}
+
+func (s *RetentionSweeper) runSweep(interval time.Duration) {
+	l := pkglog.L()
+	if s.lock != nil {
+		// Held until it expires, a replica whose ticker fires later in the interval skips its sweep
+		acquired, err := s.lock.Acquire(s.ctx, interval)
+		if err != nil {
+			l.Error().Err(err).Msg("vod retention sweep skipped")
+			return
+		}
+		if !acquired {
+			l.Debug().Msg("vod retention sweep running on another instance")
+			return
+		}
+	}
+
+	report, err := s.Sweep(s.ctx)
+	if err != nil {
+		l.Error().Err(err).Msg("vod retention sweep failed")
+		return
+	}
+	l.Info().Int("checked", report.Checked).Int("expired", len(report.Expired)).Int("deleted", report.Deleted).Bool("dry_run", report.DryRun).Msg("vod retention sweep completed")
+}
+
+// Sweep runs a single retention pass and returns what was (or, in dry-run mode, would be) deleted.
+func (s *RetentionSweeper) Sweep(ctx context.Context) (*SweepReport, error) {
+	report := &SweepReport{DryRun: s.cfg.DryRun}
+
+	rooms, err := s.vodManager.ListVODs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	l := pkglog.L()
+
+	for _, roomID := range rooms {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		days := s.retentionFor(roomID)
+		if days <= 0 {
+			continue // Room never expires
+		}
+		cutoff := now.AddDate(0, 0, -days)
+
+		vods, err := s.vodManager.ListRoomVODs(ctx, roomID)
+		if err != nil {
+			l.Error().Err(err).Str("room_id", roomID).Msg("failed to list room vods for retention")
+			continue
+		}
+
+		for _, vod := range vods {
+			report.Checked++
+
+			if vod.StartTime.IsZero() || !vod.StartTime.Before(cutoff) {
+				continue
+			}
+			// Never delete a pinned VOD or the session that is currently being recorded
+			if s.pinned[roomID+"/"+vod.SessionID] || s.vodManager.IsRecording(roomID, vod.SessionID) {
+				continue
+			}
+
+			expired := ExpiredVOD{RoomID: roomID, SessionID: vod.SessionID, StartTime: vod.StartTime}
+			report.Expired = append(report.Expired, expired)
+
+			if s.cfg.DryRun {
+				l.Info().Str("room_id", roomID).Str("session_id", vod.SessionID).Time("start_time", vod.StartTime).Int("retention_days", days).Msg("vod expired, would delete (dry run)")
+				continue
+			}
+
+			if err := s.deleteSession(ctx, expired); err != nil {
+				l.Error().Err(err).Str("room_id", roomID).Str("session_id", vod.SessionID).Msg("failed to delete expired vod")
+				continue
+			}
+			report.Deleted++
+			l.Info().Str("room_id", roomID).Str("session_id", vod.SessionID).Time("start_time", vod.StartTime).Int("retention_days", days).Msg("expired vod deleted")
+		}
+	}
+
+	return report, nil
+}
+
+// retentionFor returns the retention period in days for a room (0 = never expire).
+func (s *RetentionSweeper) retentionFor(roomID string) int {
+	if days, exists := s.cfg.RoomOverrides[roomID]; exists {
+		return days
+	}
+	return s.retentionDays
+}
+
+// deleteSession removes a VOD session's recording, previews, content keys and any stale session-store entry.
+func (s *RetentionSweeper) deleteSession(ctx context.Context, vod ExpiredVOD) error {
+	if err := s.vodManager.DeleteVOD(ctx, vod.RoomID, vod.SessionID); err != nil {
+		return fmt.Errorf("failed to delete vod: %w", err)
+	}
+
+	previewPrefix := fmt.Sprintf("preview/room_%s/%s/", vod.RoomID, vod.SessionID)
+	if err := s.storage.DeletePrefix(ctx, previewPrefix); err != nil {
+		return fmt.Errorf("failed to delete previews: %w", err)
+	}
+
+	if s.keyStore != nil {
+		if err := s.keyStore.DeleteSession(ctx, vod.RoomID, vod.SessionID); err != nil {
+			return err
+		}
+	}
+
+	// A session older than the retention period that is still stored was never finalized (e.g. crash)
+	if s.sessionStore != nil {
+		session, err := s.sessionStore.Get(ctx, vod.RoomID)
+		if err != nil {
+			return fmt.Errorf("failed to get session: %w", err)
+		}
+		if session != nil && session.SessionID == vod.SessionID {
+			if err := s.sessionStore.Delete(ctx, vod.RoomID); err != nil {
+				return fmt.Errorf("failed to delete session: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
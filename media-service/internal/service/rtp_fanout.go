@@ -0,0 +1,90 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+)
+
+// rtpFanout reads RTP packets from a single remote track and distributes them to multiple consumers.
+// A TrackRemote can only be read by one goroutine, so shared tracks (e.g. the broadcaster's audio
+// feeding both the main transcoder and simulcast renditions) are read through a fanout.
+type rtpFanout struct {
+	track  *webrtc.TrackRemote
+	subs   map[int]chan *rtp.Packet
+	nextID int
+	closed bool
+	mu     sync.Mutex
+}
+
+// newRTPFanout creates a fanout for the given track. Call run to start reading.
+func newRTPFanout(track *webrtc.TrackRemote) *rtpFanout {
+	return &rtpFanout{
+		track: track,
+		subs:  make(map[int]chan *rtp.Packet),
+	}
+}
+
+// Subscribe registers a consumer and returns its packet channel and an unsubscribe function.
+// The channel is closed when the track ends or the consumer unsubscribes.
+// Packets are dropped for consumers that fall more than buffer packets behind.
+func (f *rtpFanout) Subscribe(buffer int) (<-chan *rtp.Packet, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan *rtp.Packet, buffer)
+	if f.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	id := f.nextID
+	f.nextID++
+	f.subs[id] = ch
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if sub, exists := f.subs[id]; exists {
+			delete(f.subs, id)
+			close(sub)
+		}
+	}
+}
+
+// run reads packets until the track ends, then closes all subscriber channels.
+func (f *rtpFanout) run() {
+	defer f.closeAll()
+
+	for {
+		packet, _, err := f.track.ReadRTP()
+		if err != nil {
+			l := pkglog.L()
+			l.Debug().Err(err).Str("track_id", f.track.ID()).Msg("rtp fanout read ended")
+			return
+		}
+
+		f.mu.Lock()
+		for _, sub := range f.subs {
+			select {
+			case sub <- packet:
+			default:
+			}
+		}
+		f.mu.Unlock()
+	}
+}
+
+// closeAll closes all subscriber channels and rejects further subscriptions.
+func (f *rtpFanout) closeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	for id, sub := range f.subs {
+		close(sub)
+		delete(f.subs, id)
+	}
+}
@@ -2,16 +2,30 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math/rand"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
 	"github.com/weiawesome/wes-io-live/pkg/storage"
 )
 
+var (
+	// ErrUploadBackpressure is returned by Upload when the task was queued but the number of
+	// pending uploads is above the high-water mark. Callers should defer optional uploads.
+	ErrUploadBackpressure = errors.New("upload queue above high-water mark")
+
+	// ErrUploadQueueFull is returned by Upload when the task was rejected.
+	ErrUploadQueueFull = errors.New("upload queue is full")
+)
+
 // UploadTask represents a file upload task.
 type UploadTask struct {
 	RoomID      string
@@ -19,28 +33,68 @@ type UploadTask struct {
 	S3Key       string
 	ContentType string
 	OnComplete  func(error)
-	Retries     int
+	Retries     int            // Failed attempts so far
+	Segment     *UploadSegment // VOD segment the file belongs to, journaled so replays can update its playlist
+
+	id        string
+	createdAt time.Time
+	requeues  int // Times the task was replayed from the dead-letter list
+}
+
+// UploadSegment identifies the VOD segment carried by an upload task.
+type UploadSegment struct {
+	SessionID     string    `json:"session_id"`
+	SessionStart  time.Time `json:"session_start"`
+	Variant       string    `json:"variant,omitempty"`
+	Index         int       `json:"index"`
+	Filename      string    `json:"filename"`
+	Duration      float64   `json:"duration"`
+	IsInit        bool      `json:"is_init,omitempty"`
+	Discontinuity bool      `json:"discontinuity,omitempty"`
+	Key           string    `json:"key,omitempty"`
+	InitSegment   string    `json:"init_segment,omitempty"`
 }
 
 // S3Uploader manages concurrent uploads to S3.
+// Tasks are recorded in an on-disk journal (if configured) until they are uploaded, so they are
+// replayed after a restart. Failed uploads are retried with exponential backoff and moved to a
+// dead-letter list once their retries are exhausted.
 type S3Uploader struct {
-	storage    storage.Storage
-	workers    int
-	queue      chan *UploadTask
-	wg         sync.WaitGroup
-	ctx        context.Context
-	cancel     context.CancelFunc
-	maxRetries int
-	retryDelay time.Duration
-	stopOnce   sync.Once
+	storage  storage.Storage
+	workers  int
+	journal  *uploadJournal
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+
+	mu          sync.Mutex
+	queue       []*UploadTask          // Tasks ready to be uploaded
+	tasks       map[string]*UploadTask // All pending tasks (queued, in flight or waiting for retry) by id
+	roomPending map[string]int         // Pending tasks per room
+	wake        chan struct{}
+	seq         atomic.Uint64
+
+	highWaterMark int
+	maxPending    int
+	maxRetries    int
+	maxRequeues   int
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+
+	onReplayed func(task *UploadTask, err error) // Completion of tasks replayed from the journal
 }
 
 // S3UploaderConfig holds configuration for the S3 uploader.
 type S3UploaderConfig struct {
-	Workers    int
-	QueueSize  int
-	MaxRetries int
-	RetryDelay time.Duration
+	Workers       int
+	QueueSize     int           // High-water mark: pending uploads above which Upload signals backpressure
+	MaxPending    int           // Pending uploads above which Upload rejects new tasks
+	MaxRetries    int           // Failed attempts before a task is dead-lettered
+	MaxRequeues   int           // Starts a dead-lettered task is retried on, 0 = never
+	RetryDelay    time.Duration // First retry delay, doubled on every attempt
+	MaxRetryDelay time.Duration
+	JournalDir    string // On-disk journal directory, empty = in-memory only
 }
 
 // NewS3Uploader creates a new S3 uploader.
@@ -51,56 +105,228 @@ func NewS3Uploader(s storage.Storage, cfg S3UploaderConfig) *S3Uploader {
 	if cfg.QueueSize <= 0 {
 		cfg.QueueSize = 100
 	}
+	if cfg.MaxPending < cfg.QueueSize {
+		cfg.MaxPending = cfg.QueueSize * 10
+	}
 	if cfg.MaxRetries <= 0 {
 		cfg.MaxRetries = 3
 	}
 	if cfg.RetryDelay <= 0 {
 		cfg.RetryDelay = time.Second
 	}
+	if cfg.MaxRetryDelay < cfg.RetryDelay {
+		cfg.MaxRetryDelay = 2 * time.Minute
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &S3Uploader{
-		storage:    s,
-		workers:    cfg.Workers,
-		queue:      make(chan *UploadTask, cfg.QueueSize),
-		ctx:        ctx,
-		cancel:     cancel,
-		maxRetries: cfg.MaxRetries,
-		retryDelay: cfg.RetryDelay,
+	u := &S3Uploader{
+		storage:       s,
+		workers:       cfg.Workers,
+		ctx:           ctx,
+		cancel:        cancel,
+		tasks:         make(map[string]*UploadTask),
+		roomPending:   make(map[string]int),
+		wake:          make(chan struct{}, 1),
+		highWaterMark: cfg.QueueSize,
+		maxPending:    cfg.MaxPending,
+		maxRetries:    cfg.MaxRetries,
+		maxRequeues:   cfg.MaxRequeues,
+		retryDelay:    cfg.RetryDelay,
+		maxRetryDelay: cfg.MaxRetryDelay,
+	}
+
+	if cfg.JournalDir != "" {
+		journal, err := newUploadJournal(cfg.JournalDir)
+		if err != nil {
+			l := pkglog.L()
+			l.Error().Err(err).Str("dir", cfg.JournalDir).Msg("failed to open upload journal, uploads will not survive restarts")
+		} else {
+			u.journal = journal
+		}
 	}
+
+	return u
 }
 
-// Start launches the upload workers.
+// SetReplayHandler sets the completion callback of tasks replayed from the journal, whose
+// OnComplete did not survive the restart. Must be called before Start.
+func (u *S3Uploader) SetReplayHandler(fn func(task *UploadTask, err error)) {
+	u.onReplayed = fn
+}
+
+// Start replays journaled uploads and launches the upload workers.
+// Dead-lettered uploads are retried once more on every start, up to MaxRequeues times.
 func (u *S3Uploader) Start() {
+	l := pkglog.L()
+	replayed := 0
+
+	if u.journal != nil {
+		dead, err := u.journal.deadLetters()
+		if err != nil {
+			l.Error().Err(err).Msg("failed to read upload dead letters")
+		}
+		kept := 0
+		for _, entry := range dead {
+			if entry.Requeues >= u.maxRequeues {
+				kept++ // Left in the dead-letter list for inspection
+				continue
+			}
+			if err := u.journal.resurrect(entry); err != nil {
+				l.Error().Err(err).Str("s3_key", entry.S3Key).Msg("failed to requeue dead-lettered upload")
+			}
+		}
+
+		if kept > 0 {
+			l.Warn().Int("dead_letters", kept).Int("max_requeues", u.maxRequeues).Msg("dead-lettered uploads exhausted their requeues, not retried")
+		}
+
+		pending, err := u.journal.pending()
+		if err != nil {
+			l.Error().Err(err).Msg("failed to read upload journal")
+		}
+		for _, entry := range pending {
+			task := &UploadTask{
+				RoomID:      entry.RoomID,
+				LocalPath:   entry.LocalPath,
+				S3Key:       entry.S3Key,
+				ContentType: entry.ContentType,
+				Retries:     entry.Attempts,
+				Segment:     entry.Segment,
+				id:          entry.ID,
+				createdAt:   entry.CreatedAt,
+				requeues:    entry.Requeues,
+			}
+			if u.onReplayed != nil {
+				task.OnComplete = func(err error) { u.onReplayed(task, err) }
+			}
+			u.enqueue(task)
+			replayed++
+		}
+	}
+
 	for i := 0; i < u.workers; i++ {
 		u.wg.Add(1)
 		go u.worker(i)
 	}
-	l := pkglog.L()
-	l.Info().Int("workers", u.workers).Msg("s3 uploader started")
+	l.Info().Int("workers", u.workers).Bool("journal", u.journal != nil).Int("replayed", replayed).Msg("s3 uploader started")
 }
 
-// Stop gracefully stops all workers.
+// Stop gracefully stops all workers. Journaled tasks that were not uploaded are replayed on the next start.
 func (u *S3Uploader) Stop() {
 	u.stopOnce.Do(func() {
 		u.cancel()
-		close(u.queue)
 		u.wg.Wait()
 		l := pkglog.L()
-		l.Info().Msg("s3 uploader stopped")
+		l.Info().Int("pending", u.QueueLength()).Msg("s3 uploader stopped")
 	})
 }
 
 // Upload queues a file for upload.
+// Returns ErrUploadBackpressure if the task was queued but the queue is above its high-water mark,
+// ErrUploadQueueFull if the task was rejected.
 func (u *S3Uploader) Upload(task *UploadTask) error {
-	select {
-	case u.queue <- task:
-		return nil
-	case <-u.ctx.Done():
+	if u.ctx.Err() != nil {
 		return fmt.Errorf("uploader is stopped")
+	}
+
+	u.mu.Lock()
+	pending := len(u.tasks)
+	u.mu.Unlock()
+	if pending >= u.maxPending {
+		uploadFailures.WithLabelValues("rejected").Inc()
+		return ErrUploadQueueFull
+	}
+
+	task.id = fmt.Sprintf("%d-%d", time.Now().UnixNano(), u.seq.Add(1))
+	task.createdAt = time.Now().UTC()
+	if u.journal != nil {
+		if err := u.journal.put(u.journalEntry(task)); err != nil {
+			l := pkglog.L()
+			l.Warn().Err(err).Str("s3_key", task.S3Key).Msg("failed to journal upload")
+		}
+	}
+
+	if u.enqueue(task) > u.highWaterMark {
+		uploadBackpressure.Inc()
+		return ErrUploadBackpressure
+	}
+	return nil
+}
+
+// Backpressured returns true if the number of pending uploads is above the high-water mark.
+func (u *S3Uploader) Backpressured() bool {
+	return u.QueueLength() > u.highWaterMark
+}
+
+// enqueue adds a new task to the queue and returns the number of pending tasks.
+func (u *S3Uploader) enqueue(task *UploadTask) int {
+	u.mu.Lock()
+	u.tasks[task.id] = task
+	u.roomPending[task.RoomID]++
+	u.queue = append(u.queue, task)
+	pending := len(u.tasks)
+	u.mu.Unlock()
+
+	uploadQueueDepth.Set(float64(pending))
+	u.notify()
+	return pending
+}
+
+// requeue puts a task waiting for retry back into the queue.
+func (u *S3Uploader) requeue(task *UploadTask) {
+	if u.ctx.Err() != nil {
+		return
+	}
+	u.mu.Lock()
+	u.queue = append(u.queue, task)
+	u.mu.Unlock()
+	u.notify()
+}
+
+// done removes a task from the pending set.
+func (u *S3Uploader) done(task *UploadTask) {
+	u.mu.Lock()
+	delete(u.tasks, task.id)
+	if u.roomPending[task.RoomID]--; u.roomPending[task.RoomID] <= 0 {
+		delete(u.roomPending, task.RoomID)
+	}
+	pending := len(u.tasks)
+	u.mu.Unlock()
+
+	uploadQueueDepth.Set(float64(pending))
+}
+
+// notify wakes up an idle worker.
+func (u *S3Uploader) notify() {
+	select {
+	case u.wake <- struct{}{}:
 	default:
-		return fmt.Errorf("upload queue is full")
+	}
+}
+
+// next blocks until a task is ready or the uploader is stopped (nil).
+func (u *S3Uploader) next() *UploadTask {
+	for {
+		u.mu.Lock()
+		if len(u.queue) > 0 {
+			task := u.queue[0]
+			u.queue[0] = nil
+			u.queue = u.queue[1:]
+			more := len(u.queue) > 0
+			u.mu.Unlock()
+			if more {
+				u.notify()
+			}
+			return task
+		}
+		u.mu.Unlock()
+
+		select {
+		case <-u.wake:
+		case <-u.ctx.Done():
+			return nil
+		}
 	}
 }
 
@@ -114,43 +340,203 @@ func (u *S3Uploader) worker(id int) {
 	defer u.wg.Done()
 
 	for {
-		select {
-		case task, ok := <-u.queue:
-			if !ok {
-				return
-			}
-			u.processTask(task)
-		case <-u.ctx.Done():
+		task := u.next()
+		if task == nil {
 			return
 		}
+		u.processTask(task)
 	}
 }
 
-// processTask handles a single upload task with retries.
+// processTask makes a single upload attempt and schedules a retry on failure.
 func (u *S3Uploader) processTask(task *UploadTask) {
 	l := pkglog.L()
-	var lastErr error
 
-	for attempt := 0; attempt <= u.maxRetries; attempt++ {
-		if attempt > 0 {
-			time.Sleep(u.retryDelay * time.Duration(attempt))
+	u.mu.Lock()
+	localPath := task.LocalPath
+	u.mu.Unlock()
+
+	start := time.Now()
+	err := u.uploadFile(u.ctx, localPath, task.S3Key, task.ContentType)
+	if err == nil {
+		uploadDuration.Observe(time.Since(start).Seconds())
+		uploadAttempts.WithLabelValues("success").Inc()
+		if u.journal != nil {
+			u.mu.Lock()
+			entry := u.journalEntry(task)
+			u.mu.Unlock()
+			u.journal.remove(entry.ID)
+			u.journal.discardData(entry)
 		}
+		u.done(task)
+		if task.OnComplete != nil {
+			task.OnComplete(nil)
+		}
+		return
+	}
 
-		err := u.uploadFile(u.ctx, task.LocalPath, task.S3Key, task.ContentType)
-		if err == nil {
-			if task.OnComplete != nil {
-				task.OnComplete(nil)
-			}
+	// Interrupted by Stop, the journal keeps the task for the next start
+	if u.ctx.Err() != nil {
+		return
+	}
+
+	uploadAttempts.WithLabelValues("error").Inc()
+
+	// RetainRoom may have moved the file to the journal after it was read above
+	if errors.Is(err, fs.ErrNotExist) {
+		u.mu.Lock()
+		moved := task.LocalPath != localPath
+		u.mu.Unlock()
+		if moved {
+			u.requeue(task)
 			return
 		}
+	}
+
+	u.mu.Lock()
+	task.Retries++
+	entry := u.journalEntry(task)
+	u.mu.Unlock()
 
-		lastErr = err
-		l.Warn().Err(err).Int("attempt", attempt+1).Str("s3_key", task.S3Key).Msg("upload attempt failed")
+	// A missing file will not appear by retrying
+	if entry.Attempts <= u.maxRetries && !errors.Is(err, fs.ErrNotExist) {
+		delay := u.backoff(entry.Attempts)
+		if u.journal != nil {
+			u.journal.put(entry)
+		}
+		l.Warn().Err(err).Int("attempt", entry.Attempts).Dur("retry_in", delay).Str("s3_key", task.S3Key).Msg("upload attempt failed")
+		time.AfterFunc(delay, func() { u.requeue(task) })
+		return
 	}
 
-	l.Error().Err(lastErr).Int("attempts", u.maxRetries+1).Str("s3_key", task.S3Key).Msg("upload failed after retries")
+	l.Error().Err(err).Int("attempts", entry.Attempts).Str("s3_key", task.S3Key).Msg("upload failed after retries, moved to dead letters")
+	uploadFailures.WithLabelValues("dead_letter").Inc()
+	if u.journal != nil {
+		entry.LastError = err.Error()
+		entry.FailedAt = time.Now().UTC()
+		if err := u.journal.bury(entry); err != nil {
+			l.Error().Err(err).Str("s3_key", task.S3Key).Msg("failed to record dead-lettered upload")
+		}
+	}
+	u.done(task)
 	if task.OnComplete != nil {
-		task.OnComplete(lastErr)
+		task.OnComplete(err)
+	}
+}
+
+// backoff returns the delay before the given retry attempt (1-based), with up to 20% jitter.
+func (u *S3Uploader) backoff(attempt int) time.Duration {
+	delay := u.retryDelay
+	for i := 1; i < attempt && delay < u.maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > u.maxRetryDelay {
+		delay = u.maxRetryDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// WaitForRoom blocks until all pending uploads of a room are done or ctx expires.
+func (u *S3Uploader) WaitForRoom(ctx context.Context, roomID string) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		u.mu.Lock()
+		pending := u.roomPending[roomID]
+		u.mu.Unlock()
+		if pending == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d uploads still pending for room %s: %w", pending, roomID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitForPrefix blocks until no pending upload has an S3 key with the given prefix or ctx expires.
+func (u *S3Uploader) WaitForPrefix(ctx context.Context, prefix string) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		u.mu.Lock()
+		pending := 0
+		for _, task := range u.tasks {
+			if strings.HasPrefix(task.S3Key, prefix) {
+				pending++
+			}
+		}
+		u.mu.Unlock()
+		if pending == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d uploads still pending under %s: %w", pending, prefix, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// RetainRoom copies the files of a room's pending uploads into the journal so the uploads
+// can complete after the session's local directory is removed.
+// Files are copied without holding the lock, workers keep uploading meanwhile.
+// Returns false if there is no journal to retain them in.
+func (u *S3Uploader) RetainRoom(roomID string) bool {
+	if u.journal == nil {
+		return false
+	}
+
+	u.mu.Lock()
+	var entries []*journalEntry
+	for _, task := range u.tasks {
+		if task.RoomID == roomID {
+			entries = append(entries, u.journalEntry(task))
+		}
+	}
+	u.mu.Unlock()
+
+	l := pkglog.L()
+	for _, entry := range entries {
+		if err := u.journal.retain(entry); err != nil {
+			l.Error().Err(err).Str("s3_key", entry.S3Key).Msg("failed to retain pending upload")
+			continue
+		}
+
+		// Journaled under the lock, so a worker finishing the upload can't remove the entry first
+		u.mu.Lock()
+		task, pending := u.tasks[entry.ID]
+		if pending {
+			task.LocalPath = entry.LocalPath
+			entry.Attempts = task.Retries
+			u.journal.put(entry)
+		}
+		u.mu.Unlock()
+
+		if !pending {
+			u.journal.discardData(entry) // Uploaded while the file was copied
+		}
+	}
+	return true
+}
+
+// journalEntry returns the persisted form of a task. Caller must hold the lock for tasks already queued.
+func (u *S3Uploader) journalEntry(task *UploadTask) *journalEntry {
+	return &journalEntry{
+		ID:          task.id,
+		RoomID:      task.RoomID,
+		LocalPath:   task.LocalPath,
+		S3Key:       task.S3Key,
+		ContentType: task.ContentType,
+		Attempts:    task.Retries,
+		Requeues:    task.requeues,
+		Segment:     task.Segment,
+		CreatedAt:   task.createdAt,
 	}
 }
 
@@ -182,5 +568,7 @@ func (u *S3Uploader) UploadReader(ctx context.Context, r io.Reader, size int64,
 
 // QueueLength returns the current number of pending tasks.
 func (u *S3Uploader) QueueLength() int {
-	return len(u.queue)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.tasks)
 }
@@ -20,12 +20,17 @@ import (
 type SegmentWatcherCallback func(roomID string, sessionID string, seg SegmentInfo)
 
 // watchKey uniquely identifies a watcher for a room+session combination
+// and, for simulcast renditions, the variant subdirectory.
 type watchKey struct {
 	RoomID    string
 	SessionID string
+	Variant   string
 }
 
 func (k watchKey) String() string {
+	if k.Variant != "" {
+		return k.RoomID + ":" + k.SessionID + "/" + k.Variant
+	}
 	return k.RoomID + ":" + k.SessionID
 }
 
@@ -53,50 +58,30 @@ func NewSegmentWatcher(hlsOutputDir string, callback SegmentWatcherCallback) *Se
 // StartWatchingSession begins monitoring a room's session HLS output directory.
 // Directory structure: {hlsOutputDir}/room_{roomID}/{sessionID}/
 func (w *SegmentWatcher) StartWatchingSession(roomID, sessionID string) error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
 	key := watchKey{RoomID: roomID, SessionID: sessionID}
-	keyStr := key.String()
-
-	// Check if already watching
-	if _, exists := w.watchers[keyStr]; exists {
-		return nil
-	}
-
-	sessionDir := filepath.Join(w.hlsOutputDir, "room_"+roomID, sessionID)
-
-	// Create watcher
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return fmt.Errorf("failed to create watcher: %w", err)
-	}
-
-	// Initialize known segments map for this session
-	w.known[keyStr] = make(map[string]bool)
-
-	// Start watching
-	w.watchers[keyStr] = watcher
-
-	// Start event handler goroutine
-	go w.handleSessionEvents(key, watcher, sessionDir)
-
-	// Wait for directory to exist and start watching
-	go w.waitAndWatchSession(key, watcher, sessionDir)
+	return w.startWatching(key, filepath.Join(w.hlsOutputDir, "room_"+roomID, sessionID))
+}
 
-	l := pkglog.L()
-	l.Info().Str("room_id", roomID).Str("session_id", sessionID).Msg("started watching for segments")
-	return nil
+// StartWatchingVariant begins monitoring a simulcast rendition of a session.
+// Directory structure: {hlsOutputDir}/room_{roomID}/{sessionID}/{variant}/
+func (w *SegmentWatcher) StartWatchingVariant(roomID, sessionID, variant string) error {
+	key := watchKey{RoomID: roomID, SessionID: sessionID, Variant: variant}
+	return w.startWatching(key, filepath.Join(w.hlsOutputDir, "room_"+roomID, sessionID, variant))
 }
 
 // StartWatching begins monitoring a room's HLS output directory (legacy support).
 // This method is kept for backward compatibility but uses the default session directory structure.
 func (w *SegmentWatcher) StartWatching(roomID string) error {
 	// For backward compatibility, use empty sessionID which means direct room directory
+	key := watchKey{RoomID: roomID, SessionID: ""}
+	return w.startWatching(key, filepath.Join(w.hlsOutputDir, "room_"+roomID))
+}
+
+// startWatching creates a watcher for key monitoring dir.
+func (w *SegmentWatcher) startWatching(key watchKey, dir string) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	key := watchKey{RoomID: roomID, SessionID: ""}
 	keyStr := key.String()
 
 	// Check if already watching
@@ -104,28 +89,26 @@ func (w *SegmentWatcher) StartWatching(roomID string) error {
 		return nil
 	}
 
-	roomDir := filepath.Join(w.hlsOutputDir, "room_"+roomID)
-
 	// Create watcher
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return fmt.Errorf("failed to create watcher: %w", err)
 	}
 
-	// Initialize known segments map for this room
+	// Initialize known segments map for this session
 	w.known[keyStr] = make(map[string]bool)
 
 	// Start watching
 	w.watchers[keyStr] = watcher
 
 	// Start event handler goroutine
-	go w.handleSessionEvents(key, watcher, roomDir)
+	go w.handleSessionEvents(key, watcher, dir)
 
-	// Wait for directory to exist
-	go w.waitAndWatchSession(key, watcher, roomDir)
+	// Wait for directory to exist and start watching
+	go w.waitAndWatchSession(key, watcher, dir)
 
 	l := pkglog.L()
-	l.Info().Str("room_id", roomID).Msg("started watching for segments")
+	l.Info().Str("room_id", key.RoomID).Str("session_id", key.SessionID).Str("variant", key.Variant).Msg("started watching for segments")
 	return nil
 }
 
@@ -219,22 +202,32 @@ func (w *SegmentWatcher) scanSessionPlaylist(key watchKey, dir string) {
 
 	scanner := bufio.NewScanner(file)
 	var currentDuration float64
-
-	// Regex to extract segment index from filename
-	segmentRegex := regexp.MustCompile(`segment_(\d+)\.ts`)
+	var discontinuity bool // FFmpeg marks the first segment appended by a resumed connection
+	var segmentKey string  // EXT-X-KEY of encrypted output, applies until the next one
+	var initSegment string // EXT-X-MAP of fMP4 output, every connection writes its own
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 
-		if strings.HasPrefix(line, "#EXTINF:") {
+		if line == "#EXT-X-DISCONTINUITY" {
+			discontinuity = true
+		} else if strings.HasPrefix(line, "#EXT-X-KEY:") {
+			segmentKey = parseKeyTag(line)
+		} else if strings.HasPrefix(line, "#EXT-X-MAP:") {
+			// fMP4 init segment, reported once before any media segment that depends on it
+			initSegment = parseMapURI(line)
+			w.handleInitSegment(key, dir, knownSegments, line)
+		} else if strings.HasPrefix(line, "#EXTINF:") {
 			// Parse duration
 			durationStr := strings.TrimPrefix(line, "#EXTINF:")
 			durationStr = strings.TrimSuffix(durationStr, ",")
 			if d, err := strconv.ParseFloat(durationStr, 64); err == nil {
 				currentDuration = d
 			}
-		} else if strings.HasSuffix(line, ".ts") {
+		} else if isMediaSegment(line) {
 			filename := line
+			segmentDiscontinuity := discontinuity
+			discontinuity = false
 
 			// Skip if already known
 			w.mu.RLock()
@@ -251,13 +244,7 @@ func (w *SegmentWatcher) scanSessionPlaylist(key watchKey, dir string) {
 			w.mu.Unlock()
 
 			// Extract segment index
-			matches := segmentRegex.FindStringSubmatch(filename)
-			index := -1
-			if len(matches) >= 2 {
-				if idx, err := strconv.Atoi(matches[1]); err == nil {
-					index = idx
-				}
-			}
+			index := segmentIndex(filename)
 
 			// Verify file exists and is complete
 			segmentPath := filepath.Join(dir, filename)
@@ -271,9 +258,16 @@ func (w *SegmentWatcher) scanSessionPlaylist(key watchKey, dir string) {
 
 			// Create segment info
 			seg := SegmentInfo{
-				Index:    index,
-				Filename: filename,
-				Duration: currentDuration,
+				Index:         index,
+				Filename:      filename,
+				Duration:      currentDuration,
+				Variant:       key.Variant,
+				Discontinuity: segmentDiscontinuity,
+				Key:           segmentKey,
+				InitSegment:   initSegment,
+			}
+			if info, err := os.Stat(segmentPath); err == nil {
+				seg.Size = info.Size()
 			}
 
 			// Notify callback
@@ -287,6 +281,93 @@ func (w *SegmentWatcher) scanSessionPlaylist(key watchKey, dir string) {
 	}
 }
 
+// handleInitSegment reports the init segment referenced by an EXT-X-MAP tag.
+// The callback is invoked synchronously so the init segment is queued before the first media segment.
+func (w *SegmentWatcher) handleInitSegment(key watchKey, dir string, knownSegments map[string]bool, line string) {
+	filename := parseMapURI(line)
+	if filename == "" {
+		return
+	}
+
+	w.mu.Lock()
+	seen := knownSegments[filename]
+	if !seen {
+		knownSegments[filename] = true
+	}
+	w.mu.Unlock()
+
+	if seen {
+		return
+	}
+
+	if !w.isSegmentComplete(filepath.Join(dir, filename)) {
+		w.mu.Lock()
+		delete(knownSegments, filename)
+		w.mu.Unlock()
+		return
+	}
+
+	if w.callback != nil {
+		w.callback(key.RoomID, key.SessionID, SegmentInfo{
+			Index:    -1,
+			Filename: filename,
+			IsInit:   true,
+			Variant:  key.Variant,
+		})
+	}
+
+	l := pkglog.L()
+	l.Info().Str("room_id", key.RoomID).Str("session_id", key.SessionID).Str("segment", filename).Msg("init segment detected")
+}
+
+// segmentFilenameRegex extracts the segment index from an FFmpeg segment filename.
+var segmentFilenameRegex = regexp.MustCompile(`segment_(\d+)\.(?:ts|m4s)`)
+
+// segmentIndex returns the index encoded in a segment filename, or -1 if it has none.
+func segmentIndex(filename string) int {
+	matches := segmentFilenameRegex.FindStringSubmatch(filename)
+	if len(matches) >= 2 {
+		if idx, err := strconv.Atoi(matches[1]); err == nil {
+			return idx
+		}
+	}
+	return -1
+}
+
+// parseMapURI extracts the URI attribute from an #EXT-X-MAP tag.
+func parseMapURI(line string) string {
+	attrs := strings.TrimPrefix(line, "#EXT-X-MAP:")
+	idx := strings.Index(attrs, `URI="`)
+	if idx < 0 {
+		return ""
+	}
+	uri := attrs[idx+len(`URI="`):]
+	end := strings.Index(uri, `"`)
+	if end < 0 {
+		return ""
+	}
+	return uri[:end]
+}
+
+// isMediaSegment returns true if the playlist line references an MPEG-TS or fMP4 media segment.
+func isMediaSegment(line string) bool {
+	return strings.HasSuffix(line, ".ts") || strings.HasSuffix(line, ".m4s")
+}
+
+// segmentContentType returns the MIME type for an HLS/DASH asset based on its extension.
+func segmentContentType(filename string) string {
+	switch filepath.Ext(filename) {
+	case ".m4s":
+		return "video/iso.segment"
+	case ".mp4":
+		return "video/mp4"
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	default:
+		return "video/mp2t"
+	}
+}
+
 // isSegmentComplete checks if a segment file is complete (not being written).
 func (w *SegmentWatcher) isSegmentComplete(path string) bool {
 	info, err := os.Stat(path)
@@ -310,7 +391,7 @@ func (w *SegmentWatcher) isSegmentComplete(path string) bool {
 	return info.Size() == info2.Size()
 }
 
-// StopWatchingSession stops monitoring a specific session.
+// StopWatchingSession stops monitoring a specific session, including its simulcast renditions.
 func (w *SegmentWatcher) StopWatchingSession(roomID, sessionID string) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -318,12 +399,15 @@ func (w *SegmentWatcher) StopWatchingSession(roomID, sessionID string) {
 	key := watchKey{RoomID: roomID, SessionID: sessionID}
 	keyStr := key.String()
 
-	if watcher, exists := w.watchers[keyStr]; exists {
+	for k, watcher := range w.watchers {
+		if k != keyStr && !strings.HasPrefix(k, keyStr+"/") {
+			continue
+		}
 		watcher.Close()
-		delete(w.watchers, keyStr)
-		delete(w.known, keyStr)
+		delete(w.watchers, k)
+		delete(w.known, k)
 		l := pkglog.L()
-		l.Info().Str("room_id", roomID).Str("session_id", sessionID).Msg("stopped watching segments")
+		l.Info().Str("room_id", roomID).Str("session_id", sessionID).Str("watch_key", k).Msg("stopped watching segments")
 	}
 }
 
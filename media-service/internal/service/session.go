@@ -57,6 +57,10 @@ type VODSession struct {
 	// S3Prefix is the S3 key prefix for this session's VOD files.
 	// Format: vod/room_{roomID}/{sessionID}/
 	S3Prefix string `json:"s3_prefix"`
+
+	// InstanceID identifies the media-service instance recording this session.
+	// Used on restart to find sessions orphaned by a crash of this instance.
+	InstanceID string `json:"instance_id,omitempty"`
 }
 
 // IsActive returns true if the session is in an active state (not completed).
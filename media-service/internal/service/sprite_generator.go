@@ -0,0 +1,370 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/weiawesome/wes-io-live/media-service/internal/config"
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+)
+
+const (
+	spriteTrackFile = "thumbnails.vtt"
+
+	// spriteQueueSize bounds the segments waiting for frame capture per session.
+	spriteQueueSize = 64
+
+	// spriteFinishTimeout bounds how long finalizing a session waits for queued captures.
+	spriteFinishTimeout = 60 * time.Second
+)
+
+// SegmentObserver receives the primary stream's segments of recorded sessions.
+type SegmentObserver interface {
+	// OnSegment is called for every new segment, start is its offset into the recording in seconds.
+	OnSegment(roomID, sessionID string, seg SegmentInfo, start float64)
+	// OnSessionEnd is called when a recording is finalized, before its local files are removed.
+	OnSessionEnd(roomID, sessionID string)
+}
+
+// SpriteGenerator captures frames at fixed intervals of a recording, tiles them into sprite sheets
+// and uploads the sheets with a WebVTT thumbnails track to preview/room_{roomID}/{sessionID}/.
+// Frames are taken from the local segments as they are produced, so cue times match the VOD timeline.
+type SpriteGenerator struct {
+	cfg          config.SpriteConfig
+	hlsOutputDir string
+	uploader     *S3Uploader
+	keys         *ContentKeys
+
+	sessions map[string]*spriteSession
+	mu       sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// SpriteGeneratorConfig holds configuration for the sprite generator.
+type SpriteGeneratorConfig struct {
+	SpriteConfig config.SpriteConfig
+	HLSOutputDir string
+	Uploader     *S3Uploader
+	Keys         *ContentKeys // Local content keys of encrypted output, nil if disabled
+}
+
+// spriteSession holds the sprite sheets of a single recording.
+type spriteSession struct {
+	roomID    string
+	sessionID string
+	segments  chan spriteSegment
+	done      chan struct{}
+
+	initSegment string  // Guarded by SpriteGenerator.mu
+	lastIndex   int     // Guarded by SpriteGenerator.mu
+	nextCapture float64 // Recording offset of the next frame
+	end         float64 // Recording offset reached so far
+
+	sheet      *image.RGBA
+	sheetIndex int
+	tiles      int // Tiles drawn on the current sheet
+	cues       []spriteCue
+}
+
+// spriteSegment is a segment queued for frame capture.
+type spriteSegment struct {
+	filename string
+	start    float64
+	duration float64
+	key      string // EXT-X-KEY attributes, empty if clear
+}
+
+// spriteCue is a thumbnail track cue pointing at a tile of a sprite sheet.
+type spriteCue struct {
+	start, end float64
+	sheet      string
+	x, y, w, h int
+}
+
+// NewSpriteGenerator creates a new sprite generator.
+func NewSpriteGenerator(cfg SpriteGeneratorConfig) *SpriteGenerator {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &SpriteGenerator{
+		cfg:          cfg.SpriteConfig,
+		hlsOutputDir: cfg.HLSOutputDir,
+		uploader:     cfg.Uploader,
+		keys:         cfg.Keys,
+		sessions:     make(map[string]*spriteSession),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// OnSegment queues a segment for frame capture.
+func (g *SpriteGenerator) OnSegment(roomID, sessionID string, seg SegmentInfo, start float64) {
+	key := sessionKey(roomID, sessionID)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.ctx.Err() != nil {
+		return
+	}
+
+	session, exists := g.sessions[key]
+	if !exists {
+		session = &spriteSession{
+			roomID:    roomID,
+			sessionID: sessionID,
+			segments:  make(chan spriteSegment, spriteQueueSize),
+			done:      make(chan struct{}),
+			lastIndex: -1,
+		}
+		g.sessions[key] = session
+		go g.run(session)
+	}
+
+	if seg.IsInit {
+		session.initSegment = seg.Filename
+		return
+	}
+
+	// The segment watcher may report a segment again
+	if seg.Index <= session.lastIndex {
+		return
+	}
+	session.lastIndex = seg.Index
+
+	select {
+	case session.segments <- spriteSegment{filename: seg.Filename, start: start, duration: seg.Duration, key: seg.Key}:
+	default:
+		l := pkglog.L()
+		l.Warn().Str("room_id", roomID).Str("segment", seg.Filename).Msg("sprite capture backed up, skipping segment")
+	}
+}
+
+// OnSessionEnd waits for queued captures and uploads the last sprite sheet and the final track.
+func (g *SpriteGenerator) OnSessionEnd(roomID, sessionID string) {
+	key := sessionKey(roomID, sessionID)
+
+	g.mu.Lock()
+	session, exists := g.sessions[key]
+	if exists {
+		delete(g.sessions, key)
+		close(session.segments)
+	}
+	g.mu.Unlock()
+
+	if !exists {
+		return
+	}
+
+	select {
+	case <-session.done:
+	case <-time.After(spriteFinishTimeout):
+		l := pkglog.L()
+		l.Warn().Str("room_id", roomID).Str("session_id", sessionID).Msg("timed out waiting for sprite capture")
+	}
+}
+
+// Stop stops all sprite sessions without uploading their remaining sheets.
+func (g *SpriteGenerator) Stop() {
+	g.cancel()
+
+	g.mu.Lock()
+	for key, session := range g.sessions {
+		close(session.segments)
+		delete(g.sessions, key)
+	}
+	g.mu.Unlock()
+}
+
+// run captures the queued segments of a session, then flushes its last sheet.
+func (g *SpriteGenerator) run(session *spriteSession) {
+	defer close(session.done)
+
+	for seg := range session.segments {
+		if g.ctx.Err() != nil {
+			continue
+		}
+		g.captureSegment(session, seg)
+	}
+
+	if g.ctx.Err() == nil && session.tiles > 0 {
+		g.flushSheet(session)
+	}
+}
+
+// captureSegment draws a tile for every capture point falling within the segment.
+func (g *SpriteGenerator) captureSegment(session *spriteSession, seg spriteSegment) {
+	interval := float64(g.cfg.IntervalSeconds)
+	segEnd := seg.start + seg.duration
+	if segEnd > session.end {
+		session.end = segEnd
+	}
+
+	g.mu.Lock()
+	initSegment := session.initSegment
+	g.mu.Unlock()
+
+	l := pkglog.L()
+	for session.nextCapture < segEnd {
+		at := session.nextCapture
+		session.nextCapture += interval
+		if at < seg.start {
+			// Frames of skipped segments are lost, keep the timeline aligned
+			continue
+		}
+
+		frame, err := g.captureFrame(session, initSegment, seg, at-seg.start)
+		if err != nil {
+			l.Debug().Err(err).Str("room_id", session.roomID).Str("segment", seg.filename).Msg("failed to capture sprite frame")
+			continue
+		}
+
+		if session.sheet == nil {
+			session.sheet = image.NewRGBA(image.Rect(0, 0, g.cfg.Width*g.cfg.Columns, g.cfg.Height*g.cfg.Rows))
+		}
+		x := (session.tiles % g.cfg.Columns) * g.cfg.Width
+		y := (session.tiles / g.cfg.Columns) * g.cfg.Height
+		draw.Draw(session.sheet, image.Rect(x, y, x+g.cfg.Width, y+g.cfg.Height), frame, frame.Bounds().Min, draw.Src)
+
+		session.cues = append(session.cues, spriteCue{
+			start: at,
+			end:   at + interval,
+			sheet: spriteSheetName(session.sheetIndex),
+			x:     x,
+			y:     y,
+			w:     g.cfg.Width,
+			h:     g.cfg.Height,
+		})
+		session.tiles++
+
+		if session.tiles == g.cfg.Columns*g.cfg.Rows {
+			g.flushSheet(session)
+		}
+	}
+}
+
+// captureFrame extracts a single scaled frame at the given offset into a segment.
+func (g *SpriteGenerator) captureFrame(session *spriteSession, initSegment string, seg spriteSegment, offset float64) (image.Image, error) {
+	dir := filepath.Join(g.hlsOutputDir, "room_"+session.roomID, session.sessionID)
+	var files []segmentFile
+	if initSegment != "" {
+		// fMP4 fragments are not self-contained
+		files = append(files, segmentFile{path: filepath.Join(dir, initSegment)})
+	}
+	files = append(files, segmentFile{path: filepath.Join(dir, seg.filename), key: seg.key})
+
+	input, stdin, err := ffmpegSegmentInput(g.keys, session.roomID, session.sessionID, files)
+	if err != nil {
+		return nil, err
+	}
+
+	scaleFilter := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2",
+		g.cfg.Width, g.cfg.Height, g.cfg.Width, g.cfg.Height)
+
+	args := []string{
+		"-y",
+		"-i", input,
+		"-ss", fmt.Sprintf("%.3f", offset),
+		"-vframes", "1",
+		"-vf", scaleFilter,
+		"-f", "image2pipe",
+		"-vcodec", "mjpeg",
+		"pipe:1",
+	}
+
+	cmdCtx, cancel := context.WithTimeout(g.ctx, 15*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(cmdCtx, "ffmpeg", args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w (stderr: %s)", err, stderr.String())
+	}
+
+	frame, err := jpeg.Decode(&stdout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode frame: %w", err)
+	}
+	return frame, nil
+}
+
+// flushSheet uploads the current sprite sheet and the thumbnails track covering it,
+// then starts a new sheet.
+func (g *SpriteGenerator) flushSheet(session *spriteSession) {
+	l := pkglog.L()
+	prefix := fmt.Sprintf("preview/room_%s/%s/", session.roomID, session.sessionID)
+
+	// Crop the unused rows of a partially filled sheet
+	rows := (session.tiles + g.cfg.Columns - 1) / g.cfg.Columns
+	sheet := session.sheet.SubImage(image.Rect(0, 0, g.cfg.Width*g.cfg.Columns, g.cfg.Height*rows))
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, sheet, &jpeg.Options{Quality: g.cfg.Quality}); err != nil {
+		l.Error().Err(err).Str("room_id", session.roomID).Msg("failed to encode sprite sheet")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(g.ctx, 30*time.Second)
+	defer cancel()
+
+	sheetKey := prefix + spriteSheetName(session.sheetIndex)
+	if err := g.uploader.UploadReader(ctx, bytes.NewReader(buf.Bytes()), int64(buf.Len()), sheetKey, "image/jpeg"); err != nil {
+		l.Error().Err(err).Str("room_id", session.roomID).Str("key", sheetKey).Msg("failed to upload sprite sheet")
+		return
+	}
+
+	track := generateThumbnailTrack(session.cues, session.end)
+	if err := g.uploader.UploadReader(ctx, bytes.NewReader(track), int64(len(track)), prefix+spriteTrackFile, "text/vtt"); err != nil {
+		l.Error().Err(err).Str("room_id", session.roomID).Msg("failed to upload thumbnails track")
+	}
+
+	l.Info().Str("room_id", session.roomID).Str("session_id", session.sessionID).Int("sheet", session.sheetIndex).Int("tiles", session.tiles).Msg("sprite sheet uploaded")
+
+	session.sheet = nil
+	session.sheetIndex++
+	session.tiles = 0
+}
+
+// spriteSheetName returns the filename of a sprite sheet.
+func spriteSheetName(index int) string {
+	return fmt.Sprintf("sprite_%03d.jpg", index)
+}
+
+// generateThumbnailTrack writes a WebVTT thumbnails track. Cues reference sprite tiles with
+// media fragments (sprite_000.jpg#xywh=x,y,w,h); the last cue ends with the recording.
+func generateThumbnailTrack(cues []spriteCue, end float64) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("WEBVTT\n")
+
+	for i, cue := range cues {
+		cueEnd := cue.end
+		if i == len(cues)-1 && end > cue.start && end < cueEnd {
+			cueEnd = end
+		}
+		buf.WriteString("\n")
+		buf.WriteString(fmt.Sprintf("%s --> %s\n", formatVTTTimestamp(cue.start), formatVTTTimestamp(cueEnd)))
+		buf.WriteString(fmt.Sprintf("%s#xywh=%d,%d,%d,%d\n", cue.sheet, cue.x, cue.y, cue.w, cue.h))
+	}
+
+	return buf.Bytes()
+}
+
+// formatVTTTimestamp formats seconds as a WebVTT timestamp (hh:mm:ss.ttt).
+func formatVTTTimestamp(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,441 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/weiawesome/wes-io-live/media-service/internal/config"
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/pkg/pubsub"
+)
+
+// Thresholds for the reported health status.
+const (
+	healthFairPacketLoss = 0.01
+	healthPoorPacketLoss = 0.05
+	healthFairSpeed      = 0.98 // Encoder falling behind realtime
+	healthPoorSpeed      = 0.9
+	healthFairFPS        = 15
+)
+
+// StreamHealthMonitor collects ingest and packaging metrics of live streams, publishes them to
+// the signal channel for the broadcaster and exports them as Prometheus metrics.
+//
+// Ingest bitrate, frame rate and keyframe interval are measured from the RTP packets observed on
+// the peer connection, packet loss and jitter come from its RTCP statistics, encoder speed from
+// FFmpeg's -progress output and segment lag from the age of the live playlist.
+type StreamHealthMonitor struct {
+	transcoder      *Transcoder
+	pubsub          pubsub.PubSub
+	interval        time.Duration
+	segmentDuration float64
+
+	streams map[string]*streamHealth // roomID -> health
+	mu      sync.RWMutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// StreamHealthMonitorConfig holds configuration for the stream health monitor.
+type StreamHealthMonitorConfig struct {
+	HealthConfig    config.HealthConfig
+	Transcoder      *Transcoder
+	PubSub          pubsub.PubSub
+	SegmentDuration int // HLS segment duration in seconds, the reference for segment lag
+}
+
+// streamHealth holds the counters of a single stream between reports.
+type streamHealth struct {
+	roomID    string
+	sessionID string
+	pc        *webrtc.PeerConnection
+	videoSSRC uint32 // Primary video track, 0 until received
+	live      bool
+
+	bytes         uint64
+	frames        int
+	lastTimestamp uint32
+	haveTimestamp bool
+
+	lastKeyframeTS   uint32
+	lastKeyframe     time.Time
+	keyframeInterval float64
+
+	packetsReceived uint32
+	packetsLost     int32
+	lastReport      time.Time
+
+	mu sync.Mutex
+}
+
+// NewStreamHealthMonitor creates a new stream health monitor.
+func NewStreamHealthMonitor(cfg StreamHealthMonitorConfig) *StreamHealthMonitor {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	interval := time.Duration(cfg.HealthConfig.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	return &StreamHealthMonitor{
+		transcoder:      cfg.Transcoder,
+		pubsub:          cfg.PubSub,
+		interval:        interval,
+		segmentDuration: float64(cfg.SegmentDuration),
+		streams:         make(map[string]*streamHealth),
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+}
+
+// Start starts publishing health reports.
+func (m *StreamHealthMonitor) Start() {
+	go m.run()
+}
+
+// Stop stops publishing health reports.
+func (m *StreamHealthMonitor) Stop() {
+	m.cancel()
+}
+
+// Register starts tracking a stream. Any previous state of the room is discarded.
+func (m *StreamHealthMonitor) Register(roomID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streams[roomID] = &streamHealth{roomID: roomID, lastReport: time.Now()}
+}
+
+// Unregister stops tracking a stream and removes its metrics.
+func (m *StreamHealthMonitor) Unregister(roomID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.streams[roomID]; exists {
+		delete(m.streams, roomID)
+		deleteStreamHealthMetrics(roomID)
+	}
+}
+
+// SetPeerConnection sets the ingest peer connection whose statistics are reported.
+func (m *StreamHealthMonitor) SetPeerConnection(roomID string, pc *webrtc.PeerConnection) {
+	if h := m.get(roomID); h != nil {
+		h.mu.Lock()
+		h.pc = pc
+		h.mu.Unlock()
+	}
+}
+
+// SetVideoTrack sets the SSRC of the primary video track.
+func (m *StreamHealthMonitor) SetVideoTrack(roomID string, ssrc uint32) {
+	if h := m.get(roomID); h != nil {
+		h.mu.Lock()
+		h.videoSSRC = ssrc
+		h.haveTimestamp = false
+		h.mu.Unlock()
+	}
+}
+
+// SetLive marks a stream as live, health reports are only published for live streams.
+func (m *StreamHealthMonitor) SetLive(roomID, sessionID string) {
+	if h := m.get(roomID); h != nil {
+		h.mu.Lock()
+		h.sessionID = sessionID
+		h.live = true
+		h.mu.Unlock()
+	}
+}
+
+// RTPObserver returns an observer feeding a room's inbound RTP packets into its counters.
+func (m *StreamHealthMonitor) RTPObserver(roomID string) func(ssrc uint32, mimeType string, header *rtp.Header, payload []byte) {
+	return func(ssrc uint32, mimeType string, header *rtp.Header, payload []byte) {
+		h := m.get(roomID)
+		if h == nil {
+			return
+		}
+
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		h.bytes += uint64(header.MarshalSize() + len(payload))
+		if ssrc != h.videoSSRC || h.videoSSRC == 0 {
+			return
+		}
+
+		// Packets of a frame share its timestamp
+		if !h.haveTimestamp || header.Timestamp != h.lastTimestamp {
+			h.frames++
+			h.lastTimestamp = header.Timestamp
+			h.haveTimestamp = true
+		}
+
+		if isKeyframe(mimeType, payload) && (h.lastKeyframe.IsZero() || header.Timestamp != h.lastKeyframeTS) {
+			now := time.Now()
+			if !h.lastKeyframe.IsZero() {
+				h.keyframeInterval = now.Sub(h.lastKeyframe).Seconds()
+			}
+			h.lastKeyframe = now
+			h.lastKeyframeTS = header.Timestamp
+		}
+	}
+}
+
+// get returns the health state of a room, nil if not tracked.
+func (m *StreamHealthMonitor) get(roomID string) *streamHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.streams[roomID]
+}
+
+// run publishes a health report for every live stream each interval.
+func (m *StreamHealthMonitor) run() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+			m.mu.RLock()
+			streams := make([]*streamHealth, 0, len(m.streams))
+			for _, h := range m.streams {
+				streams = append(streams, h)
+			}
+			m.mu.RUnlock()
+
+			for _, h := range streams {
+				if report := m.report(h); report != nil {
+					m.publish(h, report)
+				}
+			}
+		}
+	}
+}
+
+// report computes the health of a stream since its last report and resets its counters.
+// Returns nil if the stream is not live yet.
+func (m *StreamHealthMonitor) report(h *streamHealth) *pubsub.StreamHealthPayload {
+	h.mu.Lock()
+	if !h.live {
+		h.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(h.lastReport).Seconds()
+	if elapsed <= 0 {
+		h.mu.Unlock()
+		return nil
+	}
+
+	report := &pubsub.StreamHealthPayload{
+		RoomID:           h.roomID,
+		SessionID:        h.sessionID,
+		BitrateKbps:      float64(h.bytes) * 8 / 1000 / elapsed,
+		FPS:              float64(h.frames) / elapsed,
+		KeyframeInterval: h.keyframeInterval,
+		Timestamp:        now.UnixMilli(),
+	}
+	h.bytes = 0
+	h.frames = 0
+	h.lastReport = now
+
+	// Packet loss and jitter of the primary video track from the RTCP statistics
+	if h.pc != nil && h.videoSSRC != 0 {
+		for _, s := range h.pc.GetStats() {
+			inbound, ok := s.(webrtc.InboundRTPStreamStats)
+			if !ok || uint32(inbound.SSRC) != h.videoSSRC {
+				continue
+			}
+			received := inbound.PacketsReceived - h.packetsReceived
+			lost := inbound.PacketsLost - h.packetsLost
+			if lost > 0 && int64(received)+int64(lost) > 0 {
+				report.PacketLoss = float64(lost) / float64(int64(received)+int64(lost))
+			}
+			report.JitterMs = inbound.Jitter * 1000
+			h.packetsReceived = inbound.PacketsReceived
+			h.packetsLost = inbound.PacketsLost
+		}
+	}
+	sessionID := h.sessionID
+	h.mu.Unlock()
+
+	if fps, speed, ok := m.transcoder.Progress(h.roomID, sessionID); ok {
+		report.EncoderFPS = fps
+		report.EncoderSpeed = speed
+	}
+
+	playlist := filepath.Join(m.transcoder.GetSessionDir(h.roomID, sessionID), "stream.m3u8")
+	if info, err := os.Stat(playlist); err == nil {
+		report.SegmentLag = now.Sub(info.ModTime()).Seconds()
+	}
+
+	report.Status, report.Issues = m.classify(report)
+	return report
+}
+
+// classify derives the overall status and its reasons from a health report.
+func (m *StreamHealthMonitor) classify(r *pubsub.StreamHealthPayload) (string, []string) {
+	status := pubsub.StreamHealthGood
+	var issues []string
+	degrade := func(to, issue string) {
+		if to == pubsub.StreamHealthPoor || status == pubsub.StreamHealthGood {
+			status = to
+		}
+		issues = append(issues, issue)
+	}
+
+	switch {
+	case r.BitrateKbps == 0:
+		degrade(pubsub.StreamHealthPoor, "no media received")
+	case r.FPS > 0 && r.FPS < healthFairFPS:
+		degrade(pubsub.StreamHealthFair, fmt.Sprintf("low frame rate (%.0f fps)", r.FPS))
+	}
+
+	switch {
+	case r.PacketLoss >= healthPoorPacketLoss:
+		degrade(pubsub.StreamHealthPoor, fmt.Sprintf("high packet loss (%.1f%%)", r.PacketLoss*100))
+	case r.PacketLoss >= healthFairPacketLoss:
+		degrade(pubsub.StreamHealthFair, fmt.Sprintf("packet loss (%.1f%%)", r.PacketLoss*100))
+	}
+
+	switch {
+	case r.EncoderSpeed > 0 && r.EncoderSpeed < healthPoorSpeed:
+		degrade(pubsub.StreamHealthPoor, fmt.Sprintf("encoder too slow (%.2fx)", r.EncoderSpeed))
+	case r.EncoderSpeed > 0 && r.EncoderSpeed < healthFairSpeed:
+		degrade(pubsub.StreamHealthFair, fmt.Sprintf("encoder behind realtime (%.2fx)", r.EncoderSpeed))
+	}
+
+	if m.segmentDuration > 0 {
+		switch {
+		case r.SegmentLag > 3*m.segmentDuration:
+			degrade(pubsub.StreamHealthPoor, fmt.Sprintf("segments delayed (%.1fs)", r.SegmentLag))
+		case r.SegmentLag > 2*m.segmentDuration:
+			degrade(pubsub.StreamHealthFair, fmt.Sprintf("segments delayed (%.1fs)", r.SegmentLag))
+		}
+
+		// Passthrough segments can only be cut on keyframes
+		if r.KeyframeInterval > 2*m.segmentDuration {
+			degrade(pubsub.StreamHealthFair, fmt.Sprintf("long keyframe interval (%.1fs)", r.KeyframeInterval))
+		}
+	}
+
+	return status, issues
+}
+
+// publish sends a health report of a stream to the signal channel and updates the Prometheus
+// metrics. Reports of streams unregistered since the snapshot are dropped, setting their gauges
+// would recreate the metrics Unregister removed.
+func (m *StreamHealthMonitor) publish(h *streamHealth, r *pubsub.StreamHealthPayload) {
+	m.mu.RLock()
+	if m.streams[r.RoomID] != h {
+		m.mu.RUnlock()
+		return
+	}
+	streamIngestBitrate.WithLabelValues(r.RoomID).Set(r.BitrateKbps * 1000)
+	streamIngestFPS.WithLabelValues(r.RoomID).Set(r.FPS)
+	streamPacketLoss.WithLabelValues(r.RoomID).Set(r.PacketLoss)
+	streamJitter.WithLabelValues(r.RoomID).Set(r.JitterMs / 1000)
+	streamKeyframeInterval.WithLabelValues(r.RoomID).Set(r.KeyframeInterval)
+	streamEncoderSpeed.WithLabelValues(r.RoomID).Set(r.EncoderSpeed)
+	streamSegmentLag.WithLabelValues(r.RoomID).Set(r.SegmentLag)
+	m.mu.RUnlock()
+
+	l := pkglog.L()
+	if r.Status != pubsub.StreamHealthGood {
+		l.Debug().Str("room_id", r.RoomID).Str("status", r.Status).Str("issues", strings.Join(r.Issues, "; ")).Msg("stream health degraded")
+	}
+
+	event, err := pubsub.NewEvent(pubsub.EventStreamHealth, r.RoomID, r)
+	if err != nil {
+		l.Error().Err(err).Str("room_id", r.RoomID).Msg("failed to create stream health event")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, 5*time.Second)
+	defer cancel()
+
+	if err := m.pubsub.Publish(ctx, pubsub.MediaToSignalChannel(r.RoomID), event); err != nil {
+		l.Warn().Err(err).Str("room_id", r.RoomID).Msg("failed to publish stream health")
+	}
+}
+
+// deleteStreamHealthMetrics removes the metrics of a room.
+func deleteStreamHealthMetrics(roomID string) {
+	streamIngestBitrate.DeleteLabelValues(roomID)
+	streamIngestFPS.DeleteLabelValues(roomID)
+	streamPacketLoss.DeleteLabelValues(roomID)
+	streamJitter.DeleteLabelValues(roomID)
+	streamKeyframeInterval.DeleteLabelValues(roomID)
+	streamEncoderSpeed.DeleteLabelValues(roomID)
+	streamSegmentLag.DeleteLabelValues(roomID)
+}
+
+// isKeyframe returns true if the RTP payload starts a keyframe of the given video codec.
+func isKeyframe(mimeType string, payload []byte) bool {
+	switch {
+	case strings.EqualFold(mimeType, webrtc.MimeTypeH264):
+		return isH264Keyframe(payload)
+	case strings.EqualFold(mimeType, webrtc.MimeTypeVP8):
+		return isVP8Keyframe(payload)
+	case strings.EqualFold(mimeType, webrtc.MimeTypeVP9):
+		return isVP9Keyframe(payload)
+	}
+	return false
+}
+
+// isVP8Keyframe returns true if the RTP payload starts a VP8 key frame (RFC 7741).
+func isVP8Keyframe(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+
+	// Only the first packet of partition 0 carries the frame header
+	if payload[0]&0x10 == 0 || payload[0]&0x07 != 0 {
+		return false
+	}
+
+	offset := 1
+	if payload[0]&0x80 != 0 { // X: extended control bits
+		if len(payload) < 2 {
+			return false
+		}
+		ext := payload[1]
+		offset++
+		if ext&0x80 != 0 { // I: picture ID, 7 or 15 bits
+			if len(payload) <= offset {
+				return false
+			}
+			if payload[offset]&0x80 != 0 {
+				offset++
+			}
+			offset++
+		}
+		if ext&0x40 != 0 { // L: TL0PICIDX
+			offset++
+		}
+		if ext&0x30 != 0 { // T/K: TID/KEYIDX
+			offset++
+		}
+	}
+
+	// Inverse key frame flag of the VP8 frame header
+	return len(payload) > offset && payload[offset]&0x01 == 0
+}
+
+// isVP9Keyframe returns true if the RTP payload starts a VP9 frame without inter-picture prediction.
+func isVP9Keyframe(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	// B: start of frame, P: inter-picture predicted
+	return payload[0]&0x08 != 0 && payload[0]&0x40 == 0
+}
@@ -1,12 +1,16 @@
 package service
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,6 +23,7 @@ type ThumbnailService struct {
 	cfg          config.PreviewConfig
 	hlsOutputDir string
 	uploader     *S3Uploader
+	keys         *ContentKeys
 
 	// Active capture sessions: roomID:sessionID -> captureSession
 	sessions map[string]*captureSession
@@ -38,8 +43,9 @@ type captureSession struct {
 // ThumbnailServiceConfig holds configuration for thumbnail service.
 type ThumbnailServiceConfig struct {
 	PreviewConfig config.PreviewConfig
-	HLSOutputDir  string      // HLS output directory for capturing thumbnails
-	Uploader      *S3Uploader // Shared uploader from VODManager
+	HLSOutputDir  string       // HLS output directory for capturing thumbnails
+	Uploader      *S3Uploader  // Shared uploader from VODManager
+	Keys          *ContentKeys // Local content keys of encrypted output, nil if disabled
 }
 
 // NewThumbnailService creates a new thumbnail service.
@@ -50,6 +56,7 @@ func NewThumbnailService(cfg ThumbnailServiceConfig) *ThumbnailService {
 		cfg:          cfg.PreviewConfig,
 		hlsOutputDir: cfg.HLSOutputDir,
 		uploader:     cfg.Uploader,
+		keys:         cfg.Keys,
 		sessions:     make(map[string]*captureSession),
 		ctx:          ctx,
 		cancel:       cancel,
@@ -133,7 +140,7 @@ func (s *ThumbnailService) captureLoop(ctx context.Context, session *captureSess
 	}
 
 	// Capture first thumbnail
-	s.captureThumbnailFromHLS(ctx, session)
+	s.capturePreviews(ctx, session)
 
 	// Then capture every interval_seconds
 	ticker := time.NewTicker(time.Duration(s.cfg.IntervalSeconds) * time.Second)
@@ -144,11 +151,19 @@ func (s *ThumbnailService) captureLoop(ctx context.Context, session *captureSess
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			s.captureThumbnailFromHLS(ctx, session)
+			s.capturePreviews(ctx, session)
 		}
 	}
 }
 
+// capturePreviews captures the thumbnail and, if enabled, the animated preview.
+func (s *ThumbnailService) capturePreviews(ctx context.Context, session *captureSession) {
+	s.captureThumbnailFromHLS(ctx, session)
+	if s.cfg.Animated.Enabled {
+		s.captureAnimatedFromHLS(ctx, session)
+	}
+}
+
 // captureThumbnailFromHLS captures a single thumbnail from HLS stream.
 // Returns true if successful, false otherwise.
 func (s *ThumbnailService) captureThumbnailFromHLS(ctx context.Context, session *captureSession) bool {
@@ -165,8 +180,12 @@ func (s *ThumbnailService) captureThumbnailFromHLS(ctx context.Context, session
 		return false
 	}
 
-	// Capture frame from HLS using FFmpeg
-	jpegData, err := s.captureFromHLS(ctx, m3u8Path)
+	// Capture frame from the live edge of the HLS stream using FFmpeg
+	input, stdin, err := s.latestSegmentInput(session, hlsDir, m3u8Path)
+	if err != nil {
+		return false
+	}
+	jpegData, err := s.captureFromHLS(ctx, input, stdin)
 	if err != nil {
 		// Don't log error for first attempts (HLS might not be ready)
 		return false
@@ -189,8 +208,72 @@ func (s *ThumbnailService) captureThumbnailFromHLS(ctx context.Context, session
 	return true
 }
 
-// captureFromHLS captures a frame from HLS stream using FFmpeg.
-func (s *ThumbnailService) captureFromHLS(ctx context.Context, m3u8Path string) ([]byte, error) {
+// latestSegmentInput returns an FFmpeg input for the newest segment listed in the playlist.
+// fMP4 fragments are not self-contained, so the init segment is prepended via the concat protocol.
+// Falls back to the playlist itself if no segment can be resolved.
+func (s *ThumbnailService) latestSegmentInput(session *captureSession, hlsDir, m3u8Path string) (string, io.Reader, error) {
+	return s.latestSegmentsInput(session, hlsDir, m3u8Path, 0)
+}
+
+// latestSegmentsInput returns an FFmpeg input for the newest segments listed in the playlist
+// covering at least the given number of seconds (at least one segment).
+// Encrypted segments are decrypted and must be fed to FFmpeg from the returned reader.
+func (s *ThumbnailService) latestSegmentsInput(session *captureSession, hlsDir, m3u8Path string, seconds float64) (string, io.Reader, error) {
+	file, err := os.Open(m3u8Path)
+	if err != nil {
+		return m3u8Path, nil, nil
+	}
+	defer file.Close()
+
+	var initSegment string
+	var segments []string
+	var keys []string
+	var durations []float64
+	var duration float64
+	var key string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#EXT-X-MAP:") {
+			initSegment = parseMapURI(line)
+		} else if strings.HasPrefix(line, "#EXT-X-KEY:") {
+			key = parseKeyTag(line)
+		} else if strings.HasPrefix(line, "#EXTINF:") {
+			durationStr := strings.TrimSuffix(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			if d, err := strconv.ParseFloat(durationStr, 64); err == nil {
+				duration = d
+			}
+		} else if isMediaSegment(line) {
+			segments = append(segments, line)
+			keys = append(keys, key)
+			durations = append(durations, duration)
+		}
+	}
+
+	if len(segments) == 0 {
+		return m3u8Path, nil, nil
+	}
+
+	first := len(segments) - 1
+	for covered := durations[first]; first > 0 && covered < seconds; {
+		first--
+		covered += durations[first]
+	}
+
+	files := make([]segmentFile, 0, len(segments)-first+1)
+	if initSegment != "" {
+		files = append(files, segmentFile{path: filepath.Join(hlsDir, initSegment)})
+	}
+	for i := first; i < len(segments); i++ {
+		files = append(files, segmentFile{path: filepath.Join(hlsDir, segments[i]), key: keys[i]})
+	}
+
+	return ffmpegSegmentInput(s.keys, session.roomID, session.sessionID, files)
+}
+
+// captureFromHLS captures a frame from an HLS playlist or segment using FFmpeg.
+// stdin feeds a "pipe:0" input, nil otherwise.
+func (s *ThumbnailService) captureFromHLS(ctx context.Context, input string, stdin io.Reader) ([]byte, error) {
 	// Calculate quality for JPEG output
 	// FFmpeg mjpeg uses -q:v (2-31, lower is better)
 	// Config quality is 0-100 (higher is better)
@@ -209,7 +292,7 @@ func (s *ThumbnailService) captureFromHLS(ctx context.Context, m3u8Path string)
 
 	args := []string{
 		"-y",
-		"-i", m3u8Path,
+		"-i", input,
 		"-vframes", "1",
 		"-vf", scaleFilter,
 		"-q:v", fmt.Sprintf("%d", quality),
@@ -224,6 +307,111 @@ func (s *ThumbnailService) captureFromHLS(ctx context.Context, m3u8Path string)
 	cmd := exec.CommandContext(cmdCtx, "ffmpeg", args...)
 
 	var stdout, stderr bytes.Buffer
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w (stderr: %s)", err, stderr.String())
+	}
+
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("ffmpeg produced no output")
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// captureAnimatedFromHLS encodes a short loop from the live edge of the HLS stream and uploads it
+// next to the thumbnail as animated.webp or animated.mp4.
+func (s *ThumbnailService) captureAnimatedFromHLS(ctx context.Context, session *captureSession) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	hlsDir := filepath.Join(s.hlsOutputDir, "room_"+session.roomID, session.sessionID)
+	m3u8Path := filepath.Join(hlsDir, "stream.m3u8")
+
+	if _, err := os.Stat(m3u8Path); os.IsNotExist(err) {
+		return false
+	}
+
+	cfg := s.cfg.Animated
+	l := pkglog.L()
+	input, stdin, err := s.latestSegmentsInput(session, hlsDir, m3u8Path, float64(cfg.DurationSeconds))
+	if err != nil {
+		l.Debug().Err(err).Str("room_id", session.roomID).Msg("failed to read segments for animated preview")
+		return false
+	}
+
+	data, err := s.encodeAnimated(ctx, input, stdin)
+	if err != nil {
+		l.Debug().Err(err).Str("room_id", session.roomID).Msg("failed to encode animated preview")
+		return false
+	}
+
+	filename, contentType := "animated.webp", "image/webp"
+	if cfg.Format == "mp4" {
+		filename, contentType = "animated.mp4", "video/mp4"
+	}
+	s3Key := fmt.Sprintf("preview/room_%s/%s/%s", session.roomID, session.sessionID, filename)
+
+	uploadCtx, uploadCancel := context.WithTimeout(ctx, 30*time.Second)
+	defer uploadCancel()
+
+	if err := s.uploader.UploadReader(uploadCtx, bytes.NewReader(data), int64(len(data)), s3Key, contentType); err != nil {
+		l.Error().Err(err).Str("room_id", session.roomID).Msg("failed to upload animated preview")
+		return false
+	}
+
+	l.Info().Str("room_id", session.roomID).Str("session_id", session.sessionID).Int("bytes", len(data)).Msg("animated preview uploaded")
+	return true
+}
+
+// encodeAnimated encodes a muted loop from an HLS playlist or segments using FFmpeg.
+// stdin feeds a "pipe:0" input, nil otherwise.
+func (s *ThumbnailService) encodeAnimated(ctx context.Context, input string, stdin io.Reader) ([]byte, error) {
+	cfg := s.cfg.Animated
+
+	filter := fmt.Sprintf("fps=%d,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2",
+		cfg.FPS, cfg.Width, cfg.Height, cfg.Width, cfg.Height)
+
+	args := []string{
+		"-y",
+		"-i", input,
+		"-t", fmt.Sprintf("%d", cfg.DurationSeconds),
+		"-vf", filter,
+		"-an",
+	}
+
+	if cfg.Format == "mp4" {
+		// CRF 18-51 from quality 100-0; fragmented so the MP4 can be written to a pipe
+		crf := 18 + (100-cfg.Quality)*33/100
+		args = append(args,
+			"-c:v", "libx264",
+			"-preset", "veryfast",
+			"-crf", fmt.Sprintf("%d", crf),
+			"-pix_fmt", "yuv420p",
+			"-movflags", "frag_keyframe+empty_moov+default_base_moof",
+			"-f", "mp4",
+		)
+	} else {
+		args = append(args,
+			"-c:v", "libwebp",
+			"-quality", fmt.Sprintf("%d", cfg.Quality),
+			"-loop", "0",
+			"-f", "webp",
+		)
+	}
+	args = append(args, "pipe:1")
+
+	cmdCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(cmdCtx, "ffmpeg", args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = stdin
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
@@ -10,7 +10,9 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
+	"github.com/pion/rtp"
 	"github.com/pion/rtp/codecs"
 	"github.com/pion/webrtc/v4"
 	"github.com/pion/webrtc/v4/pkg/media/ivfwriter"
@@ -47,30 +49,57 @@ func ffmpegLogWriter(roomID, sessionID string) io.Writer {
 	return pw
 }
 
+// initSegmentFilename is the name of the fMP4 initialization segment referenced by EXT-X-MAP.
+// Resumed connections write their own init segment (init_1.mp4, init_2.mp4, ...), see initSegmentName.
+const initSegmentFilename = "init.mp4"
+
+// initSegmentName returns the init segment name of the next FFmpeg process writing into outputDir.
+// Every connection gets its own name, a resumed encoder may change the codec parameters and the
+// init segments of earlier connections stay referenced (and cached) by their segments.
+func initSegmentName(outputDir string) string {
+	existing, _ := filepath.Glob(filepath.Join(outputDir, "init*.mp4"))
+	if len(existing) == 0 {
+		return initSegmentFilename
+	}
+	return fmt.Sprintf("init_%d.mp4", len(existing))
+}
+
 // Transcoder handles video transcoding to HLS.
 type Transcoder struct {
 	config    config.HLSConfig
 	ffmpegCfg config.FFmpegConfig
+	encoders  *EncoderRegistry
+	keys      *ContentKeys // nil when output is never encrypted
 
 	processes map[string]*transcoderProcess
 	mu        sync.RWMutex
 }
 
 type transcoderProcess struct {
-	roomID    string
-	cmd       *exec.Cmd
-	stdinPipe io.WriteCloser
-	outputDir string
-	videoPipe string
-	audioPipe string
-	done      chan struct{}
+	roomID     string
+	cmd        *exec.Cmd
+	stdinPipe  io.WriteCloser
+	outputDir  string
+	videoPipe  string
+	audioPipe  string
+	audio      *rtpFanout                    // shared audio source, nil when broadcasting without audio
+	codecs     string                        // RFC 6381 codecs string of the HLS output
+	renditions map[string]*transcoderProcess // simulcast passthrough renditions by layer (rid)
+	progress   *ffmpegProgress               // -progress reports of the main HLS process
+	keys       *keyRotation                  // content key rotation, nil for clear output
+	resumed    bool                          // appends to the output of a previous connection
+	done       chan struct{}
 }
 
 // NewTranscoder creates a new Transcoder.
-func NewTranscoder(hlsCfg config.HLSConfig, ffmpegCfg config.FFmpegConfig) *Transcoder {
+// Video is encoded with the room's profile from encoders. Segments of the rooms keys encrypts
+// are encrypted with AES-128, keys may be nil if encryption is disabled.
+func NewTranscoder(hlsCfg config.HLSConfig, ffmpegCfg config.FFmpegConfig, encoders *EncoderRegistry, keys *ContentKeys) *Transcoder {
 	return &Transcoder{
 		config:    hlsCfg,
 		ffmpegCfg: ffmpegCfg,
+		encoders:  encoders,
+		keys:      keys,
 		processes: make(map[string]*transcoderProcess),
 	}
 }
@@ -105,49 +134,79 @@ func (t *Transcoder) cleanupPipes(process *transcoderProcess) {
 	}
 }
 
-// buildVideoArgs builds FFmpeg video encoding arguments based on config.
-func (t *Transcoder) buildVideoArgs() []string {
-	args := []string{
-		"-c:v", t.ffmpegCfg.VideoCodec,
-		"-preset", t.ffmpegCfg.VideoPreset,
-		"-tune", "zerolatency",
-		"-profile:v", "baseline",
-		"-level", "3.0",
-		"-pix_fmt", "yuv420p",
-	}
+// CodecString returns the RFC 6381 codecs string of the default profile's output,
+// as advertised in DASH manifests and HLS master playlists.
+func (t *Transcoder) CodecString() string {
+	return t.withAudioCodec(t.encoders.Default().CodecString(), true)
+}
 
-	// Video bitrate or CRF
-	if t.ffmpegCfg.VideoBitrate != "" {
-		args = append(args, "-b:v", t.ffmpegCfg.VideoBitrate)
-	} else if t.ffmpegCfg.VideoCRF > 0 {
-		args = append(args, "-crf", fmt.Sprintf("%d", t.ffmpegCfg.VideoCRF))
+// withAudioCodec appends the audio codec to a video codecs string if the output has AAC audio.
+func (t *Transcoder) withAudioCodec(videoCodecs string, hasAudio bool) string {
+	if hasAudio && t.ffmpegCfg.AudioCodec == "aac" {
+		return videoCodecs + ",mp4a.40.2"
 	}
+	return videoCodecs
+}
+
+// StreamCodecString returns the RFC 6381 codecs string of a running stream's HLS output,
+// which differs from CodecString when the stream is passed through without encoding.
+func (t *Transcoder) StreamCodecString(roomID, sessionID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
-	// Resolution scaling
-	if t.ffmpegCfg.Width > 0 && t.ffmpegCfg.Height > 0 {
-		// Scale to exact resolution
-		args = append(args, "-vf", fmt.Sprintf("scale=%d:%d", t.ffmpegCfg.Width, t.ffmpegCfg.Height))
-	} else if t.ffmpegCfg.Width > 0 {
-		// Scale width, keep aspect ratio
-		args = append(args, "-vf", fmt.Sprintf("scale=%d:-2", t.ffmpegCfg.Width))
-	} else if t.ffmpegCfg.Height > 0 {
-		// Scale height, keep aspect ratio
-		args = append(args, "-vf", fmt.Sprintf("scale=-2:%d", t.ffmpegCfg.Height))
+	processKey := roomID
+	if sessionID != "" {
+		processKey = roomID + ":" + sessionID
+	}
+	if process, exists := t.processes[processKey]; exists && process.codecs != "" {
+		return process.codecs
 	}
+	return t.CodecString()
+}
 
-	// Framerate
-	if t.ffmpegCfg.Framerate > 0 {
-		args = append(args, "-r", fmt.Sprintf("%d", t.ffmpegCfg.Framerate))
+// videoInputFormat returns the FFmpeg demuxer for the elementary stream written for a codec.
+func videoInputFormat(codec webrtc.RTPCodecParameters) string {
+	if codec.MimeType == webrtc.MimeTypeH264 {
+		return "h264" // Annex B byte stream
 	}
+	return "ivf"
+}
+
+// buildHLSArgs builds the FFmpeg HLS muxer arguments writing stream.m3u8 and its segments into outputDir.
+// Segments are encrypted with the key of keyInfoFile unless it is empty.
+func (t *Transcoder) buildHLSArgs(outputDir, keyInfoFile string) []string {
+	outputPath := filepath.Join(outputDir, "stream.m3u8")
+	segmentPath := filepath.Join(outputDir, "segment_%03d"+t.config.SegmentExtension())
 
-	// GOP size (keyframe interval) - use framerate or default to 30
-	gop := 30
-	if t.ffmpegCfg.Framerate > 0 {
-		gop = t.ffmpegCfg.Framerate
+	hlsFlags := "delete_segments+append_list"
+	if !t.config.DeleteSegments {
+		hlsFlags = "append_list"
+	}
+	if keyInfoFile != "" {
+		// Re-read the key info file before every segment, so replacing it rotates the key
+		hlsFlags += "+periodic_rekey"
 	}
-	args = append(args, "-g", fmt.Sprintf("%d", gop))
 
-	return args
+	args := []string{
+		"-f", "hls",
+		"-hls_time", fmt.Sprintf("%d", t.config.SegmentDuration),
+		"-hls_list_size", fmt.Sprintf("%d", t.config.PlaylistSize),
+		"-hls_flags", hlsFlags,
+	}
+	if t.config.IsFMP4() {
+		// CMAF output: fragmented MP4 segments sharing the init segment of their connection (EXT-X-MAP)
+		args = append(args,
+			"-hls_segment_type", "fmp4",
+			"-hls_fmp4_init_filename", initSegmentName(outputDir),
+		)
+	}
+	if keyInfoFile != "" {
+		args = append(args, "-hls_key_info_file", keyInfoFile)
+	}
+	return append(args,
+		"-hls_segment_filename", segmentPath,
+		outputPath,
+	)
 }
 
 // buildAudioArgs builds FFmpeg audio encoding arguments based on config.
@@ -174,6 +233,40 @@ func (t *Transcoder) buildAudioArgs() []string {
 // StartHLS starts HLS transcoding for a room with optional audio.
 // If sessionID is provided, outputs to room_{roomID}/{sessionID}/ directory.
 func (t *Transcoder) StartHLS(roomID, sessionID string, videoTrack, audioTrack *webrtc.TrackRemote) (string, error) {
+	return t.startHLS(roomID, sessionID, videoTrack, audioTrack, false)
+}
+
+// ResumeHLS continues the HLS output of a room/session with the tracks of a new connection.
+// The FFmpeg process of the dropped connection is given time to flush its last segment, then the
+// new process appends to the existing playlist (append_list), which marks the first new segment
+// with EXT-X-DISCONTINUITY and continues the segment numbering.
+func (t *Transcoder) ResumeHLS(roomID, sessionID string, videoTrack, audioTrack *webrtc.TrackRemote) (string, error) {
+	processKey := roomID
+	if sessionID != "" {
+		processKey = roomID + ":" + sessionID
+	}
+
+	t.mu.RLock()
+	previous, exists := t.processes[processKey]
+	t.mu.RUnlock()
+
+	if exists {
+		select {
+		case <-previous.done:
+		case <-time.After(resumeFlushTimeout):
+			t.StopHLS(roomID, sessionID)
+			<-previous.done
+		}
+	}
+
+	return t.startHLS(roomID, sessionID, videoTrack, audioTrack, true)
+}
+
+// resumeFlushTimeout is how long ResumeHLS waits for the previous FFmpeg process to exit.
+const resumeFlushTimeout = 5 * time.Second
+
+// startHLS starts the HLS process of a room/session, appending to its existing output if resume is set.
+func (t *Transcoder) startHLS(roomID, sessionID string, videoTrack, audioTrack *webrtc.TrackRemote, resume bool) (string, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -199,70 +292,97 @@ func (t *Transcoder) StartHLS(roomID, sessionID string, videoTrack, audioTrack *
 		return "", fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Clean existing files
-	t.cleanDir(outputDir)
-
-	outputPath := filepath.Join(outputDir, "stream.m3u8")
-	segmentPath := filepath.Join(outputDir, "segment_%03d.ts")
-
-	hlsFlags := "delete_segments+append_list"
-	if !t.config.DeleteSegments {
-		hlsFlags = "append_list"
+	// Clean existing files, resumed sessions append to them
+	if !resume {
+		t.cleanDir(outputDir)
 	}
 
 	var process *transcoderProcess
 	var cmd *exec.Cmd
 
+	// Encrypted output starts with a fresh key
+	var keys *keyRotation
+	keyInfoFile := ""
+	if t.keys != nil && t.keys.Encrypts(roomID) {
+		var err error
+		if keys, err = t.keys.Start(roomID, sessionID); err != nil {
+			return "", fmt.Errorf("failed to start content encryption: %w", err)
+		}
+		keyInfoFile = keys.infoFile
+	}
+
 	// Build common HLS arguments
-	hlsArgs := []string{
-		"-vsync", "cfr", // Constant frame rate output for sync
-		"-f", "hls",
-		"-hls_time", fmt.Sprintf("%d", t.config.SegmentDuration),
-		"-hls_list_size", fmt.Sprintf("%d", t.config.PlaylistSize),
-		"-hls_flags", hlsFlags,
-		"-hls_segment_filename", segmentPath,
-		outputPath,
+	hlsArgs := append([]string{"-vsync", "cfr"}, t.buildHLSArgs(outputDir, keyInfoFile)...) // Constant frame rate output for sync
+	encoder := t.encoders.ForRoom(roomID)
+	videoArgs := encoder.VideoArgs()
+	codecString := t.withAudioCodec(encoder.CodecString(), audioTrack != nil)
+
+	// Passthrough: remux HLS-compatible H.264 as-is, anything else falls back to encoding
+	passthrough := t.ffmpegCfg.Passthrough && isHLSCompatibleH264(videoTrack.Codec())
+	if passthrough {
+		hlsArgs = t.buildHLSArgs(outputDir, keyInfoFile)
+		videoArgs = []string{"-c:v", "copy"}
+		codecString = t.withAudioCodec(h264CodecString(videoTrack.Codec().SDPFmtpLine), audioTrack != nil)
+	} else if t.ffmpegCfg.Passthrough {
+		l := pkglog.L()
+		l.Info().Str("room_id", roomID).Str("codec", videoTrack.Codec().MimeType).Str("fmtp", videoTrack.Codec().SDPFmtpLine).Msg("codec not hls compatible, falling back to encoding")
 	}
+	videoFormat := videoInputFormat(videoTrack.Codec())
 
 	if audioTrack != nil {
 		// With audio: use named pipes for both video and audio
 		videoPipe, audioPipe, err := t.createPipes(roomID)
 		if err != nil {
+			keys.Stop()
 			return "", err
 		}
 
 		// Build FFmpeg arguments with audio
 		// Use wallclock timestamps and generate PTS for proper A/V sync
 		args := []string{
+			"-progress", "pipe:1",
 			"-use_wallclock_as_timestamps", "1",
 			"-fflags", "+genpts",
-			"-f", "ivf",
+			"-f", videoFormat,
 			"-i", videoPipe,
 			"-use_wallclock_as_timestamps", "1",
 			"-fflags", "+genpts",
 			"-f", "ogg",
 			"-i", audioPipe,
 		}
-		args = append(args, t.buildVideoArgs()...)
+		args = append(args, videoArgs...)
 		args = append(args, t.buildAudioArgs()...)
 		args = append(args, hlsArgs...)
 
+		progress := &ffmpegProgress{}
 		cmd = exec.Command("ffmpeg", args...)
 		cmd.Stderr = ffmpegLogWriter(roomID, sessionID)
-		cmd.Stdout = io.Discard
+		cmd.Stdout = progress
 
 		if err := cmd.Start(); err != nil {
 			t.cleanupPipes(&transcoderProcess{videoPipe: videoPipe, audioPipe: audioPipe})
+			keys.Stop()
 			return "", fmt.Errorf("failed to start ffmpeg: %w", err)
 		}
 
+		// Audio is read through a fanout so simulcast renditions can share it
+		audio := newRTPFanout(audioTrack)
+		audioPackets, _ := audio.Subscribe(256)
+		go audio.run()
+
 		process = &transcoderProcess{
-			roomID:    roomID,
-			cmd:       cmd,
-			outputDir: outputDir,
-			videoPipe: videoPipe,
-			audioPipe: audioPipe,
-			done:      make(chan struct{}),
+			roomID:     roomID,
+			cmd:        cmd,
+			outputDir:  outputDir,
+			videoPipe:  videoPipe,
+			audioPipe:  audioPipe,
+			audio:      audio,
+			codecs:     codecString,
+			renditions: make(map[string]*transcoderProcess),
+			progress:   progress,
+			keys:       keys,
+			resumed:    resume,
+			done:       make(chan struct{}),
 		}
 
 		t.processes[processKey] = process
@@ -273,25 +393,30 @@ func (t *Transcoder) StartHLS(roomID, sessionID string, videoTrack, audioTrack *
 
 		go func() {
 			<-startSignal
-			t.writeVideoToPipe(roomID, videoTrack, videoPipe, process.done)
+			t.writeVideoToPipe(roomID, videoTrack, videoPipe, passthrough, process.done)
 		}()
 
 		go func() {
 			<-startSignal
-			t.writeAudioToPipe(roomID, audioTrack, audioPipe, process.done)
+			t.writeAudioToPipe(roomID, audioPackets, audioPipe, process.done)
 		}()
 
 		close(startSignal) // Start both goroutines simultaneously
 
 		l := pkglog.L()
-		l.Info().Str("room_id", roomID).Str("session_id", sessionID).Bool("audio", true).Msg("ffmpeg hls transcoding started")
+		l.Info().Str("room_id", roomID).Str("session_id", sessionID).Bool("audio", true).Bool("passthrough", passthrough).Str("profile", encoder.Name()).Msg("ffmpeg hls transcoding started")
 	} else {
 		// Without audio: use stdin pipe for video only
-		args := []string{
-			"-f", "ivf",
-			"-i", "pipe:0",
+		args := []string{"-progress", "pipe:1"}
+		if videoFormat == "h264" {
+			// Raw H.264 carries no timestamps
+			args = append(args, "-use_wallclock_as_timestamps", "1", "-fflags", "+genpts")
 		}
-		args = append(args, t.buildVideoArgs()...)
+		args = append(args,
+			"-f", videoFormat,
+			"-i", "pipe:0",
+		)
+		args = append(args, videoArgs...)
 		args = append(args, "-an")
 		args = append(args, hlsArgs...)
 
@@ -299,31 +424,39 @@ func (t *Transcoder) StartHLS(roomID, sessionID string, videoTrack, audioTrack *
 
 		stdinPipe, err := cmd.StdinPipe()
 		if err != nil {
+			keys.Stop()
 			return "", fmt.Errorf("failed to get stdin pipe: %w", err)
 		}
 
+		progress := &ffmpegProgress{}
 		cmd.Stderr = ffmpegLogWriter(roomID, sessionID)
-		cmd.Stdout = io.Discard
+		cmd.Stdout = progress
 
 		if err := cmd.Start(); err != nil {
+			keys.Stop()
 			return "", fmt.Errorf("failed to start ffmpeg: %w", err)
 		}
 
 		process = &transcoderProcess{
-			roomID:    roomID,
-			cmd:       cmd,
-			stdinPipe: stdinPipe,
-			outputDir: outputDir,
-			done:      make(chan struct{}),
+			roomID:     roomID,
+			cmd:        cmd,
+			stdinPipe:  stdinPipe,
+			outputDir:  outputDir,
+			codecs:     codecString,
+			renditions: make(map[string]*transcoderProcess),
+			progress:   progress,
+			keys:       keys,
+			resumed:    resume,
+			done:       make(chan struct{}),
 		}
 
 		t.processes[processKey] = process
 
 		// Start goroutine to write video frames to FFmpeg
-		go t.writeVideoToFFmpeg(roomID, videoTrack, stdinPipe, process.done)
+		go t.writeVideoToFFmpeg(roomID, videoTrack, stdinPipe, passthrough, process.done)
 
 		l := pkglog.L()
-		l.Info().Str("room_id", roomID).Str("session_id", sessionID).Bool("audio", false).Msg("ffmpeg hls transcoding started")
+		l.Info().Str("room_id", roomID).Str("session_id", sessionID).Bool("audio", false).Bool("passthrough", passthrough).Str("profile", encoder.Name()).Msg("ffmpeg hls transcoding started")
 	}
 
 	// Monitor FFmpeg process
@@ -336,6 +469,7 @@ func (t *Transcoder) StartHLS(roomID, sessionID string, videoTrack, audioTrack *
 			t.cleanupPipes(proc)
 		}
 		t.mu.Unlock()
+		process.keys.Stop()
 		close(process.done)
 		l := pkglog.L()
 		l.Info().Str("room_id", roomID).Str("session_id", sessionID).Msg("ffmpeg process ended")
@@ -367,8 +501,26 @@ func (t *Transcoder) StopHLS(roomID, sessionID string) error {
 		return nil
 	}
 	delete(t.processes, processKey)
+	renditions := make([]*transcoderProcess, 0, len(process.renditions))
+	for name, rendition := range process.renditions {
+		renditions = append(renditions, rendition)
+		delete(process.renditions, name)
+	}
 	t.mu.Unlock()
 
+	// Stop simulcast renditions together with the main process
+	for _, rendition := range renditions {
+		t.killProcess(rendition)
+	}
+	t.killProcess(process)
+
+	l := pkglog.L()
+	l.Info().Str("room_id", roomID).Str("session_id", sessionID).Msg("ffmpeg stopped")
+	return nil
+}
+
+// killProcess signals FFmpeg to finish, kills it and removes its named pipes.
+func (t *Transcoder) killProcess(process *transcoderProcess) {
 	// Close stdin to signal FFmpeg to finish
 	if process.stdinPipe != nil {
 		process.stdinPipe.Close()
@@ -381,14 +533,13 @@ func (t *Transcoder) StopHLS(roomID, sessionID string) error {
 
 	// Cleanup named pipes
 	t.cleanupPipes(process)
-
-	l := pkglog.L()
-	l.Info().Str("room_id", roomID).Str("session_id", sessionID).Msg("ffmpeg stopped")
-	return nil
 }
 
 // CleanupRoom removes HLS files for a room (all sessions).
 func (t *Transcoder) CleanupRoom(roomID string) error {
+	if t.keys != nil {
+		t.keys.Cleanup(roomID, "")
+	}
 	outputDir := filepath.Join(t.config.OutputDir, "room_"+roomID)
 	return os.RemoveAll(outputDir)
 }
@@ -398,11 +549,14 @@ func (t *Transcoder) CleanupSession(roomID, sessionID string) error {
 	if sessionID == "" {
 		return t.CleanupRoom(roomID)
 	}
+	if t.keys != nil {
+		t.keys.Cleanup(roomID, sessionID)
+	}
 	outputDir := filepath.Join(t.config.OutputDir, "room_"+roomID, sessionID)
 	return os.RemoveAll(outputDir)
 }
 
-func (t *Transcoder) writeVideoToFFmpeg(roomID string, track *webrtc.TrackRemote, w io.WriteCloser, done chan struct{}) {
+func (t *Transcoder) writeVideoToFFmpeg(roomID string, track *webrtc.TrackRemote, w io.WriteCloser, passthrough bool, done chan struct{}) {
 	defer w.Close()
 
 	l := pkglog.L()
@@ -414,7 +568,11 @@ func (t *Transcoder) writeVideoToFFmpeg(roomID string, track *webrtc.TrackRemote
 	case webrtc.MimeTypeVP8, webrtc.MimeTypeVP9:
 		t.writeIVF(roomID, track, w, done)
 	case webrtc.MimeTypeH264:
-		t.writeH264(roomID, track, w, done)
+		if passthrough {
+			t.writeH264Passthrough(roomID, track, w)
+		} else {
+			t.writeH264(roomID, track, w, done)
+		}
 	default:
 		l.Warn().Str("room_id", roomID).Str("codec", codec.MimeType).Msg("unsupported codec")
 	}
@@ -477,7 +635,7 @@ func (t *Transcoder) writeH264(roomID string, track *webrtc.TrackRemote, w io.Wr
 	}
 }
 
-func (t *Transcoder) writeVideoToPipe(roomID string, track *webrtc.TrackRemote, pipePath string, done chan struct{}) {
+func (t *Transcoder) writeVideoToPipe(roomID string, track *webrtc.TrackRemote, pipePath string, passthrough bool, done chan struct{}) {
 	l := pkglog.L()
 	f, err := os.OpenFile(pipePath, os.O_WRONLY, os.ModeNamedPipe)
 	if err != nil {
@@ -493,7 +651,11 @@ func (t *Transcoder) writeVideoToPipe(roomID string, track *webrtc.TrackRemote,
 	case webrtc.MimeTypeVP8, webrtc.MimeTypeVP9:
 		t.writeIVFToPipe(roomID, track, f, done)
 	case webrtc.MimeTypeH264:
-		t.writeH264(roomID, track, f, done)
+		if passthrough {
+			t.writeH264Passthrough(roomID, track, f)
+		} else {
+			t.writeH264(roomID, track, f, done)
+		}
 	default:
 		l.Warn().Str("room_id", roomID).Str("codec", codec.MimeType).Msg("unsupported codec")
 	}
@@ -524,7 +686,7 @@ func (t *Transcoder) writeIVFToPipe(roomID string, track *webrtc.TrackRemote, w
 	}
 }
 
-func (t *Transcoder) writeAudioToPipe(roomID string, track *webrtc.TrackRemote, pipePath string, done chan struct{}) {
+func (t *Transcoder) writeAudioToPipe(roomID string, packets <-chan *rtp.Packet, pipePath string, done chan struct{}) {
 	l := pkglog.L()
 	f, err := os.OpenFile(pipePath, os.O_WRONLY, os.ModeNamedPipe)
 	if err != nil {
@@ -542,13 +704,7 @@ func (t *Transcoder) writeAudioToPipe(roomID string, track *webrtc.TrackRemote,
 
 	l.Info().Str("room_id", roomID).Msg("writing audio frames to pipe")
 
-	for {
-		rtpPacket, _, err := track.ReadRTP()
-		if err != nil {
-			l.Error().Err(err).Str("room_id", roomID).Msg("audio rtp read error")
-			return
-		}
-
+	for rtpPacket := range packets {
 		if err := ogg.WriteRTP(rtpPacket); err != nil {
 			l.Error().Err(err).Str("room_id", roomID).Msg("audio ogg write error")
 			return
@@ -557,7 +713,7 @@ func (t *Transcoder) writeAudioToPipe(roomID string, track *webrtc.TrackRemote,
 }
 
 func (t *Transcoder) cleanDir(dir string) {
-	patterns := []string{"*.ts", "*.m3u8"}
+	patterns := []string{"*.ts", "*.m4s", "init*.mp4", "*.m3u8"}
 	for _, pattern := range patterns {
 		files, _ := filepath.Glob(filepath.Join(dir, pattern))
 		for _, f := range files {
@@ -580,6 +736,24 @@ func (t *Transcoder) IsRunning(roomID, sessionID string) bool {
 	return exists
 }
 
+// Progress returns the latest output frame rate and speed FFmpeg reported for a room/session.
+// ok is false if no transcoder is running or it has not reported yet.
+func (t *Transcoder) Progress(roomID, sessionID string) (fps, speed float64, ok bool) {
+	processKey := roomID
+	if sessionID != "" {
+		processKey = roomID + ":" + sessionID
+	}
+
+	t.mu.RLock()
+	process, exists := t.processes[processKey]
+	t.mu.RUnlock()
+
+	if !exists || process.progress == nil {
+		return 0, 0, false
+	}
+	return process.progress.get()
+}
+
 // GetSessionDir returns the HLS output directory for a room/session.
 func (t *Transcoder) GetSessionDir(roomID, sessionID string) string {
 	if sessionID != "" {
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+)
+
+const (
+	// audioRendition is the subdirectory of the audio-only rendition of a session.
+	audioRendition = "audio"
+
+	// aacCodecString is the RFC 6381 codecs string of AAC-LC, the audio-only rendition's codec.
+	aacCodecString = "mp4a.40.2"
+)
+
+// PublishesAudioOnly returns true if an audio-only rendition is published for a room.
+func (t *Transcoder) PublishesAudioOnly(roomID string) bool {
+	return t.config.AudioOnly.Publishes(roomID)
+}
+
+// StartAudioRendition publishes the audio of a running stream as an audio-only AAC rendition
+// in {outputDir}/audio/stream.m3u8, for listeners who don't need the video.
+// The stream must have audio. Returns the RFC 6381 codecs string of the rendition.
+func (t *Transcoder) StartAudioRendition(roomID, sessionID string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	processKey := roomID
+	if sessionID != "" {
+		processKey = roomID + ":" + sessionID
+	}
+
+	parent, exists := t.processes[processKey]
+	if !exists {
+		return "", fmt.Errorf("transcoder not running for room %s", roomID)
+	}
+	if parent.audio == nil {
+		return "", fmt.Errorf("stream of room %s has no audio", roomID)
+	}
+	if _, exists := parent.renditions[audioRendition]; exists {
+		return "", fmt.Errorf("audio rendition already running for room %s", roomID)
+	}
+
+	outputDir := filepath.Join(parent.outputDir, audioRendition)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if !parent.resumed {
+		t.cleanDir(outputDir) // The rendition of a resumed stream appends to its playlist
+	}
+
+	audioPipe := filepath.Join(os.TempDir(), fmt.Sprintf("webrtc_audio_%s_%s.ogg", roomID, audioRendition))
+	os.Remove(audioPipe)
+	if err := syscall.Mkfifo(audioPipe, 0666); err != nil {
+		return "", fmt.Errorf("failed to create audio pipe: %w", err)
+	}
+
+	bitrate := t.config.AudioOnly.Bitrate
+	if bitrate == "" {
+		bitrate = "64k"
+	}
+	sampleRate := t.ffmpegCfg.AudioSample
+	if sampleRate == 0 {
+		sampleRate = 48000
+	}
+
+	args := []string{
+		"-use_wallclock_as_timestamps", "1",
+		"-fflags", "+genpts",
+		"-f", "ogg",
+		"-i", audioPipe,
+		"-vn",
+		"-c:a", "aac", // HLS audio-only renditions must be AAC, whatever the main stream uses
+		"-b:a", bitrate,
+		"-ar", fmt.Sprintf("%d", sampleRate),
+		"-ac", "2",
+	}
+	// The rendition shares the main stream's key, rotated together with it
+	keyInfoFile := ""
+	if parent.keys != nil {
+		keyInfoFile = parent.keys.infoFile
+	}
+	args = append(args, t.buildHLSArgs(outputDir, keyInfoFile)...)
+
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = ffmpegLogWriter(roomID, sessionID+"/"+audioRendition)
+	cmd.Stdout = io.Discard
+
+	if err := cmd.Start(); err != nil {
+		os.Remove(audioPipe)
+		return "", fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	process := &transcoderProcess{
+		roomID:    roomID,
+		cmd:       cmd,
+		outputDir: outputDir,
+		audioPipe: audioPipe,
+		done:      make(chan struct{}),
+	}
+	parent.renditions[audioRendition] = process
+
+	packets, unsubscribe := parent.audio.Subscribe(256)
+	go t.writeAudioToPipe(roomID, packets, audioPipe, process.done)
+
+	// Monitor FFmpeg process
+	go func() {
+		cmd.Wait()
+		unsubscribe()
+		t.mu.Lock()
+		if parent.renditions[audioRendition] == process {
+			delete(parent.renditions, audioRendition)
+		}
+		t.cleanupPipes(process)
+		t.mu.Unlock()
+		close(process.done)
+		l := pkglog.L()
+		l.Info().Str("room_id", roomID).Str("session_id", sessionID).Msg("ffmpeg audio rendition ended")
+	}()
+
+	l := pkglog.L()
+	l.Info().Str("room_id", roomID).Str("session_id", sessionID).Str("bitrate", bitrate).Msg("ffmpeg audio rendition started")
+	return aacCodecString, nil
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/pion/webrtc/v4"
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+)
+
+// StartRendition publishes a simulcast layer as an additional HLS rendition of a running stream.
+// The layer is remuxed without re-encoding into {outputDir}/{name}/stream.m3u8, sharing the
+// main stream's audio. Only H.264 layers can be passed through.
+// Returns the RFC 6381 codecs string of the rendition.
+func (t *Transcoder) StartRendition(roomID, sessionID, name string, track *webrtc.TrackRemote) (string, error) {
+	if track.Codec().MimeType != webrtc.MimeTypeH264 {
+		return "", fmt.Errorf("passthrough rendition requires H.264 (got %s)", track.Codec().MimeType)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	processKey := roomID
+	if sessionID != "" {
+		processKey = roomID + ":" + sessionID
+	}
+
+	parent, exists := t.processes[processKey]
+	if !exists {
+		return "", fmt.Errorf("transcoder not running for room %s", roomID)
+	}
+	if _, exists := parent.renditions[name]; exists {
+		return "", fmt.Errorf("rendition %s already running for room %s", name, roomID)
+	}
+
+	outputDir := filepath.Join(parent.outputDir, name)
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if !parent.resumed {
+		t.cleanDir(outputDir) // Renditions of a resumed stream append to their playlist
+	}
+
+	videoPipe, audioPipe, err := t.createPipes(roomID + "_" + name)
+	if err != nil {
+		return "", err
+	}
+	if parent.audio == nil {
+		os.Remove(audioPipe)
+		audioPipe = ""
+	}
+
+	args := []string{
+		"-use_wallclock_as_timestamps", "1",
+		"-fflags", "+genpts",
+		"-f", "h264",
+		"-i", videoPipe,
+	}
+	if audioPipe != "" {
+		args = append(args,
+			"-use_wallclock_as_timestamps", "1",
+			"-fflags", "+genpts",
+			"-f", "ogg",
+			"-i", audioPipe,
+		)
+	}
+	args = append(args, "-c:v", "copy")
+	if audioPipe != "" {
+		args = append(args, t.buildAudioArgs()...)
+	} else {
+		args = append(args, "-an")
+	}
+	// Renditions share the main stream's key, rotated together with it
+	keyInfoFile := ""
+	if parent.keys != nil {
+		keyInfoFile = parent.keys.infoFile
+	}
+	args = append(args, t.buildHLSArgs(outputDir, keyInfoFile)...)
+
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = ffmpegLogWriter(roomID, sessionID+"/"+name)
+	cmd.Stdout = io.Discard
+
+	if err := cmd.Start(); err != nil {
+		t.cleanupPipes(&transcoderProcess{videoPipe: videoPipe, audioPipe: audioPipe})
+		return "", fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	process := &transcoderProcess{
+		roomID:    roomID,
+		cmd:       cmd,
+		outputDir: outputDir,
+		videoPipe: videoPipe,
+		audioPipe: audioPipe,
+		done:      make(chan struct{}),
+	}
+	parent.renditions[name] = process
+
+	go t.writeH264PassthroughToPipe(roomID, track, videoPipe)
+
+	unsubscribe := func() {}
+	if audioPipe != "" {
+		packets, cancel := parent.audio.Subscribe(256)
+		unsubscribe = cancel
+		go t.writeAudioToPipe(roomID, packets, audioPipe, process.done)
+	}
+
+	// Monitor FFmpeg process
+	go func() {
+		cmd.Wait()
+		unsubscribe()
+		t.mu.Lock()
+		if parent.renditions[name] == process {
+			delete(parent.renditions, name)
+		}
+		t.cleanupPipes(process)
+		t.mu.Unlock()
+		close(process.done)
+		l := pkglog.L()
+		l.Info().Str("room_id", roomID).Str("session_id", sessionID).Str("rendition", name).Msg("ffmpeg rendition ended")
+	}()
+
+	codecString := t.withAudioCodec(h264CodecString(track.Codec().SDPFmtpLine), audioPipe != "")
+
+	l := pkglog.L()
+	l.Info().Str("room_id", roomID).Str("session_id", sessionID).Str("rendition", name).Str("codecs", codecString).Msg("ffmpeg passthrough rendition started")
+	return codecString, nil
+}
+
+// writeH264PassthroughToPipe writes an H.264 track to a named pipe for remuxing.
+func (t *Transcoder) writeH264PassthroughToPipe(roomID string, track *webrtc.TrackRemote, pipePath string) {
+	l := pkglog.L()
+	f, err := os.OpenFile(pipePath, os.O_WRONLY, os.ModeNamedPipe)
+	if err != nil {
+		l.Error().Err(err).Str("room_id", roomID).Msg("failed to open rendition video pipe")
+		return
+	}
+	defer f.Close()
+
+	t.writeH264Passthrough(roomID, track, f)
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// journalEntry is the persisted form of an upload task.
+type journalEntry struct {
+	ID          string         `json:"id"`
+	RoomID      string         `json:"room_id"`
+	LocalPath   string         `json:"local_path"`
+	S3Key       string         `json:"s3_key"`
+	ContentType string         `json:"content_type"`
+	Attempts    int            `json:"attempts"`
+	Requeues    int            `json:"requeues,omitempty"` // Times the entry was moved back from the dead-letter list
+	Segment     *UploadSegment `json:"segment,omitempty"`
+	LastError   string         `json:"last_error,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	FailedAt    time.Time      `json:"failed_at,omitempty"`
+}
+
+// uploadJournal persists pending upload tasks on disk so they survive restarts.
+// Pending tasks are stored as {dir}/pending/{id}.json, tasks that exhausted their retries are
+// moved to {dir}/dead/{id}.json. Files that must outlive their session's local HLS directory
+// are retained as {dir}/data/{id}.
+type uploadJournal struct {
+	pendingDir string
+	deadDir    string
+	dataDir    string
+}
+
+// newUploadJournal opens (creating if needed) the upload journal in dir.
+func newUploadJournal(dir string) (*uploadJournal, error) {
+	j := &uploadJournal{
+		pendingDir: filepath.Join(dir, "pending"),
+		deadDir:    filepath.Join(dir, "dead"),
+		dataDir:    filepath.Join(dir, "data"),
+	}
+	for _, d := range []string{j.pendingDir, j.deadDir, j.dataDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create journal directory %s: %w", d, err)
+		}
+	}
+	return j, nil
+}
+
+// put writes or replaces a pending entry atomically.
+func (j *uploadJournal) put(entry *journalEntry) error {
+	return writeJSONFile(filepath.Join(j.pendingDir, entry.ID+".json"), entry)
+}
+
+// remove deletes a pending entry.
+func (j *uploadJournal) remove(id string) error {
+	err := os.Remove(filepath.Join(j.pendingDir, id+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// retain keeps a copy of the entry's local file inside the journal (hard link if possible)
+// and points the entry at it.
+func (j *uploadJournal) retain(entry *journalEntry) error {
+	dataPath := filepath.Join(j.dataDir, entry.ID)
+	if entry.LocalPath == dataPath {
+		return nil
+	}
+	if err := os.Link(entry.LocalPath, dataPath); err != nil && !os.IsExist(err) {
+		if err := copyFile(entry.LocalPath, dataPath); err != nil {
+			return fmt.Errorf("failed to retain %s: %w", entry.LocalPath, err)
+		}
+	}
+	entry.LocalPath = dataPath
+	return nil
+}
+
+// bury moves a pending entry to the dead-letter list. The local file is retained
+// so the upload can still be replayed once the session's local directory is gone.
+func (j *uploadJournal) bury(entry *journalEntry) error {
+	j.retain(entry) // Best effort, the file may be the cause of the failure
+
+	if err := writeJSONFile(filepath.Join(j.deadDir, entry.ID+".json"), entry); err != nil {
+		return err
+	}
+	return j.remove(entry.ID)
+}
+
+// pending returns all pending entries, oldest first.
+func (j *uploadJournal) pending() ([]*journalEntry, error) {
+	return readJournalDir(j.pendingDir)
+}
+
+// deadLetters returns all dead-letter entries, oldest first.
+func (j *uploadJournal) deadLetters() ([]*journalEntry, error) {
+	return readJournalDir(j.deadDir)
+}
+
+// resurrect moves a dead-letter entry back to the pending list with its attempts reset.
+func (j *uploadJournal) resurrect(entry *journalEntry) error {
+	entry.Requeues++
+	entry.Attempts = 0
+	entry.LastError = ""
+	entry.FailedAt = time.Time{}
+	if err := j.put(entry); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(j.deadDir, entry.ID+".json")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// discardData removes the retained copy of a file once it has been uploaded.
+func (j *uploadJournal) discardData(entry *journalEntry) {
+	if filepath.Dir(entry.LocalPath) == j.dataDir {
+		os.Remove(entry.LocalPath)
+	}
+}
+
+// readJournalDir loads all entries of a journal directory sorted by creation time.
+func readJournalDir(dir string) ([]*journalEntry, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal directory %s: %w", dir, err)
+	}
+
+	var entries []*journalEntry
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			continue
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(data, &entry); err != nil || entry.ID == "" {
+			continue // Partially written entry
+		}
+		entries = append(entries, &entry)
+	}
+
+	sort.Slice(entries, func(i, k int) bool { return entries[i].CreatedAt.Before(entries[k].CreatedAt) })
+	return entries, nil
+}
+
+// writeJSONFile writes v to path via a temporary file and rename.
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// copyFile copies src to dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
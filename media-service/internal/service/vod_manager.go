@@ -3,6 +3,7 @@ package service
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,16 +17,26 @@ import (
 	"github.com/weiawesome/wes-io-live/pkg/storage"
 )
 
+// uploadDrainTimeout bounds how long FinalizeRoom waits for a room's segment uploads.
+const uploadDrainTimeout = 30 * time.Second
+
 // VODManager manages VOD recording and S3 upload for live streams.
 type VODManager struct {
 	s3Storage        storage.Storage
 	uploader         *S3Uploader
 	segmentWatcher   *SegmentWatcher
 	sessionStore     SessionStore
-	playlistBuilders map[string]*VODPlaylistBuilder // sessionKey -> builder (roomID:sessionID)
+	playlistBuilders map[string]*VODPlaylistBuilder // sessionKey -> builder (roomID:sessionID[/variant])
+	variants         map[string][]vodVariant        // sessionKey -> simulcast renditions
 	hlsOutputDir     string
 	vodConfig        config.VODConfig
 	targetDuration   int
+	dashEnabled      bool
+	codecs           string
+	instanceID       string
+	observer         SegmentObserver
+	replays          map[string]*replayedUploads // variantKey -> replayed segment uploads awaiting a playlist rebuild
+	rebuildMu        sync.Mutex                  // Serializes playlist rebuilds from storage
 	mu               sync.RWMutex
 	ctx              context.Context
 	cancel           context.CancelFunc
@@ -39,6 +50,9 @@ type VODManagerConfig struct {
 	VODConfig      config.VODConfig
 	TargetDuration int
 	SessionStore   SessionStore
+	DASHEnabled    bool   // Also generate a DASH manifest (requires fMP4 segments)
+	Codecs         string // Default RFC 6381 codecs string advertised in the DASH manifest
+	InstanceID     string // Owner recorded on sessions, used to reconcile them after a crash
 }
 
 // NewVODManager creates a new VOD manager.
@@ -56,20 +70,31 @@ func NewVODManager(cfg VODManagerConfig) *VODManager {
 		hlsOutputDir:     cfg.HLSOutputDir,
 		vodConfig:        cfg.VODConfig,
 		targetDuration:   cfg.TargetDuration,
+		dashEnabled:      cfg.DASHEnabled,
+		codecs:           cfg.Codecs,
+		instanceID:       cfg.InstanceID,
 		sessionStore:     sessionStore,
 		playlistBuilders: make(map[string]*VODPlaylistBuilder),
+		variants:         make(map[string][]vodVariant),
+		replays:          make(map[string]*replayedUploads),
 		ctx:              ctx,
 		cancel:           cancel,
 	}
 
 	// Create S3 uploader if S3 storage is configured
 	if cfg.S3Storage != nil {
+		queueCfg := cfg.VODConfig.UploadQueue
 		m.uploader = NewS3Uploader(cfg.S3Storage, S3UploaderConfig{
-			Workers:    cfg.VODConfig.UploadWorkers,
-			QueueSize:  200,
-			MaxRetries: 3,
-			RetryDelay: time.Second,
+			Workers:       cfg.VODConfig.UploadWorkers,
+			QueueSize:     queueCfg.HighWaterMark,
+			MaxPending:    queueCfg.MaxPending,
+			MaxRetries:    queueCfg.MaxRetries,
+			MaxRequeues:   queueCfg.MaxRequeues,
+			RetryDelay:    time.Duration(queueCfg.RetryBaseDelayMs) * time.Millisecond,
+			MaxRetryDelay: time.Duration(queueCfg.RetryMaxDelayMs) * time.Millisecond,
+			JournalDir:    queueCfg.JournalDir,
 		})
+		m.uploader.SetReplayHandler(m.onReplayedUpload)
 	}
 
 	// Create segment watcher with session-aware callback
@@ -110,6 +135,28 @@ func sessionKey(roomID, sessionID string) string {
 	return roomID + ":" + sessionID
 }
 
+// variantKey returns the playlistBuilders key for a simulcast rendition (primary stream if variant is empty).
+func variantKey(roomID, sessionID, variant string) string {
+	if variant == "" {
+		return sessionKey(roomID, sessionID)
+	}
+	return sessionKey(roomID, sessionID) + "/" + variant
+}
+
+// vodVariant describes a rendition recorded alongside the primary stream.
+type vodVariant struct {
+	Name   string // rendition subdirectory (simulcast rid or "audio")
+	Codecs string // RFC 6381 codecs string
+}
+
+// sessionPath returns the path of a session file, relative to the session root, for the given variant.
+func sessionPath(variant, filename string) string {
+	if variant == "" {
+		return filename
+	}
+	return variant + "/" + filename
+}
+
 // StartRoom begins VOD tracking for a room.
 // Returns the created session.
 func (m *VODManager) StartRoom(ctx context.Context, roomID string) (*VODSession, error) {
@@ -132,12 +179,13 @@ func (m *VODManager) StartRoom(ctx context.Context, roomID string) (*VODSession,
 
 	// Create session
 	session := &VODSession{
-		RoomID:    roomID,
-		SessionID: sessionID,
-		StartTime: time.Now().UTC(),
-		State:     SessionStarting,
-		LocalDir:  filepath.Join(m.hlsOutputDir, "room_"+roomID, sessionID),
-		S3Prefix:  fmt.Sprintf("vod/room_%s/%s", roomID, sessionID),
+		RoomID:     roomID,
+		SessionID:  sessionID,
+		StartTime:  time.Now().UTC(),
+		State:      SessionStarting,
+		LocalDir:   filepath.Join(m.hlsOutputDir, "room_"+roomID, sessionID),
+		S3Prefix:   fmt.Sprintf("vod/room_%s/%s", roomID, sessionID),
+		InstanceID: m.instanceID,
 	}
 
 	// Save session
@@ -149,6 +197,7 @@ func (m *VODManager) StartRoom(ctx context.Context, roomID string) (*VODSession,
 	// Create playlist builder for this session
 	key := sessionKey(roomID, sessionID)
 	builder := NewVODPlaylistBuilder(roomID, m.targetDuration)
+	builder.SetStartTime(session.StartTime)
 	m.playlistBuilders[key] = builder
 	m.mu.Unlock()
 
@@ -172,9 +221,93 @@ func (m *VODManager) StartRoom(ctx context.Context, roomID string) (*VODSession,
 	return session, nil
 }
 
+// SetSessionCodecs overrides the codecs string advertised for a session's primary stream,
+// e.g. when the broadcaster's H.264 is passed through instead of encoded.
+func (m *VODManager) SetSessionCodecs(roomID, sessionID, codecs string) {
+	m.mu.RLock()
+	builder, exists := m.playlistBuilders[sessionKey(roomID, sessionID)]
+	m.mu.RUnlock()
+
+	if exists {
+		builder.SetCodecs(codecs)
+	}
+}
+
+// sessionCodecs returns the codecs string advertised for a builder's stream.
+func (m *VODManager) sessionCodecs(builder *VODPlaylistBuilder) string {
+	if codecs := builder.GetCodecs(); codecs != "" {
+		return codecs
+	}
+	return m.codecs
+}
+
+// AddVariant starts recording a simulcast or audio-only rendition written to the variant subdirectory of the session.
+// Simulcast variants are listed in the session's master playlist (master.m3u8) next to the primary stream.
+func (m *VODManager) AddVariant(roomID, sessionID, variant, codecs string) error {
+	if !m.vodConfig.Enabled {
+		return nil
+	}
+
+	key := variantKey(roomID, sessionID, variant)
+
+	m.mu.Lock()
+	if _, exists := m.playlistBuilders[key]; exists {
+		m.mu.Unlock()
+		return nil
+	}
+	primary, exists := m.playlistBuilders[sessionKey(roomID, sessionID)]
+	if !exists {
+		m.mu.Unlock()
+		return fmt.Errorf("no vod tracking for room %s session %s", roomID, sessionID)
+	}
+	builder := NewVODPlaylistBuilder(roomID, m.targetDuration)
+	builder.SetStartTime(primary.startTime)
+	builder.SetCodecs(codecs)
+	m.playlistBuilders[key] = builder
+	m.variants[sessionKey(roomID, sessionID)] = append(m.variants[sessionKey(roomID, sessionID)], vodVariant{
+		Name:   variant,
+		Codecs: codecs,
+	})
+	m.mu.Unlock()
+
+	if err := m.segmentWatcher.StartWatchingVariant(roomID, sessionID, variant); err != nil {
+		m.mu.Lock()
+		delete(m.playlistBuilders, key)
+		m.removeVariantLocked(roomID, sessionID, variant)
+		m.mu.Unlock()
+		return fmt.Errorf("failed to start segment watcher: %w", err)
+	}
+
+	l := pkglog.L()
+	l.Info().Str("room_id", roomID).Str("session_id", sessionID).Str("variant", variant).Msg("vod variant tracking started")
+	return nil
+}
+
+// removeVariantLocked removes a variant from the session's variant list. Caller must hold the lock.
+func (m *VODManager) removeVariantLocked(roomID, sessionID, variant string) {
+	key := sessionKey(roomID, sessionID)
+	variants := m.variants[key]
+	for i, v := range variants {
+		if v.Name == variant {
+			m.variants[key] = append(variants[:i:i], variants[i+1:]...)
+			return
+		}
+	}
+}
+
+// getVariants returns a copy of the simulcast renditions recorded for a session.
+func (m *VODManager) getVariants(roomID, sessionID string) []vodVariant {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	variants := make([]vodVariant, len(m.variants[sessionKey(roomID, sessionID)]))
+	copy(variants, m.variants[sessionKey(roomID, sessionID)])
+	return variants
+}
+
 // onSegmentReady handles new segment detection.
 func (m *VODManager) onSegmentReady(roomID string, sessionID string, seg SegmentInfo) {
-	key := sessionKey(roomID, sessionID)
+	key := variantKey(roomID, sessionID, seg.Variant)
 
 	m.mu.RLock()
 	builder, exists := m.playlistBuilders[key]
@@ -184,19 +317,43 @@ func (m *VODManager) onSegmentReady(roomID string, sessionID string, seg Segment
 		return
 	}
 
-	// Add segment to playlist builder
-	builder.AddSegment(seg)
+	// Add media segment to playlist builder (init segments are tracked once uploaded)
+	start := builder.Duration()
+	if !seg.IsInit {
+		builder.AddSegment(seg)
+	}
+
+	if seg.Variant == "" {
+		m.mu.RLock()
+		observer := m.observer
+		m.mu.RUnlock()
+		if observer != nil {
+			observer.OnSegment(roomID, sessionID, seg, start)
+		}
+	}
 
 	// Upload segment to S3 asynchronously
 	if m.uploader != nil {
-		localPath := filepath.Join(m.hlsOutputDir, "room_"+roomID, sessionID, seg.Filename)
-		s3Key := fmt.Sprintf("vod/room_%s/%s/%s", roomID, sessionID, seg.Filename)
+		localPath := filepath.Join(m.hlsOutputDir, "room_"+roomID, sessionID, seg.Variant, seg.Filename)
+		s3Key := fmt.Sprintf("vod/room_%s/%s/%s", roomID, sessionID, sessionPath(seg.Variant, seg.Filename))
 
 		task := &UploadTask{
 			RoomID:      roomID,
 			LocalPath:   localPath,
 			S3Key:       s3Key,
-			ContentType: "video/mp2t",
+			ContentType: segmentContentType(seg.Filename),
+			Segment: &UploadSegment{
+				SessionID:     sessionID,
+				SessionStart:  builder.GetStartTime(),
+				Variant:       seg.Variant,
+				Index:         seg.Index,
+				Filename:      seg.Filename,
+				Duration:      seg.Duration,
+				IsInit:        seg.IsInit,
+				Discontinuity: seg.Discontinuity,
+				Key:           seg.Key,
+				InitSegment:   seg.InitSegment,
+			},
 			OnComplete: func(err error) {
 				if err != nil {
 					l := pkglog.L()
@@ -204,24 +361,36 @@ func (m *VODManager) onSegmentReady(roomID string, sessionID string, seg Segment
 					return
 				}
 
-				// Mark segment as uploaded
-				builder.MarkSegmentUploaded(seg.Index, s3Key)
+				// Mark segment (or fMP4 init segment) as uploaded
+				if seg.IsInit {
+					builder.SetInitSegment(seg.Filename)
+				} else {
+					builder.MarkSegmentUploaded(seg.Index, s3Key)
+				}
 
-				// Update VOD playlist on S3
-				m.uploadVODPlaylist(roomID, sessionID, false)
+				// Update VOD playlist on S3, deferred while uploads are backed up
+				// (the next segment or the final playlist catches up)
+				if !m.uploader.Backpressured() {
+					m.uploadVODPlaylist(roomID, sessionID, seg.Variant, false)
+				}
 			},
 		}
 
 		if err := m.uploader.Upload(task); err != nil {
 			l := pkglog.L()
-			l.Error().Err(err).Str("room_id", roomID).Msg("failed to queue segment upload")
+			if errors.Is(err, ErrUploadBackpressure) {
+				l.Warn().Str("room_id", roomID).Int("pending", m.uploader.QueueLength()).Msg("segment upload queue backed up, deferring playlist updates")
+			} else {
+				l.Error().Err(err).Str("room_id", roomID).Str("segment", seg.Filename).Msg("failed to queue segment upload")
+			}
 		}
 	}
 }
 
-// uploadVODPlaylist generates and uploads the VOD playlist to S3.
-func (m *VODManager) uploadVODPlaylist(roomID, sessionID string, finalized bool) {
-	key := sessionKey(roomID, sessionID)
+// uploadVODPlaylist generates and uploads the VOD playlist of the primary stream (empty variant)
+// or of a simulcast rendition to S3.
+func (m *VODManager) uploadVODPlaylist(roomID, sessionID, variant string, finalized bool) {
+	key := variantKey(roomID, sessionID, variant)
 
 	m.mu.RLock()
 	builder, exists := m.playlistBuilders[key]
@@ -231,11 +400,18 @@ func (m *VODManager) uploadVODPlaylist(roomID, sessionID string, finalized bool)
 		return
 	}
 
+	// Segments uploaded after the session was finalized refresh the final playlist
+	if finalized {
+		builder.End()
+	} else {
+		finalized = builder.Ended()
+	}
+
 	// Generate playlist content
 	content := builder.GenerateM3U8(finalized)
 
 	// Upload to S3
-	s3Key := fmt.Sprintf("vod/room_%s/%s/stream.m3u8", roomID, sessionID)
+	s3Key := fmt.Sprintf("vod/room_%s/%s/%s", roomID, sessionID, sessionPath(variant, "stream.m3u8"))
 	reader := bytes.NewReader(content)
 
 	ctx, cancel := context.WithTimeout(m.ctx, 30*time.Second)
@@ -243,12 +419,84 @@ func (m *VODManager) uploadVODPlaylist(roomID, sessionID string, finalized bool)
 
 	l := pkglog.L()
 	if err := m.uploader.UploadReader(ctx, reader, int64(len(content)), s3Key, "application/vnd.apple.mpegurl"); err != nil {
-		l.Error().Err(err).Str("room_id", roomID).Str("session_id", sessionID).Msg("failed to upload vod playlist")
+		l.Error().Err(err).Str("room_id", roomID).Str("session_id", sessionID).Str("variant", variant).Msg("failed to upload vod playlist")
 		return
 	}
 
+	// Session-level manifests are refreshed along with the primary stream
+	if variant == "" {
+		if m.dashEnabled {
+			m.uploadDASHManifest(ctx, builder, roomID, sessionID, finalized)
+		}
+		if variants := m.getVariants(roomID, sessionID); len(variants) > 0 {
+			m.uploadMasterPlaylist(ctx, builder, roomID, sessionID, variants)
+		}
+	}
+
 	if finalized {
-		l.Info().Str("room_id", roomID).Str("session_id", sessionID).Msg("final vod playlist uploaded")
+		l.Info().Str("room_id", roomID).Str("session_id", sessionID).Str("variant", variant).Msg("final vod playlist uploaded")
+	}
+}
+
+// uploadMasterPlaylist generates and uploads the master playlist listing the primary stream
+// and its simulcast renditions. Renditions without a measured bandwidth yet are left out.
+// The audio-only rendition is no alternative to the video streams, which carry their own audio,
+// and is played through playback-service's audio routes instead.
+func (m *VODManager) uploadMasterPlaylist(ctx context.Context, primary *VODPlaylistBuilder, roomID, sessionID string, variants []vodVariant) {
+	streams := []masterStream{{
+		URI:       "stream.m3u8",
+		Bandwidth: primary.PeakBandwidth(),
+		Codecs:    m.sessionCodecs(primary),
+	}}
+
+	for _, v := range variants {
+		if v.Name == audioRendition {
+			continue
+		}
+		m.mu.RLock()
+		builder, exists := m.playlistBuilders[variantKey(roomID, sessionID, v.Name)]
+		m.mu.RUnlock()
+		if !exists {
+			continue
+		}
+		streams = append(streams, masterStream{
+			URI:       sessionPath(v.Name, "stream.m3u8"),
+			Bandwidth: builder.PeakBandwidth(),
+			Codecs:    v.Codecs,
+		})
+	}
+	if len(streams) == 1 {
+		// Only an audio-only rendition, the primary stream plays without a master playlist
+		return
+	}
+
+	content := generateMasterPlaylist(streams)
+
+	s3Key := fmt.Sprintf("vod/room_%s/%s/master.m3u8", roomID, sessionID)
+	if err := m.uploader.UploadReader(ctx, bytes.NewReader(content), int64(len(content)), s3Key, "application/vnd.apple.mpegurl"); err != nil {
+		l := pkglog.L()
+		l.Error().Err(err).Str("room_id", roomID).Str("session_id", sessionID).Msg("failed to upload master playlist")
+	}
+}
+
+// uploadDASHManifest generates and uploads the DASH manifest next to the HLS playlist.
+// Live sessions get a dynamic MPD, finalized sessions a static one.
+func (m *VODManager) uploadDASHManifest(ctx context.Context, builder *VODPlaylistBuilder, roomID, sessionID string, finalized bool) {
+	// The MPD can only reference segments once the init segment is available
+	if builder.GetInitSegment() == "" {
+		return
+	}
+
+	l := pkglog.L()
+	content, err := builder.GenerateMPD(finalized, m.sessionCodecs(builder))
+	if err != nil {
+		l.Error().Err(err).Str("room_id", roomID).Str("session_id", sessionID).Msg("failed to generate dash manifest")
+		return
+	}
+
+	s3Key := fmt.Sprintf("vod/room_%s/%s/manifest.mpd", roomID, sessionID)
+	if err := m.uploader.UploadReader(ctx, bytes.NewReader(content), int64(len(content)), s3Key, "application/dash+xml"); err != nil {
+		l.Error().Err(err).Str("room_id", roomID).Str("session_id", sessionID).Msg("failed to upload dash manifest")
 	}
 }
 
@@ -294,14 +542,40 @@ func (m *VODManager) FinalizeRoom(ctx context.Context, roomID string) (string, e
 
 	// Wait for pending uploads to complete
 	time.Sleep(2 * time.Second)
+	retained := false
+	if m.uploader != nil {
+		waitCtx, cancel := context.WithTimeout(ctx, uploadDrainTimeout)
+		err := m.uploader.WaitForRoom(waitCtx, roomID)
+		cancel()
+		if err != nil {
+			// Keep the remaining segments in the upload journal, the local directory is removed below
+			retained = m.uploader.RetainRoom(roomID)
+			l.Warn().Err(err).Str("room_id", roomID).Bool("retained", retained).Msg("finalizing vod with uploads still pending")
+		}
+	}
+
+	// Let the observer finish with the local segments before they are removed
+	m.mu.RLock()
+	observer := m.observer
+	m.mu.RUnlock()
+	if observer != nil {
+		observer.OnSessionEnd(roomID, sessionID)
+	}
 
-	// Upload final playlist with ENDLIST
-	m.uploadVODPlaylist(roomID, sessionID, true)
+	// Upload final playlists with ENDLIST, renditions first so the master playlist sees their final bandwidth
+	variants := m.getVariants(roomID, sessionID)
+	for _, v := range variants {
+		m.uploadVODPlaylist(roomID, sessionID, v.Name, true)
+	}
+	m.uploadVODPlaylist(roomID, sessionID, "", true)
 
-	// Clean up playlist builder
-	m.mu.Lock()
-	delete(m.playlistBuilders, key)
-	m.mu.Unlock()
+	// Clean up playlist builders. Builders of retained uploads stay until they complete,
+	// so each one re-uploads the final playlists with its segment
+	if retained {
+		go m.releaseBuildersAfterUploads(roomID, sessionID, variants)
+	} else {
+		m.releaseBuilders(roomID, sessionID, variants)
+	}
 
 	// Clean up local HLS files
 	if err := os.RemoveAll(session.LocalDir); err != nil {
@@ -336,6 +610,31 @@ func (m *VODManager) FinalizeRoom(ctx context.Context, roomID string) (string, e
 	return "", nil
 }
 
+// releaseBuilders removes the playlist builders of a finalized session.
+func (m *VODManager) releaseBuilders(roomID, sessionID string, variants []vodVariant) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.playlistBuilders, sessionKey(roomID, sessionID))
+	for _, v := range variants {
+		delete(m.playlistBuilders, variantKey(roomID, sessionID, v.Name))
+	}
+	delete(m.variants, sessionKey(roomID, sessionID))
+}
+
+// releaseBuildersAfterUploads removes the playlist builders of a finalized session once its
+// retained uploads are done, or when the VOD manager stops.
+func (m *VODManager) releaseBuildersAfterUploads(roomID, sessionID string, variants []vodVariant) {
+	l := pkglog.L()
+	prefix := fmt.Sprintf("vod/room_%s/%s/", roomID, sessionID)
+	if err := m.uploader.WaitForPrefix(m.ctx, prefix); err != nil {
+		l.Warn().Err(err).Str("room_id", roomID).Str("session_id", sessionID).Msg("released vod playlist builders with uploads still pending")
+	} else {
+		l.Info().Str("room_id", roomID).Str("session_id", sessionID).Msg("retained vod uploads completed")
+	}
+	m.releaseBuilders(roomID, sessionID, variants)
+}
+
 // GetVODURL returns the VOD URL for the latest session of a room.
 func (m *VODManager) GetVODURL(ctx context.Context, roomID string) (string, error) {
 	if m.s3Storage == nil {
@@ -405,6 +704,14 @@ func (m *VODManager) IsRoomTracking(roomID string) bool {
 	return session.IsActive()
 }
 
+// IsRecording returns whether this instance is currently recording the given session.
+func (m *VODManager) IsRecording(roomID, sessionID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, exists := m.playlistBuilders[sessionKey(roomID, sessionID)]
+	return exists
+}
+
 // GetRoomStats returns VOD statistics for a room's active session.
 func (m *VODManager) GetRoomStats(roomID string) (totalSegments, uploadedSegments int) {
 	session, err := m.sessionStore.Get(m.ctx, roomID)
@@ -535,6 +842,13 @@ func (m *VODManager) IsEnabled() bool {
 	return m.vodConfig.Enabled
 }
 
+// SetSegmentObserver registers an observer for the primary stream's segments of recorded sessions.
+func (m *VODManager) SetSegmentObserver(observer SegmentObserver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observer = observer
+}
+
 // GetUploader returns the S3 uploader instance.
 // This allows sharing the uploader with other services like ThumbnailService.
 func (m *VODManager) GetUploader() *S3Uploader {
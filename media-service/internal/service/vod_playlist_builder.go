@@ -3,16 +3,24 @@ package service
 import (
 	"bytes"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 )
 
 // SegmentInfo represents information about a single HLS segment.
 type SegmentInfo struct {
-	Index    int
-	Filename string
-	Duration float64
-	S3Key    string
-	Uploaded bool
+	Index         int
+	Filename      string
+	Duration      float64
+	S3Key         string
+	Uploaded      bool
+	Size          int64
+	IsInit        bool   // fMP4 initialization segment (EXT-X-MAP), not a media segment
+	Variant       string // simulcast rendition subdirectory, empty for the primary stream
+	Discontinuity bool   // first segment after a resumed connection (EXT-X-DISCONTINUITY)
+	Key           string // EXT-X-KEY attributes the segment is encrypted with, empty if clear
+	InitSegment   string // fMP4 init segment (EXT-X-MAP) of the segment's connection, empty = the builder's
 }
 
 // VODPlaylistBuilder builds and manages VOD m3u8 playlists.
@@ -20,6 +28,11 @@ type VODPlaylistBuilder struct {
 	roomID         string
 	targetDuration int
 	segments       []SegmentInfo
+	initSegment    string          // first uploaded fMP4 init segment filename, empty for MPEG-TS
+	inits          map[string]bool // uploaded fMP4 init segments, one per connection
+	startTime      time.Time
+	codecs         string // RFC 6381 codecs string, empty = VOD manager default
+	ended          bool   // final playlist uploaded, later refreshes keep ENDLIST
 	mu             sync.RWMutex
 }
 
@@ -32,9 +45,53 @@ func NewVODPlaylistBuilder(roomID string, targetDuration int) *VODPlaylistBuilde
 		roomID:         roomID,
 		targetDuration: targetDuration,
 		segments:       make([]SegmentInfo, 0),
+		inits:          make(map[string]bool),
+		startTime:      time.Now().UTC(),
 	}
 }
 
+// SetStartTime sets the wall-clock start of the recording (defaults to creation time).
+func (b *VODPlaylistBuilder) SetStartTime(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.startTime = t
+}
+
+// GetStartTime returns the wall-clock start of the recording.
+func (b *VODPlaylistBuilder) GetStartTime() time.Time {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.startTime
+}
+
+// SetCodecs sets the RFC 6381 codecs string of the recorded stream.
+func (b *VODPlaylistBuilder) SetCodecs(codecs string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.codecs = codecs
+}
+
+// GetCodecs returns the RFC 6381 codecs string of the recorded stream, empty if unknown.
+func (b *VODPlaylistBuilder) GetCodecs() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.codecs
+}
+
+// End marks the recording as complete. Segments uploaded afterwards still join the final playlist.
+func (b *VODPlaylistBuilder) End() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ended = true
+}
+
+// Ended returns true once the final playlist has been generated.
+func (b *VODPlaylistBuilder) Ended() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.ended
+}
+
 // AddSegment adds a new segment to the playlist.
 func (b *VODPlaylistBuilder) AddSegment(seg SegmentInfo) {
 	b.mu.Lock()
@@ -52,6 +109,18 @@ func (b *VODPlaylistBuilder) AddSegment(seg SegmentInfo) {
 	b.segments = append(b.segments, seg)
 }
 
+// Duration returns the total duration of the added segments in seconds.
+func (b *VODPlaylistBuilder) Duration() float64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var total float64
+	for _, seg := range b.segments {
+		total += seg.Duration
+	}
+	return total
+}
+
 // MarkSegmentUploaded marks a segment as uploaded to S3.
 func (b *VODPlaylistBuilder) MarkSegmentUploaded(index int, s3Key string) {
 	b.mu.Lock()
@@ -66,6 +135,24 @@ func (b *VODPlaylistBuilder) MarkSegmentUploaded(index int, s3Key string) {
 	}
 }
 
+// SetInitSegment records an uploaded fMP4 init segment referenced by EXT-X-MAP. The first one
+// is the init segment of segments that don't name their own.
+func (b *VODPlaylistBuilder) SetInitSegment(filename string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inits[filename] = true
+	if b.initSegment == "" {
+		b.initSegment = filename
+	}
+}
+
+// GetInitSegment returns the first fMP4 init segment filename, or empty for MPEG-TS playlists.
+func (b *VODPlaylistBuilder) GetInitSegment() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.initSegment
+}
+
 // GetSegments returns a copy of all segments.
 func (b *VODPlaylistBuilder) GetSegments() []SegmentInfo {
 	b.mu.RLock()
@@ -104,6 +191,27 @@ func (b *VODPlaylistBuilder) GetPendingSegments() []SegmentInfo {
 	return pending
 }
 
+// PeakBandwidth returns the highest observed segment bitrate in bits per second.
+func (b *VODPlaylistBuilder) PeakBandwidth() int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.peakBandwidthLocked()
+}
+
+// peakBandwidthLocked computes the peak segment bitrate. Caller must hold the lock.
+func (b *VODPlaylistBuilder) peakBandwidthLocked() int64 {
+	var peak int64
+	for _, seg := range b.segments {
+		if seg.Duration <= 0 || seg.Size <= 0 {
+			continue
+		}
+		if bw := int64(float64(seg.Size*8) / seg.Duration); bw > peak {
+			peak = bw
+		}
+	}
+	return peak
+}
+
 // SegmentCount returns the total number of segments.
 func (b *VODPlaylistBuilder) SegmentCount() int {
 	b.mu.RLock()
@@ -119,22 +227,25 @@ func (b *VODPlaylistBuilder) GenerateM3U8(finalized bool) []byte {
 	defer b.mu.RUnlock()
 
 	var buf bytes.Buffer
-
-	// Header
-	buf.WriteString("#EXTM3U\n")
-	buf.WriteString("#EXT-X-VERSION:3\n")
-	buf.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", b.targetDuration))
-	buf.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
-
-	if finalized {
-		buf.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
-	}
-
-	// Segments - only include uploaded ones
+	b.writeHeader(&buf, finalized)
+
+	// Segments - only include uploaded ones.
+	// fMP4 segments are unplayable until their init segment has been uploaded.
+	// A discontinuity of a skipped segment moves to the next included one.
+	discontinuity := false
+	key := ""
+	init := b.initSegment
 	for _, seg := range b.segments {
-		if !seg.Uploaded {
+		discontinuity = discontinuity || seg.Discontinuity
+		if !seg.Uploaded || b.awaitingInit(seg) {
 			continue
 		}
+		if discontinuity {
+			buf.WriteString("#EXT-X-DISCONTINUITY\n")
+			discontinuity = false
+		}
+		init = writeMapTag(&buf, init, b.segmentInit(seg))
+		key = writeKeyTag(&buf, key, seg.Key)
 		buf.WriteString(fmt.Sprintf("#EXTINF:%.6f,\n", seg.Duration))
 		buf.WriteString(seg.Filename + "\n")
 	}
@@ -153,19 +264,17 @@ func (b *VODPlaylistBuilder) GenerateM3U8WithAllSegments(finalized bool) []byte
 	defer b.mu.RUnlock()
 
 	var buf bytes.Buffer
-
-	// Header
-	buf.WriteString("#EXTM3U\n")
-	buf.WriteString("#EXT-X-VERSION:3\n")
-	buf.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", b.targetDuration))
-	buf.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
-
-	if finalized {
-		buf.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
-	}
+	b.writeHeader(&buf, finalized)
 
 	// All segments
+	key := ""
+	init := b.initSegment
 	for _, seg := range b.segments {
+		if seg.Discontinuity {
+			buf.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		init = writeMapTag(&buf, init, b.segmentInit(seg))
+		key = writeKeyTag(&buf, key, seg.Key)
 		buf.WriteString(fmt.Sprintf("#EXTINF:%.6f,\n", seg.Duration))
 		buf.WriteString(seg.Filename + "\n")
 	}
@@ -178,6 +287,70 @@ func (b *VODPlaylistBuilder) GenerateM3U8WithAllSegments(finalized bool) []byte
 	return buf.Bytes()
 }
 
+// writeHeader writes the playlist header tags.
+// fMP4 playlists require version 7 and an EXT-X-MAP tag pointing at the init segment,
+// segments of later connections are preceded by an EXT-X-MAP tag of their own.
+func (b *VODPlaylistBuilder) writeHeader(buf *bytes.Buffer, finalized bool) {
+	version := 3
+	if b.initSegment != "" {
+		version = 7
+	}
+
+	buf.WriteString("#EXTM3U\n")
+	buf.WriteString(fmt.Sprintf("#EXT-X-VERSION:%d\n", version))
+	buf.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", b.targetDuration))
+	buf.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+
+	if finalized {
+		buf.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	}
+
+	if b.initSegment != "" {
+		buf.WriteString(fmt.Sprintf("#EXT-X-MAP:URI=\"%s\"\n", b.initSegment))
+	}
+}
+
+// writeKeyTag writes an EXT-X-KEY tag if a segment's key differs from the current one
+// and returns the segment's key.
+func writeKeyTag(buf *bytes.Buffer, current, key string) string {
+	if key == current {
+		return current
+	}
+	if key == "" {
+		buf.WriteString("#EXT-X-KEY:METHOD=NONE\n")
+	} else {
+		buf.WriteString("#EXT-X-KEY:" + key + "\n")
+	}
+	return key
+}
+
+// writeMapTag writes an EXT-X-MAP tag if a segment's init segment differs from the current one
+// and returns the segment's init segment.
+func writeMapTag(buf *bytes.Buffer, current, init string) string {
+	if init == current || init == "" {
+		return current
+	}
+	buf.WriteString(fmt.Sprintf("#EXT-X-MAP:URI=\"%s\"\n", init))
+	return init
+}
+
+// segmentInit returns the init segment of seg, the first init segment if it doesn't name its own.
+func (b *VODPlaylistBuilder) segmentInit(seg SegmentInfo) string {
+	if seg.InitSegment != "" {
+		return seg.InitSegment
+	}
+	return b.initSegment
+}
+
+// awaitingInit returns true if seg is an fMP4 segment whose init segment is not available yet.
+func (b *VODPlaylistBuilder) awaitingInit(seg SegmentInfo) bool {
+	if !strings.HasSuffix(seg.Filename, ".m4s") {
+		return false
+	}
+	init := b.segmentInit(seg)
+	return init == "" || !b.inits[init]
+}
+
 // Clear removes all segments.
 func (b *VODPlaylistBuilder) Clear() {
 	b.mu.Lock()
@@ -0,0 +1,441 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/pkg/storage"
+)
+
+// ReconcileOrphanedSessions finalizes VOD sessions left active by a previous run of this instance
+// (e.g. after a crash). For each session the playlist is rebuilt from the segments already in storage
+// and the local HLS directory, missing segments are uploaded and a final playlist with
+// #EXT-X-ENDLIST is written. Must be called before new broadcasts are accepted.
+func (m *VODManager) ReconcileOrphanedSessions(ctx context.Context) error {
+	if !m.vodConfig.Enabled {
+		return nil
+	}
+
+	l := pkglog.L()
+	var orphaned []*VODSession
+	for _, state := range []SessionState{SessionStarting, SessionLive, SessionFinalizing} {
+		sessions, err := m.sessionStore.GetByState(ctx, state)
+		if err != nil {
+			return fmt.Errorf("failed to list %s sessions: %w", state.String(), err)
+		}
+		for _, session := range sessions {
+			// Sessions of other instances may still be live; sessions without owner predate
+			// instance tracking and expire with the session store TTL.
+			if session.InstanceID != m.instanceID {
+				if session.InstanceID == "" {
+					l.Warn().Str("room_id", session.RoomID).Str("session_id", session.SessionID).Msg("skipping active session without instance id")
+				}
+				continue
+			}
+			orphaned = append(orphaned, session)
+		}
+	}
+
+	for _, session := range orphaned {
+		if err := m.reconcileSession(ctx, session); err != nil {
+			l.Error().Err(err).Str("room_id", session.RoomID).Str("session_id", session.SessionID).Msg("failed to reconcile orphaned session")
+			continue
+		}
+		l.Info().Str("room_id", session.RoomID).Str("session_id", session.SessionID).Msg("orphaned vod session finalized")
+	}
+
+	return nil
+}
+
+// reconcileSession rebuilds, completes and finalizes a single orphaned session.
+func (m *VODManager) reconcileSession(ctx context.Context, session *VODSession) error {
+	m.rebuildMu.Lock()
+	defer m.rebuildMu.Unlock()
+
+	roomID, sessionID := session.RoomID, session.SessionID
+	prefix := fmt.Sprintf("vod/room_%s/%s/", roomID, sessionID)
+
+	if m.uploader != nil {
+		// Group uploaded files by variant ("" for the primary stream)
+		stored := make(map[string]map[string]storage.FileInfo)
+		files, err := m.s3Storage.List(ctx, prefix)
+		if err != nil {
+			return fmt.Errorf("failed to list uploaded files: %w", err)
+		}
+		for _, f := range files {
+			dir, name := path.Split(strings.TrimPrefix(f.Key, prefix))
+			variant := strings.TrimSuffix(dir, "/")
+			if stored[variant] == nil {
+				stored[variant] = make(map[string]storage.FileInfo)
+			}
+			stored[variant][name] = f
+		}
+
+		// Variants that never uploaded anything may still have local output
+		if entries, err := os.ReadDir(session.LocalDir); err == nil {
+			for _, entry := range entries {
+				if entry.IsDir() && stored[entry.Name()] == nil {
+					stored[entry.Name()] = make(map[string]storage.FileInfo)
+				}
+			}
+		}
+		if stored[""] == nil {
+			stored[""] = make(map[string]storage.FileInfo)
+		}
+
+		masterCodecs := m.readMasterCodecs(ctx, prefix)
+
+		var variants []vodVariant
+		builders := make(map[string]*VODPlaylistBuilder, len(stored))
+		for variant, uploaded := range stored {
+			codecs := masterCodecs[sessionPath(variant, "stream.m3u8")]
+			if codecs == "" && variant != "" {
+				codecs = m.codecs
+			}
+
+			builder := NewVODPlaylistBuilder(roomID, m.targetDuration)
+			builder.SetStartTime(session.StartTime)
+			builder.SetCodecs(codecs)
+			m.rebuildPlaylist(ctx, session, variant, builder, uploaded, nil)
+			builders[variant] = builder
+
+			if variant != "" {
+				variants = append(variants, vodVariant{Name: variant, Codecs: codecs})
+			}
+		}
+		sort.Slice(variants, func(i, j int) bool { return variants[i].Name < variants[j].Name })
+
+		m.mu.Lock()
+		for variant, builder := range builders {
+			m.playlistBuilders[variantKey(roomID, sessionID, variant)] = builder
+		}
+		m.variants[sessionKey(roomID, sessionID)] = variants
+		m.mu.Unlock()
+
+		// Final playlists, renditions first so the master playlist sees their bandwidth
+		for _, v := range variants {
+			m.uploadVODPlaylist(roomID, sessionID, v.Name, true)
+		}
+		m.uploadVODPlaylist(roomID, sessionID, "", true)
+
+		m.mu.Lock()
+		for variant := range stored {
+			delete(m.playlistBuilders, variantKey(roomID, sessionID, variant))
+		}
+		delete(m.variants, sessionKey(roomID, sessionID))
+		m.mu.Unlock()
+	}
+
+	// Clean up local HLS files and the session entry
+	l := pkglog.L()
+	if session.LocalDir != "" {
+		if err := os.RemoveAll(session.LocalDir); err != nil {
+			l.Error().Err(err).Str("dir", session.LocalDir).Msg("failed to cleanup local dir")
+		}
+		roomDir := filepath.Dir(session.LocalDir)
+		if entries, err := os.ReadDir(roomDir); err == nil && len(entries) == 0 {
+			os.Remove(roomDir)
+		}
+	}
+	if err := m.sessionStore.Delete(ctx, roomID); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// rebuildPlaylist restores a variant's segment list from the previously uploaded playlist,
+// the local playlist, the given known segments and the files in storage, uploading local
+// segments that are missing.
+func (m *VODManager) rebuildPlaylist(ctx context.Context, session *VODSession, variant string, builder *VODPlaylistBuilder, uploaded map[string]storage.FileInfo, known []SegmentInfo) {
+	l := pkglog.L()
+	localDir := filepath.Join(session.LocalDir, variant)
+	prefix := fmt.Sprintf("vod/room_%s/%s/", session.RoomID, session.SessionID)
+
+	// Durations: uploaded playlist has every uploaded segment, the local one the most recent
+	// segments (older ones may have been deleted by FFmpeg).
+	segments := make(map[string]SegmentInfo)
+	var initSegment string
+	if rc, err := m.s3Storage.Read(ctx, prefix+sessionPath(variant, "stream.m3u8")); err == nil {
+		initSegment = mergePlaylistEntries(rc, segments)
+		rc.Close()
+	}
+	if f, err := os.Open(filepath.Join(localDir, "stream.m3u8")); err == nil {
+		if init := mergePlaylistEntries(f, segments); initSegment == "" {
+			initSegment = init
+		}
+		f.Close()
+	}
+
+	for _, seg := range known {
+		if _, exists := segments[seg.Filename]; !exists && !seg.IsInit {
+			segments[seg.Filename] = seg
+		}
+	}
+
+	// Uploaded segments missing from both playlists get the target duration
+	for name, info := range uploaded {
+		if !isMediaSegment(name) {
+			continue
+		}
+		seg, exists := segments[name]
+		if !exists {
+			seg = SegmentInfo{Index: segmentIndex(name), Filename: name, Duration: float64(m.targetDuration)}
+		}
+		seg.Size = info.Size
+		segments[name] = seg
+	}
+
+	// fMP4 init segments, the first connection's one first
+	if initSegment == "" {
+		if _, exists := uploaded[initSegmentFilename]; exists {
+			initSegment = initSegmentFilename
+		}
+	}
+	inits := []string{initSegment}
+	for _, seg := range segments {
+		if seg.InitSegment != "" && !slices.Contains(inits, seg.InitSegment) {
+			inits = append(inits, seg.InitSegment)
+		}
+	}
+	for _, init := range inits {
+		if init != "" && m.ensureUploaded(ctx, localDir, prefix+sessionPath(variant, init), init, uploaded) {
+			builder.SetInitSegment(init)
+		}
+	}
+
+	// Add segments in order, uploading the ones that only exist locally
+	ordered := make([]SegmentInfo, 0, len(segments))
+	for _, seg := range segments {
+		ordered = append(ordered, seg)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].Index < ordered[j].Index })
+
+	missing := 0
+	for _, seg := range ordered {
+		seg.Variant = variant
+		if seg.Size == 0 {
+			if info, err := os.Stat(filepath.Join(localDir, seg.Filename)); err == nil {
+				seg.Size = info.Size()
+			}
+		}
+		builder.AddSegment(seg)
+
+		s3Key := prefix + sessionPath(variant, seg.Filename)
+		if m.ensureUploaded(ctx, localDir, s3Key, seg.Filename, uploaded) {
+			builder.MarkSegmentUploaded(seg.Index, s3Key)
+		} else {
+			missing++
+		}
+	}
+
+	l.Info().Str("room_id", session.RoomID).Str("session_id", session.SessionID).Str("variant", variant).Int("segments", len(ordered)).Int("missing", missing).Msg("vod playlist rebuilt")
+}
+
+// replayedUploads collects the segments of a session variant uploaded from the journal after a restart.
+type replayedUploads struct {
+	roomID    string
+	sessionID string
+	variant   string
+	startTime time.Time
+	segments  []SegmentInfo
+}
+
+// onReplayedUpload is called for uploads replayed from the journal. Their session was finalized
+// (or reconciled) by a previous run, so the final playlist is rebuilt from storage instead of
+// updating an in-memory builder. Rebuilds of a session variant are coalesced.
+func (m *VODManager) onReplayedUpload(task *UploadTask, err error) {
+	seg := task.Segment
+	if seg == nil {
+		return
+	}
+
+	l := pkglog.L()
+	if err != nil {
+		l.Error().Err(err).Str("room_id", task.RoomID).Str("session_id", seg.SessionID).Str("segment", seg.Filename).Msg("failed to upload replayed segment")
+		return
+	}
+
+	key := variantKey(task.RoomID, seg.SessionID, seg.Variant)
+	m.mu.Lock()
+	pending, scheduled := m.replays[key]
+	if !scheduled {
+		pending = &replayedUploads{roomID: task.RoomID, sessionID: seg.SessionID, variant: seg.Variant, startTime: seg.SessionStart}
+		m.replays[key] = pending
+	}
+	pending.segments = append(pending.segments, SegmentInfo{
+		Index:         seg.Index,
+		Filename:      seg.Filename,
+		Duration:      seg.Duration,
+		IsInit:        seg.IsInit,
+		Variant:       seg.Variant,
+		Discontinuity: seg.Discontinuity,
+		Key:           seg.Key,
+		InitSegment:   seg.InitSegment,
+	})
+	m.mu.Unlock()
+
+	if !scheduled {
+		go m.rebuildReplayedPlaylist(key)
+	}
+}
+
+// rebuildReplayedPlaylist rewrites the final playlist (and DASH manifest) of a session variant
+// to include its replayed segment uploads.
+func (m *VODManager) rebuildReplayedPlaylist(key string) {
+	m.rebuildMu.Lock()
+	defer m.rebuildMu.Unlock()
+
+	m.mu.Lock()
+	replayed := m.replays[key]
+	delete(m.replays, key)
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(m.ctx, 30*time.Second)
+	defer cancel()
+
+	l := pkglog.L()
+	roomID, sessionID, variant := replayed.roomID, replayed.sessionID, replayed.variant
+	prefix := fmt.Sprintf("vod/room_%s/%s/", roomID, sessionID)
+
+	files, err := m.s3Storage.List(ctx, prefix)
+	if err != nil {
+		l.Error().Err(err).Str("room_id", roomID).Str("session_id", sessionID).Msg("failed to list uploaded files")
+		return
+	}
+	uploaded := make(map[string]storage.FileInfo)
+	for _, f := range files {
+		dir, name := path.Split(strings.TrimPrefix(f.Key, prefix))
+		if strings.TrimSuffix(dir, "/") == variant {
+			uploaded[name] = f
+		}
+	}
+
+	codecs := m.readMasterCodecs(ctx, prefix)[sessionPath(variant, "stream.m3u8")]
+	if codecs == "" && variant != "" {
+		codecs = m.codecs
+	}
+
+	builder := NewVODPlaylistBuilder(roomID, m.targetDuration)
+	builder.SetStartTime(replayed.startTime)
+	builder.SetCodecs(codecs)
+	session := &VODSession{
+		RoomID:    roomID,
+		SessionID: sessionID,
+		StartTime: replayed.startTime,
+		LocalDir:  filepath.Join(m.hlsOutputDir, "room_"+roomID, sessionID),
+	}
+	m.rebuildPlaylist(ctx, session, variant, builder, uploaded, replayed.segments)
+	builder.End()
+
+	content := builder.GenerateM3U8(true)
+	s3Key := prefix + sessionPath(variant, "stream.m3u8")
+	if err := m.uploader.UploadReader(ctx, bytes.NewReader(content), int64(len(content)), s3Key, "application/vnd.apple.mpegurl"); err != nil {
+		l.Error().Err(err).Str("room_id", roomID).Str("session_id", sessionID).Str("variant", variant).Msg("failed to upload vod playlist")
+		return
+	}
+	if variant == "" && m.dashEnabled {
+		m.uploadDASHManifest(ctx, builder, roomID, sessionID, true)
+	}
+
+	l.Info().Str("room_id", roomID).Str("session_id", sessionID).Str("variant", variant).Int("replayed", len(replayed.segments)).Msg("vod playlist refreshed after replayed uploads")
+}
+
+// ensureUploaded returns true if filename is in storage, uploading the local copy if needed.
+func (m *VODManager) ensureUploaded(ctx context.Context, localDir, s3Key, filename string, uploaded map[string]storage.FileInfo) bool {
+	if _, exists := uploaded[filename]; exists {
+		return true
+	}
+
+	localPath := filepath.Join(localDir, filename)
+	if _, err := os.Stat(localPath); err != nil {
+		return false
+	}
+	if err := m.uploader.UploadSync(ctx, localPath, s3Key, segmentContentType(filename)); err != nil {
+		l := pkglog.L()
+		l.Error().Err(err).Str("segment", filename).Msg("failed to upload missing segment")
+		return false
+	}
+	return true
+}
+
+// mergePlaylistEntries adds the segments of a media playlist to segments (keyed by filename)
+// and returns the first EXT-X-MAP init segment, if any.
+func mergePlaylistEntries(r io.Reader, segments map[string]SegmentInfo) string {
+	var initSegment, currentInit string
+	var duration float64
+	var discontinuity bool
+	var key string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "#EXT-X-DISCONTINUITY":
+			discontinuity = true
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			key = parseKeyTag(line)
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			currentInit = parseMapURI(line)
+			if initSegment == "" {
+				initSegment = currentInit
+			}
+		case strings.HasPrefix(line, "#EXTINF:"):
+			durationStr := strings.TrimSuffix(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			if d, err := strconv.ParseFloat(durationStr, 64); err == nil {
+				duration = d
+			}
+		case isMediaSegment(line):
+			// The local playlist may have dropped the tag together with older segments
+			// FFmpeg's playlist only maps its latest init segment, earlier segments keep theirs
+			discontinuity = discontinuity || segments[line].Discontinuity
+			init := currentInit
+			if previous := segments[line].InitSegment; previous != "" {
+				init = previous
+			}
+			segments[line] = SegmentInfo{Index: segmentIndex(line), Filename: line, Duration: duration, Discontinuity: discontinuity, Key: key, InitSegment: init}
+			discontinuity = false
+		}
+	}
+	return initSegment
+}
+
+// readMasterCodecs returns the CODECS attribute per variant URI from a session's uploaded master playlist.
+func (m *VODManager) readMasterCodecs(ctx context.Context, prefix string) map[string]string {
+	codecs := make(map[string]string)
+
+	rc, err := m.s3Storage.Read(ctx, prefix+"master.m3u8")
+	if err != nil {
+		return codecs
+	}
+	defer rc.Close()
+
+	var pending string
+	scanner := bufio.NewScanner(rc)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
+			pending = ""
+			if idx := strings.Index(line, `CODECS="`); idx >= 0 {
+				value := line[idx+len(`CODECS="`):]
+				if end := strings.Index(value, `"`); end >= 0 {
+					pending = value[:end]
+				}
+			}
+		} else if line != "" && !strings.HasPrefix(line, "#") {
+			codecs[line] = pending
+		}
+	}
+	return codecs
+}
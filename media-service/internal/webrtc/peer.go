@@ -2,6 +2,7 @@ package webrtc
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/pion/interceptor"
 	"github.com/pion/interceptor/pkg/intervalpli"
@@ -11,13 +12,19 @@ import (
 
 // PeerManager manages WebRTC peer connections for rooms.
 type PeerManager struct {
-	iceServers []webrtc.ICEServer
+	iceServers  []webrtc.ICEServer
+	simulcast   bool
+	pliInterval time.Duration
 }
 
 // NewPeerManager creates a new PeerManager.
-func NewPeerManager(iceServers []webrtc.ICEServer) *PeerManager {
+// If simulcast is true, the RTP header extensions needed to receive simulcast layers (mid/rid) are negotiated.
+// pliInterval sets how often keyframes are requested from the broadcaster (0 = interceptor default).
+func NewPeerManager(iceServers []webrtc.ICEServer, simulcast bool, pliInterval time.Duration) *PeerManager {
 	return &PeerManager{
-		iceServers: iceServers,
+		iceServers:  iceServers,
+		simulcast:   simulcast,
+		pliInterval: pliInterval,
 	}
 }
 
@@ -31,10 +38,12 @@ type StateHandler func(state webrtc.PeerConnectionState)
 type ICECandidateHandler func(candidate *webrtc.ICECandidate)
 
 // CreatePeerConnection creates a new peer connection with the given handlers.
+// onRTP may be nil; otherwise it observes every inbound RTP packet, e.g. for ingest health metrics.
 func (pm *PeerManager) CreatePeerConnection(
 	onTrack TrackHandler,
 	onState StateHandler,
 	onICECandidate ICECandidateHandler,
+	onRTP RTPObserver,
 ) (*webrtc.PeerConnection, error) {
 	m := &webrtc.MediaEngine{}
 
@@ -90,15 +99,31 @@ func (pm *PeerManager) CreatePeerConnection(
 		return nil, err
 	}
 
+	// Register mid/rid header extensions so simulcast layers can be demultiplexed
+	if pm.simulcast {
+		if err := webrtc.ConfigureSimulcastExtensionHeaders(m); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create interceptor registry with PLI support
 	i := &interceptor.Registry{}
 
-	intervalPliFactory, err := intervalpli.NewReceiverInterceptor()
+	var pliOpts []intervalpli.GeneratorOption
+	if pm.pliInterval > 0 {
+		// Passthrough segments can only be cut on keyframes the broadcaster sends
+		pliOpts = append(pliOpts, intervalpli.GeneratorInterval(pm.pliInterval))
+	}
+	intervalPliFactory, err := intervalpli.NewReceiverInterceptor(pliOpts...)
 	if err != nil {
 		return nil, err
 	}
 	i.Add(intervalPliFactory)
 
+	if onRTP != nil {
+		i.Add(&rtpObserverFactory{observer: onRTP})
+	}
+
 	if err := webrtc.RegisterDefaultInterceptors(m, i); err != nil {
 		return nil, err
 	}
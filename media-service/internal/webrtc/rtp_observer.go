@@ -0,0 +1,55 @@
+package webrtc
+
+import (
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+// RTPObserver is called for every inbound RTP packet with the SSRC and MIME type of its stream.
+// The payload is only valid during the call.
+type RTPObserver func(ssrc uint32, mimeType string, header *rtp.Header, payload []byte)
+
+// rtpObserverFactory creates interceptors that report inbound RTP packets to an observer.
+type rtpObserverFactory struct {
+	observer RTPObserver
+}
+
+// NewInterceptor implements interceptor.Factory.
+func (f *rtpObserverFactory) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	return &rtpObserverInterceptor{observer: f.observer}, nil
+}
+
+// rtpObserverInterceptor passes inbound RTP packets through unchanged.
+type rtpObserverInterceptor struct {
+	interceptor.NoOp
+	observer RTPObserver
+}
+
+// BindRemoteStream implements interceptor.Interceptor.
+func (i *rtpObserverInterceptor) BindRemoteStream(info *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	return interceptor.RTPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, a, err := reader.Read(b, a)
+		if err != nil {
+			return n, a, err
+		}
+		if a == nil {
+			a = interceptor.Attributes{}
+		}
+
+		header, err := a.GetRTPHeader(b[:n])
+		if err != nil {
+			// Not ours to reject, later stages handle malformed packets
+			return n, a, nil
+		}
+
+		start, end := header.MarshalSize(), n
+		if header.Padding && end > start {
+			end -= int(b[end-1])
+		}
+		if start <= end {
+			i.observer(info.SSRC, info.MimeType, header, b[start:end])
+		}
+
+		return n, a, nil
+	})
+}
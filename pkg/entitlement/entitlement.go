@@ -0,0 +1,124 @@
+package entitlement
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Config holds which rooms are restricted and the Redis store of their grants.
+type Config struct {
+	Rooms     []string // Restricted rooms, "*" for every room, empty = none
+	Address   string
+	Password  string
+	DB        int
+	KeyPrefix string
+}
+
+// Checker decides which users may watch a room. Rooms are open to every authenticated user
+// unless restricted (private rooms, subscriber-only recordings). A restricted room admits its
+// owner and the users granted the room or one of its sessions, kept in Redis sets written by
+// whatever sells or shares access.
+type Checker struct {
+	client    *redis.Client // nil when no room is restricted
+	keyPrefix string
+	rooms     []string
+}
+
+// NewChecker creates a new entitlement checker. Redis is only connected if a room is restricted.
+func NewChecker(cfg Config) (*Checker, error) {
+	c := &Checker{
+		keyPrefix: cfg.KeyPrefix,
+		rooms:     cfg.Rooms,
+	}
+	if len(cfg.Rooms) == 0 {
+		return c, nil
+	}
+
+	c.client = redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return c, nil
+}
+
+// Restricted returns true if a room only admits its owner and granted users.
+func (c *Checker) Restricted(roomID string) bool {
+	return slices.Contains(c.rooms, "*") || slices.Contains(c.rooms, roomID)
+}
+
+// key returns the Redis set of the users granted a room, or one of its sessions.
+func (c *Checker) key(roomID, sessionID string) string {
+	if sessionID == "" {
+		return c.keyPrefix + roomID
+	}
+	return c.keyPrefix + roomID + ":" + sessionID
+}
+
+// Allows reports whether a user may watch a room and, if sessionID is not empty, its session.
+// An empty sessionID requires a grant of the whole room.
+func (c *Checker) Allows(ctx context.Context, roomID, sessionID, ownerID, userID string) (bool, error) {
+	if userID == "" {
+		return false, nil
+	}
+	if userID == ownerID || !c.Restricted(roomID) {
+		return true, nil
+	}
+
+	granted, err := c.client.SIsMember(ctx, c.key(roomID, ""), userID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check entitlement: %w", err)
+	}
+	if granted || sessionID == "" {
+		return granted, nil
+	}
+
+	granted, err = c.client.SIsMember(ctx, c.key(roomID, sessionID), userID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check entitlement: %w", err)
+	}
+	return granted, nil
+}
+
+// Grant admits a user to a room, or only to one of its sessions if sessionID is not empty.
+func (c *Checker) Grant(ctx context.Context, roomID, sessionID, userID string) error {
+	if c.client == nil {
+		return nil
+	}
+	if err := c.client.SAdd(ctx, c.key(roomID, sessionID), userID).Err(); err != nil {
+		return fmt.Errorf("failed to grant entitlement: %w", err)
+	}
+	return nil
+}
+
+// Revoke removes a user's grant of a room or one of its sessions.
+func (c *Checker) Revoke(ctx context.Context, roomID, sessionID, userID string) error {
+	if c.client == nil {
+		return nil
+	}
+	if err := c.client.SRem(ctx, c.key(roomID, sessionID), userID).Err(); err != nil {
+		return fmt.Errorf("failed to revoke entitlement: %w", err)
+	}
+	return nil
+}
+
+// Close closes the Redis connection.
+func (c *Checker) Close() error {
+	if c.client == nil {
+		return nil
+	}
+	return c.client.Close()
+}
@@ -0,0 +1,131 @@
+package hlskey
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Size is the length of an AES-128 content key and its IV in bytes.
+const Size = 16
+
+// ErrKeyNotFound is returned for keys that were never stored or have expired.
+var ErrKeyNotFound = errors.New("content key not found")
+
+// Key is an AES-128 content key of encrypted HLS segments.
+type Key struct {
+	ID    string // Random hex identifier, the last element of the key URI
+	Bytes []byte
+	IV    []byte // Written explicitly to playlists, so segments decrypt regardless of their media sequence
+}
+
+// Generate returns a new random content key.
+func Generate() (*Key, error) {
+	buf := make([]byte, 8+2*Size)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate content key: %w", err)
+	}
+	return &Key{
+		ID:    hex.EncodeToString(buf[:8]),
+		Bytes: buf[8 : 8+Size],
+		IV:    buf[8+Size:],
+	}, nil
+}
+
+// URI returns the key server URI of a key, {base}/{roomID}/{sessionID}/{keyID}.key.
+func URI(base, roomID, sessionID, keyID string) string {
+	return fmt.Sprintf("%s/%s/%s/%s.key", strings.TrimSuffix(base, "/"), roomID, sessionID, keyID)
+}
+
+// RedisConfig holds the Redis store shared by the service encrypting segments and the key server.
+type RedisConfig struct {
+	Address   string
+	Password  string
+	DB        int
+	KeyPrefix string
+	TTL       time.Duration // 0 = keys never expire
+}
+
+// Store keeps the content keys of every session in a Redis hash, keyed by key ID.
+type Store struct {
+	client    *redis.Client
+	keyPrefix string
+	ttl       time.Duration
+}
+
+// NewRedisStore creates a new Redis-backed content key store.
+func NewRedisStore(cfg RedisConfig) (*Store, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &Store{
+		client:    client,
+		keyPrefix: cfg.KeyPrefix,
+		ttl:       cfg.TTL,
+	}, nil
+}
+
+// key returns the Redis key of a session's content keys.
+func (s *Store) key(roomID, sessionID string) string {
+	return s.keyPrefix + roomID + ":" + sessionID
+}
+
+// Put stores a content key of a session.
+func (s *Store) Put(ctx context.Context, roomID, sessionID string, key *Key) error {
+	redisKey := s.key(roomID, sessionID)
+
+	pipe := s.client.TxPipeline()
+	pipe.HSet(ctx, redisKey, key.ID, key.Bytes)
+	if s.ttl > 0 {
+		pipe.Expire(ctx, redisKey, s.ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store content key: %w", err)
+	}
+	return nil
+}
+
+// Get returns the bytes of a session's content key.
+func (s *Store) Get(ctx context.Context, roomID, sessionID, keyID string) ([]byte, error) {
+	data, err := s.client.HGet(ctx, s.key(roomID, sessionID), keyID).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+		}
+		return nil, fmt.Errorf("failed to get content key: %w", err)
+	}
+	if len(data) != Size {
+		return nil, fmt.Errorf("invalid content key %s: %d bytes", keyID, len(data))
+	}
+	return data, nil
+}
+
+// DeleteSession removes every content key of a session.
+func (s *Store) DeleteSession(ctx context.Context, roomID, sessionID string) error {
+	if err := s.client.Del(ctx, s.key(roomID, sessionID)).Err(); err != nil {
+		return fmt.Errorf("failed to delete content keys: %w", err)
+	}
+	return nil
+}
+
+// Close closes the Redis connection.
+func (s *Store) Close() error {
+	return s.client.Close()
+}
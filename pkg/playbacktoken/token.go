@@ -0,0 +1,188 @@
+package playbacktoken
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// QueryParam is the URL query parameter carrying the playback token.
+const QueryParam = "token"
+
+var (
+	ErrMissingToken = errors.New("missing playback token")
+	ErrInvalidToken = errors.New("invalid playback token")
+	ErrExpiredToken = errors.New("playback token has expired")
+)
+
+// Claims is the content of a playback token.
+type Claims struct {
+	RoomID    string `json:"room_id"`
+	SessionID string `json:"session_id,omitempty"` // Empty grants every session of the room
+	ExpiresAt int64  `json:"exp"`                  // Unix seconds
+	IP        string `json:"ip,omitempty"`         // Client address the token is bound to, empty for any
+}
+
+// Allows reports whether the claims grant access to a room and session from the given client address.
+// An empty sessionID only checks the room, for requests that don't name a session.
+func (c *Claims) Allows(roomID, sessionID, ip string) bool {
+	if c.RoomID != roomID {
+		return false
+	}
+	if c.SessionID != "" && sessionID != "" && c.SessionID != sessionID {
+		return false
+	}
+	if c.IP != "" && c.IP != ip {
+		return false
+	}
+	return true
+}
+
+// Signer issues and verifies HMAC-SHA256 signed playback tokens.
+// A token is the base64url encoded JSON claims and signature joined by a dot.
+type Signer struct {
+	secret []byte
+}
+
+// NewSigner creates a signer with a shared secret.
+func NewSigner(secret string) (*Signer, error) {
+	if secret == "" {
+		return nil, errors.New("playback token secret is empty")
+	}
+	return &Signer{secret: []byte(secret)}, nil
+}
+
+// Sign returns a token for the claims.
+func (s *Signer) Sign(claims Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+// Verify checks the signature and expiry of a token and returns its claims.
+func (s *Signer) Verify(token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, s.mac(encoded)) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+func (s *Signer) mac(encoded string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
+
+// Proxies are the reverse proxies trusted to name the client of a request in the
+// X-Forwarded-For and X-Real-IP headers. Anyone else can set them to any address.
+type Proxies struct {
+	nets []*net.IPNet
+}
+
+// ParseProxies parses the addresses and CIDR ranges of trusted proxies.
+func ParseProxies(addrs []string) (*Proxies, error) {
+	p := &Proxies{}
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if !strings.Contains(addr, "/") {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", addr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			p.nets = append(p.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", addr, err)
+		}
+		p.nets = append(p.nets, ipNet)
+	}
+	return p, nil
+}
+
+// trusts reports whether an address belongs to a trusted proxy.
+func (p *Proxies) trusts(addr string) bool {
+	if p == nil {
+		return false
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that sent a request. Forwarding headers are only
+// honored on requests from a trusted proxy: X-Forwarded-For is read from the right, skipping
+// the trusted proxies it passed, then X-Real-IP. A nil Proxies trusts no proxy.
+// Issuers and verifiers must use the same rule for IP bound tokens to match.
+func (p *Proxies) ClientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if !p.trusts(peer) {
+		return peer
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop != "" && !p.trusts(hop) {
+				return hop
+			}
+		}
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	return peer
+}
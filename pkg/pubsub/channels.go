@@ -24,6 +24,7 @@ const (
 	EventServerICECandidate = "server_ice_candidate"
 	EventStreamReady        = "stream_ready"
 	EventStreamEnded        = "stream_ended"
+	EventStreamHealth       = "stream_health"
 )
 
 // SignalToMediaChannel returns the channel name for Signal -> Media events.
@@ -73,11 +74,36 @@ type ServerICECandidatePayload struct {
 
 // StreamReadyPayload is sent when HLS streaming is ready.
 type StreamReadyPayload struct {
-	RoomID string `json:"room_id"`
-	HLSUrl string `json:"hls_url"`
+	RoomID    string `json:"room_id"`
+	SessionID string `json:"session_id,omitempty"`
+	HLSUrl    string `json:"hls_url"`
 }
 
 // StreamEndedPayload is sent when the stream has ended.
 type StreamEndedPayload struct {
 	RoomID string `json:"room_id"`
 }
+
+// Stream health status values.
+const (
+	StreamHealthGood = "good"
+	StreamHealthFair = "fair"
+	StreamHealthPoor = "poor"
+)
+
+// StreamHealthPayload is sent periodically with ingest and packaging metrics of a live stream.
+type StreamHealthPayload struct {
+	RoomID           string   `json:"room_id"`
+	SessionID        string   `json:"session_id,omitempty"`
+	Status           string   `json:"status"`            // "good", "fair" or "poor"
+	Issues           []string `json:"issues,omitempty"`  // Human readable reasons for a degraded status
+	BitrateKbps      float64  `json:"bitrate_kbps"`      // Ingest bitrate of all received RTP streams
+	FPS              float64  `json:"fps"`               // Ingest frame rate of the primary video track
+	PacketLoss       float64  `json:"packet_loss"`       // Fraction of video packets lost since the last report (0-1)
+	JitterMs         float64  `json:"jitter_ms"`         // Interarrival jitter of the primary video track
+	KeyframeInterval float64  `json:"keyframe_interval"` // Seconds between the last two keyframes, 0 if unknown
+	EncoderSpeed     float64  `json:"encoder_speed"`     // FFmpeg processing speed relative to realtime, 0 if unknown
+	EncoderFPS       float64  `json:"encoder_fps"`       // FFmpeg output frame rate, 0 if unknown
+	SegmentLag       float64  `json:"segment_lag"`       // Seconds since the live playlist was last updated
+	Timestamp        int64    `json:"timestamp"`         // Unix milliseconds
+}
@@ -0,0 +1,390 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxBufferedWrite is the largest write held in memory for replication, larger or
+// unknown sized content is spooled to a temporary file.
+const maxBufferedWrite = 16 << 20
+
+// healthCheckKey is probed with Exists to check that a backend responds.
+const healthCheckKey = ".healthcheck"
+
+// FailoverBackend is a named backend of a FailoverStorage.
+type FailoverBackend struct {
+	Name    string
+	Storage Storage
+}
+
+// FailoverConfig holds configuration for failover storage.
+type FailoverConfig struct {
+	HealthCheckInterval time.Duration // Between probes of every backend
+	HealthCheckTimeout  time.Duration
+	FailureThreshold    int              // Consecutive failures before a backend is taken out of rotation
+	Observer            FailoverObserver // Optional, notified of failover events
+}
+
+// FailoverObserver is notified of failover events, e.g. to log them or export metrics.
+type FailoverObserver interface {
+	// BackendHealthChanged is called when a backend is taken out of or back into rotation.
+	BackendHealthChanged(backend string, healthy bool, err error)
+
+	// ReadFailedOver is called when a read falls back from a failing backend to the next.
+	ReadFailedOver(op, backend string, err error)
+
+	// ReplicationFailed is called when a write or delete fails on one of the backends.
+	ReplicationFailed(op, backend string, err error)
+}
+
+// failoverBackend is a backend with its health state.
+type failoverBackend struct {
+	FailoverBackend
+	healthy  atomic.Bool
+	failures atomic.Int32
+}
+
+// FailoverStorage implements Storage over backends in priority order, e.g. S3 with a local mirror.
+// Reads are served by the first healthy backend that has the content, falling back to the next
+// one on errors. Writes and deletes are replicated to every healthy backend and succeed if any
+// backend accepts them. Backends are probed periodically and taken out of rotation after
+// repeated failures, so an outage costs one failed attempt per request at most until detected.
+type FailoverStorage struct {
+	backends []*failoverBackend
+	cfg      FailoverConfig
+
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewFailoverStorage creates a failover storage over the given backends, the first being the primary,
+// and starts health checking them. Close stops the health checks.
+func NewFailoverStorage(backends []FailoverBackend, cfg FailoverConfig) (*FailoverStorage, error) {
+	if len(backends) == 0 {
+		return nil, errors.New("failover storage requires at least one backend")
+	}
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = 10 * time.Second
+	}
+	if cfg.HealthCheckTimeout <= 0 {
+		cfg.HealthCheckTimeout = 3 * time.Second
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 3
+	}
+
+	s := &FailoverStorage{
+		cfg:    cfg,
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+	for _, b := range backends {
+		backend := &failoverBackend{FailoverBackend: b}
+		backend.healthy.Store(true)
+		s.backends = append(s.backends, backend)
+	}
+
+	go s.healthCheckLoop()
+
+	return s, nil
+}
+
+// Close stops health checking. The backends are not closed.
+func (s *FailoverStorage) Close() error {
+	s.stopOnce.Do(func() { close(s.stopCh) })
+	<-s.doneCh
+	return nil
+}
+
+// Healthy returns the health of each backend by name.
+func (s *FailoverStorage) Healthy() map[string]bool {
+	health := make(map[string]bool, len(s.backends))
+	for _, b := range s.backends {
+		health[b.Name] = b.healthy.Load()
+	}
+	return health
+}
+
+func (s *FailoverStorage) healthCheckLoop() {
+	defer close(s.doneCh)
+
+	ticker := time.NewTicker(s.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			for _, b := range s.backends {
+				ctx, cancel := context.WithTimeout(context.Background(), s.cfg.HealthCheckTimeout)
+				_, err := b.Storage.Exists(ctx, healthCheckKey)
+				cancel()
+				s.record(b, err)
+			}
+		}
+	}
+}
+
+// record updates the health of a backend after an operation. Missing content is a healthy response
+// and a request cancelled by its caller says nothing about the backend.
+func (s *FailoverStorage) record(b *failoverBackend, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil || errors.Is(err, ErrNotFound) {
+		b.failures.Store(0)
+		if !b.healthy.Swap(true) && s.cfg.Observer != nil {
+			s.cfg.Observer.BackendHealthChanged(b.Name, true, nil)
+		}
+		return
+	}
+
+	if b.failures.Add(1) >= int32(s.cfg.FailureThreshold) {
+		if b.healthy.Swap(false) && s.cfg.Observer != nil {
+			s.cfg.Observer.BackendHealthChanged(b.Name, false, err)
+		}
+	}
+}
+
+// available returns the healthy backends in priority order, or all of them when none
+// is healthy so the operation is at least attempted.
+func (s *FailoverStorage) available() []*failoverBackend {
+	var healthy []*failoverBackend
+	for _, b := range s.backends {
+		if b.healthy.Load() {
+			healthy = append(healthy, b)
+		}
+	}
+	if len(healthy) == 0 {
+		return s.backends
+	}
+	return healthy
+}
+
+// read runs a read operation on each available backend in turn until one succeeds.
+// Backends that don't have the content are skipped, since a mirror may be behind or
+// may have received writes while the primary was down. Returns ErrNotFound if no backend
+// has the content, otherwise the last error.
+func (s *FailoverStorage) read(op string, fn func(Storage) error) error {
+	var lastErr error
+	notFound := false
+	for _, b := range s.available() {
+		err := fn(b.Storage)
+		s.record(b, err)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, ErrNotFound) {
+			notFound = true
+			continue
+		}
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		lastErr = fmt.Errorf("%s: %w", b.Name, err)
+		if s.cfg.Observer != nil {
+			s.cfg.Observer.ReadFailedOver(op, b.Name, err)
+		}
+	}
+	if lastErr == nil && notFound {
+		return ErrNotFound
+	}
+	return lastErr
+}
+
+// replicate runs a write operation on every available backend. Succeeds if any backend succeeds.
+func (s *FailoverStorage) replicate(op string, fn func(Storage) error) error {
+	var errs []error
+	succeeded := false
+	for _, b := range s.available() {
+		err := fn(b.Storage)
+		s.record(b, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+			if s.cfg.Observer != nil {
+				s.cfg.Observer.ReplicationFailed(op, b.Name, err)
+			}
+			continue
+		}
+		succeeded = true
+	}
+	if !succeeded {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// Write stores content on every healthy backend.
+// The content is buffered, in memory or in a temporary file, so it can be written more than once.
+func (s *FailoverStorage) Write(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	content, cleanup, err := spool(r, size)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return s.replicate("write", func(backend Storage) error {
+		if _, err := content.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind content: %w", err)
+		}
+		return backend.Write(ctx, key, content, size, contentType)
+	})
+}
+
+// spool buffers content for replicated writes.
+func spool(r io.Reader, size int64) (io.ReadSeeker, func(), error) {
+	if size >= 0 && size <= maxBufferedWrite {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to buffer content: %w", err)
+		}
+		return bytes.NewReader(data), func() {}, nil
+	}
+
+	tmpFile, err := os.CreateTemp("", "failover-write-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	cleanup := func() {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	}
+	if _, err := io.Copy(tmpFile, r); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to buffer content: %w", err)
+	}
+	return tmpFile, cleanup, nil
+}
+
+// Read retrieves content from the first backend that has it.
+func (s *FailoverStorage) Read(ctx context.Context, key string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := s.read("read", func(backend Storage) error {
+		var err error
+		rc, err = backend.Read(ctx, key)
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return rc, err
+}
+
+// ReadRange retrieves a byte range from the first backend that has the content.
+func (s *FailoverStorage) ReadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := s.read("read_range", func(backend Storage) error {
+		var err error
+		rc, err = backend.ReadRange(ctx, key, offset, length)
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return rc, err
+}
+
+// Stat returns metadata from the first backend that has the content.
+func (s *FailoverStorage) Stat(ctx context.Context, key string) (*FileInfo, error) {
+	var info *FileInfo
+	err := s.read("stat", func(backend Storage) error {
+		var err error
+		info, err = backend.Stat(ctx, key)
+		return err
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return info, err
+}
+
+// Delete removes content from every healthy backend.
+func (s *FailoverStorage) Delete(ctx context.Context, key string) error {
+	return s.replicate("delete", func(backend Storage) error {
+		return backend.Delete(ctx, key)
+	})
+}
+
+// DeletePrefix removes content under a prefix from every healthy backend.
+func (s *FailoverStorage) DeletePrefix(ctx context.Context, prefix string) error {
+	return s.replicate("delete_prefix", func(backend Storage) error {
+		return backend.DeletePrefix(ctx, prefix)
+	})
+}
+
+// List returns the files under a prefix on every reachable backend, merged by key
+// with the metadata of the highest priority backend.
+func (s *FailoverStorage) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	var result []FileInfo
+	seen := make(map[string]bool)
+	var lastErr error
+	listed := false
+
+	for _, b := range s.available() {
+		files, err := b.Storage.List(ctx, prefix)
+		s.record(b, err)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", b.Name, err)
+			if s.cfg.Observer != nil {
+				s.cfg.Observer.ReadFailedOver("list", b.Name, err)
+			}
+			continue
+		}
+		listed = true
+		for _, f := range files {
+			if !seen[f.Key] {
+				seen[f.Key] = true
+				result = append(result, f)
+			}
+		}
+	}
+
+	if !listed {
+		return nil, lastErr
+	}
+	return result, nil
+}
+
+// Exists checks if any backend has the content.
+func (s *FailoverStorage) Exists(ctx context.Context, key string) (bool, error) {
+	found := false
+	err := s.read("exists", func(backend Storage) error {
+		exists, err := backend.Exists(ctx, key)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound // Try the next backend
+		}
+		found = true
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+	return found, nil
+}
+
+// GetURL returns a URL from the first backend that can provide one.
+func (s *FailoverStorage) GetURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	var url string
+	err := s.read("get_url", func(backend Storage) error {
+		var err error
+		url, err = backend.GetURL(ctx, key, expires)
+		return err
+	})
+	return url, err
+}
+
+// Ensure FailoverStorage implements Storage interface
+var _ Storage = (*FailoverStorage)(nil)
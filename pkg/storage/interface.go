@@ -2,16 +2,21 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
 	"time"
 )
 
+// ErrNotFound is returned by Read, ReadRange and Stat when no content exists for the key.
+var ErrNotFound = errors.New("content not found")
+
 // FileInfo represents metadata about a stored file.
 type FileInfo struct {
 	Key          string
 	Size         int64
 	LastModified time.Time
 	ContentType  string
+	ETag         string // Quoted entity tag, set by Stat
 }
 
 // Storage defines the interface for file storage operations.
@@ -22,9 +27,19 @@ type Storage interface {
 	Write(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
 
 	// Read retrieves content for the given key.
+	// Returns an error wrapping ErrNotFound if the content does not exist.
 	// The caller is responsible for closing the returned ReadCloser.
 	Read(ctx context.Context, key string) (io.ReadCloser, error)
 
+	// ReadRange retrieves length bytes of content starting at offset.
+	// A negative length reads to the end of the content.
+	// The caller is responsible for closing the returned ReadCloser.
+	ReadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+
+	// Stat returns metadata for the content with the given key.
+	// Returns an error wrapping ErrNotFound if the content does not exist.
+	Stat(ctx context.Context, key string) (*FileInfo, error)
+
 	// Delete removes the content with the given key.
 	Delete(ctx context.Context, key string) error
 
@@ -99,7 +99,7 @@ func (s *LocalStorage) Read(ctx context.Context, key string) (io.ReadCloser, err
 	file, err := os.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("file not found: %s", key)
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
 		}
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
@@ -107,6 +107,55 @@ func (s *LocalStorage) Read(ctx context.Context, key string) (io.ReadCloser, err
 	return file, nil
 }
 
+// ReadRange retrieves length bytes of content starting at offset.
+func (s *LocalStorage) ReadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	file, err := s.Read(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	f := file.(*os.File)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to seek file: %w", err)
+	}
+	if length < 0 {
+		return f, nil
+	}
+
+	return &limitedReadCloser{Reader: io.LimitReader(f, length), Closer: f}, nil
+}
+
+// limitedReadCloser reads a section of a file and closes the file.
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Stat returns metadata for the content with the given key.
+func (s *LocalStorage) Stat(ctx context.Context, key string) (*FileInfo, error) {
+	path := s.fullPath(key)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	return &FileInfo{
+		Key:          key,
+		Size:         info.Size(),
+		LastModified: info.ModTime(),
+		// Files are replaced atomically, so size and mtime identify a version
+		ETag: fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+	}, nil
+}
+
 // Delete removes the content with the given key.
 func (s *LocalStorage) Delete(ctx context.Context, key string) error {
 	path := s.fullPath(key)
@@ -224,7 +273,7 @@ func (s *LocalStorage) GetURL(ctx context.Context, key string, expires time.Dura
 	// Check if file exists
 	if _, err := os.Stat(path); err != nil {
 		if os.IsNotExist(err) {
-			return "", fmt.Errorf("file not found: %s", key)
+			return "", fmt.Errorf("%w: %s", ErrNotFound, key)
 		}
 		return "", fmt.Errorf("failed to stat file: %w", err)
 	}
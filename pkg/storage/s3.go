@@ -117,12 +117,62 @@ func (s *S3Storage) Read(ctx context.Context, key string) (io.ReadCloser, error)
 		Key:    aws.String(key),
 	})
 	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
 		return nil, fmt.Errorf("failed to get object from S3: %w", err)
 	}
 
 	return output.Body, nil
 }
 
+// ReadRange retrieves length bytes of content starting at offset.
+func (s *S3Storage) ReadRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		if length == 0 {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(byteRange),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to get object range from S3: %w", err)
+	}
+
+	return output.Body, nil
+}
+
+// Stat returns metadata for the content with the given key.
+func (s *S3Storage) Stat(ctx context.Context, key string) (*FileInfo, error) {
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	return &FileInfo{
+		Key:          key,
+		Size:         aws.ToInt64(output.ContentLength),
+		LastModified: aws.ToTime(output.LastModified),
+		ContentType:  aws.ToString(output.ContentType),
+		ETag:         aws.ToString(output.ETag),
+	}, nil
+}
+
 // Delete removes the content with the given key.
 func (s *S3Storage) Delete(ctx context.Context, key string) error {
 	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
@@ -213,7 +263,7 @@ func (s *S3Storage) Exists(ctx context.Context, key string) (bool, error) {
 	})
 	if err != nil {
 		// Check if it's a "not found" error
-		if strings.Contains(err.Error(), "NotFound") || strings.Contains(err.Error(), "404") {
+		if isNotFound(err) {
 			return false, nil
 		}
 		return false, fmt.Errorf("failed to check object existence: %w", err)
@@ -243,6 +293,11 @@ func (s *S3Storage) GetURL(ctx context.Context, key string, expires time.Duratio
 	return presignedReq.URL, nil
 }
 
+// isNotFound reports whether err is an S3 "not found" response.
+func isNotFound(err error) bool {
+	return strings.Contains(err.Error(), "NotFound") || strings.Contains(err.Error(), "404")
+}
+
 // GetBucket returns the bucket name.
 func (s *S3Storage) GetBucket() string {
 	return s.bucket
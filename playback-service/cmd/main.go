@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,11 +11,17 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/weiawesome/wes-io-live/pkg/entitlement"
+	"github.com/weiawesome/wes-io-live/pkg/hlskey"
 	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/pkg/playbacktoken"
 	"github.com/weiawesome/wes-io-live/pkg/storage"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/client"
 	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
 	"github.com/weiawesome/wes-io-live/playback-service/internal/handler"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/kafka"
 	"github.com/weiawesome/wes-io-live/playback-service/internal/service"
 )
 
@@ -47,6 +54,9 @@ func main() {
 	if err != nil {
 		logger.Fatal().Err(err).Msg("failed to initialize storage")
 	}
+	if closer, ok := store.(io.Closer); ok {
+		defer closer.Close()
+	}
 	logger.Info().Msg("storage initialized successfully")
 
 	// Initialize session store
@@ -57,17 +67,97 @@ func main() {
 	logger.Info().Str("type", cfg.Session.Type).Msg("session store initialized")
 
 	// Initialize content provider
-	contentProvider := service.NewContentProvider(store, cfg.Playback, cfg.Storage.Type)
+	contentProvider := service.NewContentProvider(store, cfg.Playback, cfg.Cache, cfg.Storage.Type)
 	logger.Info().Bool("redirect_mode", contentProvider.IsRedirectMode()).Msg("content provider initialized")
 
+	// Initialize playback token verification
+	proxies, err := playbacktoken.ParseProxies(cfg.Playback.Token.TrustedProxies)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to parse trusted proxies")
+	}
+	var tokenSigner *playbacktoken.Signer
+	if cfg.Playback.Token.Enabled {
+		tokenSigner, err = playbacktoken.NewSigner(cfg.Playback.Token.Secret)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to initialize playback tokens")
+		}
+		logger.Info().Msg("playback tokens required for live and VOD content")
+	}
+
+	// Identify room owners for streamer-only requests
+	owners, ownersCleanup, err := initOwners(cfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to initialize owner authorization")
+	}
+	defer ownersCleanup()
+
+	// Initialize the key server of encrypted sessions
+	var keySvc *service.KeyService
+	if cfg.Keys.Enabled {
+		var keysCleanup func()
+		keySvc, keysCleanup, err = initKeys(cfg, proxies, owners)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to initialize key server")
+		}
+		defer keysCleanup()
+	}
+
+	// Initialize ad insertion
+	var adInserter *service.AdInserter
+	if cfg.Ads.Enabled {
+		adInserter = service.NewAdInserter(service.NewStaticAdDecider(cfg.Ads), cfg.Playback.StoragePrefix, cfg.Ads)
+		logger.Info().Strs("rooms", cfg.Ads.Rooms).Msg("ad insertion enabled")
+	}
+
+	// Initialize session markers
+	var markerSvc *service.MarkerService
+	if cfg.Markers.Enabled {
+		markerLock, err := service.NewMarkerLock(cfg.Markers.Redis)
+		if err != nil {
+			logger.Warn().Err(err).Msg("failed to connect to markers redis, marker updates are only serialized within this instance")
+		} else {
+			defer markerLock.Close()
+		}
+		markerSvc = service.NewMarkerService(store, contentProvider, sessionStore, markerLock, cfg.Playback, cfg.Markers)
+	}
+
+	// Initialize subtitle tracks
+	var subtitleSvc *service.SubtitleService
+	if cfg.Subtitles.Enabled {
+		subtitleSvc = service.NewSubtitleService(store, contentProvider, cfg.Playback, cfg.Subtitles)
+	}
+
 	// Initialize playback service
-	playbackSvc := service.NewPlaybackService(contentProvider, sessionStore, cfg.Playback)
+	playbackSvc := service.NewPlaybackService(contentProvider, sessionStore, tokenSigner, proxies, adInserter, markerSvc, subtitleSvc, cfg.Playback)
+	clipSvc := service.NewClipService(store, contentProvider, playbackSvc, keySvc, cfg.Playback)
+
+	var exportSvc *service.ExportService
+	if cfg.Export.Enabled {
+		exportSvc = service.NewExportService(store, contentProvider, keySvc, cfg.Playback, cfg.Export)
+	}
+
+	var audioSvc *service.AudioService
+	if cfg.Audio.Enabled {
+		audioSvc = service.NewAudioService(playbackSvc, exportSvc, cfg.Audio)
+	}
+
+	// Initialize playback analytics
+	var analyticsSvc *service.AnalyticsService
+	if cfg.Analytics.Enabled {
+		var analyticsCleanup func()
+		analyticsSvc, analyticsCleanup = initAnalytics(ctx, cfg)
+		if analyticsCleanup != nil {
+			defer analyticsCleanup()
+		}
+	}
 
 	// Initialize handlers
 	healthHandler := handler.NewHealthHandler(version)
 	liveHandler := handler.NewLiveHandler(playbackSvc)
-	vodHandler := handler.NewVODHandler(playbackSvc)
+	vodHandler := handler.NewVODHandler(playbackSvc, exportSvc, owners)
 	previewHandler := handler.NewPreviewHandler(playbackSvc)
+	clipHandler := handler.NewClipHandler(clipSvc, playbackSvc, owners)
+	adHandler := handler.NewAdHandler(playbackSvc)
 
 	// Setup Gin router
 	r := gin.New()
@@ -79,6 +169,24 @@ func main() {
 	liveHandler.RegisterRoutes(r)
 	vodHandler.RegisterRoutes(r)
 	previewHandler.RegisterRoutes(r)
+	clipHandler.RegisterRoutes(r)
+	adHandler.RegisterRoutes(r)
+	if markerSvc != nil {
+		handler.NewMarkerHandler(markerSvc, playbackSvc, owners).RegisterRoutes(r)
+	}
+	if subtitleSvc != nil {
+		handler.NewSubtitleHandler(subtitleSvc, playbackSvc, owners).RegisterRoutes(r)
+	}
+	if keySvc != nil {
+		handler.NewKeyHandler(keySvc).RegisterRoutes(r)
+	}
+	if audioSvc != nil {
+		handler.NewAudioHandler(audioSvc, playbackSvc, exportSvc, owners).RegisterRoutes(r)
+	}
+	if analyticsSvc != nil {
+		handler.NewAnalyticsHandler(analyticsSvc, playbackSvc, owners).RegisterRoutes(r)
+	}
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
@@ -116,7 +224,33 @@ func main() {
 
 // initStorage initializes the storage backend based on configuration.
 func initStorage(ctx context.Context, cfg *config.Config) (storage.Storage, error) {
-	switch cfg.Storage.Type {
+	if cfg.Storage.Type != "failover" {
+		return newStorageBackend(ctx, cfg, cfg.Storage.Type)
+	}
+
+	// Multi-origin: reads fail over from the primary to the secondary, writes go to both
+	if cfg.Storage.Failover.Secondary == "" || cfg.Storage.Failover.Secondary == cfg.Storage.Failover.Primary {
+		return nil, fmt.Errorf("failover storage requires a secondary backend other than %q, kept in sync with the primary", cfg.Storage.Failover.Primary)
+	}
+	var backends []storage.FailoverBackend
+	for _, backendType := range []string{cfg.Storage.Failover.Primary, cfg.Storage.Failover.Secondary} {
+		backend, err := newStorageBackend(ctx, cfg, backendType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize %s storage backend: %w", backendType, err)
+		}
+		backends = append(backends, storage.FailoverBackend{Name: backendType, Storage: backend})
+	}
+
+	return storage.NewFailoverStorage(backends, storage.FailoverConfig{
+		HealthCheckInterval: time.Duration(cfg.Storage.Failover.HealthCheckInterval) * time.Second,
+		FailureThreshold:    cfg.Storage.Failover.FailureThreshold,
+		Observer:            service.NewStorageObserver(cfg.Storage.Failover.Primary, cfg.Storage.Failover.Secondary),
+	})
+}
+
+// newStorageBackend initializes a single storage backend.
+func newStorageBackend(ctx context.Context, cfg *config.Config, backendType string) (storage.Storage, error) {
+	switch backendType {
 	case "s3":
 		return storage.NewS3Storage(ctx, storage.S3Config{
 			Endpoint:        cfg.Storage.S3.Endpoint,
@@ -132,7 +266,7 @@ func initStorage(ctx context.Context, cfg *config.Config) (storage.Storage, erro
 			BasePath: cfg.Storage.Local.BasePath,
 		})
 	default:
-		return nil, fmt.Errorf("unsupported storage type: %s", cfg.Storage.Type)
+		return nil, fmt.Errorf("unsupported storage type: %s", backendType)
 	}
 }
 
@@ -168,3 +302,135 @@ func initSessionStore(cfg *config.Config) (service.SessionStore, func()) {
 		return service.NewNoOpSessionStore(), nil
 	}
 }
+
+// initOwners initializes the auth-service and room-service clients identifying room owners.
+func initOwners(cfg *config.Config) (*service.OwnerAuthorizer, func(), error) {
+	authClient, err := client.NewAuthClient(cfg.Auth.GRPCAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+	roomClient := client.NewRoomClient(cfg.Auth.RoomHTTPAddress, time.Duration(cfg.Auth.RoomCacheTTL)*time.Second)
+
+	return service.NewOwnerAuthorizer(authClient, roomClient), func() {
+		authClient.Close()
+	}, nil
+}
+
+// initKeys initializes the key server: the content key store shared with media-service and
+// the credentials viewers authorize with. At least one of JWTs or playback tokens must be accepted.
+func initKeys(cfg *config.Config, proxies *playbacktoken.Proxies, owners *service.OwnerAuthorizer) (*service.KeyService, func(), error) {
+	l := pkglog.L()
+
+	store, err := hlskey.NewRedisStore(hlskey.RedisConfig{
+		Address:   cfg.Keys.Redis.Address,
+		Password:  cfg.Keys.Redis.Password,
+		DB:        cfg.Keys.Redis.DB,
+		KeyPrefix: cfg.Keys.Redis.KeyPrefix,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Viewers authorize with their JWT, validated by auth-service, or a playback token
+	var authClient *client.AuthClient
+	if cfg.Keys.AuthGRPCAddress != "" {
+		authClient, err = client.NewAuthClient(cfg.Keys.AuthGRPCAddress)
+		if err != nil {
+			store.Close()
+			return nil, nil, err
+		}
+	}
+	var tokenSigner *playbacktoken.Signer
+	if cfg.Playback.Token.Secret != "" {
+		tokenSigner, err = playbacktoken.NewSigner(cfg.Playback.Token.Secret)
+		if err != nil {
+			store.Close()
+			return nil, nil, err
+		}
+	}
+	if authClient == nil && tokenSigner == nil {
+		store.Close()
+		return nil, nil, fmt.Errorf("key server requires auth.grpc_address or a playback token secret")
+	}
+
+	// Viewers authorizing with their JWT must be entitled to restricted rooms, grants share the key store Redis unless configured
+	entitlementCfg := entitlement.Config{
+		Rooms:     cfg.Entitlement.Rooms,
+		Address:   cfg.Entitlement.Address,
+		Password:  cfg.Entitlement.Password,
+		DB:        cfg.Entitlement.DB,
+		KeyPrefix: cfg.Entitlement.KeyPrefix,
+	}
+	if entitlementCfg.Address == "" {
+		entitlementCfg.Address = cfg.Keys.Redis.Address
+		entitlementCfg.Password = cfg.Keys.Redis.Password
+	}
+	entitlements, err := entitlement.NewChecker(entitlementCfg)
+	if err != nil {
+		if authClient != nil {
+			authClient.Close()
+		}
+		store.Close()
+		return nil, nil, err
+	}
+
+	l.Info().Bool("jwt", authClient != nil).Bool("playback_token", tokenSigner != nil).Strs("restricted_rooms", cfg.Entitlement.Rooms).Msg("key server enabled")
+
+	return service.NewKeyService(store, authClient, tokenSigner, proxies, owners, entitlements), func() {
+		if authClient != nil {
+			authClient.Close()
+		}
+		entitlements.Close()
+		if err := store.Close(); err != nil {
+			l.Error().Err(err).Msg("error closing key store")
+		}
+	}, nil
+}
+
+// initAnalytics initializes beacon publishing and the consumer aggregating them into Redis.
+// Returns nil when either Kafka or Redis is unavailable, analytics are then disabled.
+func initAnalytics(ctx context.Context, cfg *config.Config) (*service.AnalyticsService, func()) {
+	l := pkglog.L()
+
+	store, err := service.NewRedisAnalyticsStore(cfg.Analytics.Redis, cfg.Analytics.RetentionDays)
+	if err != nil {
+		l.Warn().Err(err).Msg("failed to connect to analytics redis, playback analytics disabled")
+		return nil, nil
+	}
+
+	producer, err := kafka.NewConfluentProducer(cfg.Analytics.Kafka.Brokers, cfg.Analytics.Kafka.Topic, cfg.Analytics.Kafka.Partitions)
+	if err != nil {
+		l.Warn().Err(err).Msg("failed to create kafka producer, playback analytics disabled")
+		store.Close()
+		return nil, nil
+	}
+
+	analyticsSvc := service.NewAnalyticsService(producer, store)
+
+	consumerCtx, cancel := context.WithCancel(ctx)
+	consumer, err := kafka.NewConfluentConsumer(cfg.Analytics.Kafka.Brokers, cfg.Analytics.Kafka.Topic, cfg.Analytics.Kafka.GroupID, analyticsSvc)
+	if err == nil {
+		err = consumer.Start(consumerCtx)
+	}
+	if err != nil {
+		l.Warn().Err(err).Msg("failed to start kafka consumer, playback analytics disabled")
+		cancel()
+		producer.Close()
+		store.Close()
+		return nil, nil
+	}
+
+	l.Info().Str("brokers", cfg.Analytics.Kafka.Brokers).Str("topic", cfg.Analytics.Kafka.Topic).Msg("playback analytics enabled")
+
+	return analyticsSvc, func() {
+		// Stop the consume loop before closing the consumer it reads from
+		cancel()
+		if err := consumer.Close(); err != nil {
+			l.Error().Err(err).Msg("error closing kafka consumer")
+		}
+		producer.Close()
+		if err := store.Close(); err != nil {
+			l.Error().Err(err).Msg("error closing analytics redis connection")
+		}
+	}
+}
@@ -6,11 +6,21 @@ import (
 
 // Config holds all configuration for the playback service.
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Storage  StorageConfig  `mapstructure:"storage"`
-	Playback PlaybackConfig `mapstructure:"playback"`
-	Session  SessionConfig  `mapstructure:"session"`
-	Log      LogConfig      `mapstructure:"log"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Storage     StorageConfig     `mapstructure:"storage"`
+	Playback    PlaybackConfig    `mapstructure:"playback"`
+	Session     SessionConfig     `mapstructure:"session"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+	Cache       CacheConfig       `mapstructure:"cache"`
+	Export      ExportConfig      `mapstructure:"export"`
+	Analytics   AnalyticsConfig   `mapstructure:"analytics"`
+	Ads         AdsConfig         `mapstructure:"ads"`
+	Markers     MarkersConfig     `mapstructure:"markers"`
+	Subtitles   SubtitlesConfig   `mapstructure:"subtitles"`
+	Audio       AudioConfig       `mapstructure:"audio"`
+	Keys        KeysConfig        `mapstructure:"keys"`
+	Entitlement EntitlementConfig `mapstructure:"entitlement"`
+	Log         LogConfig         `mapstructure:"log"`
 }
 
 // ServerConfig holds HTTP server configuration.
@@ -21,9 +31,21 @@ type ServerConfig struct {
 
 // StorageConfig holds storage backend configuration.
 type StorageConfig struct {
-	Type  string       `mapstructure:"type"` // "local" or "s3"
-	Local LocalConfig  `mapstructure:"local"`
-	S3    S3Config     `mapstructure:"s3"`
+	Type     string         `mapstructure:"type"` // "local", "s3" or "failover"
+	Local    LocalConfig    `mapstructure:"local"`
+	S3       S3Config       `mapstructure:"s3"`
+	Failover FailoverConfig `mapstructure:"failover"`
+}
+
+// FailoverConfig holds multi-origin storage. Reads fail over from the primary to the secondary
+// and writes are replicated to both, each backend configured in its own section above.
+// Only playback-service writes (exports, clips) are replicated, media-service uploads to its own
+// storage, so the secondary must be a mirror kept in sync externally (bucket replication, mc mirror).
+type FailoverConfig struct {
+	Primary             string `mapstructure:"primary"`               // "s3" or "local"
+	Secondary           string `mapstructure:"secondary"`             // "s3" or "local", required, a mirror with the same key layout
+	HealthCheckInterval int    `mapstructure:"health_check_interval"` // seconds
+	FailureThreshold    int    `mapstructure:"failure_threshold"`     // Consecutive failures before a backend is taken out of rotation
 }
 
 // LocalConfig holds local filesystem storage configuration.
@@ -49,6 +71,29 @@ type PlaybackConfig struct {
 	LivePrefix    string `mapstructure:"live_prefix"`    // S3 prefix for live HLS
 	VODPrefix     string `mapstructure:"vod_prefix"`     // S3 prefix for VOD
 	StoragePrefix string `mapstructure:"storage_prefix"` // Global S3 prefix (empty for root)
+
+	ClipPrefix      string `mapstructure:"clip_prefix"`       // S3 prefix for clips
+	ClipMaxDuration int    `mapstructure:"clip_max_duration"` // seconds, 0 = unlimited
+
+	DVRWindow int `mapstructure:"dvr_window"` // seconds of the live broadcast viewers can seek back, 0 = disabled
+
+	Token TokenConfig `mapstructure:"token"`
+}
+
+// TokenConfig holds playback token verification for live and VOD content.
+type TokenConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`         // Require a signed token on every live and VOD request
+	Secret         string   `mapstructure:"secret"`          // HMAC secret shared with signal-service, which issues the tokens
+	TrustedProxies []string `mapstructure:"trusted_proxies"` // Proxies whose X-Forwarded-For/X-Real-IP name the viewer, empty = none
+}
+
+// AuthConfig holds the services identifying room owners for streamer-only requests
+// (clips, exports, markers, subtitles, analytics): auth-service validates their JWT
+// and room-service tells who owns the room.
+type AuthConfig struct {
+	GRPCAddress     string `mapstructure:"grpc_address"`
+	RoomHTTPAddress string `mapstructure:"room_http_address"`
+	RoomCacheTTL    int    `mapstructure:"room_cache_ttl"` // seconds room owners are cached
 }
 
 // SessionConfig holds session store configuration.
@@ -65,6 +110,120 @@ type SessionRedisConfig struct {
 	KeyPrefix string `mapstructure:"key_prefix"`
 }
 
+// CacheConfig holds the in-memory cache for hot playlists and segments in proxy mode.
+type CacheConfig struct {
+	Enabled       bool `mapstructure:"enabled"`
+	MaxSizeMB     int  `mapstructure:"max_size_mb"`     // Total memory for cached content
+	MaxObjectKB   int  `mapstructure:"max_object_kb"`   // Larger objects are served but not cached
+	PlaylistTTLMs int  `mapstructure:"playlist_ttl_ms"` // .m3u8/.mpd, keep below the segment duration
+	SegmentTTL    int  `mapstructure:"segment_ttl"`     // seconds, .ts/.m4s
+	InitTTL       int  `mapstructure:"init_ttl"`        // seconds, fMP4 init segments
+}
+
+// ExportConfig holds MP4 and audio export configuration.
+type ExportConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	MaxConcurrent int    `mapstructure:"max_concurrent"` // FFmpeg remux jobs running at once
+	TempDir       string `mapstructure:"temp_dir"`       // Work directory for downloaded segments, empty = OS temp dir
+	AudioFormat   string `mapstructure:"audio_format"`   // "m4a" (AAC remuxed as-is) or "mp3" (encoded)
+	AudioBitrate  string `mapstructure:"audio_bitrate"`  // MP3 bitrate
+}
+
+// AnalyticsConfig holds playback QoE beacon collection and aggregation.
+type AnalyticsConfig struct {
+	Enabled       bool                 `mapstructure:"enabled"`
+	Kafka         AnalyticsKafkaConfig `mapstructure:"kafka"`
+	Redis         AnalyticsRedisConfig `mapstructure:"redis"`
+	RetentionDays int                  `mapstructure:"retention_days"` // How long aggregates are kept after the last beacon
+}
+
+// AnalyticsKafkaConfig holds the Kafka topic beacons are published to and aggregated from.
+type AnalyticsKafkaConfig struct {
+	Brokers    string `mapstructure:"brokers"`
+	Topic      string `mapstructure:"topic"`
+	GroupID    string `mapstructure:"group_id"`
+	Partitions int    `mapstructure:"partitions"`
+}
+
+// AnalyticsRedisConfig holds the Redis store for aggregated view statistics.
+type AnalyticsRedisConfig struct {
+	Address   string `mapstructure:"address"`
+	Password  string `mapstructure:"password"`
+	DB        int    `mapstructure:"db"`
+	KeyPrefix string `mapstructure:"key_prefix"`
+}
+
+// AdsConfig holds ad insertion for monetized rooms. Creatives are pre-encoded HLS assets
+// stored at {prefix}/{creativeID}/stream.m3u8, in the same container format as the broadcasts.
+type AdsConfig struct {
+	Enabled         bool     `mapstructure:"enabled"`
+	Prefix          string   `mapstructure:"prefix"`            // Storage prefix of creatives
+	Rooms           []string `mapstructure:"rooms"`             // Monetized room IDs, "*" for every room
+	PreRoll         []string `mapstructure:"pre_roll"`          // Creative IDs played before content, rotated per viewer
+	MidRoll         []string `mapstructure:"mid_roll"`          // Creative IDs rotated through mid-roll breaks
+	MidRollInterval int      `mapstructure:"mid_roll_interval"` // seconds of content between mid-roll breaks, 0 = pre-roll only
+}
+
+// MarkersConfig holds session markers: chapters and timed events stored with each VOD
+// session and announced in its playlists.
+type MarkersConfig struct {
+	Enabled       bool               `mapstructure:"enabled"`
+	MaxPerSession int                `mapstructure:"max_per_session"`
+	CacheTTL      int                `mapstructure:"cache_ttl"` // seconds markers are cached for playlist requests
+	Redis         MarkersRedisConfig `mapstructure:"redis"`
+}
+
+// MarkersRedisConfig holds the Redis lock serializing markers file updates across replicas.
+type MarkersRedisConfig struct {
+	Address   string `mapstructure:"address"`
+	Password  string `mapstructure:"password"`
+	DB        int    `mapstructure:"db"`
+	KeyPrefix string `mapstructure:"key_prefix"`
+}
+
+// SubtitlesConfig holds uploaded WebVTT/SRT subtitle tracks of VOD sessions.
+type SubtitlesConfig struct {
+	Enabled       bool `mapstructure:"enabled"`
+	MaxSizeKB     int  `mapstructure:"max_size_kb"`     // Largest accepted upload
+	MaxPerSession int  `mapstructure:"max_per_session"` // Languages per session
+}
+
+// AudioConfig holds the audio-only routes of rooms listened to in the background: the audio-only
+// rendition media-service publishes and a podcast RSS feed of each room's exported sessions.
+type AudioConfig struct {
+	Enabled      bool   `mapstructure:"enabled"`
+	PublicURL    string `mapstructure:"public_url"`    // Base URL of feed links, podcast apps need absolute URLs
+	FeedEpisodes int    `mapstructure:"feed_episodes"` // Most recent sessions listed in a feed
+	FeedLanguage string `mapstructure:"feed_language"`
+}
+
+// KeysConfig holds the key server of encrypted HLS sessions. Keys are read from the Redis
+// store media-service writes them to when it encrypts segments.
+type KeysConfig struct {
+	Enabled         bool                `mapstructure:"enabled"`
+	Redis           KeyStoreRedisConfig `mapstructure:"redis"`
+	AuthGRPCAddress string              `mapstructure:"auth_grpc_address"` // auth-service validating viewer JWTs, empty = playback tokens only
+}
+
+// KeyStoreRedisConfig holds the Redis content key store shared with media-service.
+type KeyStoreRedisConfig struct {
+	Address   string `mapstructure:"address"`
+	Password  string `mapstructure:"password"`
+	DB        int    `mapstructure:"db"`
+	KeyPrefix string `mapstructure:"key_prefix"`
+}
+
+// EntitlementConfig holds the restricted rooms (private rooms, subscriber-only recordings) whose
+// keys only their owner and granted users get, the same rooms and grants signal-service checks
+// before issuing playback tokens.
+type EntitlementConfig struct {
+	Rooms     []string `mapstructure:"rooms"` // Restricted rooms, "*" for every room, empty = none
+	Address   string   `mapstructure:"address"`
+	Password  string   `mapstructure:"password"`
+	DB        int      `mapstructure:"db"`
+	KeyPrefix string   `mapstructure:"key_prefix"`
+}
+
 // LogConfig holds logging configuration.
 type LogConfig struct {
 	Level string `mapstructure:"level"`
@@ -84,14 +243,70 @@ func Load() (*Config, error) {
 	v.SetDefault("storage.local.base_path", "./hls")
 	v.SetDefault("storage.s3.region", "us-east-1")
 	v.SetDefault("storage.s3.use_path_style", true)
+	v.SetDefault("storage.failover.primary", "s3")
+	v.SetDefault("storage.failover.health_check_interval", 10)
+	v.SetDefault("storage.failover.failure_threshold", 3)
 	v.SetDefault("playback.access_mode", "proxy")
 	v.SetDefault("playback.presign_expiry", 3600)
 	v.SetDefault("playback.live_prefix", "live")
 	v.SetDefault("playback.vod_prefix", "vod")
 	v.SetDefault("playback.storage_prefix", "")
+	v.SetDefault("playback.clip_prefix", "clips")
+	v.SetDefault("playback.clip_max_duration", 120)
+	v.SetDefault("playback.dvr_window", 7200)
+	v.SetDefault("playback.token.enabled", false)
+	v.SetDefault("playback.token.trusted_proxies", []string{})
+	v.SetDefault("auth.grpc_address", "localhost:50051")
+	v.SetDefault("auth.room_http_address", "http://localhost:8083")
+	v.SetDefault("auth.room_cache_ttl", 300)
 	v.SetDefault("session.type", "none")
 	v.SetDefault("session.redis.db", 1)
 	v.SetDefault("session.redis.key_prefix", "vod:session:")
+	v.SetDefault("cache.enabled", true)
+	v.SetDefault("cache.max_size_mb", 256)
+	v.SetDefault("cache.max_object_kb", 8192)
+	v.SetDefault("cache.playlist_ttl_ms", 1000)
+	v.SetDefault("cache.segment_ttl", 60)
+	v.SetDefault("cache.init_ttl", 3600)
+	v.SetDefault("export.enabled", true)
+	v.SetDefault("export.max_concurrent", 2)
+	v.SetDefault("export.temp_dir", "")
+	v.SetDefault("export.audio_format", "m4a")
+	v.SetDefault("export.audio_bitrate", "128k")
+	v.SetDefault("analytics.enabled", false)
+	v.SetDefault("analytics.kafka.brokers", "localhost:9092")
+	v.SetDefault("analytics.kafka.topic", "playback-beacons")
+	v.SetDefault("analytics.kafka.group_id", "playback-analytics")
+	v.SetDefault("analytics.kafka.partitions", 4)
+	v.SetDefault("analytics.redis.address", "localhost:6379")
+	v.SetDefault("analytics.redis.db", 1)
+	v.SetDefault("analytics.redis.key_prefix", "playback:analytics:")
+	v.SetDefault("analytics.retention_days", 90)
+	v.SetDefault("ads.enabled", false)
+	v.SetDefault("ads.prefix", "ads")
+	v.SetDefault("ads.mid_roll_interval", 600)
+	v.SetDefault("markers.enabled", true)
+	v.SetDefault("markers.max_per_session", 500)
+	v.SetDefault("markers.cache_ttl", 5)
+	v.SetDefault("markers.redis.address", "localhost:6379")
+	v.SetDefault("markers.redis.db", 1)
+	v.SetDefault("markers.redis.key_prefix", "playback:markers:lock:")
+	v.SetDefault("subtitles.enabled", true)
+	v.SetDefault("subtitles.max_size_kb", 2048)
+	v.SetDefault("subtitles.max_per_session", 20)
+	v.SetDefault("audio.enabled", true)
+	v.SetDefault("audio.public_url", "http://localhost:8087")
+	v.SetDefault("audio.feed_episodes", 50)
+	v.SetDefault("audio.feed_language", "en")
+	v.SetDefault("keys.enabled", false)
+	v.SetDefault("keys.redis.address", "localhost:6379")
+	v.SetDefault("keys.redis.db", 1)
+	v.SetDefault("keys.redis.key_prefix", "hls:key:")
+	v.SetDefault("keys.auth_grpc_address", "localhost:50051")
+	v.SetDefault("entitlement.rooms", []string{})
+	v.SetDefault("entitlement.address", "")
+	v.SetDefault("entitlement.db", 0)
+	v.SetDefault("entitlement.key_prefix", "entitlement:")
 	v.SetDefault("log.level", "info")
 
 	// Bind environment variables
@@ -104,10 +319,39 @@ func Load() (*Config, error) {
 	v.BindEnv("storage.s3.access_key_id", "S3_ACCESS_KEY_ID")
 	v.BindEnv("storage.s3.secret_access_key", "S3_SECRET_ACCESS_KEY")
 	v.BindEnv("storage.s3.public_url", "S3_PUBLIC_URL")
+	v.BindEnv("storage.failover.primary", "STORAGE_FAILOVER_PRIMARY")
+	v.BindEnv("storage.failover.secondary", "STORAGE_FAILOVER_SECONDARY")
 	v.BindEnv("playback.access_mode", "PLAYBACK_ACCESS_MODE")
+	v.BindEnv("playback.dvr_window", "PLAYBACK_DVR_WINDOW")
+	v.BindEnv("playback.token.enabled", "PLAYBACK_TOKEN_ENABLED")
+	v.BindEnv("playback.token.secret", "PLAYBACK_TOKEN_SECRET")
+	v.BindEnv("playback.token.trusted_proxies", "PLAYBACK_TRUSTED_PROXIES")
+	v.BindEnv("auth.grpc_address", "AUTH_GRPC_ADDRESS")
+	v.BindEnv("auth.room_http_address", "ROOM_HTTP_ADDRESS")
 	v.BindEnv("session.type", "SESSION_TYPE")
 	v.BindEnv("session.redis.address", "REDIS_ADDRESS")
 	v.BindEnv("session.redis.password", "REDIS_PASSWORD")
+	v.BindEnv("cache.enabled", "CACHE_ENABLED")
+	v.BindEnv("cache.max_size_mb", "CACHE_MAX_SIZE_MB")
+	v.BindEnv("export.enabled", "EXPORT_ENABLED")
+	v.BindEnv("analytics.enabled", "ANALYTICS_ENABLED")
+	v.BindEnv("analytics.kafka.brokers", "KAFKA_BROKERS")
+	v.BindEnv("analytics.kafka.topic", "KAFKA_BEACON_TOPIC")
+	v.BindEnv("analytics.redis.address", "REDIS_ADDRESS")
+	v.BindEnv("analytics.redis.password", "REDIS_PASSWORD")
+	v.BindEnv("ads.enabled", "ADS_ENABLED")
+	v.BindEnv("markers.enabled", "MARKERS_ENABLED")
+	v.BindEnv("markers.redis.address", "REDIS_ADDRESS")
+	v.BindEnv("markers.redis.password", "REDIS_PASSWORD")
+	v.BindEnv("subtitles.enabled", "SUBTITLES_ENABLED")
+	v.BindEnv("audio.enabled", "AUDIO_ENABLED")
+	v.BindEnv("audio.public_url", "AUDIO_PUBLIC_URL")
+	v.BindEnv("keys.enabled", "KEYS_ENABLED")
+	v.BindEnv("keys.redis.address", "REDIS_ADDRESS")
+	v.BindEnv("keys.redis.password", "REDIS_PASSWORD")
+	v.BindEnv("keys.auth_grpc_address", "AUTH_GRPC_ADDRESS")
+	v.BindEnv("entitlement.rooms", "RESTRICTED_ROOMS")
+	v.BindEnv("entitlement.address", "ENTITLEMENT_REDIS_ADDRESS")
 
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
@@ -118,6 +362,7 @@ func Load() (*Config, error) {
 }
 
 // IsRedirectMode returns true if using redirect mode with S3 storage.
+// Failover storage is always proxied, a presigned URL would bypass the failover.
 func (c *Config) IsRedirectMode() bool {
 	return c.Playback.AccessMode == "redirect" && c.Storage.Type == "s3"
 }
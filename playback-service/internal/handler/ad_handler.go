@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/weiawesome/wes-io-live/playback-service/internal/service"
+)
+
+// AdHandler serves the ad creatives inserted into playlists.
+type AdHandler struct {
+	playbackSvc *service.PlaybackService
+}
+
+// NewAdHandler creates a new ad handler.
+func NewAdHandler(playbackSvc *service.PlaybackService) *AdHandler {
+	return &AdHandler{
+		playbackSvc: playbackSvc,
+	}
+}
+
+// RegisterRoutes registers the ad creative routes.
+func (h *AdHandler) RegisterRoutes(r *gin.Engine) {
+	r.Any("/ads/*path", h.handleAd)
+}
+
+// handleAd handles ad creative requests.
+// Supports:
+// - GET /ads/{creativeID}/{file} - Creative playlist (stream.m3u8) and segments
+func (h *AdHandler) handleAd(c *gin.Context) {
+	w := c.Writer
+	r := c.Request
+
+	// Set CORS headers
+	setCORSHeaders(w)
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse path: /ads/{creativeID}/{file}
+	path := strings.TrimPrefix(c.Param("path"), "/")
+
+	// Security: prevent directory traversal
+	cleanPath := filepath.Clean(path)
+	if strings.Contains(cleanPath, "..") {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts := strings.SplitN(cleanPath, "/", 2)
+	if len(parts) != 2 || !isStreamFile(filepath.Ext(parts[1])) {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := h.playbackSvc.ServeAdContent(r.Context(), w, r, parts[0], parts[1])
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error serving ad content: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/weiawesome/wes-io-live/playback-service/internal/service"
+)
+
+// AnalyticsHandler handles player QoE beacons and view statistics requests.
+type AnalyticsHandler struct {
+	analyticsSvc *service.AnalyticsService
+	playbackSvc  *service.PlaybackService
+	owners       *service.OwnerAuthorizer
+}
+
+// NewAnalyticsHandler creates a new analytics handler.
+func NewAnalyticsHandler(analyticsSvc *service.AnalyticsService, playbackSvc *service.PlaybackService, owners *service.OwnerAuthorizer) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analyticsSvc: analyticsSvc,
+		playbackSvc:  playbackSvc,
+		owners:       owners,
+	}
+}
+
+// RegisterRoutes registers the analytics routes.
+func (h *AnalyticsHandler) RegisterRoutes(r *gin.Engine) {
+	r.Any("/analytics/*path", h.handleAnalytics)
+}
+
+// handleAnalytics handles analytics requests.
+// Supports:
+// - POST /analytics/beacons - Report playback events of a view session
+// - GET /analytics/{roomID}/summary - Aggregated statistics of a room (room owner only)
+// - GET /analytics/{roomID}/{sessionID}/summary - Aggregated statistics of a session (room owner only)
+func (h *AnalyticsHandler) handleAnalytics(c *gin.Context) {
+	w := c.Writer
+	r := c.Request
+
+	// Set CORS headers
+	setCORSHeaders(w)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Parse path: /analytics/beacons or /analytics/{roomID}/.../summary
+	path := strings.TrimPrefix(c.Param("path"), "/")
+	path = strings.TrimSuffix(path, "/")
+
+	// Security: prevent directory traversal
+	cleanPath := filepath.Clean(path)
+	if strings.Contains(cleanPath, "..") {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts := strings.Split(cleanPath, "/")
+
+	switch {
+	case cleanPath == "beacons":
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleBeacons(w, r)
+	case r.Method != "GET":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	case len(parts) == 2 && parts[1] == "summary":
+		h.handleSummary(w, r, parts[0], "")
+	case len(parts) == 3 && parts[2] == "summary":
+		h.handleSummary(w, r, parts[0], parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleBeacons publishes the events of a beacon request.
+// Players may send beacons with navigator.sendBeacon, so any content type is accepted.
+func (h *AnalyticsHandler) handleBeacons(w http.ResponseWriter, r *http.Request) {
+	var req service.BeaconRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Only viewers allowed to play the stream may report on it
+	if err := h.playbackSvc.Authorize(r, req.RoomID, req.SessionID); err != nil {
+		http.Error(w, "Invalid or expired playback token", http.StatusForbidden)
+		return
+	}
+
+	if err := h.analyticsSvc.SubmitBeacons(r.Context(), &req); err != nil {
+		if errors.Is(err, service.ErrInvalidBeacon) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error submitting beacons for room %s: %v", req.RoomID, err)
+		http.Error(w, "Failed to submit beacons", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSummary returns the aggregated statistics of a room or session.
+func (h *AnalyticsHandler) handleSummary(w http.ResponseWriter, r *http.Request, roomID, sessionID string) {
+	if !authorizeOwner(w, r, h.owners, roomID) {
+		return
+	}
+
+	summary, err := h.analyticsSvc.Summary(r.Context(), roomID, sessionID)
+	if err != nil {
+		log.Printf("Error getting analytics summary for room %s: %v", roomID, err)
+		http.Error(w, "Failed to get analytics summary", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	json.NewEncoder(w).Encode(summary)
+}
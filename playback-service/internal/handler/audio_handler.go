@@ -0,0 +1,219 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/weiawesome/wes-io-live/playback-service/internal/service"
+)
+
+// AudioHandler handles audio-only playback, audio exports and podcast feeds.
+type AudioHandler struct {
+	audioSvc    *service.AudioService
+	playbackSvc *service.PlaybackService
+	exportSvc   *service.ExportService // nil if export is disabled
+	owners      *service.OwnerAuthorizer
+}
+
+// NewAudioHandler creates a new audio handler.
+func NewAudioHandler(audioSvc *service.AudioService, playbackSvc *service.PlaybackService, exportSvc *service.ExportService, owners *service.OwnerAuthorizer) *AudioHandler {
+	return &AudioHandler{
+		audioSvc:    audioSvc,
+		playbackSvc: playbackSvc,
+		exportSvc:   exportSvc,
+		owners:      owners,
+	}
+}
+
+// RegisterRoutes registers the audio routes.
+func (h *AudioHandler) RegisterRoutes(r *gin.Engine) {
+	r.Any("/audio/*path", h.handleAudio)
+}
+
+// handleAudio handles audio requests.
+// Supports:
+// - GET /audio/{roomID}/stream.m3u8 - Redirect to the audio-only rendition of the active session
+// - GET /audio/{roomID}/feed.xml - Podcast RSS feed of the room's exported sessions
+// - GET /audio/{roomID}/{sessionID}/{file} - Audio-only rendition content (stream.m3u8, segments)
+// - POST /audio/{roomID}/{sessionID}/export - Start exporting the session's audio (room owner only)
+// - GET /audio/{roomID}/{sessionID}/export - Export status and progress
+// - GET /audio/{roomID}/{sessionID}/download - Download the exported audio
+func (h *AudioHandler) handleAudio(c *gin.Context) {
+	w := c.Writer
+	r := c.Request
+
+	// Set CORS headers
+	setCORSHeaders(w)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != "GET" && !(r.Method == "POST" && strings.HasSuffix(c.Param("path"), "/export")) {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse path: /audio/{roomID}/...
+	path := strings.TrimPrefix(c.Param("path"), "/")
+	if path == "" {
+		http.Error(w, "Room ID required", http.StatusBadRequest)
+		return
+	}
+
+	// Security: prevent directory traversal
+	cleanPath := filepath.Clean(path)
+	if strings.Contains(cleanPath, "..") {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts := strings.SplitN(cleanPath, "/", 3)
+	roomID := parts[0]
+
+	sessionID := ""
+	if len(parts) == 3 {
+		sessionID = parts[1]
+	}
+	if err := h.playbackSvc.Authorize(r, roomID, sessionID); err != nil {
+		http.Error(w, "Invalid or expired playback token", http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "stream.m3u8":
+		h.handleActiveAudio(w, r, roomID)
+	case len(parts) == 2 && parts[1] == "feed.xml":
+		h.handleFeed(w, r, roomID)
+	case len(parts) == 3 && parts[2] == "export":
+		h.handleExport(w, r, roomID, sessionID)
+	case len(parts) == 3 && parts[2] == "download":
+		h.handleDownload(w, r, roomID, sessionID)
+	case len(parts) == 3:
+		h.handleAudioContent(w, r, roomID, sessionID, parts[2])
+	default:
+		http.Error(w, "Invalid path format", http.StatusBadRequest)
+	}
+}
+
+// handleActiveAudio redirects to the audio-only rendition of the room's active session,
+// so its relative segment URIs resolve under the session.
+func (h *AudioHandler) handleActiveAudio(w http.ResponseWriter, r *http.Request, roomID string) {
+	sessionID, err := h.playbackSvc.GetActiveSessionID(r.Context(), roomID)
+	if err != nil {
+		log.Printf("Error getting active session for room %s: %v", roomID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if sessionID == "" {
+		http.Error(w, "Stream not found or not live", http.StatusNotFound)
+		return
+	}
+
+	target := "/audio/" + roomID + "/" + sessionID + "/stream.m3u8"
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// handleFeed serves the podcast RSS feed of a room.
+func (h *AudioHandler) handleFeed(w http.ResponseWriter, r *http.Request, roomID string) {
+	feed, err := h.audioSvc.Feed(r.Context(), r, roomID)
+	if err != nil {
+		log.Printf("Error building feed for room %s: %v", roomID, err)
+		http.Error(w, "Failed to build feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	// Enclosure URLs carry the requester's playback token, shared caches must not serve them to others
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Write(feed)
+}
+
+// handleAudioContent serves the audio-only rendition's playlist and segments.
+func (h *AudioHandler) handleAudioContent(w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) {
+	// Only allow playlists and media segments
+	ext := filepath.Ext(filename)
+	if !isStreamFile(ext) {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := h.audioSvc.ServeAudioContent(r.Context(), w, r, roomID, sessionID, filename)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error serving audio content: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// handleExport starts an audio export (POST) or returns its status (GET).
+func (h *AudioHandler) handleExport(w http.ResponseWriter, r *http.Request, roomID, sessionID string) {
+	if h.exportSvc == nil {
+		http.Error(w, "Audio export is disabled", http.StatusNotFound)
+		return
+	}
+
+	var job *service.ExportJob
+	var err error
+	status := http.StatusOK
+	if r.Method == "POST" {
+		if !authorizeOwner(w, r, h.owners, roomID) {
+			return
+		}
+		job, err = h.exportSvc.StartAudioExport(r.Context(), roomID, sessionID)
+		status = http.StatusAccepted
+	} else {
+		job, err = h.exportSvc.GetAudioExport(r.Context(), roomID, sessionID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrExportNotFound), strings.Contains(err.Error(), "not found"):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrExportUnavailable):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("Error exporting audio for room %s session %s: %v", roomID, sessionID, err)
+			http.Error(w, "Failed to export audio", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleDownload serves the exported audio of a session.
+func (h *AudioHandler) handleDownload(w http.ResponseWriter, r *http.Request, roomID, sessionID string) {
+	if h.exportSvc == nil {
+		http.Error(w, "Audio export is disabled", http.StatusNotFound)
+		return
+	}
+
+	err := h.exportSvc.ServeAudioDownload(r.Context(), w, r, roomID, sessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrExportNotFound), strings.Contains(err.Error(), "not found"):
+			http.NotFound(w, r)
+		case errors.Is(err, service.ErrExportUnavailable):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("Error serving audio download: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/weiawesome/wes-io-live/playback-service/internal/service"
+)
+
+// ClipHandler handles clip creation and playback requests.
+type ClipHandler struct {
+	clipSvc     *service.ClipService
+	playbackSvc *service.PlaybackService
+	owners      *service.OwnerAuthorizer
+}
+
+// NewClipHandler creates a new clip handler.
+func NewClipHandler(clipSvc *service.ClipService, playbackSvc *service.PlaybackService, owners *service.OwnerAuthorizer) *ClipHandler {
+	return &ClipHandler{
+		clipSvc:     clipSvc,
+		playbackSvc: playbackSvc,
+		owners:      owners,
+	}
+}
+
+// RegisterRoutes registers the clip routes.
+func (h *ClipHandler) RegisterRoutes(r *gin.Engine) {
+	r.Any("/clip/*path", h.handleClip)
+}
+
+// createClipRequest is the body of a clip creation request.
+type createClipRequest struct {
+	SessionID string  `json:"session_id"` // Empty = live DVR window of the room
+	Title     string  `json:"title"`
+	Start     float64 `json:"start"` // Offset into the session in seconds
+	End       float64 `json:"end"`
+}
+
+// handleClip handles clip requests.
+// Creating clips is limited to the room owner, reads need a playback token for the room when tokens are required.
+// Supports:
+// - POST /clip/{roomID} - Create a clip from a VOD session or the live DVR window
+// - GET /clip/{roomID} - List all clips of a room
+// - GET /clip/{roomID}/{clipID} - Get clip info
+// - GET /clip/{roomID}/{clipID}/{file} - Stream clip content (stream.m3u8, segments, thumbnail.jpg)
+func (h *ClipHandler) handleClip(c *gin.Context) {
+	w := c.Writer
+	r := c.Request
+
+	// Set CORS headers
+	setCORSHeaders(w)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Parse path: /clip/{roomID}/...
+	path := strings.TrimPrefix(c.Param("path"), "/")
+	path = strings.TrimSuffix(path, "/")
+	if path == "" {
+		http.Error(w, "Room ID required", http.StatusBadRequest)
+		return
+	}
+
+	// Security: prevent directory traversal
+	cleanPath := filepath.Clean(path)
+	if strings.Contains(cleanPath, "..") {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts := strings.SplitN(cleanPath, "/", 3)
+	roomID := parts[0]
+
+	if r.Method == "POST" && len(parts) == 1 {
+		if authorizeOwner(w, r, h.owners, roomID) {
+			h.handleCreateClip(w, r, roomID)
+		}
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := h.playbackSvc.Authorize(r, roomID, ""); err != nil {
+		http.Error(w, "Invalid or expired playback token", http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		h.handleListClips(w, r, roomID)
+	case len(parts) == 2:
+		h.handleClipInfo(w, r, roomID, parts[1])
+	default:
+		h.handleClipContent(w, r, roomID, parts[1], parts[2])
+	}
+}
+
+// handleCreateClip creates a new clip.
+func (h *ClipHandler) handleCreateClip(w http.ResponseWriter, r *http.Request, roomID string) {
+	var req createClipRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	clip, err := h.clipSvc.CreateClip(r.Context(), service.CreateClipRequest{
+		RoomID:    roomID,
+		SessionID: req.SessionID,
+		Title:     req.Title,
+		Start:     req.Start,
+		End:       req.End,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidClip) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error creating clip for room %s: %v", roomID, err)
+		http.Error(w, "Failed to create clip", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(clip)
+}
+
+// handleListClips returns all clips of a room.
+func (h *ClipHandler) handleListClips(w http.ResponseWriter, r *http.Request, roomID string) {
+	clips, err := h.clipSvc.ListRoomClips(r.Context(), roomID)
+	if err != nil {
+		log.Printf("Error listing clips for room %s: %v", roomID, err)
+		http.Error(w, "Failed to list clips", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"room_id": roomID,
+		"clips":   clips,
+	})
+}
+
+// handleClipInfo returns information about a clip.
+func (h *ClipHandler) handleClipInfo(w http.ResponseWriter, r *http.Request, roomID, clipID string) {
+	clip, err := h.clipSvc.GetClip(r.Context(), roomID, clipID)
+	if err != nil {
+		if errors.Is(err, service.ErrClipNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error getting clip %s for room %s: %v", clipID, roomID, err)
+		http.Error(w, "Failed to get clip", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clip)
+}
+
+// handleClipContent serves clip playlists, segments and the thumbnail.
+func (h *ClipHandler) handleClipContent(w http.ResponseWriter, r *http.Request, roomID, clipID, filename string) {
+	ext := filepath.Ext(filename)
+	if !isStreamFile(ext) && filename != "thumbnail.jpg" {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := h.clipSvc.ServeClipContent(r.Context(), w, r, roomID, clipID, filename)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error serving clip content: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
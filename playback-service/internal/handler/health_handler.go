@@ -1,9 +1,13 @@
 package handler
 
 import (
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/weiawesome/wes-io-live/playback-service/internal/service"
 )
 
 // HealthHandler handles health check requests.
@@ -37,6 +41,36 @@ func (h *HealthHandler) handleHealth(c *gin.Context) {
 func setCORSHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Range")
-	w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Range")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Range, If-None-Match, If-Modified-Since")
+	w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Range, Accept-Ranges, ETag, Last-Modified")
+}
+
+// isStreamFile returns true if the extension is a playlist or media segment that may be served.
+// Covers HLS playlists, DASH manifests, MPEG-TS segments as well as fMP4/CMAF segments and their init segment.
+func isStreamFile(ext string) bool {
+	switch ext {
+	case ".m3u8", ".mpd", ".ts", ".m4s", ".mp4":
+		return true
+	default:
+		return false
+	}
+}
+
+// authorizeOwner checks that a streamer-only request is made by the room owner.
+// Writes the error response and returns false otherwise.
+func authorizeOwner(w http.ResponseWriter, r *http.Request, owners *service.OwnerAuthorizer, roomID string) bool {
+	_, err := owners.AuthorizeOwner(r, roomID)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, service.ErrOwnerUnauthorized):
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+	case errors.Is(err, service.ErrOwnerForbidden):
+		http.Error(w, "Only the room owner may do this", http.StatusForbidden)
+	default:
+		log.Printf("Error authorizing owner of room %s: %v", roomID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+	return false
 }
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/weiawesome/wes-io-live/playback-service/internal/service"
+)
+
+// KeyHandler handles content key requests of encrypted HLS sessions.
+type KeyHandler struct {
+	keySvc *service.KeyService
+}
+
+// NewKeyHandler creates a new key handler.
+func NewKeyHandler(keySvc *service.KeyService) *KeyHandler {
+	return &KeyHandler{
+		keySvc: keySvc,
+	}
+}
+
+// RegisterRoutes registers the key routes.
+func (h *KeyHandler) RegisterRoutes(r *gin.Engine) {
+	r.Any("/keys/*path", h.handleKey)
+}
+
+// handleKey serves a content key to an authorized viewer.
+// Supports:
+// - GET /keys/{roomID}/{sessionID}/{keyID}.key - The AES-128 key of a session's segments
+func (h *KeyHandler) handleKey(c *gin.Context) {
+	w := c.Writer
+	r := c.Request
+
+	// Set CORS headers
+	setCORSHeaders(w)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse path: /keys/{roomID}/{sessionID}/{keyID}.key
+	path := strings.TrimPrefix(c.Param("path"), "/")
+
+	// Security: prevent directory traversal
+	cleanPath := filepath.Clean(path)
+	if strings.Contains(cleanPath, "..") {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts := strings.Split(cleanPath, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || !strings.HasSuffix(parts[2], ".key") {
+		http.NotFound(w, r)
+		return
+	}
+	roomID, sessionID, keyID := parts[0], parts[1], strings.TrimSuffix(parts[2], ".key")
+
+	if err := h.keySvc.Authorize(r, roomID, sessionID); err != nil {
+		switch {
+		case errors.Is(err, service.ErrKeyUnauthorized):
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Authorization required", http.StatusUnauthorized)
+		case errors.Is(err, service.ErrKeyForbidden):
+			http.Error(w, "Invalid or expired credentials", http.StatusForbidden)
+		default:
+			log.Printf("Error authorizing key request for room %s session %s: %v", roomID, sessionID, err)
+			http.Error(w, "Failed to authorize key request", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	key, err := h.keySvc.Key(r.Context(), roomID, sessionID, keyID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error reading key %s for room %s session %s: %v", keyID, roomID, sessionID, err)
+		http.Error(w, "Failed to read key", http.StatusInternalServerError)
+		return
+	}
+
+	// Keys must never be stored by shared caches
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(key)
+}
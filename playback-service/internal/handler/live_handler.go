@@ -11,6 +11,9 @@ import (
 	"github.com/weiawesome/wes-io-live/playback-service/internal/service"
 )
 
+// dvrPlaylist is the generated live playlist with a seekable window.
+const dvrPlaylist = "dvr.m3u8"
+
 // LiveHandler handles live stream playback requests.
 type LiveHandler struct {
 	playbackSvc *service.PlaybackService
@@ -30,7 +33,10 @@ func (h *LiveHandler) RegisterRoutes(r *gin.Engine) {
 
 // handleLive handles live stream requests.
 // Supports:
-// - GET /live/{roomID}/stream.m3u8 - Live stream (auto-detect sessionID from session store)
+// - GET /live/{roomID}/stream.m3u8 - Live HLS stream (auto-detect sessionID from session store)
+// - GET /live/{roomID}/master.m3u8 - Live HLS master playlist with simulcast renditions
+// - GET /live/{roomID}/manifest.mpd - Live DASH stream (auto-detect sessionID from session store)
+// - GET /live/{roomID}/dvr.m3u8 - Live HLS stream with a seekable DVR window (auto-detect sessionID)
 // - GET /live/{roomID}/{sessionID}/{file} - Live stream with explicit sessionID
 func (h *LiveHandler) handleLive(c *gin.Context) {
 	w := c.Writer
@@ -66,9 +72,9 @@ func (h *LiveHandler) handleLive(c *gin.Context) {
 	parts := strings.SplitN(cleanPath, "/", 3)
 	roomID := parts[0]
 
-	// Handle simplified live stream request: /live/{roomID}/stream.m3u8
-	if len(parts) == 2 && parts[1] == "stream.m3u8" {
-		h.handleSimplifiedLive(w, r, roomID)
+	// Handle simplified live stream request: /live/{roomID}/stream.m3u8, master.m3u8 (simulcast renditions), manifest.mpd or dvr.m3u8
+	if len(parts) == 2 && (parts[1] == "stream.m3u8" || parts[1] == "master.m3u8" || parts[1] == "manifest.mpd" || parts[1] == dvrPlaylist) {
+		h.handleSimplifiedLive(w, r, roomID, parts[1])
 		return
 	}
 
@@ -85,7 +91,7 @@ func (h *LiveHandler) handleLive(c *gin.Context) {
 
 // handleSimplifiedLive handles requests without explicit sessionID.
 // It looks up the active session from the session store.
-func (h *LiveHandler) handleSimplifiedLive(w http.ResponseWriter, r *http.Request, roomID string) {
+func (h *LiveHandler) handleSimplifiedLive(w http.ResponseWriter, r *http.Request, roomID, filename string) {
 	// Try to get active session from session store
 	sessionID, err := h.playbackSvc.GetActiveSessionID(r.Context(), roomID)
 	if err != nil {
@@ -99,22 +105,40 @@ func (h *LiveHandler) handleSimplifiedLive(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if err := h.playbackSvc.Authorize(r, roomID, sessionID); err != nil {
+		http.Error(w, "Invalid or expired playback token", http.StatusForbidden)
+		return
+	}
+
 	// Redirect to the session-specific URL
 	if h.playbackSvc.IsRedirectMode() {
 		// In redirect mode, serve content directly (will redirect to S3)
-		h.handleSessionLive(w, r, roomID, sessionID, "stream.m3u8")
+		h.handleSessionLive(w, r, roomID, sessionID, filename)
 	} else {
 		// In proxy mode, redirect to session-specific URL
-		redirectURL := "/live/" + roomID + "/" + sessionID + "/stream.m3u8"
+		redirectURL := "/live/" + roomID + "/" + sessionID + "/" + filename
+		if r.URL.RawQuery != "" {
+			redirectURL += "?" + r.URL.RawQuery // Keep the playback token
+		}
 		http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
 	}
 }
 
 // handleSessionLive handles live stream requests with explicit sessionID.
 func (h *LiveHandler) handleSessionLive(w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) {
-	// Only allow .m3u8 and .ts files
+	if err := h.playbackSvc.Authorize(r, roomID, sessionID); err != nil {
+		http.Error(w, "Invalid or expired playback token", http.StatusForbidden)
+		return
+	}
+
+	if filename == dvrPlaylist {
+		h.handleDVR(w, r, roomID, sessionID)
+		return
+	}
+
+	// Only allow playlists and media segments
 	ext := filepath.Ext(filename)
-	if ext != ".m3u8" && ext != ".ts" {
+	if !isStreamFile(ext) {
 		http.NotFound(w, r)
 		return
 	}
@@ -129,3 +153,21 @@ func (h *LiveHandler) handleSessionLive(w http.ResponseWriter, r *http.Request,
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 	}
 }
+
+// handleDVR serves the DVR playlist of a live session.
+func (h *LiveHandler) handleDVR(w http.ResponseWriter, r *http.Request, roomID, sessionID string) {
+	if !h.playbackSvc.DVREnabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := h.playbackSvc.ServeDVRPlaylist(r.Context(), w, r, roomID, sessionID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error serving DVR playlist: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
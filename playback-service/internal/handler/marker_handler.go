@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/weiawesome/wes-io-live/playback-service/internal/service"
+)
+
+// MarkerHandler handles chapter and timed event requests.
+type MarkerHandler struct {
+	markerSvc   *service.MarkerService
+	playbackSvc *service.PlaybackService
+	owners      *service.OwnerAuthorizer
+}
+
+// NewMarkerHandler creates a new marker handler.
+func NewMarkerHandler(markerSvc *service.MarkerService, playbackSvc *service.PlaybackService, owners *service.OwnerAuthorizer) *MarkerHandler {
+	return &MarkerHandler{
+		markerSvc:   markerSvc,
+		playbackSvc: playbackSvc,
+		owners:      owners,
+	}
+}
+
+// RegisterRoutes registers the marker routes.
+func (h *MarkerHandler) RegisterRoutes(r *gin.Engine) {
+	r.Any("/markers/*path", h.handleMarkers)
+}
+
+// createMarkerRequest is the body of a marker creation request.
+type createMarkerRequest struct {
+	SessionID string            `json:"session_id"` // Empty = live session of the room
+	Type      string            `json:"type"`       // "chapter" or "event"
+	Title     string            `json:"title"`
+	Offset    *float64          `json:"offset"` // Seconds into the session, omitted = now
+	Duration  float64           `json:"duration"`
+	Data      map[string]string `json:"data"`
+}
+
+// handleMarkers handles marker requests.
+// Supports:
+// - POST /markers/{roomID} - Add a chapter or timed event to the live session or a VOD session (room owner only)
+// - GET /markers/{roomID}/{sessionID} - List the markers of a session
+func (h *MarkerHandler) handleMarkers(c *gin.Context) {
+	w := c.Writer
+	r := c.Request
+
+	// Set CORS headers
+	setCORSHeaders(w)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Parse path: /markers/{roomID}/...
+	path := strings.TrimPrefix(c.Param("path"), "/")
+	path = strings.TrimSuffix(path, "/")
+	if path == "" {
+		http.Error(w, "Room ID required", http.StatusBadRequest)
+		return
+	}
+
+	// Security: prevent directory traversal
+	cleanPath := filepath.Clean(path)
+	if strings.Contains(cleanPath, "..") {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts := strings.Split(cleanPath, "/")
+
+	switch {
+	case r.Method == "POST" && len(parts) == 1:
+		h.handleCreateMarker(w, r, parts[0])
+	case r.Method != "GET":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	case len(parts) == 2:
+		h.handleListMarkers(w, r, parts[0], parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleCreateMarker adds a marker to a session.
+func (h *MarkerHandler) handleCreateMarker(w http.ResponseWriter, r *http.Request, roomID string) {
+	if !authorizeOwner(w, r, h.owners, roomID) {
+		return
+	}
+
+	var req createMarkerRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	marker, err := h.markerSvc.AddMarker(r.Context(), service.CreateMarkerRequest{
+		RoomID:    roomID,
+		SessionID: req.SessionID,
+		Type:      req.Type,
+		Title:     req.Title,
+		Offset:    req.Offset,
+		Duration:  req.Duration,
+		Data:      req.Data,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidMarker) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error adding marker for room %s: %v", roomID, err)
+		http.Error(w, "Failed to add marker", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(marker)
+}
+
+// handleListMarkers returns the markers of a session.
+func (h *MarkerHandler) handleListMarkers(w http.ResponseWriter, r *http.Request, roomID, sessionID string) {
+	if err := h.playbackSvc.Authorize(r, roomID, sessionID); err != nil {
+		http.Error(w, "Invalid or expired playback token", http.StatusForbidden)
+		return
+	}
+
+	markers, err := h.markerSvc.Markers(r.Context(), roomID, sessionID)
+	if err != nil {
+		log.Printf("Error listing markers for room %s session %s: %v", roomID, sessionID, err)
+		http.Error(w, "Failed to list markers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"room_id":    roomID,
+		"session_id": sessionID,
+		"markers":    markers,
+	})
+}
@@ -11,6 +11,9 @@ import (
 	"github.com/weiawesome/wes-io-live/playback-service/internal/service"
 )
 
+// animatedPreviewMP4 is the MP4 variant of the animated room card preview.
+const animatedPreviewMP4 = "animated.mp4"
+
 // PreviewHandler handles preview image requests.
 type PreviewHandler struct {
 	playbackSvc *service.PlaybackService
@@ -32,6 +35,11 @@ func (h *PreviewHandler) RegisterRoutes(r *gin.Engine) {
 // Supports:
 // - GET /preview/{roomID}/latest/thumbnail.jpg - Get latest session thumbnail
 // - GET /preview/{roomID}/{sessionID}/thumbnail.jpg - Get specific session thumbnail
+// - GET /preview/{roomID}/{latest|sessionID}/animated.{webp|mp4} - Short looping preview, if enabled in media-service
+// - GET /preview/{roomID}/{sessionID}/thumbnails.vtt - WebVTT seek preview track of a session
+// - GET /preview/{roomID}/{sessionID}/sprite_{n}.jpg - Sprite sheet referenced by the track
+// Previews are gated by playback tokens like the streams they show, latest only checks the room.
+// Room cards fall back to their placeholder without a token.
 func (h *PreviewHandler) handlePreview(c *gin.Context) {
 	w := c.Writer
 	r := c.Request
@@ -74,6 +82,16 @@ func (h *PreviewHandler) handlePreview(c *gin.Context) {
 
 	roomID := parts[0]
 
+	// Check playback token
+	tokenSession := parts[1]
+	if tokenSession == "latest" {
+		tokenSession = ""
+	}
+	if err := h.playbackSvc.Authorize(r, roomID, tokenSession); err != nil {
+		http.Error(w, "Invalid or expired playback token", http.StatusForbidden)
+		return
+	}
+
 	// Handle latest: /preview/{roomID}/latest/thumbnail.jpg
 	if parts[1] == "latest" {
 		filename := "thumbnail.jpg"
@@ -95,9 +113,9 @@ func (h *PreviewHandler) handlePreview(c *gin.Context) {
 
 // handleLatestPreview serves the latest session's preview image.
 func (h *PreviewHandler) handleLatestPreview(w http.ResponseWriter, r *http.Request, roomID, filename string) {
-	// Only allow image files
+	// Only allow image files and animated previews
 	ext := filepath.Ext(filename)
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".webp" {
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".webp" && filename != animatedPreviewMP4 {
 		http.NotFound(w, r)
 		return
 	}
@@ -113,11 +131,11 @@ func (h *PreviewHandler) handleLatestPreview(w http.ResponseWriter, r *http.Requ
 	}
 }
 
-// handleSessionPreview serves a specific session's preview image.
+// handleSessionPreview serves a specific session's preview image or thumbnails track.
 func (h *PreviewHandler) handleSessionPreview(w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) {
-	// Only allow image files
+	// Only allow image files, animated previews and the thumbnails track
 	ext := filepath.Ext(filename)
-	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".webp" {
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".webp" && ext != ".vtt" && filename != animatedPreviewMP4 {
 		http.NotFound(w, r)
 		return
 	}
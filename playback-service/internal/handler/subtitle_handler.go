@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/weiawesome/wes-io-live/playback-service/internal/service"
+)
+
+// SubtitleHandler handles subtitle track uploads.
+type SubtitleHandler struct {
+	subtitleSvc *service.SubtitleService
+	playbackSvc *service.PlaybackService
+	owners      *service.OwnerAuthorizer
+}
+
+// NewSubtitleHandler creates a new subtitle handler.
+func NewSubtitleHandler(subtitleSvc *service.SubtitleService, playbackSvc *service.PlaybackService, owners *service.OwnerAuthorizer) *SubtitleHandler {
+	return &SubtitleHandler{
+		subtitleSvc: subtitleSvc,
+		playbackSvc: playbackSvc,
+		owners:      owners,
+	}
+}
+
+// RegisterRoutes registers the subtitle routes.
+func (h *SubtitleHandler) RegisterRoutes(r *gin.Engine) {
+	r.Any("/subtitles/*path", h.handleSubtitles)
+}
+
+// handleSubtitles handles subtitle track requests. Tracks are played through the VOD routes.
+// Supports:
+// - GET /subtitles/{roomID}/{sessionID} - List the subtitle tracks of a session
+// - PUT /subtitles/{roomID}/{sessionID}/{language}?name=&captions= - Upload a WebVTT or SRT file as the track in a language (room owner only)
+// - DELETE /subtitles/{roomID}/{sessionID}/{language} - Remove the track in a language (room owner only)
+func (h *SubtitleHandler) handleSubtitles(c *gin.Context) {
+	w := c.Writer
+	r := c.Request
+
+	// Set CORS headers
+	setCORSHeaders(w)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, DELETE, OPTIONS")
+
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Parse path: /subtitles/{roomID}/{sessionID}/...
+	path := strings.TrimPrefix(c.Param("path"), "/")
+	path = strings.TrimSuffix(path, "/")
+
+	// Security: prevent directory traversal
+	cleanPath := filepath.Clean(path)
+	if strings.Contains(cleanPath, "..") {
+		http.NotFound(w, r)
+		return
+	}
+
+	parts := strings.Split(cleanPath, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		http.Error(w, "Room and session ID required", http.StatusBadRequest)
+		return
+	}
+	roomID, sessionID := parts[0], parts[1]
+
+	switch {
+	case r.Method == "GET" && len(parts) == 2:
+		if err := h.playbackSvc.Authorize(r, roomID, sessionID); err != nil {
+			http.Error(w, "Invalid or expired playback token", http.StatusForbidden)
+			return
+		}
+		h.handleListTracks(w, r, roomID, sessionID)
+	case r.Method == "PUT" && len(parts) == 3:
+		if !authorizeOwner(w, r, h.owners, roomID) {
+			return
+		}
+		h.handleUpload(w, r, roomID, sessionID, parts[2])
+	case r.Method == "DELETE" && len(parts) == 3:
+		if !authorizeOwner(w, r, h.owners, roomID) {
+			return
+		}
+		h.handleDelete(w, r, roomID, sessionID, parts[2])
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleListTracks returns the subtitle tracks of a session.
+func (h *SubtitleHandler) handleListTracks(w http.ResponseWriter, r *http.Request, roomID, sessionID string) {
+	tracks, err := h.subtitleSvc.Tracks(r.Context(), roomID, sessionID)
+	if err != nil {
+		log.Printf("Error listing subtitle tracks for room %s session %s: %v", roomID, sessionID, err)
+		http.Error(w, "Failed to list subtitle tracks", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"room_id":    roomID,
+		"session_id": sessionID,
+		"tracks":     tracks,
+	})
+}
+
+// handleUpload stores the request body as the session's subtitle track in a language.
+func (h *SubtitleHandler) handleUpload(w http.ResponseWriter, r *http.Request, roomID, sessionID, language string) {
+	captions, _ := strconv.ParseBool(r.URL.Query().Get("captions"))
+
+	track, err := h.subtitleSvc.Upload(r.Context(), service.UploadSubtitleRequest{
+		RoomID:    roomID,
+		SessionID: sessionID,
+		Language:  language,
+		Name:      r.URL.Query().Get("name"),
+		Captions:  captions,
+		Content:   r.Body,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSubtitle) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error uploading subtitles for room %s session %s: %v", roomID, sessionID, err)
+		http.Error(w, "Failed to upload subtitles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(track)
+}
+
+// handleDelete removes the session's subtitle track in a language.
+func (h *SubtitleHandler) handleDelete(w http.ResponseWriter, r *http.Request, roomID, sessionID, language string) {
+	err := h.subtitleSvc.Delete(r.Context(), roomID, sessionID, language)
+	if err != nil {
+		if errors.Is(err, service.ErrSubtitleNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error deleting subtitles for room %s session %s: %v", roomID, sessionID, err)
+		http.Error(w, "Failed to delete subtitles", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"path/filepath"
@@ -15,12 +16,16 @@ import (
 // VODHandler handles VOD playback requests.
 type VODHandler struct {
 	playbackSvc *service.PlaybackService
+	exportSvc   *service.ExportService // nil if MP4 export is disabled
+	owners      *service.OwnerAuthorizer
 }
 
 // NewVODHandler creates a new VOD handler.
-func NewVODHandler(playbackSvc *service.PlaybackService) *VODHandler {
+func NewVODHandler(playbackSvc *service.PlaybackService, exportSvc *service.ExportService, owners *service.OwnerAuthorizer) *VODHandler {
 	return &VODHandler{
 		playbackSvc: playbackSvc,
+		exportSvc:   exportSvc,
+		owners:      owners,
 	}
 }
 
@@ -33,20 +38,26 @@ func (h *VODHandler) RegisterRoutes(r *gin.Engine) {
 // Supports:
 // - GET /vod/{roomID} - List all VOD sessions for a room
 // - GET /vod/{roomID}/latest - Get the latest VOD URL
-// - GET /vod/{roomID}/{sessionID}/{file} - Stream VOD content
+// - GET /vod/{roomID}/{sessionID}/{file} - Stream VOD content (stream.m3u8, master.m3u8, manifest.mpd, segments, {rendition}/...)
+// - POST /vod/{roomID}/{sessionID}/export - Start exporting the session as a single MP4 (room owner only)
+// - GET /vod/{roomID}/{sessionID}/export - Export status and progress
+// - GET /vod/{roomID}/{sessionID}/download - Download the exported MP4
+// - GET /vod/{roomID}/{sessionID}/chapters.vtt - WebVTT chapters track of the session's markers
+// - GET /vod/{roomID}/{sessionID}/subtitles/{file} - Subtitle renditions ({language}.m3u8, {language}/{index}.vtt, {language}.vtt)
 func (h *VODHandler) handleVOD(c *gin.Context) {
 	w := c.Writer
 	r := c.Request
 
 	// Set CORS headers
 	setCORSHeaders(w)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 
 	if r.Method == "OPTIONS" {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	if r.Method != "GET" {
+	if r.Method != "GET" && !(r.Method == "POST" && strings.HasSuffix(c.Param("path"), "/export")) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -71,6 +82,15 @@ func (h *VODHandler) handleVOD(c *gin.Context) {
 	parts := strings.SplitN(cleanPath, "/", 3)
 	roomID := parts[0]
 
+	sessionID := ""
+	if len(parts) >= 2 && parts[1] != "latest" {
+		sessionID = parts[1]
+	}
+	if err := h.playbackSvc.Authorize(r, roomID, sessionID); err != nil {
+		http.Error(w, "Invalid or expired playback token", http.StatusForbidden)
+		return
+	}
+
 	// Handle list request: /vod/{roomID}
 	if len(parts) == 1 {
 		h.handleListVODs(w, r, roomID)
@@ -85,8 +105,6 @@ func (h *VODHandler) handleVOD(c *gin.Context) {
 
 	// Handle file request: /vod/{roomID}/{sessionID}/{file}
 	if len(parts) >= 2 {
-		sessionID := parts[1]
-
 		// If only sessionID without file, return session info
 		if len(parts) == 2 {
 			h.handleSessionInfo(w, r, roomID, sessionID)
@@ -94,7 +112,20 @@ func (h *VODHandler) handleVOD(c *gin.Context) {
 		}
 
 		filename := parts[2]
-		h.handleVODContent(w, r, roomID, sessionID, filename)
+		if subtitle, ok := strings.CutPrefix(filename, "subtitles/"); ok {
+			h.handleSubtitles(w, r, roomID, sessionID, subtitle)
+			return
+		}
+		switch filename {
+		case "export":
+			h.handleExport(w, r, roomID, sessionID)
+		case "download":
+			h.handleDownload(w, r, roomID, sessionID)
+		case "chapters.vtt":
+			h.handleChapters(w, r, roomID, sessionID)
+		default:
+			h.handleVODContent(w, r, roomID, sessionID, filename)
+		}
 		return
 	}
 
@@ -166,9 +197,9 @@ func (h *VODHandler) handleSessionInfo(w http.ResponseWriter, r *http.Request, r
 
 // handleVODContent serves VOD content files.
 func (h *VODHandler) handleVODContent(w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) {
-	// Only allow .m3u8 and .ts files
+	// Only allow playlists and media segments
 	ext := filepath.Ext(filename)
-	if ext != ".m3u8" && ext != ".ts" {
+	if !isStreamFile(ext) {
 		http.NotFound(w, r)
 		return
 	}
@@ -183,3 +214,87 @@ func (h *VODHandler) handleVODContent(w http.ResponseWriter, r *http.Request, ro
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 	}
 }
+
+// handleChapters serves the chapters track of a session.
+func (h *VODHandler) handleChapters(w http.ResponseWriter, r *http.Request, roomID, sessionID string) {
+	err := h.playbackSvc.ServeChapters(r.Context(), w, roomID, sessionID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error serving chapters: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// handleSubtitles serves subtitle rendition playlists and segments.
+func (h *VODHandler) handleSubtitles(w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) {
+	err := h.playbackSvc.ServeSubtitles(r.Context(), w, r, roomID, sessionID, filename)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Error serving subtitles: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// handleExport starts an MP4 export (POST) or returns its status (GET).
+func (h *VODHandler) handleExport(w http.ResponseWriter, r *http.Request, roomID, sessionID string) {
+	if h.exportSvc == nil {
+		http.Error(w, "MP4 export is disabled", http.StatusNotFound)
+		return
+	}
+
+	var job *service.ExportJob
+	var err error
+	status := http.StatusOK
+	if r.Method == "POST" {
+		if !authorizeOwner(w, r, h.owners, roomID) {
+			return
+		}
+		job, err = h.exportSvc.StartExport(r.Context(), roomID, sessionID)
+		status = http.StatusAccepted
+	} else {
+		job, err = h.exportSvc.GetExport(r.Context(), roomID, sessionID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrExportNotFound), strings.Contains(err.Error(), "not found"):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, service.ErrExportUnavailable):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("Error exporting VOD for room %s session %s: %v", roomID, sessionID, err)
+			http.Error(w, "Failed to export VOD", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleDownload serves the exported MP4 of a session.
+func (h *VODHandler) handleDownload(w http.ResponseWriter, r *http.Request, roomID, sessionID string) {
+	if h.exportSvc == nil {
+		http.Error(w, "MP4 export is disabled", http.StatusNotFound)
+		return
+	}
+
+	err := h.exportSvc.ServeDownload(r.Context(), w, r, roomID, sessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrExportNotFound), strings.Contains(err.Error(), "not found"):
+			http.NotFound(w, r)
+		case errors.Is(err, service.ErrExportUnavailable):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("Error serving VOD download: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
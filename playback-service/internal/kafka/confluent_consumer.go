@@ -0,0 +1,102 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+)
+
+// ConfluentConsumer implements BeaconConsumer using confluent-kafka-go.
+type ConfluentConsumer struct {
+	consumer *kafka.Consumer
+	topic    string
+	handler  BeaconHandler
+	doneCh   chan struct{}
+}
+
+// NewConfluentConsumer creates a new Kafka consumer for playback beacons.
+func NewConfluentConsumer(brokers, topic, groupID string, handler BeaconHandler) (*ConfluentConsumer, error) {
+	c, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers":  brokers,
+		"group.id":           groupID,
+		"auto.offset.reset":  "earliest",
+		"enable.auto.commit": true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka consumer: %w", err)
+	}
+
+	return &ConfluentConsumer{
+		consumer: c,
+		topic:    topic,
+		handler:  handler,
+		doneCh:   make(chan struct{}),
+	}, nil
+}
+
+// Start begins consuming messages from Kafka.
+func (cc *ConfluentConsumer) Start(ctx context.Context) error {
+	if err := cc.consumer.Subscribe(cc.topic, nil); err != nil {
+		return fmt.Errorf("failed to subscribe to topic %s: %w", cc.topic, err)
+	}
+
+	l := pkglog.L()
+	l.Info().Str("topic", cc.topic).Msg("kafka consumer started")
+
+	go cc.consumeLoop(ctx)
+
+	return nil
+}
+
+func (cc *ConfluentConsumer) consumeLoop(ctx context.Context) {
+	l := pkglog.L()
+	defer close(cc.doneCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			l.Info().Msg("kafka consumer shutting down")
+			return
+		default:
+			msg, err := cc.consumer.ReadMessage(100 * time.Millisecond)
+			if err != nil {
+				// Timeout is expected, continue
+				if err.(kafka.Error).Code() == kafka.ErrTimedOut {
+					continue
+				}
+				l.Error().Err(err).Msg("kafka consumer error")
+				continue
+			}
+
+			cc.processMessage(ctx, msg)
+		}
+	}
+}
+
+func (cc *ConfluentConsumer) processMessage(ctx context.Context, msg *kafka.Message) {
+	l := pkglog.L()
+
+	var beacon Beacon
+	if err := json.Unmarshal(msg.Value, &beacon); err != nil {
+		l.Error().Err(err).Msg("failed to unmarshal beacon")
+		return
+	}
+
+	if err := cc.handler.HandleBeacon(ctx, &beacon); err != nil {
+		l.Error().Err(err).Str("room_id", beacon.RoomID).Str("type", beacon.Type).Msg("failed to handle beacon")
+	}
+}
+
+// Close waits for the consume loop to exit and releases resources.
+// The context passed to Start must be cancelled first.
+func (cc *ConfluentConsumer) Close() error {
+	<-cc.doneCh
+	if err := cc.consumer.Close(); err != nil {
+		return fmt.Errorf("failed to close kafka consumer: %w", err)
+	}
+	return nil
+}
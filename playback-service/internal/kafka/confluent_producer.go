@@ -0,0 +1,123 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+)
+
+// ConfluentProducer implements BeaconProducer using confluent-kafka-go.
+type ConfluentProducer struct {
+	producer *kafka.Producer
+	topic    string
+	doneCh   chan struct{}
+}
+
+// NewConfluentProducer creates a new Kafka producer for playback beacons.
+func NewConfluentProducer(brokers, topic string, partitions int) (*ConfluentProducer, error) {
+	// Ensure topic exists with desired partition count
+	if err := ensureTopic(brokers, topic, partitions); err != nil {
+		l := pkglog.L()
+		l.Warn().Err(err).Str("topic", topic).Msg("failed to ensure topic, may already exist")
+	}
+
+	p, err := kafka.NewProducer(&kafka.ConfigMap{
+		"bootstrap.servers": brokers,
+		"acks":              "1",
+		"linger.ms":         50, // Beacons are not latency sensitive, batch them
+		"compression.type":  "snappy",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka producer: %w", err)
+	}
+
+	cp := &ConfluentProducer{
+		producer: p,
+		topic:    topic,
+		doneCh:   make(chan struct{}),
+	}
+
+	go cp.deliveryReportHandler()
+
+	return cp, nil
+}
+
+func ensureTopic(brokers, topic string, partitions int) error {
+	admin, err := kafka.NewAdminClient(&kafka.ConfigMap{
+		"bootstrap.servers": brokers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create admin client: %w", err)
+	}
+	defer admin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	results, err := admin.CreateTopics(ctx, []kafka.TopicSpecification{
+		{
+			Topic:             topic,
+			NumPartitions:     partitions,
+			ReplicationFactor: 1,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.Error.Code() != kafka.ErrNoError && result.Error.Code() != kafka.ErrTopicAlreadyExists {
+			return fmt.Errorf("failed to create topic %s: %v", result.Topic, result.Error)
+		}
+	}
+
+	return nil
+}
+
+func (cp *ConfluentProducer) deliveryReportHandler() {
+	l := pkglog.L()
+	for e := range cp.producer.Events() {
+		switch ev := e.(type) {
+		case *kafka.Message:
+			if ev.TopicPartition.Error != nil {
+				l.Error().Err(ev.TopicPartition.Error).Msg("kafka delivery failed")
+			}
+		}
+	}
+	close(cp.doneCh)
+}
+
+// ProduceBeacon sends a playback beacon to Kafka.
+func (cp *ConfluentProducer) ProduceBeacon(ctx context.Context, beacon *Beacon) error {
+	value, err := json.Marshal(beacon)
+	if err != nil {
+		return fmt.Errorf("failed to marshal beacon: %w", err)
+	}
+
+	// Use the view ID as key so a view's beacons stay in order
+	err = cp.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &cp.topic,
+			Partition: kafka.PartitionAny,
+		},
+		Key:   []byte(beacon.ViewID),
+		Value: value,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to produce message: %w", err)
+	}
+
+	return nil
+}
+
+// Close flushes pending messages and closes the producer.
+func (cp *ConfluentProducer) Close() error {
+	cp.producer.Flush(5000)
+	cp.producer.Close()
+	<-cp.doneCh
+	return nil
+}
@@ -0,0 +1,49 @@
+package kafka
+
+import "context"
+
+// Beacon is a single playback event reported by a player, keyed by its view session.
+type Beacon struct {
+	ViewID       string  `json:"view_id"` // Random ID the player picks for each playback
+	RoomID       string  `json:"room_id"`
+	SessionID    string  `json:"session_id"`
+	Mode         string  `json:"mode"` // "live" | "vod"
+	Type         string  `json:"type"`
+	StartupMs    int64   `json:"startup_ms,omitempty"`    // start: time from load to first frame
+	RebufferMs   int64   `json:"rebuffer_ms,omitempty"`   // rebuffer: stall duration
+	BitrateKbps  int64   `json:"bitrate_kbps,omitempty"`  // bitrate_switch: new rendition bitrate
+	WatchSeconds float64 `json:"watch_seconds,omitempty"` // heartbeat, end: playing time since the previous beacon
+	Timestamp    int64   `json:"timestamp"`               // Unix milliseconds, set by the player
+}
+
+// Beacon types
+const (
+	BeaconStart         = "start"
+	BeaconRebuffer      = "rebuffer"
+	BeaconBitrateSwitch = "bitrate_switch"
+	BeaconHeartbeat     = "heartbeat"
+	BeaconEnd           = "end"
+)
+
+// Playback modes
+const (
+	ModeLive = "live"
+	ModeVOD  = "vod"
+)
+
+// BeaconProducer defines the interface for producing beacons.
+type BeaconProducer interface {
+	ProduceBeacon(ctx context.Context, beacon *Beacon) error
+	Close() error
+}
+
+// BeaconHandler handles incoming beacons.
+type BeaconHandler interface {
+	HandleBeacon(ctx context.Context, beacon *Beacon) error
+}
+
+// BeaconConsumer defines the interface for consuming beacons.
+type BeaconConsumer interface {
+	Start(ctx context.Context) error
+	Close() error
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
+)
+
+// AdRequest describes a playlist an ad decision is made for.
+type AdRequest struct {
+	RoomID    string
+	SessionID string
+	Live      bool
+	Viewer    string  // Client address of the viewer
+	Start     float64 // Content the playlist covers, in seconds since the session started
+	End       float64
+}
+
+// AdBreak is a creative to insert into the content.
+type AdBreak struct {
+	ID         string  // Stable across playlist reloads
+	Offset     float64 // Seconds since the session started
+	PreRoll    bool    // Played before the content, Offset is ignored
+	CreativeID string
+}
+
+// AdDecider decides which creatives a viewer sees and where.
+type AdDecider interface {
+	// Decide returns the breaks within [Start, End) of the request, ordered by offset
+	// with the pre-roll first. No breaks means the content is served unmodified.
+	Decide(ctx context.Context, req AdRequest) ([]AdBreak, error)
+}
+
+// StaticAdDecider places a pre-roll and mid-rolls at a fixed interval in monetized rooms,
+// all from configuration. Creatives are rotated per viewer so audiences see different ones,
+// while a viewer gets the same decision on every playlist reload.
+type StaticAdDecider struct {
+	cfg      config.AdsConfig
+	rooms    map[string]bool
+	allRooms bool
+}
+
+// NewStaticAdDecider creates an ad decider from configuration.
+func NewStaticAdDecider(cfg config.AdsConfig) *StaticAdDecider {
+	d := &StaticAdDecider{
+		cfg:   cfg,
+		rooms: make(map[string]bool),
+	}
+	for _, room := range cfg.Rooms {
+		if room == "*" {
+			d.allRooms = true
+		}
+		d.rooms[room] = true
+	}
+	return d
+}
+
+// Decide implements AdDecider.
+func (d *StaticAdDecider) Decide(ctx context.Context, req AdRequest) ([]AdBreak, error) {
+	if !d.allRooms && !d.rooms[req.RoomID] {
+		return nil, nil
+	}
+
+	rotation := viewerRotation(req.RoomID, req.Viewer)
+
+	var breaks []AdBreak
+	if len(d.cfg.PreRoll) > 0 {
+		breaks = append(breaks, AdBreak{
+			ID:         "preroll",
+			PreRoll:    true,
+			CreativeID: d.cfg.PreRoll[rotation%len(d.cfg.PreRoll)],
+		})
+	}
+
+	interval := float64(d.cfg.MidRollInterval)
+	if interval <= 0 || len(d.cfg.MidRoll) == 0 {
+		return breaks, nil
+	}
+	// Break n is at n*interval, the first at one interval into the session
+	for n := max(1, int(math.Ceil(req.Start/interval))); float64(n)*interval < req.End; n++ {
+		breaks = append(breaks, AdBreak{
+			ID:         fmt.Sprintf("midroll-%d", n),
+			Offset:     float64(n) * interval,
+			CreativeID: d.cfg.MidRoll[(rotation+n)%len(d.cfg.MidRoll)],
+		})
+	}
+
+	return breaks, nil
+}
+
+// viewerRotation returns a stable per viewer offset into the creative lists.
+func viewerRotation(roomID, viewer string) int {
+	h := fnv.New32a()
+	h.Write([]byte(roomID + "/" + viewer))
+	return int(h.Sum32() & math.MaxInt32)
+}
+
+// Ensure StaticAdDecider implements AdDecider interface
+var _ AdDecider = (*StaticAdDecider)(nil)
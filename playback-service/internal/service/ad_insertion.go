@@ -0,0 +1,174 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
+)
+
+// AdInserter inserts the creatives an AdDecider picks into HLS media playlists.
+// VOD playlists get the creative segments stitched in between EXT-X-DISCONTINUITY tags.
+// Live playlists slide, so inserted segments could not keep stable sequence numbers
+// across reloads; breaks are announced as interstitials for the player to schedule instead.
+type AdInserter struct {
+	decider AdDecider
+	prefix  string // Storage prefix of creatives
+}
+
+// NewAdInserter creates an ad inserter.
+func NewAdInserter(decider AdDecider, storagePrefix string, cfg config.AdsConfig) *AdInserter {
+	prefix := cfg.Prefix
+	if storagePrefix != "" {
+		prefix = storagePrefix + "/" + cfg.Prefix
+	}
+	return &AdInserter{
+		decider: decider,
+		prefix:  prefix,
+	}
+}
+
+// adURI returns the URI a creative's file is served at.
+func adURI(creativeID, filename string) string {
+	return "/ads/" + creativeID + "/" + filename
+}
+
+// liveInterstitials returns the viewer's ad breaks in the live window [windowStart, windowEnd)
+// as interstitials. Breaks are placed at fixed offsets from the session start, without one
+// only the pre-roll can be placed. The pre-roll is dated at the session start too, a date range
+// must keep its START-DATE across reloads of the sliding playlist.
+func (s *PlaybackService) liveInterstitials(ctx context.Context, r *http.Request, roomID, sessionID string, sessionStart, windowStart, windowEnd time.Time) ([]interstitial, error) {
+	req := AdRequest{
+		RoomID:    roomID,
+		SessionID: sessionID,
+		Live:      true,
+		Viewer:    s.proxies.ClientIP(r),
+	}
+	if !sessionStart.IsZero() {
+		req.Start = windowStart.Sub(sessionStart).Seconds()
+		req.End = windowEnd.Sub(sessionStart).Seconds()
+	}
+
+	breaks, err := s.ads.decider.Decide(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decide ads: %w", err)
+	}
+
+	interstitials := make([]interstitial, 0, len(breaks))
+	for _, b := range breaks {
+		start := sessionStart.Add(time.Duration(b.Offset * float64(time.Second)))
+		if b.PreRoll {
+			start = sessionStart
+			if start.IsZero() {
+				start = windowStart
+			}
+		}
+		interstitials = append(interstitials, interstitial{
+			ID:       b.ID,
+			Start:    start,
+			AssetURI: adURI(b.CreativeID, mediaPlaylistFile),
+			PreRoll:  b.PreRoll,
+		})
+	}
+	return interstitials, nil
+}
+
+// stitchVODAds returns the segments of a VOD media playlist with the viewer's ad breaks stitched in.
+func (s *PlaybackService) stitchVODAds(ctx context.Context, r *http.Request, roomID, sessionID string, source *mediaPlaylist) ([]playlistSegment, error) {
+	breaks, err := s.ads.decider.Decide(ctx, AdRequest{
+		RoomID:    roomID,
+		SessionID: sessionID,
+		Viewer:    s.proxies.ClientIP(r),
+		End:       source.Duration(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decide ads: %w", err)
+	}
+	if len(breaks) == 0 {
+		return source.Segments, nil
+	}
+	return s.spliceAds(ctx, source, breaks), nil
+}
+
+// ServeAdContent serves a creative's playlist or segments.
+func (s *PlaybackService) ServeAdContent(ctx context.Context, w http.ResponseWriter, r *http.Request, creativeID, filename string) error {
+	if s.ads == nil {
+		return fmt.Errorf("content not found: ads are disabled")
+	}
+	return s.provider.ServeContent(ctx, w, r, s.ads.prefix+"/"+creativeID+"/"+filename)
+}
+
+// spliceAds inserts the creatives of each break at the first segment boundary at or after its offset.
+// Breaks must be ordered as AdDecider returns them.
+// Creatives that can't be loaded are skipped so a missing asset never breaks playback.
+func (s *PlaybackService) spliceAds(ctx context.Context, content *mediaPlaylist, breaks []AdBreak) []playlistSegment {
+	segments := make([]playlistSegment, 0, len(content.Segments))
+	next := 0
+	for _, seg := range content.Segments {
+		inserted := false
+		for next < len(breaks) && (breaks[next].PreRoll || breaks[next].Offset <= seg.Start) {
+			if ad := s.creativeSegments(ctx, breaks[next].CreativeID, content.InitSegment != ""); len(ad) > 0 {
+				ad[0].Discontinuity = len(segments) > 0
+				segments = append(segments, ad...)
+				inserted = true
+			}
+			next++
+		}
+		if inserted {
+			seg.Discontinuity = true
+			// Restate the content's date after the break, the ad segments don't advance it
+			if first := content.Segments[0]; !first.ProgramDateTime.IsZero() {
+				seg.ProgramDateTime = first.ProgramDateTime.Add(time.Duration((seg.Start - first.Start) * float64(time.Second)))
+			}
+		}
+		segments = append(segments, seg)
+	}
+
+	return segments
+}
+
+// creativeSegments returns the segments of a creative with URIs on the ads route.
+// fmp4 is whether the content uses fMP4 segments, a creative in the other format can't be spliced in.
+func (s *PlaybackService) creativeSegments(ctx context.Context, creativeID string, fmp4 bool) []playlistSegment {
+	l := pkglog.L()
+
+	data, err := s.provider.readAll(ctx, s.ads.prefix+"/"+creativeID+"/"+mediaPlaylistFile)
+	if err != nil {
+		l.Warn().Err(err).Str("creative_id", creativeID).Msg("failed to load ad creative, skipping break")
+		return nil
+	}
+	creative, err := parseMediaPlaylist(bytes.NewReader(data))
+	if err != nil {
+		l.Warn().Err(err).Str("creative_id", creativeID).Msg("invalid ad creative playlist, skipping break")
+		return nil
+	}
+	if (creative.InitSegment != "") != fmp4 {
+		l.Warn().Str("creative_id", creativeID).Msg("ad creative segment format differs from the content, skipping break")
+		return nil
+	}
+
+	segments := make([]playlistSegment, len(creative.Segments))
+	for i, seg := range creative.Segments {
+		seg.URI = adURI(creativeID, seg.URI)
+		if fmp4 {
+			seg.InitSegment = adURI(creativeID, creative.InitSegment)
+		}
+		segments[i] = seg
+	}
+	return segments
+}
+
+// sessionURIPrefix returns the route prefix of the directory a session playlist is in,
+// so relative segment URIs of a generated playlist resolve through this service.
+func sessionURIPrefix(route, roomID, sessionID, filename string) string {
+	prefix := route + roomID + "/" + sessionID + "/"
+	if dir := path.Dir(filename); dir != "." {
+		prefix += dir + "/"
+	}
+	return prefix
+}
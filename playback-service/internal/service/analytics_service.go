@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/weiawesome/wes-io-live/playback-service/internal/kafka"
+)
+
+// maxBeaconEvents caps the events accepted in a single beacon request.
+const maxBeaconEvents = 50
+
+// ErrInvalidBeacon is returned for beacon requests that fail validation.
+var ErrInvalidBeacon = errors.New("invalid beacon")
+
+// BeaconRequest is a batch of playback events a player reports for one view session.
+type BeaconRequest struct {
+	ViewID    string        `json:"view_id"`
+	RoomID    string        `json:"room_id"`
+	SessionID string        `json:"session_id"`
+	Mode      string        `json:"mode"` // "live" or "vod"
+	Events    []BeaconEvent `json:"events"`
+}
+
+// BeaconEvent is a single playback event within a beacon request.
+type BeaconEvent struct {
+	Type         string  `json:"type"` // "start", "rebuffer", "bitrate_switch", "heartbeat" or "end"
+	StartupMs    int64   `json:"startup_ms,omitempty"`
+	RebufferMs   int64   `json:"rebuffer_ms,omitempty"`
+	BitrateKbps  int64   `json:"bitrate_kbps,omitempty"`
+	WatchSeconds float64 `json:"watch_seconds,omitempty"`
+	Timestamp    int64   `json:"timestamp,omitempty"` // Unix milliseconds, defaults to the receive time
+}
+
+// ViewSummary is the aggregated quality of experience of a room or one of its sessions.
+type ViewSummary struct {
+	RoomID          string  `json:"room_id"`
+	SessionID       string  `json:"session_id,omitempty"`
+	Views           int64   `json:"views"`  // Distinct view sessions
+	Starts          int64   `json:"starts"` // Views that reached the first frame
+	AvgStartupMs    float64 `json:"avg_startup_ms"`
+	Rebuffers       int64   `json:"rebuffers"`
+	RebufferMs      int64   `json:"rebuffer_ms"`
+	RebufferRatio   float64 `json:"rebuffer_ratio"` // Stalled time over stalled plus watched time
+	BitrateSwitches int64   `json:"bitrate_switches"`
+	WatchSeconds    float64 `json:"watch_seconds"`
+	AvgWatchSeconds float64 `json:"avg_watch_seconds"` // Per view
+}
+
+// AnalyticsStore aggregates beacons into per room and per session statistics.
+type AnalyticsStore interface {
+	// Record adds a beacon to the aggregates of its room and session.
+	Record(ctx context.Context, beacon *kafka.Beacon) error
+
+	// Summary returns the aggregates of a room, or of one session when sessionID is set.
+	Summary(ctx context.Context, roomID, sessionID string) (*ViewSummary, error)
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// AnalyticsService accepts player beacons, publishes them to Kafka and serves
+// the statistics aggregated from the topic.
+type AnalyticsService struct {
+	producer kafka.BeaconProducer
+	store    AnalyticsStore
+}
+
+// NewAnalyticsService creates a new analytics service.
+func NewAnalyticsService(producer kafka.BeaconProducer, store AnalyticsStore) *AnalyticsService {
+	return &AnalyticsService{
+		producer: producer,
+		store:    store,
+	}
+}
+
+// SubmitBeacons validates a beacon request and publishes each event.
+func (s *AnalyticsService) SubmitBeacons(ctx context.Context, req *BeaconRequest) error {
+	if err := validateBeaconRequest(req); err != nil {
+		return err
+	}
+
+	now := time.Now().UnixMilli()
+	for _, event := range req.Events {
+		timestamp := event.Timestamp
+		if timestamp <= 0 || timestamp > now {
+			timestamp = now
+		}
+
+		beacon := &kafka.Beacon{
+			ViewID:       req.ViewID,
+			RoomID:       req.RoomID,
+			SessionID:    req.SessionID,
+			Mode:         req.Mode,
+			Type:         event.Type,
+			StartupMs:    event.StartupMs,
+			RebufferMs:   event.RebufferMs,
+			BitrateKbps:  event.BitrateKbps,
+			WatchSeconds: event.WatchSeconds,
+			Timestamp:    timestamp,
+		}
+		if err := s.producer.ProduceBeacon(ctx, beacon); err != nil {
+			return fmt.Errorf("failed to publish beacon: %w", err)
+		}
+		beaconsReceived.WithLabelValues(event.Type).Inc()
+	}
+
+	return nil
+}
+
+// HandleBeacon implements kafka.BeaconHandler, aggregating consumed beacons.
+func (s *AnalyticsService) HandleBeacon(ctx context.Context, beacon *kafka.Beacon) error {
+	return s.store.Record(ctx, beacon)
+}
+
+// Summary returns the aggregated statistics of a room, or of one session when sessionID is set.
+func (s *AnalyticsService) Summary(ctx context.Context, roomID, sessionID string) (*ViewSummary, error) {
+	return s.store.Summary(ctx, roomID, sessionID)
+}
+
+// validateBeaconRequest checks the view identifiers and the values of each event.
+func validateBeaconRequest(req *BeaconRequest) error {
+	if req.ViewID == "" || len(req.ViewID) > 64 {
+		return fmt.Errorf("%w: view_id is required", ErrInvalidBeacon)
+	}
+	if req.RoomID == "" {
+		return fmt.Errorf("%w: room_id is required", ErrInvalidBeacon)
+	}
+	switch req.Mode {
+	case kafka.ModeLive:
+	case kafka.ModeVOD:
+		if req.SessionID == "" {
+			return fmt.Errorf("%w: session_id is required for vod", ErrInvalidBeacon)
+		}
+	default:
+		return fmt.Errorf("%w: mode must be %q or %q", ErrInvalidBeacon, kafka.ModeLive, kafka.ModeVOD)
+	}
+	if len(req.Events) == 0 || len(req.Events) > maxBeaconEvents {
+		return fmt.Errorf("%w: between 1 and %d events required", ErrInvalidBeacon, maxBeaconEvents)
+	}
+
+	for _, event := range req.Events {
+		if event.StartupMs < 0 || event.RebufferMs < 0 || event.BitrateKbps < 0 || event.WatchSeconds < 0 {
+			return fmt.Errorf("%w: negative value in %s event", ErrInvalidBeacon, event.Type)
+		}
+		switch event.Type {
+		case kafka.BeaconStart, kafka.BeaconRebuffer, kafka.BeaconBitrateSwitch:
+		case kafka.BeaconHeartbeat, kafka.BeaconEnd:
+			// Players send heartbeats every few seconds, anything larger is a bogus report
+			if event.WatchSeconds > 3600 {
+				return fmt.Errorf("%w: watch_seconds out of range", ErrInvalidBeacon)
+			}
+		default:
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidBeacon, event.Type)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/kafka"
+)
+
+// Aggregate hash fields
+const (
+	fieldStarts          = "starts"
+	fieldStartupMs       = "startup_ms"
+	fieldRebuffers       = "rebuffers"
+	fieldRebufferMs      = "rebuffer_ms"
+	fieldBitrateSwitches = "bitrate_switches"
+	fieldWatchSeconds    = "watch_seconds"
+)
+
+// RedisAnalyticsStore keeps aggregates in Redis hashes, one per room and one per session,
+// with a HyperLogLog of view IDs next to each for distinct view counts.
+type RedisAnalyticsStore struct {
+	client    *redis.Client
+	keyPrefix string
+	retention time.Duration
+}
+
+// NewRedisAnalyticsStore creates a new Redis-backed analytics store.
+func NewRedisAnalyticsStore(cfg config.AnalyticsRedisConfig, retentionDays int) (*RedisAnalyticsStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisAnalyticsStore{
+		client:    client,
+		keyPrefix: cfg.KeyPrefix,
+		retention: time.Duration(retentionDays) * 24 * time.Hour,
+	}, nil
+}
+
+// key returns the aggregate hash key of a room, or of a session when sessionID is set.
+func (s *RedisAnalyticsStore) key(roomID, sessionID string) string {
+	if sessionID == "" {
+		return s.keyPrefix + "room:" + roomID
+	}
+	return s.keyPrefix + "room:" + roomID + ":session:" + sessionID
+}
+
+// viewsKey returns the HyperLogLog key of an aggregate.
+func (s *RedisAnalyticsStore) viewsKey(key string) string {
+	return key + ":views"
+}
+
+// Record adds a beacon to the room aggregate and, for beacons naming a session, the session aggregate.
+func (s *RedisAnalyticsStore) Record(ctx context.Context, beacon *kafka.Beacon) error {
+	keys := []string{s.key(beacon.RoomID, "")}
+	if beacon.SessionID != "" {
+		keys = append(keys, s.key(beacon.RoomID, beacon.SessionID))
+	}
+
+	pipe := s.client.TxPipeline()
+	for _, key := range keys {
+		switch beacon.Type {
+		case kafka.BeaconStart:
+			pipe.HIncrBy(ctx, key, fieldStarts, 1)
+			pipe.HIncrBy(ctx, key, fieldStartupMs, beacon.StartupMs)
+		case kafka.BeaconRebuffer:
+			pipe.HIncrBy(ctx, key, fieldRebuffers, 1)
+			pipe.HIncrBy(ctx, key, fieldRebufferMs, beacon.RebufferMs)
+		case kafka.BeaconBitrateSwitch:
+			pipe.HIncrBy(ctx, key, fieldBitrateSwitches, 1)
+		case kafka.BeaconHeartbeat, kafka.BeaconEnd:
+			if beacon.WatchSeconds > 0 {
+				pipe.HIncrByFloat(ctx, key, fieldWatchSeconds, beacon.WatchSeconds)
+			}
+		}
+		// Any beacon counts the view, players may fail to report the start
+		pipe.PFAdd(ctx, s.viewsKey(key), beacon.ViewID)
+
+		if s.retention > 0 {
+			pipe.Expire(ctx, key, s.retention)
+			pipe.Expire(ctx, s.viewsKey(key), s.retention)
+		}
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record beacon in redis: %w", err)
+	}
+	return nil
+}
+
+// Summary returns the aggregates of a room, or of one session when sessionID is set.
+func (s *RedisAnalyticsStore) Summary(ctx context.Context, roomID, sessionID string) (*ViewSummary, error) {
+	key := s.key(roomID, sessionID)
+
+	pipe := s.client.Pipeline()
+	fieldsCmd := pipe.HGetAll(ctx, key)
+	viewsCmd := pipe.PFCount(ctx, s.viewsKey(key))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get analytics from redis: %w", err)
+	}
+
+	fields := fieldsCmd.Val()
+	summary := &ViewSummary{
+		RoomID:          roomID,
+		SessionID:       sessionID,
+		Views:           viewsCmd.Val(),
+		Starts:          parseCounter(fields[fieldStarts]),
+		Rebuffers:       parseCounter(fields[fieldRebuffers]),
+		RebufferMs:      parseCounter(fields[fieldRebufferMs]),
+		BitrateSwitches: parseCounter(fields[fieldBitrateSwitches]),
+	}
+	summary.WatchSeconds, _ = strconv.ParseFloat(fields[fieldWatchSeconds], 64)
+
+	if summary.Starts > 0 {
+		summary.AvgStartupMs = float64(parseCounter(fields[fieldStartupMs])) / float64(summary.Starts)
+	}
+	if summary.Views > 0 {
+		summary.AvgWatchSeconds = summary.WatchSeconds / float64(summary.Views)
+	}
+	if stalled := float64(summary.RebufferMs) / 1000; stalled+summary.WatchSeconds > 0 {
+		summary.RebufferRatio = stalled / (stalled + summary.WatchSeconds)
+	}
+
+	return summary, nil
+}
+
+// Close closes the Redis client connection.
+func (s *RedisAnalyticsStore) Close() error {
+	return s.client.Close()
+}
+
+// parseCounter parses a hash field, treating missing or malformed values as zero.
+func parseCounter(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
+
+// Ensure RedisAnalyticsStore implements AnalyticsStore interface
+var _ AnalyticsStore = (*RedisAnalyticsStore)(nil)
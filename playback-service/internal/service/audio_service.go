@@ -0,0 +1,170 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
+)
+
+// audioRendition is the subdirectory of a session's audio-only rendition, written by media-service.
+const audioRendition = "audio"
+
+// isAudioRendition returns true if a session file belongs to the audio-only rendition.
+func isAudioRendition(filename string) bool {
+	return strings.HasPrefix(filename, audioRendition+"/")
+}
+
+// AudioService serves rooms for listening: the audio-only rendition of live and recorded
+// sessions and a podcast RSS feed per room with the sessions whose audio was exported.
+type AudioService struct {
+	playbackSvc *PlaybackService
+	exportSvc   *ExportService // nil when exports are disabled, feeds are then empty
+	cfg         config.AudioConfig
+}
+
+// NewAudioService creates a new audio service.
+func NewAudioService(playbackSvc *PlaybackService, exportSvc *ExportService, cfg config.AudioConfig) *AudioService {
+	return &AudioService{
+		playbackSvc: playbackSvc,
+		exportSvc:   exportSvc,
+		cfg:         cfg,
+	}
+}
+
+// ServeAudioContent serves a playlist or segment of a session's audio-only rendition,
+// from the live output while the session is live and from its recording afterwards.
+func (s *AudioService) ServeAudioContent(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) error {
+	activeSessionID, err := s.playbackSvc.GetActiveSessionID(ctx, roomID)
+	if err != nil {
+		return err
+	}
+
+	name := path.Join(audioRendition, filename)
+	if activeSessionID == sessionID {
+		return s.playbackSvc.ServeLiveContent(ctx, w, r, roomID, sessionID, name)
+	}
+	return s.playbackSvc.ServeVODContent(ctx, w, r, roomID, sessionID, name)
+}
+
+// rssFeed is a podcast RSS 2.0 feed with the iTunes tags podcast apps read.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Language    string    `xml:"language,omitempty"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title     string       `xml:"title"`
+	GUID      rssGUID      `xml:"guid"`
+	PubDate   string       `xml:"pubDate"`
+	Enclosure rssEnclosure `xml:"enclosure"`
+	Duration  string       `xml:"itunes:duration,omitempty"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// Feed returns the podcast RSS feed of a room. Episodes are the room's most recent sessions
+// with a completed audio export, sessions are listed once their audio is exported.
+func (s *AudioService) Feed(ctx context.Context, r *http.Request, roomID string) ([]byte, error) {
+	base := strings.TrimSuffix(s.cfg.PublicURL, "/")
+	channel := rssChannel{
+		Title:       "Room " + roomID,
+		Link:        base + "/audio/" + roomID + "/feed.xml",
+		Description: "Recorded broadcasts of room " + roomID,
+		Language:    s.cfg.FeedLanguage,
+	}
+
+	if s.exportSvc != nil {
+		vods, err := s.playbackSvc.ListRoomVODs(ctx, roomID)
+		if err != nil {
+			return nil, err
+		}
+		// Enclosures carry the feed's playback token, podcast apps can't add one
+		query := ""
+		if tokenQuery := s.playbackSvc.tokenQuery(r); tokenQuery != "" {
+			query = "?" + tokenQuery
+		}
+
+		l := pkglog.L()
+		for _, vod := range vods {
+			// Only sessions with a completed export count toward the episode limit
+			if s.cfg.FeedEpisodes > 0 && len(channel.Items) >= s.cfg.FeedEpisodes {
+				break
+			}
+			job, err := s.exportSvc.GetAudioExport(ctx, roomID, vod.SessionID)
+			if err != nil || job.Status != ExportCompleted {
+				if err != nil && !strings.Contains(err.Error(), "not found") {
+					l.Warn().Err(err).Str("room_id", roomID).Str("session_id", vod.SessionID).Msg("failed to read audio export, episode left out of feed")
+				}
+				continue
+			}
+
+			published := vod.StartTime
+			if published.IsZero() && job.CompletedAt != nil {
+				published = *job.CompletedAt
+			}
+			channel.Items = append(channel.Items, rssItem{
+				Title:   "Broadcast of " + published.UTC().Format("January 2, 2006 15:04 MST"),
+				GUID:    rssGUID{Value: roomID + "/" + vod.SessionID},
+				PubDate: published.UTC().Format(time.RFC1123Z),
+				Enclosure: rssEnclosure{
+					URL:    base + "/audio/" + roomID + "/" + vod.SessionID + "/download" + query,
+					Length: job.Size,
+					Type:   s.exportSvc.AudioContentType(),
+				},
+				Duration: formatFeedDuration(job.Duration),
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	err := enc.Encode(rssFeed{
+		Version: "2.0",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Channel: channel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode feed: %w", err)
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes(), nil
+}
+
+// formatFeedDuration formats an episode duration as HH:MM:SS, empty if unknown.
+func formatFeedDuration(seconds float64) string {
+	if seconds <= 0 {
+		return ""
+	}
+	total := int(seconds + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d", total/3600, total/60%60, total%60)
+}
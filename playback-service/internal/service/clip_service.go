@@ -0,0 +1,379 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/pkg/storage"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
+)
+
+const (
+	clipMetadataFile  = "clip.json"
+	clipThumbnailFile = "thumbnail.jpg"
+)
+
+var (
+	// ErrClipNotFound is returned when a clip does not exist.
+	ErrClipNotFound = errors.New("clip not found")
+
+	// ErrInvalidClip is returned when a clip request is invalid.
+	ErrInvalidClip = errors.New("invalid clip request")
+)
+
+// Clip is a short excerpt of a VOD session stored as its own HLS asset.
+type Clip struct {
+	ID           string    `json:"id"`
+	RoomID       string    `json:"room_id"`
+	SessionID    string    `json:"session_id"`
+	Title        string    `json:"title"`
+	Start        float64   `json:"start"` // Offset into the session in seconds, aligned to segment boundaries
+	End          float64   `json:"end"`
+	Duration     float64   `json:"duration"`
+	CreatedAt    time.Time `json:"created_at"`
+	URL          string    `json:"url,omitempty"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+}
+
+// CreateClipRequest describes a clip to cut from a VOD session.
+type CreateClipRequest struct {
+	RoomID    string
+	SessionID string // Empty = the room's live session (DVR window)
+	Title     string
+	Start     float64 // Offset into the session in seconds
+	End       float64
+}
+
+// ClipService creates clips from recorded sessions and serves them like VODs.
+// Clips are cut on segment boundaries: the segments overlapping the requested range are copied
+// to {clip_prefix}/room_{roomID}/{clipID}/ so the clip outlives the VOD it was cut from.
+type ClipService struct {
+	storage     storage.Storage
+	provider    *ContentProvider
+	playbackSvc *PlaybackService
+	keys        *KeyService // Decrypts the thumbnail frame of encrypted sessions, nil if disabled
+	cfg         config.PlaybackConfig
+	maxDuration float64
+}
+
+// NewClipService creates a new clip service.
+func NewClipService(store storage.Storage, provider *ContentProvider, playbackSvc *PlaybackService, keys *KeyService, cfg config.PlaybackConfig) *ClipService {
+	return &ClipService{
+		storage:     store,
+		provider:    provider,
+		playbackSvc: playbackSvc,
+		keys:        keys,
+		cfg:         cfg,
+		maxDuration: float64(cfg.ClipMaxDuration),
+	}
+}
+
+// CreateClip cuts a clip from a VOD session, or from the live DVR window if no session is given.
+func (s *ClipService) CreateClip(ctx context.Context, req CreateClipRequest) (*Clip, error) {
+	if req.Start < 0 || req.End <= req.Start {
+		return nil, fmt.Errorf("%w: end must be after start", ErrInvalidClip)
+	}
+	if s.maxDuration > 0 && req.End-req.Start > s.maxDuration {
+		return nil, fmt.Errorf("%w: clips are limited to %.0f seconds", ErrInvalidClip, s.maxDuration)
+	}
+
+	sessionID := req.SessionID
+	if sessionID == "" {
+		active, err := s.playbackSvc.GetActiveSessionID(ctx, req.RoomID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get active session: %w", err)
+		}
+		if active == "" {
+			return nil, fmt.Errorf("%w: no live stream for room %s", ErrInvalidClip, req.RoomID)
+		}
+		sessionID = active
+	}
+
+	// The session playlist lists every uploaded segment, also while the session is still live
+	source, err := s.readPlaylist(ctx, buildStorageKey(s.cfg.VODPrefix, req.RoomID, sessionID, "stream.m3u8"))
+	if err != nil {
+		return nil, err
+	}
+
+	segments := source.Range(req.Start, req.End)
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("%w: range is outside the recording (%.1f seconds)", ErrInvalidClip, source.Duration())
+	}
+
+	clipID, err := newClipID()
+	if err != nil {
+		return nil, err
+	}
+
+	first, last := segments[0], segments[len(segments)-1]
+	clip := &Clip{
+		ID:        clipID,
+		RoomID:    req.RoomID,
+		SessionID: sessionID,
+		Title:     req.Title,
+		Start:     first.Start,
+		End:       last.Start + last.Duration,
+		CreatedAt: time.Now().UTC(),
+	}
+	clip.Duration = clip.End - clip.Start
+
+	l := pkglog.L()
+	srcKey := func(file string) string { return buildStorageKey(s.cfg.VODPrefix, req.RoomID, sessionID, file) }
+	dstKey := func(file string) string { return buildStorageKey(s.cfg.ClipPrefix, req.RoomID, clipID, file) }
+
+	// Copy media, then the playlist and finally the metadata, which registers the clip
+	files := initSegments(source.InitSegment, segments)
+	for _, seg := range segments {
+		files = append(files, seg.URI)
+	}
+	for _, file := range files {
+		if err := s.copyObject(ctx, srcKey(file), dstKey(file)); err != nil {
+			s.storage.DeletePrefix(ctx, dstKey(""))
+			return nil, fmt.Errorf("failed to copy segment %s: %w", file, err)
+		}
+	}
+
+	playlist := encodeVODPlaylist(source.InitSegment, segments)
+	if err := s.storage.Write(ctx, dstKey("stream.m3u8"), bytes.NewReader(playlist), int64(len(playlist)), "application/vnd.apple.mpegurl"); err != nil {
+		s.storage.DeletePrefix(ctx, dstKey(""))
+		return nil, fmt.Errorf("failed to write clip playlist: %w", err)
+	}
+
+	// The thumbnail is the first frame of the clip, the session's latest preview image if it can't be captured
+	if err := s.captureThumbnail(ctx, req.RoomID, clipID, source.InitSegment, segments[0]); err != nil {
+		l.Warn().Err(err).Str("room_id", req.RoomID).Str("clip_id", clipID).Msg("failed to capture clip thumbnail")
+		previewKey := buildPreviewKey(s.cfg.StoragePrefix, req.RoomID, sessionID, clipThumbnailFile)
+		if err := s.copyObject(ctx, previewKey, dstKey(clipThumbnailFile)); err != nil {
+			l.Debug().Err(err).Str("room_id", req.RoomID).Str("session_id", sessionID).Msg("no thumbnail for clip")
+		}
+	}
+
+	metadata, err := json.Marshal(clip)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.storage.Write(ctx, dstKey(clipMetadataFile), bytes.NewReader(metadata), int64(len(metadata)), "application/json"); err != nil {
+		s.storage.DeletePrefix(ctx, dstKey(""))
+		return nil, fmt.Errorf("failed to write clip metadata: %w", err)
+	}
+
+	l.Info().Str("room_id", req.RoomID).Str("session_id", sessionID).Str("clip_id", clipID).
+		Float64("start", clip.Start).Float64("end", clip.End).Int("segments", len(segments)).Msg("clip created")
+
+	s.setURLs(ctx, clip)
+	return clip, nil
+}
+
+// GetClip returns a clip by ID.
+func (s *ClipService) GetClip(ctx context.Context, roomID, clipID string) (*Clip, error) {
+	clip, err := s.readClip(ctx, buildStorageKey(s.cfg.ClipPrefix, roomID, clipID, clipMetadataFile))
+	if err != nil {
+		return nil, err
+	}
+	s.setURLs(ctx, clip)
+	return clip, nil
+}
+
+// ListRoomClips returns the clips of a room, most recent first.
+func (s *ClipService) ListRoomClips(ctx context.Context, roomID string) ([]*Clip, error) {
+	files, err := s.storage.List(ctx, buildStoragePrefix(s.cfg.ClipPrefix, roomID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clips: %w", err)
+	}
+
+	clips := make([]*Clip, 0)
+	for _, f := range files {
+		if path.Base(f.Key) != clipMetadataFile {
+			continue
+		}
+		clip, err := s.readClip(ctx, f.Key)
+		if err != nil {
+			continue
+		}
+		s.setURLs(ctx, clip)
+		clips = append(clips, clip)
+	}
+
+	sort.Slice(clips, func(i, j int) bool {
+		return clips[i].CreatedAt.After(clips[j].CreatedAt)
+	})
+
+	return clips, nil
+}
+
+// ServeClipContent serves clip playlists, segments and the thumbnail.
+// Playlists pass the request's playback token on to the segments, like VOD playlists.
+func (s *ClipService) ServeClipContent(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, clipID, filename string) error {
+	key := buildStorageKey(s.cfg.ClipPrefix, roomID, clipID, filename)
+	return s.playbackSvc.serveStream(ctx, w, r, key)
+}
+
+// captureThumbnail extracts the first frame of a clip's first segment with FFmpeg as its thumbnail.
+func (s *ClipService) captureThumbnail(ctx context.Context, roomID, clipID, initSegment string, first playlistSegment) error {
+	workDir, err := os.MkdirTemp("", "clip-")
+	if err != nil {
+		return fmt.Errorf("failed to create work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	files := append(initSegments(initSegment, []playlistSegment{first}), first.URI)
+	for _, file := range files {
+		key := buildStorageKey(s.cfg.ClipPrefix, roomID, clipID, file)
+		if err := downloadObject(ctx, s.storage, key, filepath.Join(workDir, filepath.FromSlash(file))); err != nil {
+			return fmt.Errorf("failed to download %s: %w", file, err)
+		}
+	}
+
+	segments, err := downloadKeys(ctx, s.keys, workDir, []playlistSegment{first})
+	if err != nil {
+		return err
+	}
+	playlistPath := filepath.Join(workDir, "stream.m3u8")
+	if err := os.WriteFile(playlistPath, encodeVODPlaylist(initSegment, segments), 0644); err != nil {
+		return fmt.Errorf("failed to write playlist: %w", err)
+	}
+
+	thumbnailPath := filepath.Join(workDir, clipThumbnailFile)
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-allowed_extensions", "ALL",
+		"-i", playlistPath,
+		"-frames:v", "1",
+		"-q:v", "3",
+		thumbnailPath,
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	f, err := os.Open(thumbnailPath)
+	if err != nil {
+		return fmt.Errorf("failed to open thumbnail: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat thumbnail: %w", err)
+	}
+
+	key := buildStorageKey(s.cfg.ClipPrefix, roomID, clipID, clipThumbnailFile)
+	return s.storage.Write(ctx, key, f, info.Size(), "image/jpeg")
+}
+
+// setURLs fills in the playlist and thumbnail URLs of a clip.
+func (s *ClipService) setURLs(ctx context.Context, clip *Clip) {
+	ttl := time.Duration(s.cfg.PresignExpiry) * time.Second
+
+	if url, err := s.provider.GetURL(ctx, buildStorageKey(s.cfg.ClipPrefix, clip.RoomID, clip.ID, "stream.m3u8"), ttl); err == nil {
+		clip.URL = url
+	}
+
+	thumbnailKey := buildStorageKey(s.cfg.ClipPrefix, clip.RoomID, clip.ID, clipThumbnailFile)
+	if exists, _ := s.provider.Exists(ctx, thumbnailKey); exists {
+		if url, err := s.provider.GetURL(ctx, thumbnailKey, ttl); err == nil {
+			clip.ThumbnailURL = url
+		}
+	}
+}
+
+// readPlaylist reads and parses a media playlist from storage.
+func (s *ClipService) readPlaylist(ctx context.Context, key string) (*mediaPlaylist, error) {
+	exists, err := s.storage.Exists(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check VOD existence: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: recording not found", ErrInvalidClip)
+	}
+
+	reader, err := s.storage.Read(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	defer reader.Close()
+
+	return parseMediaPlaylist(reader)
+}
+
+// readClip reads a clip's metadata from storage.
+func (s *ClipService) readClip(ctx context.Context, key string) (*Clip, error) {
+	exists, err := s.storage.Exists(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check clip existence: %w", err)
+	}
+	if !exists {
+		return nil, ErrClipNotFound
+	}
+
+	reader, err := s.storage.Read(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clip: %w", err)
+	}
+	defer reader.Close()
+
+	var clip Clip
+	if err := json.NewDecoder(reader).Decode(&clip); err != nil {
+		return nil, fmt.Errorf("failed to decode clip: %w", err)
+	}
+	return &clip, nil
+}
+
+// copyObject copies an object within storage.
+func (s *ClipService) copyObject(ctx context.Context, srcKey, dstKey string) error {
+	reader, err := s.storage.Read(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	return s.storage.Write(ctx, dstKey, bytes.NewReader(data), int64(len(data)), contentTypeFor(srcKey))
+}
+
+// contentTypeFor returns the content type stored for a clip file.
+func contentTypeFor(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	case ".m4s":
+		return "video/iso.segment"
+	case ".mp4":
+		return "video/mp4"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// newClipID returns a random clip ID.
+func newClipID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate clip id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
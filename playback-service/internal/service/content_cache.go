@@ -0,0 +1,148 @@
+package service
+
+import (
+	"container/list"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/weiawesome/wes-io-live/pkg/storage"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
+)
+
+// contentCache is a size-bounded LRU of recently served playlists and segments.
+// Live viewers all request the same few objects, so a short-lived copy in memory
+// saves a storage round trip per viewer.
+type contentCache struct {
+	maxBytes    int64
+	maxObject   int64
+	playlistTTL time.Duration
+	segmentTTL  time.Duration
+	initTTL     time.Duration
+
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List // Front is most recently used
+	mu      sync.Mutex
+}
+
+// cachedContent is a stored object held in memory.
+type cachedContent struct {
+	info *storage.FileInfo
+	data []byte
+}
+
+// cacheEntry is a cached object.
+type cacheEntry struct {
+	key     string
+	content *cachedContent
+	expires time.Time
+}
+
+// newContentCache creates a content cache.
+func newContentCache(cfg config.CacheConfig) *contentCache {
+	return &contentCache{
+		maxBytes:    int64(cfg.MaxSizeMB) << 20,
+		maxObject:   int64(cfg.MaxObjectKB) << 10,
+		playlistTTL: time.Duration(cfg.PlaylistTTLMs) * time.Millisecond,
+		segmentTTL:  time.Duration(cfg.SegmentTTL) * time.Second,
+		initTTL:     time.Duration(cfg.InitTTL) * time.Second,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+// cacheKind returns the metrics label for a key, empty if the object is not cached.
+func cacheKind(key string) string {
+	// Uploaded subtitle tracks are re-read for every segment of the rendition
+	if filepath.Base(filepath.Dir(key)) == subtitlesDir && filepath.Ext(key) == ".vtt" {
+		return "subtitle"
+	}
+
+	switch filepath.Ext(key) {
+	case ".m3u8", ".mpd":
+		return "playlist"
+	case ".ts", ".m4s":
+		return "segment"
+	case ".mp4":
+		// Only fMP4 init segments (init.mp4, init_{n}.mp4 of resumed connections) are cached,
+		// exports are too large and animated previews change
+		if name := filepath.Base(key); name == "init.mp4" || strings.HasPrefix(name, "init_") {
+			return "init"
+		}
+	}
+	return ""
+}
+
+// ttl returns how long an object of the given kind stays cached.
+func (c *contentCache) ttl(kind string) time.Duration {
+	switch kind {
+	case "playlist":
+		// Live playlists change every segment, keep this well below the segment duration
+		return c.playlistTTL
+	case "segment", "subtitle":
+		return c.segmentTTL
+	case "init":
+		return c.initTTL
+	default:
+		return 0
+	}
+}
+
+// get returns the cached content for key if present and not expired.
+func (c *contentCache) get(key string) (*cachedContent, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.removeLocked(elem)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return entry.content, true
+}
+
+// set stores content for key, evicting least recently used entries to stay within the size limit.
+// Objects larger than the per-object limit are not cached.
+func (c *contentCache) set(key string, content *cachedContent, ttl time.Duration) {
+	size := int64(len(content.data))
+	if ttl <= 0 || size > c.maxObject || size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.removeLocked(elem)
+	}
+
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, content: content, expires: time.Now().Add(ttl)})
+	c.size += size
+
+	for c.size > c.maxBytes {
+		oldest := c.lru.Back()
+		if oldest == nil {
+			break
+		}
+		c.removeLocked(oldest)
+		cacheEvictions.Inc()
+	}
+
+	cacheBytes.Set(float64(c.size))
+}
+
+// removeLocked drops an entry. Caller must hold c.mu.
+func (c *contentCache) removeLocked(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.content.data))
+	cacheBytes.Set(float64(c.size))
+}
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,6 +11,8 @@ import (
 	"strings"
 	"time"
 
+	"golang.org/x/sync/singleflight"
+
 	"github.com/weiawesome/wes-io-live/pkg/storage"
 	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
 )
@@ -19,18 +23,25 @@ type ContentProvider struct {
 	storage      storage.Storage
 	redirectMode bool
 	presignTTL   time.Duration
+	cache        *contentCache // nil when disabled
+	sf           singleflight.Group
 }
 
 // NewContentProvider creates a new content provider.
-func NewContentProvider(store storage.Storage, cfg config.PlaybackConfig, storageType string) *ContentProvider {
+func NewContentProvider(store storage.Storage, cfg config.PlaybackConfig, cacheCfg config.CacheConfig, storageType string) *ContentProvider {
 	// Redirect mode only works with S3 storage
 	redirectMode := cfg.AccessMode == "redirect" && storageType == "s3"
 
-	return &ContentProvider{
+	p := &ContentProvider{
 		storage:      store,
 		redirectMode: redirectMode,
 		presignTTL:   time.Duration(cfg.PresignExpiry) * time.Second,
 	}
+	if cacheCfg.Enabled {
+		p.cache = newContentCache(cacheCfg)
+	}
+
+	return p
 }
 
 // ServeContent serves content from storage to the HTTP response.
@@ -49,6 +60,73 @@ func (p *ContentProvider) ServeContent(ctx context.Context, w http.ResponseWrite
 	return p.proxyContent(ctx, w, r, key)
 }
 
+// ProxyContent streams content from storage to the client regardless of the access mode.
+// Used for text tracks whose relative references must resolve against this service.
+func (p *ContentProvider) ProxyContent(ctx context.Context, w http.ResponseWriter, r *http.Request, key string) error {
+	// Security: validate key to prevent directory traversal
+	cleanKey := filepath.Clean(key)
+	if strings.Contains(cleanKey, "..") {
+		return fmt.Errorf("invalid key: directory traversal attempt")
+	}
+
+	return p.proxyContent(ctx, w, r, key)
+}
+
+// ServeManifest proxies a playlist or DASH manifest with query appended to every URI it references.
+// The rewritten manifest differs per viewer, so it is served without validators.
+func (p *ContentProvider) ServeManifest(ctx context.Context, w http.ResponseWriter, key, query string) error {
+	// Security: validate key to prevent directory traversal
+	cleanKey := filepath.Clean(key)
+	if strings.Contains(cleanKey, "..") {
+		return fmt.Errorf("invalid key: directory traversal attempt")
+	}
+
+	data, err := p.readAll(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(key)
+	setContentHeaders(w, ext)
+	w.Write(appendManifestQuery(data, ext, query))
+	return nil
+}
+
+// readAll returns the content of a stored object, from the cache when possible.
+func (p *ContentProvider) readAll(ctx context.Context, key string) ([]byte, error) {
+	content, err := p.readObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return content.data, nil
+}
+
+// readObject returns the content and metadata of a stored object, from the cache when possible.
+func (p *ContentProvider) readObject(ctx context.Context, key string) (*cachedContent, error) {
+	if p.cache != nil {
+		if kind := cacheKind(key); kind != "" {
+			return p.fetchCached(ctx, key, kind)
+		}
+	}
+
+	info, err := p.stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := p.storage.Read(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content: %w", err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content: %w", err)
+	}
+	return &cachedContent{info: info, data: data}, nil
+}
+
 // redirectToPresignedURL redirects the client to a presigned URL.
 func (p *ContentProvider) redirectToPresignedURL(ctx context.Context, w http.ResponseWriter, r *http.Request, key string) error {
 	url, err := p.storage.GetURL(ctx, key, p.presignTTL)
@@ -61,35 +139,167 @@ func (p *ContentProvider) redirectToPresignedURL(ctx context.Context, w http.Res
 }
 
 // proxyContent streams content from storage to the client.
+// Range, If-None-Match and If-Modified-Since requests are answered from the object's metadata.
 func (p *ContentProvider) proxyContent(ctx context.Context, w http.ResponseWriter, r *http.Request, key string) error {
-	// Check if content exists
-	exists, err := p.storage.Exists(ctx, key)
+	if p.cache != nil {
+		if kind := cacheKind(key); kind != "" {
+			content, err := p.fetchCached(ctx, key, kind)
+			if err != nil {
+				return err
+			}
+			setObjectHeaders(w, key, content.info)
+			http.ServeContent(w, r, "", content.info.LastModified, bytes.NewReader(content.data))
+			return nil
+		}
+	}
+
+	info, err := p.stat(ctx, key)
 	if err != nil {
-		return fmt.Errorf("failed to check content existence: %w", err)
+		return err
 	}
-	if !exists {
-		return fmt.Errorf("content not found: %s", key)
+
+	content := &storageReadSeeker{ctx: ctx, storage: p.storage, key: key, size: info.Size}
+	defer content.Close()
+
+	setObjectHeaders(w, key, info)
+	http.ServeContent(w, r, "", info.LastModified, content)
+	return nil
+}
+
+// fetchCached returns content from the cache, reading it from storage on a miss.
+// Concurrent misses for the same key share a single storage read.
+func (p *ContentProvider) fetchCached(ctx context.Context, key, kind string) (*cachedContent, error) {
+	if content, ok := p.cache.get(key); ok {
+		cacheHits.WithLabelValues(kind).Inc()
+		return content, nil
 	}
+	cacheMisses.WithLabelValues(kind).Inc()
 
-	// Read content from storage
-	reader, err := p.storage.Read(ctx, key)
+	// Do reports shared to the leader as well, only the waiters count as coalesced
+	leader := false
+	result, err, shared := p.sf.Do(key, func() (interface{}, error) {
+		leader = true
+
+		// Detached from the request so one viewer disconnecting doesn't fail the others
+		ctx := context.WithoutCancel(ctx)
+
+		info, err := p.stat(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		reader, err := p.storage.Read(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read content: %w", err)
+		}
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read content: %w", err)
+		}
+
+		content := &cachedContent{info: info, data: data}
+		p.cache.set(key, content, p.cache.ttl(kind))
+		return content, nil
+	})
+	if shared && !leader {
+		cacheCoalesced.WithLabelValues(kind).Inc()
+	}
 	if err != nil {
-		return fmt.Errorf("failed to read content: %w", err)
+		return nil, err
 	}
-	defer reader.Close()
 
+	return result.(*cachedContent), nil
+}
+
+// stat returns the metadata of content in storage.
+func (p *ContentProvider) stat(ctx context.Context, key string) (*storage.FileInfo, error) {
+	info, err := p.storage.Stat(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, fmt.Errorf("content not found: %s", key)
+		}
+		return nil, fmt.Errorf("failed to check content existence: %w", err)
+	}
+	return info, nil
+}
+
+// setObjectHeaders sets the content type, caching and validator headers for a stored object.
+func setObjectHeaders(w http.ResponseWriter, key string, info *storage.FileInfo) {
 	// Set content type and caching headers based on file extension
 	ext := filepath.Ext(key)
 	setContentHeaders(w, ext)
+	if filepath.Base(key) == "animated.mp4" {
+		// Animated previews are refreshed while live, unlike fMP4 init segments
+		w.Header().Set("Cache-Control", "public, max-age=5")
+	}
 
-	// Stream content to client
-	_, err = io.Copy(w, reader)
-	if err != nil {
-		// Client may have disconnected, log but don't return error
-		return nil
+	// http.ServeContent checks If-None-Match against this header
+	if info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
 	}
+}
 
-	return nil
+// storageReadSeeker reads a stored object of known size for http.ServeContent.
+// Each seek is served by a new ranged read from the requested offset.
+type storageReadSeeker struct {
+	ctx     context.Context
+	storage storage.Storage
+	key     string
+	size    int64
+	offset  int64
+	reader  io.ReadCloser // Open ranged read at offset, nil until the next Read
+}
+
+// Read implements io.Reader.
+func (s *storageReadSeeker) Read(b []byte) (int, error) {
+	if s.offset >= s.size {
+		return 0, io.EOF
+	}
+	if s.reader == nil {
+		reader, err := s.storage.ReadRange(s.ctx, s.key, s.offset, s.size-s.offset)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read content: %w", err)
+		}
+		s.reader = reader
+	}
+
+	n, err := s.reader.Read(b)
+	s.offset += int64(n)
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (s *storageReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position: %d", offset)
+	}
+
+	if offset != s.offset {
+		s.Close()
+		s.offset = offset
+	}
+	return offset, nil
+}
+
+// Close closes the open ranged read, if any.
+func (s *storageReadSeeker) Close() error {
+	if s.reader == nil {
+		return nil
+	}
+	err := s.reader.Close()
+	s.reader = nil
+	return err
 }
 
 // GetURL returns a URL for accessing content.
@@ -99,6 +309,11 @@ func (p *ContentProvider) GetURL(ctx context.Context, key string, ttl time.Durat
 	return p.storage.GetURL(ctx, key, ttl)
 }
 
+// Read opens content from storage.
+func (p *ContentProvider) Read(ctx context.Context, key string) (io.ReadCloser, error) {
+	return p.storage.Read(ctx, key)
+}
+
 // Exists checks if content exists in storage.
 func (p *ContentProvider) Exists(ctx context.Context, key string) (bool, error) {
 	return p.storage.Exists(ctx, key)
@@ -120,9 +335,22 @@ func setContentHeaders(w http.ResponseWriter, ext string) {
 	case ".m3u8":
 		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	case ".mpd":
+		w.Header().Set("Content-Type", "application/dash+xml")
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	case ".ts":
 		w.Header().Set("Content-Type", "video/mp2t")
 		w.Header().Set("Cache-Control", "public, max-age=10")
+	case ".m4s":
+		w.Header().Set("Content-Type", "video/iso.segment")
+		w.Header().Set("Cache-Control", "public, max-age=10")
+	case ".mp4":
+		// fMP4 init segment (EXT-X-MAP), shared by every segment of the session
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	case ".vtt":
+		w.Header().Set("Content-Type", "text/vtt")
+		w.Header().Set("Cache-Control", "no-cache") // Thumbnail tracks grow while the session is live
 	case ".jpg", ".jpeg":
 		w.Header().Set("Content-Type", "image/jpeg")
 		w.Header().Set("Cache-Control", "public, max-age=5") // Short cache for live previews
@@ -0,0 +1,635 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/pkg/storage"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
+)
+
+const (
+	exportStatusFile = "export.json"
+	exportFile       = "download.mp4"
+
+	// exportStaleAfter marks a running export as abandoned (e.g. its instance restarted)
+	// when its status has not been updated for this long.
+	exportStaleAfter = 2 * time.Minute
+)
+
+// ExportStatus is the state of an MP4 export job.
+type ExportStatus string
+
+const (
+	ExportPending   ExportStatus = "pending"
+	ExportRunning   ExportStatus = "running"
+	ExportCompleted ExportStatus = "completed"
+	ExportFailed    ExportStatus = "failed"
+)
+
+var (
+	// ErrExportNotFound is returned when no export exists for a session.
+	ErrExportNotFound = errors.New("export not found")
+
+	// ErrExportUnavailable is returned when a session cannot be exported (yet).
+	ErrExportUnavailable = errors.New("export unavailable")
+)
+
+// ExportJob describes the MP4 or audio export of a VOD session.
+// It is stored next to the VOD (export.json for MP4) so any instance can report its status.
+type ExportJob struct {
+	RoomID      string       `json:"room_id"`
+	SessionID   string       `json:"session_id"`
+	Format      string       `json:"format,omitempty"` // "mp4", "m4a" or "mp3"
+	Status      ExportStatus `json:"status"`
+	Progress    float64      `json:"progress"` // 0-1
+	Error       string       `json:"error,omitempty"`
+	Size        int64        `json:"size,omitempty"`
+	Duration    float64      `json:"duration,omitempty"` // seconds
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+	DownloadURL string       `json:"download_url,omitempty"`
+}
+
+// exportFormat is a file format VOD sessions are exported to.
+type exportFormat struct {
+	Name        string   // "mp4", "m4a" or "mp3"
+	File        string   // Stored next to the VOD
+	StatusFile  string   // Job status, stored next to the VOD
+	ContentType string   // MIME type of the file
+	AudioOnly   bool     // Exported from the audio-only rendition when the session has one
+	Args        []string // FFmpeg output arguments
+}
+
+// mp4Export remuxes a session into a single faststart MP4, moov atom first for progressive download.
+var mp4Export = exportFormat{
+	Name:        "mp4",
+	File:        exportFile,
+	StatusFile:  exportStatusFile,
+	ContentType: "video/mp4",
+	Args:        []string{"-map", "0", "-c", "copy", "-movflags", "+faststart"},
+}
+
+// audioExportFormat returns the audio export format: "mp3" encodes the audio at bitrate,
+// anything else remuxes the AAC audio into an M4A file.
+func audioExportFormat(format, bitrate string) exportFormat {
+	if format == "mp3" {
+		return exportFormat{
+			Name:        "mp3",
+			File:        "audio.mp3",
+			StatusFile:  "export_mp3.json",
+			ContentType: "audio/mpeg",
+			AudioOnly:   true,
+			Args:        []string{"-vn", "-c:a", "libmp3lame", "-b:a", bitrate},
+		}
+	}
+	return exportFormat{
+		Name:        "m4a",
+		File:        "audio.m4a",
+		StatusFile:  "export_m4a.json",
+		ContentType: "audio/mp4",
+		AudioOnly:   true,
+		Args:        []string{"-vn", "-c:a", "copy", "-movflags", "+faststart"},
+	}
+}
+
+// ExportService exports finished VOD sessions with FFmpeg, remuxed into a single faststart MP4
+// (download.mp4) or as an audio file for listening offline (audio.m4a or audio.mp3).
+// Exports are stored next to the VOD.
+type ExportService struct {
+	storage   storage.Storage
+	provider  *ContentProvider
+	cfg       config.PlaybackConfig
+	exportCfg config.ExportConfig
+	audio     exportFormat
+	keys      *KeyService // nil when encrypted sessions can't be exported
+	slots     chan struct{}
+
+	mu      sync.Mutex
+	running map[string]bool // roomID/sessionID/format
+	jobMu   sync.Mutex      // Guards the fields of running jobs
+}
+
+// NewExportService creates a new export service.
+// keys reads the content keys of encrypted sessions, nil if the key server is disabled.
+func NewExportService(store storage.Storage, provider *ContentProvider, keys *KeyService, cfg config.PlaybackConfig, exportCfg config.ExportConfig) *ExportService {
+	concurrency := exportCfg.MaxConcurrent
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &ExportService{
+		storage:   store,
+		provider:  provider,
+		cfg:       cfg,
+		exportCfg: exportCfg,
+		audio:     audioExportFormat(exportCfg.AudioFormat, exportCfg.AudioBitrate),
+		keys:      keys,
+		slots:     make(chan struct{}, concurrency),
+		running:   make(map[string]bool),
+	}
+}
+
+// StartExport starts exporting a finished VOD session to MP4.
+// Returns the existing job if the session is already exported or being exported.
+func (s *ExportService) StartExport(ctx context.Context, roomID, sessionID string) (*ExportJob, error) {
+	return s.start(ctx, roomID, sessionID, mp4Export)
+}
+
+// StartAudioExport starts exporting the audio of a finished VOD session.
+// Returns the existing job if the session's audio is already exported or being exported.
+func (s *ExportService) StartAudioExport(ctx context.Context, roomID, sessionID string) (*ExportJob, error) {
+	return s.start(ctx, roomID, sessionID, s.audio)
+}
+
+// start starts exporting a finished VOD session to a format.
+func (s *ExportService) start(ctx context.Context, roomID, sessionID string, format exportFormat) (*ExportJob, error) {
+	job, err := s.getExport(ctx, roomID, sessionID, format)
+	if err != nil && !errors.Is(err, ErrExportNotFound) {
+		return nil, err
+	}
+	if job != nil && (job.Status == ExportCompleted || s.isActive(job)) {
+		return job, nil
+	}
+
+	// Only finished recordings can be exported
+	dir, playlist, err := s.readSource(ctx, roomID, sessionID, format)
+	if err != nil {
+		return nil, err
+	}
+	if !playlist.Ended {
+		return nil, fmt.Errorf("%w: session %s is still live", ErrExportUnavailable, sessionID)
+	}
+	if len(playlist.Segments) == 0 {
+		return nil, fmt.Errorf("%w: session %s has no segments", ErrExportUnavailable, sessionID)
+	}
+
+	key := roomID + "/" + sessionID + "/" + format.Name
+	s.mu.Lock()
+	if s.running[key] {
+		s.mu.Unlock()
+		return s.getExport(ctx, roomID, sessionID, format)
+	}
+	s.running[key] = true
+	s.mu.Unlock()
+
+	now := time.Now().UTC()
+	job = &ExportJob{
+		RoomID:    roomID,
+		SessionID: sessionID,
+		Format:    format.Name,
+		Status:    ExportPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.saveJob(ctx, job, format); err != nil {
+		s.finish(key)
+		return nil, err
+	}
+
+	created := *job
+	go s.run(job, format, dir, playlist)
+
+	return &created, nil
+}
+
+// GetExport returns the MP4 export job of a session.
+func (s *ExportService) GetExport(ctx context.Context, roomID, sessionID string) (*ExportJob, error) {
+	return s.getExport(ctx, roomID, sessionID, mp4Export)
+}
+
+// GetAudioExport returns the audio export job of a session.
+func (s *ExportService) GetAudioExport(ctx context.Context, roomID, sessionID string) (*ExportJob, error) {
+	return s.getExport(ctx, roomID, sessionID, s.audio)
+}
+
+// AudioContentType returns the MIME type of audio exports.
+func (s *ExportService) AudioContentType() string {
+	return s.audio.ContentType
+}
+
+// getExport returns the export job of a session in a format.
+func (s *ExportService) getExport(ctx context.Context, roomID, sessionID string, format exportFormat) (*ExportJob, error) {
+	key := buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, format.StatusFile)
+	exists, err := s.storage.Exists(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check export existence: %w", err)
+	}
+	if !exists {
+		return nil, ErrExportNotFound
+	}
+
+	reader, err := s.storage.Read(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export status: %w", err)
+	}
+	defer reader.Close()
+
+	var job ExportJob
+	if err := json.NewDecoder(reader).Decode(&job); err != nil {
+		return nil, fmt.Errorf("failed to decode export status: %w", err)
+	}
+
+	if job.Status == ExportCompleted {
+		ttl := time.Duration(s.cfg.PresignExpiry) * time.Second
+		if url, err := s.provider.GetURL(ctx, buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, format.File), ttl); err == nil {
+			job.DownloadURL = url
+		}
+	}
+	return &job, nil
+}
+
+// ServeDownload serves the exported MP4 of a session as an attachment.
+func (s *ExportService) ServeDownload(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID string) error {
+	return s.serveDownload(ctx, w, r, roomID, sessionID, mp4Export)
+}
+
+// ServeAudioDownload serves the exported audio of a session as an attachment.
+func (s *ExportService) ServeAudioDownload(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID string) error {
+	return s.serveDownload(ctx, w, r, roomID, sessionID, s.audio)
+}
+
+// serveDownload serves the export of a session in a format as an attachment.
+func (s *ExportService) serveDownload(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID string, format exportFormat) error {
+	job, err := s.getExport(ctx, roomID, sessionID, format)
+	if err != nil {
+		return err
+	}
+	if job.Status != ExportCompleted {
+		return fmt.Errorf("%w: export is %s", ErrExportUnavailable, job.Status)
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"room_%s_%s.%s\"", roomID, sessionID, format.Name))
+	return s.provider.ServeContent(ctx, w, r, buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, format.File))
+}
+
+// isActive returns true if a job is pending or running and has been updated recently.
+func (s *ExportService) isActive(job *ExportJob) bool {
+	if job.Status != ExportPending && job.Status != ExportRunning {
+		return false
+	}
+	return time.Since(job.UpdatedAt) < exportStaleAfter
+}
+
+// finish releases the in-process lock of an export.
+func (s *ExportService) finish(key string) {
+	s.mu.Lock()
+	delete(s.running, key)
+	s.mu.Unlock()
+}
+
+// run executes an export job: download the segments of the playlist in dir, convert them with
+// FFmpeg and upload the result.
+func (s *ExportService) run(job *ExportJob, format exportFormat, dir string, playlist *mediaPlaylist) {
+	defer s.finish(job.RoomID + "/" + job.SessionID + "/" + format.Name)
+
+	// Keep the status fresh while queued or working so the job is not considered stale
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(exportStaleAfter / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.touch(job, format)
+			}
+		}
+	}()
+
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+
+	l := pkglog.L()
+	start := time.Now()
+
+	size, err := s.export(job, format, dir, playlist)
+	if err != nil {
+		l.Error().Err(err).Str("room_id", job.RoomID).Str("session_id", job.SessionID).Msg("vod export failed")
+		s.jobMu.Lock()
+		job.Error = err.Error()
+		progress := job.Progress
+		s.jobMu.Unlock()
+		s.update(job, format, ExportFailed, progress)
+		return
+	}
+
+	now := time.Now().UTC()
+	s.jobMu.Lock()
+	job.Size = size
+	job.Duration = playlist.Duration()
+	job.CompletedAt = &now
+	s.jobMu.Unlock()
+	s.update(job, format, ExportCompleted, 1)
+	l.Info().Str("room_id", job.RoomID).Str("session_id", job.SessionID).Str("format", format.Name).Int64("size", size).Dur("took", time.Since(start)).Msg("vod exported")
+}
+
+// export downloads the segments of the session's playlist in dir, converts them and uploads the
+// result. Returns the exported file's size.
+// Progress: downloading 0-40%, converting 40-90%, uploading 90-100%.
+func (s *ExportService) export(job *ExportJob, format exportFormat, dir string, playlist *mediaPlaylist) (int64, error) {
+	ctx := context.Background()
+	s.update(job, format, ExportRunning, 0)
+
+	workDir, err := os.MkdirTemp(s.exportCfg.TempDir, "export-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	// Download segments
+	files := initSegments(playlist.InitSegment, playlist.Segments)
+	for _, seg := range playlist.Segments {
+		files = append(files, seg.URI)
+	}
+	lastUpdate := time.Now()
+	for i, file := range files {
+		key := buildStorageKey(s.cfg.VODPrefix, job.RoomID, job.SessionID, path.Join(dir, file))
+		if err := downloadObject(ctx, s.storage, key, filepath.Join(workDir, filepath.FromSlash(file))); err != nil {
+			return 0, fmt.Errorf("failed to download %s: %w", file, err)
+		}
+		if time.Since(lastUpdate) > time.Second {
+			s.update(job, format, ExportRunning, 0.4*float64(i+1)/float64(len(files)))
+			lastUpdate = time.Now()
+		}
+	}
+
+	segments, err := downloadKeys(ctx, s.keys, workDir, playlist.Segments)
+	if err != nil {
+		return 0, err
+	}
+
+	playlistPath := filepath.Join(workDir, "stream.m3u8")
+	if err := os.WriteFile(playlistPath, encodeVODPlaylist(playlist.InitSegment, segments), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write playlist: %w", err)
+	}
+
+	outputPath := filepath.Join(workDir, format.File)
+	total := playlist.Duration()
+	args := []string{
+		"-hide_banner", "-nostats", "-y",
+		"-allowed_extensions", "ALL",
+		"-i", playlistPath,
+	}
+	args = append(args, format.Args...)
+	args = append(args, "-progress", "pipe:1", outputPath)
+	err = runFFmpegWithProgress(args, func(seconds float64) {
+		if total > 0 && time.Since(lastUpdate) > time.Second {
+			s.update(job, format, ExportRunning, 0.4+0.5*min(seconds/total, 1))
+			lastUpdate = time.Now()
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Upload
+	s.update(job, format, ExportRunning, 0.9)
+	f, err := os.Open(outputPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", format.Name, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %w", format.Name, err)
+	}
+
+	key := buildStorageKey(s.cfg.VODPrefix, job.RoomID, job.SessionID, format.File)
+	if err := s.storage.Write(ctx, key, f, info.Size(), format.ContentType); err != nil {
+		return 0, fmt.Errorf("failed to upload %s: %w", format.Name, err)
+	}
+
+	return info.Size(), nil
+}
+
+// downloadKeys writes the content keys of encrypted segments to the work dir and returns the
+// segments with their key URIs pointing at the local copies, so FFmpeg can decrypt them.
+func downloadKeys(ctx context.Context, keys *KeyService, workDir string, segments []playlistSegment) ([]playlistSegment, error) {
+	local := make(map[string]string) // Key URI -> local file
+	result := make([]playlistSegment, len(segments))
+	for i, seg := range segments {
+		if seg.Key.Method != "" {
+			file, ok := local[seg.Key.URI]
+			if !ok {
+				if keys == nil {
+					return nil, fmt.Errorf("session is encrypted but the key server is disabled")
+				}
+				roomID, sessionID, keyID, valid := keyURIPath(seg.Key.URI)
+				if !valid {
+					return nil, fmt.Errorf("invalid key URI %q", seg.Key.URI)
+				}
+				key, err := keys.store.Get(ctx, roomID, sessionID, keyID)
+				if err != nil {
+					return nil, err
+				}
+				file = "key_" + keyID + ".key"
+				if err := os.WriteFile(filepath.Join(workDir, file), key, 0600); err != nil {
+					return nil, fmt.Errorf("failed to write key: %w", err)
+				}
+				local[seg.Key.URI] = file
+			}
+			seg.Key.URI = file
+		}
+		result[i] = seg
+	}
+	return result, nil
+}
+
+// update sets a job's status and progress and persists it.
+func (s *ExportService) update(job *ExportJob, format exportFormat, status ExportStatus, progress float64) {
+	s.jobMu.Lock()
+	job.Status = status
+	job.Progress = progress
+	s.jobMu.Unlock()
+	s.touch(job, format)
+}
+
+// touch refreshes a job's update time and persists it.
+func (s *ExportService) touch(job *ExportJob, format exportFormat) {
+	s.jobMu.Lock()
+	job.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(job)
+	s.jobMu.Unlock()
+
+	if err == nil {
+		err = s.writeStatus(context.Background(), job.RoomID, job.SessionID, format, data)
+	}
+	if err != nil {
+		l := pkglog.L()
+		l.Warn().Err(err).Str("room_id", job.RoomID).Str("session_id", job.SessionID).Msg("failed to save export status")
+	}
+}
+
+// saveJob writes a job's status next to the VOD.
+func (s *ExportService) saveJob(ctx context.Context, job *ExportJob, format exportFormat) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.writeStatus(ctx, job.RoomID, job.SessionID, format, data)
+}
+
+// writeStatus stores an encoded export status.
+func (s *ExportService) writeStatus(ctx context.Context, roomID, sessionID string, format exportFormat, data []byte) error {
+	key := buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, format.StatusFile)
+	if err := s.storage.Write(ctx, key, bytes.NewReader(data), int64(len(data)), "application/json"); err != nil {
+		return fmt.Errorf("failed to save export status: %w", err)
+	}
+	return nil
+}
+
+// readSource returns the playlist a session is exported from and the directory it is in,
+// relative to the session. Audio is exported from the audio-only rendition if the session has one.
+func (s *ExportService) readSource(ctx context.Context, roomID, sessionID string, format exportFormat) (string, *mediaPlaylist, error) {
+	if format.AudioOnly {
+		key := buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, path.Join(audioRendition, mediaPlaylistFile))
+		exists, err := s.storage.Exists(ctx, key)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to check audio rendition existence: %w", err)
+		}
+		if exists {
+			playlist, err := s.readPlaylist(ctx, roomID, sessionID, path.Join(audioRendition, mediaPlaylistFile))
+			return audioRendition, playlist, err
+		}
+	}
+	playlist, err := s.readPlaylist(ctx, roomID, sessionID, mediaPlaylistFile)
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		return s.readRenditionSource(ctx, roomID, sessionID, err)
+	}
+	return "", playlist, err
+}
+
+// readRenditionSource returns the largest video rendition of a session without a primary stream,
+// e.g. one recorded from simulcast renditions only. Returns notFound if it has no rendition either.
+func (s *ExportService) readRenditionSource(ctx context.Context, roomID, sessionID string, notFound error) (string, *mediaPlaylist, error) {
+	prefix := buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, "")
+	files, err := s.storage.List(ctx, prefix)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to list session files: %w", err)
+	}
+
+	// Renditions are {rendition}/stream.m3u8, the one with the most bytes has the best quality
+	sizes := make(map[string]int64)
+	playlists := make(map[string]bool)
+	for _, f := range files {
+		dir, file := path.Split(strings.TrimPrefix(f.Key, prefix))
+		dir = strings.TrimSuffix(dir, "/")
+		if dir == "" || strings.Contains(dir, "/") || dir == audioRendition {
+			continue
+		}
+		sizes[dir] += f.Size
+		if file == mediaPlaylistFile {
+			playlists[dir] = true
+		}
+	}
+
+	best := ""
+	for dir := range playlists {
+		if best == "" || sizes[dir] > sizes[best] || (sizes[dir] == sizes[best] && dir < best) {
+			best = dir
+		}
+	}
+	if best == "" {
+		return "", nil, notFound
+	}
+
+	playlist, err := s.readPlaylist(ctx, roomID, sessionID, path.Join(best, mediaPlaylistFile))
+	return best, playlist, err
+}
+
+// readPlaylist reads a VOD playlist of the session.
+func (s *ExportService) readPlaylist(ctx context.Context, roomID, sessionID, filename string) (*mediaPlaylist, error) {
+	key := buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, filename)
+	exists, err := s.storage.Exists(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check VOD existence: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("VOD not found for room %s session %s", roomID, sessionID)
+	}
+
+	reader, err := s.storage.Read(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	defer reader.Close()
+
+	return parseMediaPlaylist(reader)
+}
+
+// runFFmpegWithProgress runs FFmpeg with "-progress pipe:1" and reports the processed media time.
+func runFFmpegWithProgress(args []string, onProgress func(seconds float64)) error {
+	cmd := exec.Command("ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create ffmpeg pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		// out_time_us is reported in microseconds (as is the misnamed out_time_ms)
+		value, found := strings.CutPrefix(scanner.Text(), "out_time_us=")
+		if !found {
+			continue
+		}
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil && us > 0 {
+			onProgress(float64(us) / 1e6)
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if idx := strings.LastIndex(msg, "\n"); idx >= 0 {
+			msg = msg[idx+1:]
+		}
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, msg)
+	}
+	return nil
+}
+
+// downloadObject copies an object from storage to a local file.
+func downloadObject(ctx context.Context, store storage.Storage, key, path string) error {
+	reader, err := store.Read(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, reader); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
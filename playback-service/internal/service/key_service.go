@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/weiawesome/wes-io-live/pkg/entitlement"
+	"github.com/weiawesome/wes-io-live/pkg/hlskey"
+	"github.com/weiawesome/wes-io-live/pkg/playbacktoken"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/client"
+)
+
+var (
+	// ErrKeyUnauthorized is returned for key requests without a JWT or playback token.
+	ErrKeyUnauthorized = errors.New("key request carries no credentials")
+
+	// ErrKeyForbidden is returned for key requests whose credentials don't grant the session.
+	ErrKeyForbidden = errors.New("key access denied")
+)
+
+// KeyService serves the AES-128 content keys of encrypted HLS sessions, stored by media-service.
+// Unlike segments, keys are never served without credentials, whether or not playback tokens are required.
+type KeyService struct {
+	store        *hlskey.Store
+	auth         *client.AuthClient    // nil when JWTs are not accepted
+	tokens       *playbacktoken.Signer // nil when playback tokens are not accepted
+	proxies      *playbacktoken.Proxies
+	owners       *OwnerAuthorizer
+	entitlements *entitlement.Checker
+}
+
+// NewKeyService creates a new key service.
+func NewKeyService(store *hlskey.Store, auth *client.AuthClient, tokens *playbacktoken.Signer, proxies *playbacktoken.Proxies, owners *OwnerAuthorizer, entitlements *entitlement.Checker) *KeyService {
+	return &KeyService{
+		store:        store,
+		auth:         auth,
+		tokens:       tokens,
+		proxies:      proxies,
+		owners:       owners,
+		entitlements: entitlements,
+	}
+}
+
+// Authorize checks that a key request carries a playback token granting the room and session,
+// or the JWT (Authorization: Bearer) of a viewer entitled to watch them.
+func (s *KeyService) Authorize(r *http.Request, roomID, sessionID string) error {
+	err := s.authorize(r, roomID, sessionID)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrKeyUnauthorized):
+		keyRequests.WithLabelValues("unauthorized").Inc()
+	case errors.Is(err, ErrKeyForbidden):
+		keyRequests.WithLabelValues("forbidden").Inc()
+	default:
+		keyRequests.WithLabelValues("error").Inc()
+	}
+	return err
+}
+
+func (s *KeyService) authorize(r *http.Request, roomID, sessionID string) error {
+	if jwt := bearerToken(r); jwt != "" && s.auth != nil {
+		result, err := s.auth.ValidateToken(r.Context(), jwt)
+		if err != nil {
+			return err
+		}
+		if !result.Valid {
+			return fmt.Errorf("%w: %s", ErrKeyForbidden, result.Error)
+		}
+		return s.checkEntitlement(r.Context(), roomID, sessionID, result.UserID)
+	}
+
+	if token := r.URL.Query().Get(playbacktoken.QueryParam); token != "" && s.tokens != nil {
+		claims, err := s.tokens.Verify(token)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrKeyForbidden, err)
+		}
+		if !claims.Allows(roomID, sessionID, s.proxies.ClientIP(r)) {
+			return fmt.Errorf("%w: token not valid for room %s", ErrKeyForbidden, roomID)
+		}
+		return nil
+	}
+
+	return ErrKeyUnauthorized
+}
+
+// checkEntitlement checks that an authenticated viewer may watch a session. Restricted rooms
+// only admit their owner and granted users, playback tokens are checked when signal-service issues them.
+func (s *KeyService) checkEntitlement(ctx context.Context, roomID, sessionID, userID string) error {
+	var ownerID string
+	if s.entitlements.Restricted(roomID) {
+		var err error
+		if ownerID, err = s.owners.Owner(ctx, roomID); err != nil {
+			if errors.Is(err, ErrOwnerForbidden) {
+				return fmt.Errorf("%w: %v", ErrKeyForbidden, err)
+			}
+			return err
+		}
+	}
+
+	allowed, err := s.entitlements.Allows(ctx, roomID, sessionID, ownerID, userID)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%w: not entitled to room %s session %s", ErrKeyForbidden, roomID, sessionID)
+	}
+	return nil
+}
+
+// Key returns a content key of a session.
+func (s *KeyService) Key(ctx context.Context, roomID, sessionID, keyID string) ([]byte, error) {
+	key, err := s.store.Get(ctx, roomID, sessionID, keyID)
+	if err != nil {
+		if errors.Is(err, hlskey.ErrKeyNotFound) {
+			keyRequests.WithLabelValues("not_found").Inc()
+			return nil, fmt.Errorf("key not found: %w", err)
+		}
+		keyRequests.WithLabelValues("error").Inc()
+		return nil, err
+	}
+	keyRequests.WithLabelValues("served").Inc()
+	return key, nil
+}
+
+// bearerToken returns the token of a request's Authorization: Bearer header.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// keyURIPath splits a key server URI, {base}/{roomID}/{sessionID}/{keyID}.key, into its elements.
+func keyURIPath(uri string) (roomID, sessionID, keyID string, ok bool) {
+	if idx := strings.IndexAny(uri, "?#"); idx >= 0 {
+		uri = uri[:idx]
+	}
+	parts := strings.Split(uri, "/")
+	if len(parts) < 3 || !strings.HasSuffix(parts[len(parts)-1], ".key") {
+		return "", "", "", false
+	}
+	n := len(parts)
+	return parts[n-3], parts[n-2], strings.TrimSuffix(parts[n-1], ".key"), true
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
+)
+
+const (
+	markerLockTTL   = 10 * time.Second // Longer than a markers file read and write
+	markerLockWait  = 5 * time.Second  // Before giving up on a busy session
+	markerLockRetry = 50 * time.Millisecond
+)
+
+// releaseScript deletes a lock only if it is still held by the token that took it,
+// so a write that outlived the TTL never releases the next holder's lock.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// MarkerLock serializes updates of a session's markers file across playback-service replicas,
+// since storage has no conditional writes to detect a concurrent read-modify-write.
+type MarkerLock struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewMarkerLock creates a new Redis-backed markers lock.
+func NewMarkerLock(cfg config.MarkersRedisConfig) (*MarkerLock, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &MarkerLock{
+		client:    client,
+		keyPrefix: cfg.KeyPrefix,
+	}, nil
+}
+
+// Acquire takes the lock of a session's markers, waiting while another replica holds it.
+// The returned function releases the lock.
+func (l *MarkerLock) Acquire(ctx context.Context, roomID, sessionID string) (func(), error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+	key := l.keyPrefix + roomID + ":" + sessionID
+
+	ctx, cancel := context.WithTimeout(ctx, markerLockWait)
+	defer cancel()
+
+	for {
+		ok, err := l.client.SetNX(ctx, key, token, markerLockTTL).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to acquire markers lock: %w", err)
+		}
+		if ok {
+			return func() {
+				// Released even if the request was cancelled meanwhile
+				releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer releaseCancel()
+				releaseScript.Run(releaseCtx, l.client, []string{key}, token)
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to acquire markers lock: %w", ctx.Err())
+		case <-time.After(markerLockRetry):
+		}
+	}
+}
+
+// Close closes the Redis connection.
+func (l *MarkerLock) Close() error {
+	return l.client.Close()
+}
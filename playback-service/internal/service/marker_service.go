@@ -0,0 +1,434 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/pkg/storage"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
+)
+
+const (
+	markersFile = "markers.json"
+
+	maxMarkerTitle = 200
+	maxMarkerData  = 16 // Attributes per marker
+)
+
+// Marker types.
+const (
+	MarkerChapter = "chapter" // Starts a chapter that lasts until the next one
+	MarkerEvent   = "event"   // Timed metadata such as a poll or a donation
+)
+
+// markerClasses are the EXT-X-DATERANGE classes markers are announced with, by type.
+var markerClasses = map[string]string{
+	MarkerChapter: "com.wes-io-live.chapter",
+	MarkerEvent:   "com.wes-io-live.event",
+}
+
+// ErrInvalidMarker is returned when a marker request is invalid.
+var ErrInvalidMarker = errors.New("invalid marker request")
+
+// Marker is a chapter or timed event on the timeline of a session.
+type Marker struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	Title     string            `json:"title,omitempty"`
+	Offset    float64           `json:"offset"`             // Seconds from the session start
+	Duration  float64           `json:"duration,omitempty"` // seconds, events only
+	Data      map[string]string `json:"data,omitempty"`     // Announced as X-{NAME} attributes
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// CreateMarkerRequest describes a marker to add to a session.
+type CreateMarkerRequest struct {
+	RoomID    string
+	SessionID string // Empty = the room's live session
+	Type      string
+	Title     string
+	Offset    *float64 // Seconds from the session start, nil = now
+	Duration  float64
+	Data      map[string]string
+}
+
+// sessionMarkers is the markers file of a session.
+type sessionMarkers struct {
+	RoomID    string   `json:"room_id"`
+	SessionID string   `json:"session_id"`
+	Markers   []Marker `json:"markers"`
+}
+
+// markerCacheEntry is the cached markers of a session.
+type markerCacheEntry struct {
+	markers []Marker
+	expires time.Time
+}
+
+// MarkerService stores chapters and timed events of sessions.
+// Markers are kept in {vod_prefix}/room_{roomID}/{sessionID}/markers.json next to the recording,
+// so they share its lifetime, and are announced in the session's playlists as EXT-X-DATERANGE tags.
+// Playlist requests read them through a short-lived cache, since every viewer reloads the playlist.
+type MarkerService struct {
+	storage       storage.Storage
+	provider      *ContentProvider
+	sessionStore  SessionStore
+	lock          *MarkerLock // nil = updates are only serialized within this instance
+	cfg           config.PlaybackConfig
+	maxPerSession int
+	cacheTTL      time.Duration
+
+	writeMu sync.Mutex // Serializes updates of markers files made by this instance
+	cache   map[string]markerCacheEntry
+	cacheMu sync.Mutex
+}
+
+// NewMarkerService creates a new marker service.
+func NewMarkerService(store storage.Storage, provider *ContentProvider, sessionStore SessionStore, lock *MarkerLock, cfg config.PlaybackConfig, markersCfg config.MarkersConfig) *MarkerService {
+	return &MarkerService{
+		storage:       store,
+		provider:      provider,
+		sessionStore:  sessionStore,
+		lock:          lock,
+		cfg:           cfg,
+		maxPerSession: markersCfg.MaxPerSession,
+		cacheTTL:      time.Duration(markersCfg.CacheTTL) * time.Second,
+		cache:         make(map[string]markerCacheEntry),
+	}
+}
+
+// AddMarker adds a marker to a session, by default to the room's live session at the current time.
+func (s *MarkerService) AddMarker(ctx context.Context, req CreateMarkerRequest) (*Marker, error) {
+	if err := validateMarkerRequest(req); err != nil {
+		return nil, err
+	}
+
+	sessionID := req.SessionID
+	if sessionID == "" {
+		session, err := s.sessionStore.Get(ctx, req.RoomID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get active session: %w", err)
+		}
+		if session == nil || !session.IsActive() {
+			return nil, fmt.Errorf("%w: no live stream for room %s", ErrInvalidMarker, req.RoomID)
+		}
+		sessionID = session.SessionID
+	} else {
+		exists, err := s.storage.Exists(ctx, buildStorageKey(s.cfg.VODPrefix, req.RoomID, sessionID, mediaPlaylistFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to check VOD existence: %w", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("%w: recording not found", ErrInvalidMarker)
+		}
+	}
+
+	sessionStart, err := parseSessionStart(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: session %s has no start time", ErrInvalidMarker, sessionID)
+	}
+
+	offset := time.Since(sessionStart).Seconds()
+	if req.Offset != nil {
+		offset = *req.Offset
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidMarker)
+	}
+
+	id, err := newMarkerID()
+	if err != nil {
+		return nil, err
+	}
+	marker := Marker{
+		ID:        id,
+		Type:      req.Type,
+		Title:     req.Title,
+		Offset:    offset,
+		Duration:  req.Duration,
+		CreatedAt: time.Now().UTC(),
+	}
+	if len(req.Data) > 0 {
+		marker.Data = make(map[string]string, len(req.Data))
+		for name, value := range req.Data {
+			marker.Data[strings.ToUpper(name)] = value
+		}
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	// Other replicas may be updating the same file
+	if s.lock != nil {
+		release, err := s.lock.Acquire(ctx, req.RoomID, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	markers, err := s.load(ctx, req.RoomID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if s.maxPerSession > 0 && len(markers) >= s.maxPerSession {
+		return nil, fmt.Errorf("%w: sessions are limited to %d markers", ErrInvalidMarker, s.maxPerSession)
+	}
+
+	markers = append(markers, marker)
+	sort.SliceStable(markers, func(i, j int) bool {
+		return markers[i].Offset < markers[j].Offset
+	})
+
+	data, err := json.Marshal(sessionMarkers{RoomID: req.RoomID, SessionID: sessionID, Markers: markers})
+	if err != nil {
+		return nil, err
+	}
+	key := buildStorageKey(s.cfg.VODPrefix, req.RoomID, sessionID, markersFile)
+	if err := s.storage.Write(ctx, key, bytes.NewReader(data), int64(len(data)), "application/json"); err != nil {
+		return nil, fmt.Errorf("failed to save markers: %w", err)
+	}
+	s.setCached(key, markers)
+
+	l := pkglog.L()
+	l.Info().Str("room_id", req.RoomID).Str("session_id", sessionID).Str("marker_id", marker.ID).
+		Str("type", marker.Type).Float64("offset", marker.Offset).Msg("marker added")
+
+	return &marker, nil
+}
+
+// Markers returns the markers of a session ordered by offset.
+func (s *MarkerService) Markers(ctx context.Context, roomID, sessionID string) ([]Marker, error) {
+	return s.load(ctx, roomID, sessionID)
+}
+
+// ChaptersVTT returns the chapters of a session as a WebVTT chapters track.
+// Each chapter ends where the next one starts, the last one at the end of the recording.
+func (s *MarkerService) ChaptersVTT(ctx context.Context, roomID, sessionID string) ([]byte, error) {
+	data, err := s.provider.readAll(ctx, buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, mediaPlaylistFile))
+	if err != nil {
+		return nil, err
+	}
+	playlist, err := parseMediaPlaylist(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	markers, err := s.load(ctx, roomID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var chapters []Marker
+	for _, m := range markers {
+		if m.Type == MarkerChapter {
+			chapters = append(chapters, m)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("WEBVTT\n")
+	cue := 0
+	for i, chapter := range chapters {
+		end := playlist.Duration()
+		if i+1 < len(chapters) {
+			end = min(chapters[i+1].Offset, end)
+		}
+		if end <= chapter.Offset {
+			continue
+		}
+		cue++
+		title := strings.NewReplacer("\r", " ", "\n", " ", "-->", "->").Replace(chapter.Title)
+		buf.WriteString(fmt.Sprintf("\n%d\n%s --> %s\n%s\n", cue, formatVTTTime(chapter.Offset), formatVTTTime(end), title))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// dateRanges returns the markers of a session as date ranges, placed relative to the session start.
+// Markers that ended before notBefore are left out, the chapter in progress is always included.
+// Markers that can't be loaded are left out so they never break playback.
+func (s *MarkerService) dateRanges(ctx context.Context, roomID, sessionID string, sessionStart, notBefore time.Time) []dateRange {
+	markers, err := s.cached(ctx, roomID, sessionID)
+	if err != nil {
+		l := pkglog.L()
+		l.Warn().Err(err).Str("room_id", roomID).Str("session_id", sessionID).Msg("failed to load markers, playlist served without them")
+		return nil
+	}
+
+	var ranges []dateRange
+	for i, m := range markers {
+		duration := m.Duration
+		if m.Type == MarkerChapter {
+			duration = 0 // Open until the next chapter
+			for _, next := range markers[i+1:] {
+				if next.Type == MarkerChapter {
+					duration = next.Offset - m.Offset
+					break
+				}
+			}
+		}
+
+		start := sessionStart.Add(time.Duration(m.Offset * float64(time.Second)))
+		end := start.Add(time.Duration(duration * float64(time.Second)))
+		openChapter := m.Type == MarkerChapter && duration == 0
+		if !notBefore.IsZero() && !openChapter && end.Before(notBefore) {
+			continue
+		}
+
+		attributes := make(map[string]string, len(m.Data)+1)
+		for name, value := range m.Data {
+			attributes[name] = value
+		}
+		if m.Title != "" {
+			attributes["TITLE"] = m.Title
+		}
+		ranges = append(ranges, dateRange{
+			ID:         m.ID,
+			Class:      markerClasses[m.Type],
+			Start:      start,
+			Duration:   duration,
+			Attributes: attributes,
+		})
+	}
+	return ranges
+}
+
+// cached returns the markers of a session from the cache when fresh enough.
+func (s *MarkerService) cached(ctx context.Context, roomID, sessionID string) ([]Marker, error) {
+	key := buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, markersFile)
+
+	s.cacheMu.Lock()
+	entry, ok := s.cache[key]
+	s.cacheMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.markers, nil
+	}
+
+	markers, err := s.load(ctx, roomID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	s.setCached(key, markers)
+	return markers, nil
+}
+
+// setCached caches the markers stored at key, dropping expired entries of other sessions.
+func (s *MarkerService) setCached(key string, markers []Marker) {
+	if s.cacheTTL <= 0 {
+		return
+	}
+
+	s.cacheMu.Lock()
+	defer s.cacheMu.Unlock()
+
+	now := time.Now()
+	for k, entry := range s.cache {
+		if now.After(entry.expires) {
+			delete(s.cache, k)
+		}
+	}
+	s.cache[key] = markerCacheEntry{markers: markers, expires: now.Add(s.cacheTTL)}
+}
+
+// load reads the markers of a session from storage. A session without markers has none.
+func (s *MarkerService) load(ctx context.Context, roomID, sessionID string) ([]Marker, error) {
+	reader, err := s.storage.Read(ctx, buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, markersFile))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return []Marker{}, nil
+		}
+		return nil, fmt.Errorf("failed to read markers: %w", err)
+	}
+	defer reader.Close()
+
+	var stored sessionMarkers
+	if err := json.NewDecoder(reader).Decode(&stored); err != nil {
+		return nil, fmt.Errorf("failed to decode markers: %w", err)
+	}
+	if stored.Markers == nil {
+		stored.Markers = []Marker{}
+	}
+	return stored.Markers, nil
+}
+
+// ServeChapters serves the WebVTT chapters track of a VOD session.
+func (s *PlaybackService) ServeChapters(ctx context.Context, w http.ResponseWriter, roomID, sessionID string) error {
+	if s.markers == nil {
+		return fmt.Errorf("content not found: markers are disabled")
+	}
+
+	data, err := s.markers.ChaptersVTT(ctx, roomID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	setContentHeaders(w, ".vtt")
+	w.Write(data)
+	return nil
+}
+
+// validateMarkerRequest checks the type, title, duration and attributes of a marker.
+func validateMarkerRequest(req CreateMarkerRequest) error {
+	if _, ok := markerClasses[req.Type]; !ok {
+		return fmt.Errorf("%w: type must be %q or %q", ErrInvalidMarker, MarkerChapter, MarkerEvent)
+	}
+	if req.Type == MarkerChapter && req.Title == "" {
+		return fmt.Errorf("%w: chapters require a title", ErrInvalidMarker)
+	}
+	if len(req.Title) > maxMarkerTitle {
+		return fmt.Errorf("%w: title is limited to %d characters", ErrInvalidMarker, maxMarkerTitle)
+	}
+	if req.Duration < 0 || (req.Type == MarkerChapter && req.Duration != 0) {
+		return fmt.Errorf("%w: duration must not be negative and is only allowed for events", ErrInvalidMarker)
+	}
+	if len(req.Data) > maxMarkerData {
+		return fmt.Errorf("%w: markers are limited to %d data attributes", ErrInvalidMarker, maxMarkerData)
+	}
+	for name := range req.Data {
+		if !isAttributeName(name) || strings.EqualFold(name, "TITLE") {
+			return fmt.Errorf("%w: invalid data attribute name %q", ErrInvalidMarker, name)
+		}
+	}
+	return nil
+}
+
+// isAttributeName reports whether name can be used in an X-{NAME} playlist attribute,
+// which allows letters, digits and dashes.
+func isAttributeName(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// formatVTTTime formats seconds as a WebVTT timestamp (hh:mm:ss.mmm).
+func formatVTTTime(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// newMarkerID returns a random marker ID.
+func newMarkerID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate marker id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
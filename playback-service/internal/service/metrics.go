@@ -0,0 +1,88 @@
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Content cache metrics, exposed on the service's /metrics endpoint.
+var (
+	cacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "playback",
+		Subsystem: "cache",
+		Name:      "hits_total",
+		Help:      "Proxied requests served from the content cache by kind (playlist, segment, init, subtitle).",
+	}, []string{"kind"})
+
+	cacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "playback",
+		Subsystem: "cache",
+		Name:      "misses_total",
+		Help:      "Proxied requests not found in the content cache by kind (playlist, segment, init, subtitle).",
+	}, []string{"kind"})
+
+	cacheCoalesced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "playback",
+		Subsystem: "cache",
+		Name:      "coalesced_total",
+		Help:      "Cache misses that shared another request's storage fetch by kind.",
+	}, []string{"kind"})
+
+	cacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "playback",
+		Subsystem: "cache",
+		Name:      "evictions_total",
+		Help:      "Entries evicted to stay within the cache size limit.",
+	})
+
+	cacheBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "playback",
+		Subsystem: "cache",
+		Name:      "bytes",
+		Help:      "Bytes of content currently held in the cache.",
+	})
+)
+
+// Analytics metrics.
+var (
+	beaconsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "playback",
+		Subsystem: "analytics",
+		Name:      "beacons_total",
+		Help:      "Player beacon events accepted and published by type.",
+	}, []string{"type"})
+)
+
+// Storage failover metrics.
+var (
+	storageBackendUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "playback",
+		Subsystem: "storage",
+		Name:      "backend_up",
+		Help:      "Whether a failover storage backend is in rotation (1) or taken out after failures (0).",
+	}, []string{"backend"})
+
+	storageFailovers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "playback",
+		Subsystem: "storage",
+		Name:      "failovers_total",
+		Help:      "Reads that failed on a backend and fell back to the next, by operation and failed backend.",
+	}, []string{"op", "backend"})
+
+	storageReplicationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "playback",
+		Subsystem: "storage",
+		Name:      "replication_errors_total",
+		Help:      "Writes and deletes that failed on one of the backends, by operation and backend.",
+	}, []string{"op", "backend"})
+)
+
+// Key server metrics.
+var (
+	keyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "playback",
+		Subsystem: "keys",
+		Name:      "requests_total",
+		Help:      "Content key requests by result (served, unauthorized, forbidden, not_found, error).",
+	}, []string{"result"})
+)
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/weiawesome/wes-io-live/playback-service/internal/client"
+)
+
+var (
+	// ErrOwnerUnauthorized is returned for streamer-only requests without a valid JWT.
+	ErrOwnerUnauthorized = errors.New("authentication required")
+
+	// ErrOwnerForbidden is returned for streamer-only requests by users who don't own the room.
+	ErrOwnerForbidden = errors.New("only the room owner may do this")
+)
+
+// OwnerAuthorizer identifies the owner of a room for streamer-only requests, such as creating
+// clips and exports or editing markers and subtitles. The caller's JWT is validated by auth-service
+// and compared with the room's owner in room-service.
+type OwnerAuthorizer struct {
+	auth  *client.AuthClient
+	rooms *client.RoomClient
+}
+
+// NewOwnerAuthorizer creates a new owner authorizer.
+func NewOwnerAuthorizer(auth *client.AuthClient, rooms *client.RoomClient) *OwnerAuthorizer {
+	return &OwnerAuthorizer{
+		auth:  auth,
+		rooms: rooms,
+	}
+}
+
+// Authenticate validates the JWT of a request (Authorization: Bearer) and returns the user ID.
+func (a *OwnerAuthorizer) Authenticate(r *http.Request) (string, error) {
+	jwt := bearerToken(r)
+	if jwt == "" {
+		return "", ErrOwnerUnauthorized
+	}
+
+	result, err := a.auth.ValidateToken(r.Context(), jwt)
+	if err != nil {
+		return "", err
+	}
+	if !result.Valid || result.UserID == "" {
+		return "", fmt.Errorf("%w: %s", ErrOwnerUnauthorized, result.Error)
+	}
+	return result.UserID, nil
+}
+
+// AuthorizeOwner checks that a request is made by the owner of a room and returns the user ID.
+func (a *OwnerAuthorizer) AuthorizeOwner(r *http.Request, roomID string) (string, error) {
+	userID, err := a.Authenticate(r)
+	if err != nil {
+		return "", err
+	}
+
+	owner, err := a.Owner(r.Context(), roomID)
+	if err != nil {
+		return "", err
+	}
+	if owner != userID {
+		return "", fmt.Errorf("%w: room %s", ErrOwnerForbidden, roomID)
+	}
+	return userID, nil
+}
+
+// Owner returns the user ID of a room's owner.
+func (a *OwnerAuthorizer) Owner(ctx context.Context, roomID string) (string, error) {
+	room, err := a.rooms.GetRoom(ctx, roomID)
+	if err != nil {
+		if errors.Is(err, client.ErrRoomNotFound) {
+			return "", fmt.Errorf("%w: room %s not found", ErrOwnerForbidden, roomID)
+		}
+		return "", err
+	}
+	return room.OwnerID, nil
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/weiawesome/wes-io-live/pkg/playbacktoken"
 	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
 )
 
@@ -22,14 +24,25 @@ type VODInfo struct {
 type PlaybackService struct {
 	provider     *ContentProvider
 	sessionStore SessionStore
+	tokens       *playbacktoken.Signer  // nil when playback tokens are not required
+	proxies      *playbacktoken.Proxies // reverse proxies naming the viewer's address
+	ads          *AdInserter            // nil when ad insertion is disabled
+	markers      *MarkerService         // nil when markers are disabled
+	subtitles    *SubtitleService       // nil when subtitles are disabled
 	cfg          config.PlaybackConfig
 }
 
 // NewPlaybackService creates a new playback service.
-func NewPlaybackService(provider *ContentProvider, sessionStore SessionStore, cfg config.PlaybackConfig) *PlaybackService {
+// When tokens is not nil, live and VOD requests must carry a playback token it signed.
+func NewPlaybackService(provider *ContentProvider, sessionStore SessionStore, tokens *playbacktoken.Signer, proxies *playbacktoken.Proxies, ads *AdInserter, markers *MarkerService, subtitles *SubtitleService, cfg config.PlaybackConfig) *PlaybackService {
 	return &PlaybackService{
 		provider:     provider,
 		sessionStore: sessionStore,
+		tokens:       tokens,
+		proxies:      proxies,
+		ads:          ads,
+		markers:      markers,
+		subtitles:    subtitles,
 		cfg:          cfg,
 	}
 }
@@ -48,14 +61,89 @@ func (s *PlaybackService) GetActiveSessionID(ctx context.Context, roomID string)
 }
 
 // ServeLiveContent serves live HLS content for a room/session.
+// Media playlists carry the viewer's ad breaks and the session's markers when enabled.
 func (s *PlaybackService) ServeLiveContent(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) error {
+	if s.rewritesPlaylist(filename) {
+		return s.serveLivePlaylist(ctx, w, r, roomID, sessionID, filename)
+	}
 	key := buildStorageKey(s.cfg.LivePrefix, roomID, sessionID, filename)
-	return s.provider.ServeContent(ctx, w, r, key)
+	return s.serveStream(ctx, w, r, key)
+}
+
+// DVREnabled returns true if live DVR playlists are served.
+func (s *PlaybackService) DVREnabled() bool {
+	return s.cfg.DVRWindow > 0
+}
+
+// ServeDVRPlaylist serves a live playlist covering the last DVRWindow seconds of a session.
+// It is built from the session's VOD playlist, which media-service updates as segments are
+// uploaded, so viewers can seek back within the broadcast while the player follows the live edge.
+// Segments are referenced through the VOD routes and the playlist is always served directly,
+// since it is generated per request.
+func (s *PlaybackService) ServeDVRPlaylist(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID string) error {
+	key := buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, "stream.m3u8")
+	exists, err := s.provider.Exists(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to check playlist existence: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("content not found: %s", key)
+	}
+
+	reader, err := s.provider.Read(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to read playlist: %w", err)
+	}
+	defer reader.Close()
+
+	source, err := parseMediaPlaylist(reader)
+	if err != nil {
+		return err
+	}
+
+	segments := source.Window(float64(s.cfg.DVRWindow))
+	if len(segments) == 0 {
+		return fmt.Errorf("content not found: no segments uploaded for session %s", sessionID)
+	}
+
+	opts := playlistOptions{
+		MediaSequence:         segments[0].Sequence,
+		DiscontinuitySequence: source.DiscontinuitiesBefore(segments[0].Sequence),
+		Ended:                 source.Ended,
+		URIPrefix:             "/vod/" + roomID + "/" + sessionID + "/",
+		URIQuery:              s.tokenQuery(r),
+	}
+	if sessionStart, err := parseSessionStart(sessionID); err == nil && s.markers != nil {
+		opts.ProgramDateTime = sessionStart.Add(time.Duration(segments[0].Start * float64(time.Second)))
+		opts.DateRanges = s.markers.dateRanges(ctx, roomID, sessionID, sessionStart, opts.ProgramDateTime)
+	}
+	playlist := encodePlaylist(source.InitSegment, segments, opts)
+
+	setContentHeaders(w, ".m3u8")
+	w.Write(playlist)
+	return nil
 }
 
 // ServeVODContent serves VOD content for a room/session.
+// Media playlists have the viewer's ad breaks stitched in and carry the session's markers when enabled,
+// the master playlist lists the session's subtitle tracks.
 func (s *PlaybackService) ServeVODContent(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) error {
+	if s.subtitles != nil && filename == "master.m3u8" {
+		return s.serveVODMasterPlaylist(ctx, w, r, roomID, sessionID, filename)
+	}
+	if s.rewritesPlaylist(filename) {
+		return s.serveVODPlaylist(ctx, w, r, roomID, sessionID, filename)
+	}
 	key := buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, filename)
+	return s.serveStream(ctx, w, r, key)
+}
+
+// serveStream serves a playlist or segment. When the request carries a playback token,
+// manifests are proxied with the token appended to every URI so players pass it on.
+func (s *PlaybackService) serveStream(ctx context.Context, w http.ResponseWriter, r *http.Request, key string) error {
+	if query := s.tokenQuery(r); query != "" && isManifest(key) && !s.provider.IsRedirectMode() {
+		return s.provider.ServeManifest(ctx, w, key, query)
+	}
 	return s.provider.ServeContent(ctx, w, r, key)
 }
 
@@ -81,8 +169,7 @@ func (s *PlaybackService) ListRoomVODs(ctx context.Context, roomID string) ([]VO
 	// Build VODInfo list
 	var result []VODInfo
 	for sessionID := range sessions {
-		// Parse start time from sessionID (format: 2006-01-02T15-04-05Z)
-		startTime, _ := time.Parse("2006-01-02T15-04-05Z", sessionID)
+		startTime, _ := parseSessionStart(sessionID)
 
 		info := VODInfo{
 			SessionID: sessionID,
@@ -162,8 +249,17 @@ func (s *PlaybackService) ServeLatestPreview(ctx context.Context, w http.Respons
 }
 
 // ServePreviewContent serves preview content for a specific session.
+// The thumbnails track is always proxied so its relative sprite sheet references resolve
+// against the preview route instead of a presigned storage URL, with the request's playback
+// token appended to them.
 func (s *PlaybackService) ServePreviewContent(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) error {
 	key := buildPreviewKey(s.cfg.StoragePrefix, roomID, sessionID, filename)
+	if filepath.Ext(filename) == ".vtt" {
+		if query := s.tokenQuery(r); query != "" {
+			return s.provider.ServeManifest(ctx, w, key, query)
+		}
+		return s.provider.ProxyContent(ctx, w, r, key)
+	}
 	return s.provider.ServeContent(ctx, w, r, key)
 }
 
@@ -201,6 +297,11 @@ func (s *PlaybackService) findLatestPreviewSession(ctx context.Context, roomID s
 	return latest, nil
 }
 
+// parseSessionStart returns the start time encoded in a session ID (format: 2006-01-02T15-04-05Z).
+func parseSessionStart(sessionID string) (time.Time, error) {
+	return time.Parse("2006-01-02T15-04-05Z", sessionID)
+}
+
 // buildStorageKey builds a storage key from prefix, roomID, sessionID, and filename.
 // Handles empty prefix correctly (no leading slash).
 func buildStorageKey(prefix, roomID, sessionID, filename string) string {
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/weiawesome/wes-io-live/pkg/playbacktoken"
+)
+
+// Authorize checks the playback token of a request for a room and, if the request names one, a session.
+// Every request is allowed when tokens are not required.
+func (s *PlaybackService) Authorize(r *http.Request, roomID, sessionID string) error {
+	if s.tokens == nil {
+		return nil
+	}
+
+	claims, err := s.tokens.Verify(r.URL.Query().Get(playbacktoken.QueryParam))
+	if err != nil {
+		return err
+	}
+	if !claims.Allows(roomID, sessionID, s.proxies.ClientIP(r)) {
+		return fmt.Errorf("%w: not valid for room %s", playbacktoken.ErrInvalidToken, roomID)
+	}
+
+	return nil
+}
+
+// tokenQuery returns the query string passing the request's playback token on to the URIs of a manifest.
+// Empty when tokens are not required.
+func (s *PlaybackService) tokenQuery(r *http.Request) string {
+	if s.tokens == nil {
+		return ""
+	}
+	token := r.URL.Query().Get(playbacktoken.QueryParam)
+	if token == "" {
+		return ""
+	}
+	return url.Values{playbacktoken.QueryParam: {token}}.Encode()
+}
+
+// isManifest returns true for HLS playlists and DASH manifests.
+func isManifest(key string) bool {
+	ext := filepath.Ext(key)
+	return ext == ".m3u8" || ext == ".mpd"
+}
+
+// manifestURIAttr matches the URI attributes of HLS tags (EXT-X-MAP, EXT-X-MEDIA) and of DASH
+// segment lists (Initialization sourceURL, SegmentURL media) and templates.
+var manifestURIAttr = regexp.MustCompile(`\b(URI|initialization|media|sourceURL)="([^"]*)"`)
+
+// appendManifestQuery appends query to every URI referenced by an HLS playlist, DASH manifest
+// or thumbnails track, so players carry the playback token to variant playlists, init segments,
+// media segments and sprite sheets.
+func appendManifestQuery(data []byte, ext, query string) []byte {
+	sep := "&"
+	if ext == ".mpd" {
+		sep = "&amp;" // XML attribute
+	}
+	appendQuery := func(uri string) string {
+		if strings.Contains(uri, "?") {
+			return uri + sep + query
+		}
+		return uri + "?" + query
+	}
+
+	var buf bytes.Buffer
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case ext == ".m3u8" && trimmed != "" && !strings.HasPrefix(trimmed, "#"):
+			// Segment or variant playlist URI
+			buf.WriteString(strings.Replace(line, trimmed, appendQuery(trimmed), 1))
+		case ext == ".vtt" && strings.Contains(trimmed, "#xywh="):
+			// Sprite sheet reference, the query goes before the media fragment
+			sheet, fragment, _ := strings.Cut(trimmed, "#")
+			buf.WriteString(strings.Replace(line, trimmed, appendQuery(sheet)+"#"+fragment, 1))
+		default:
+			buf.WriteString(manifestURIAttr.ReplaceAllStringFunc(line, func(attr string) string {
+				m := manifestURIAttr.FindStringSubmatch(attr)
+				return m[1] + `="` + appendQuery(m[2]) + `"`
+			}))
+		}
+	}
+
+	return buf.Bytes()
+}
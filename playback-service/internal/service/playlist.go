@@ -0,0 +1,387 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// playlistSegment is a media segment of an HLS media playlist.
+type playlistSegment struct {
+	URI           string
+	Duration      float64
+	Start         float64 // Offset from the start of the playlist in seconds
+	Sequence      int     // Media sequence number
+	Discontinuity bool    // Preceded by EXT-X-DISCONTINUITY (broadcast resumed after a reconnect)
+	InitSegment   string  // EXT-X-MAP URI when it differs from the playlist's, e.g. for spliced ads
+	Key           segmentKey
+
+	ProgramDateTime time.Time // EXT-X-PROGRAM-DATE-TIME of the segment, zero to omit
+}
+
+// segmentKey is the EXT-X-KEY a segment is encrypted with, the zero value for clear segments.
+type segmentKey struct {
+	Method string // AES-128 or SAMPLE-AES
+	URI    string
+	IV     string // Hex IV including the 0x prefix
+}
+
+// tag returns the EXT-X-KEY tag of the key with the given URI.
+func (k segmentKey) tag(uri string) string {
+	if k.Method == "" {
+		return "#EXT-X-KEY:METHOD=NONE"
+	}
+	tag := fmt.Sprintf(`#EXT-X-KEY:METHOD=%s,URI="%s"`, k.Method, uri)
+	if k.IV != "" {
+		tag += ",IV=" + k.IV
+	}
+	return tag
+}
+
+// parseKeyTag parses an EXT-X-KEY tag.
+func parseKeyTag(line string) segmentKey {
+	attrs := strings.TrimPrefix(line, "#EXT-X-KEY:")
+	key := segmentKey{
+		Method: tagAttr(attrs, "METHOD"),
+		URI:    tagAttr(attrs, "URI"),
+		IV:     tagAttr(attrs, "IV"),
+	}
+	if key.Method == "" || key.Method == "NONE" {
+		return segmentKey{}
+	}
+	return key
+}
+
+// tagAttr returns an attribute of a tag's attribute list, without quotes.
+func tagAttr(attrs, name string) string {
+	for attrs != "" {
+		var attr string
+		if attrs, attr = splitAttr(attrs); strings.HasPrefix(attr, name+"=") {
+			return strings.Trim(strings.TrimPrefix(attr, name+"="), `"`)
+		}
+	}
+	return ""
+}
+
+// splitAttr splits the first attribute off an attribute list, skipping commas in quoted values.
+func splitAttr(attrs string) (rest, attr string) {
+	quoted := false
+	for i, c := range attrs {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			return attrs[i+1:], attrs[:i]
+		}
+	}
+	return "", attrs
+}
+
+// mediaPlaylist is a parsed HLS media playlist as written by media-service.
+type mediaPlaylist struct {
+	TargetDuration        int
+	DiscontinuitySequence int    // EXT-X-DISCONTINUITY-SEQUENCE of the first segment
+	InitSegment           string // First EXT-X-MAP URI, empty for MPEG-TS
+	Segments              []playlistSegment
+	Ended                 bool // EXT-X-ENDLIST present
+}
+
+// parseMediaPlaylist parses an HLS media playlist.
+func parseMediaPlaylist(r io.Reader) (*mediaPlaylist, error) {
+	p := &mediaPlaylist{}
+	var duration, offset float64
+	sequence := 0
+	discontinuity := false
+	var key segmentKey
+	initSegment := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			sequence, _ = strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"))
+		case strings.HasPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"):
+			p.DiscontinuitySequence, _ = strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"))
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			p.TargetDuration, _ = strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"))
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			if idx := strings.Index(line, `URI="`); idx >= 0 {
+				uri := line[idx+len(`URI="`):]
+				if end := strings.Index(uri, `"`); end >= 0 {
+					initSegment = uri[:end]
+				}
+				// The first init segment is the playlist's, resumed connections bring their own
+				if p.InitSegment == "" {
+					p.InitSegment = initSegment
+				}
+			}
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			if comma := strings.Index(value, ","); comma >= 0 {
+				value = value[:comma]
+			}
+			d, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid segment duration %q", line)
+			}
+			duration = d
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			key = parseKeyTag(line)
+		case line == "#EXT-X-DISCONTINUITY":
+			discontinuity = true
+		case line == "#EXT-X-ENDLIST":
+			p.Ended = true
+		case strings.HasPrefix(line, "#"):
+		default:
+			// Without IV a segment's media sequence number is its IV, made explicit so the
+			// segment still decrypts once re-sequenced
+			segKey := key
+			if segKey.Method != "" && segKey.IV == "" {
+				segKey.IV = fmt.Sprintf("0x%032x", sequence)
+			}
+			seg := playlistSegment{URI: line, Duration: duration, Start: offset, Sequence: sequence, Discontinuity: discontinuity, Key: segKey}
+			if initSegment != p.InitSegment {
+				seg.InitSegment = initSegment
+			}
+			p.Segments = append(p.Segments, seg)
+			offset += duration
+			duration = 0
+			sequence++
+			discontinuity = false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+
+	return p, nil
+}
+
+// initSegments returns the playlist's init segment followed by the ones of the given segments.
+func initSegments(initSegment string, segments []playlistSegment) []string {
+	var inits []string
+	if initSegment != "" {
+		inits = append(inits, initSegment)
+	}
+	for _, seg := range segments {
+		if seg.InitSegment != "" && !slices.Contains(inits, seg.InitSegment) {
+			inits = append(inits, seg.InitSegment)
+		}
+	}
+	return inits
+}
+
+// Duration returns the total duration of the playlist in seconds.
+func (p *mediaPlaylist) Duration() float64 {
+	if len(p.Segments) == 0 {
+		return 0
+	}
+	last := p.Segments[len(p.Segments)-1]
+	return last.Start + last.Duration
+}
+
+// Window returns the most recent segments covering at least the given number of seconds.
+func (p *mediaPlaylist) Window(seconds float64) []playlistSegment {
+	total := p.Duration()
+	if seconds <= 0 || total <= seconds {
+		return p.Segments
+	}
+	for i, seg := range p.Segments {
+		if seg.Start+seg.Duration > total-seconds {
+			return p.Segments[i:]
+		}
+	}
+	return nil
+}
+
+// DiscontinuitiesBefore returns the number of discontinuities preceding the segment with the given sequence number.
+func (p *mediaPlaylist) DiscontinuitiesBefore(sequence int) int {
+	count := 0
+	for _, seg := range p.Segments {
+		if seg.Sequence >= sequence {
+			break
+		}
+		if seg.Discontinuity {
+			count++
+		}
+	}
+	return count
+}
+
+// Range returns the segments overlapping [start, end) seconds.
+func (p *mediaPlaylist) Range(start, end float64) []playlistSegment {
+	var segments []playlistSegment
+	for _, seg := range p.Segments {
+		if seg.Start < end && seg.Start+seg.Duration > start {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
+// encodeVODPlaylist writes a finalized VOD playlist for the given segments, in the same format
+// media-service uses for recorded sessions.
+func encodeVODPlaylist(initSegment string, segments []playlistSegment) []byte {
+	return encodePlaylist(initSegment, segments, playlistOptions{Ended: true})
+}
+
+// playlistOptions controls how a media playlist is written.
+type playlistOptions struct {
+	MediaSequence         int    // Sequence number of the first segment
+	DiscontinuitySequence int    // Discontinuities before the first segment
+	Ended                 bool   // Finalized playlist (PLAYLIST-TYPE VOD and ENDLIST)
+	URIPrefix             string // Prepended to relative segment and init segment URIs
+	URIQuery              string // Appended as the query of segment and init segment URIs
+
+	ProgramDateTime time.Time      // EXT-X-PROGRAM-DATE-TIME of the first segment, zero to omit
+	Interstitials   []interstitial // Written as EXT-X-DATERANGE tags, requires ProgramDateTime
+	DateRanges      []dateRange    // Timed metadata, requires ProgramDateTime
+}
+
+// encodePlaylist writes a media playlist for the given segments.
+func encodePlaylist(initSegment string, segments []playlistSegment, opts playlistOptions) []byte {
+	version := 3
+	if initSegment != "" {
+		version = 7
+	}
+
+	targetDuration := 0
+	for _, seg := range segments {
+		if d := int(math.Ceil(seg.Duration)); d > targetDuration {
+			targetDuration = d
+		}
+		if seg.InitSegment != "" {
+			version = 7
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	buf.WriteString(fmt.Sprintf("#EXT-X-VERSION:%d\n", version))
+	buf.WriteString(fmt.Sprintf("#EXT-X-TARGETDURATION:%d\n", targetDuration))
+	buf.WriteString(fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d\n", opts.MediaSequence))
+	if opts.DiscontinuitySequence > 0 {
+		buf.WriteString(fmt.Sprintf("#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", opts.DiscontinuitySequence))
+	}
+	if opts.Ended {
+		buf.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	}
+	uri := func(name string) string {
+		if !strings.HasPrefix(name, "/") {
+			name = opts.URIPrefix + name
+		}
+		if opts.URIQuery == "" {
+			return name
+		}
+		return name + "?" + opts.URIQuery
+	}
+	for _, i := range opts.Interstitials {
+		buf.WriteString(i.tag() + "\n")
+	}
+	for _, d := range opts.DateRanges {
+		buf.WriteString(d.tag() + "\n")
+	}
+	currentInit := ""
+	var currentKey segmentKey
+	for i, seg := range segments {
+		if seg.Discontinuity {
+			buf.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		// Spliced segments bring their own init segment, switch back to the playlist's after them
+		segInit := initSegment
+		if seg.InitSegment != "" {
+			segInit = seg.InitSegment
+		}
+		if segInit != "" && segInit != currentInit {
+			buf.WriteString(fmt.Sprintf("#EXT-X-MAP:URI=\"%s\"\n", uri(segInit)))
+			currentInit = segInit
+		}
+		// Spliced ads are clear, switch keys whenever the segments' key changes
+		if seg.Key != currentKey {
+			buf.WriteString(seg.Key.tag(uri(seg.Key.URI)) + "\n")
+			currentKey = seg.Key
+		}
+		dateTime := seg.ProgramDateTime
+		if i == 0 && !opts.ProgramDateTime.IsZero() {
+			dateTime = opts.ProgramDateTime
+		}
+		if !dateTime.IsZero() {
+			buf.WriteString("#EXT-X-PROGRAM-DATE-TIME:" + formatDateTime(dateTime) + "\n")
+		}
+		buf.WriteString(fmt.Sprintf("#EXTINF:%.6f,\n", seg.Duration))
+		buf.WriteString(uri(seg.URI) + "\n")
+	}
+	if opts.Ended {
+		buf.WriteString("#EXT-X-ENDLIST\n")
+	}
+
+	return buf.Bytes()
+}
+
+// interstitial is an HLS interstitial, an asset the player schedules into the
+// primary content at a date (EXT-X-DATERANGE with CLASS="com.apple.hls.interstitial").
+type interstitial struct {
+	ID       string
+	Start    time.Time
+	AssetURI string
+	PreRoll  bool // CUE="PRE", played before the primary content when playback starts
+}
+
+// tag returns the EXT-X-DATERANGE tag of the interstitial. Without X-RESUME-OFFSET
+// live playback resumes where the stream is after the asset, keeping viewers near the live edge.
+func (i interstitial) tag() string {
+	tag := fmt.Sprintf(`#EXT-X-DATERANGE:ID="%s",CLASS="com.apple.hls.interstitial",START-DATE="%s",X-ASSET-URI="%s",X-RESTRICT="SKIP,JUMP"`,
+		i.ID, formatDateTime(i.Start), i.AssetURI)
+	if i.PreRoll {
+		tag += `,CUE="PRE"`
+	}
+	return tag
+}
+
+// dateRange is timed metadata such as a chapter or a poll, written as an EXT-X-DATERANGE tag.
+type dateRange struct {
+	ID         string
+	Class      string
+	Start      time.Time
+	Duration   float64           // seconds, 0 to omit
+	Attributes map[string]string // Client attributes by name without the X- prefix
+}
+
+// tag returns the EXT-X-DATERANGE tag of the date range.
+func (d dateRange) tag() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `#EXT-X-DATERANGE:ID="%s",CLASS="%s",START-DATE="%s"`, quotedString(d.ID), quotedString(d.Class), formatDateTime(d.Start))
+	if d.Duration > 0 {
+		fmt.Fprintf(&b, ",DURATION=%.3f", d.Duration)
+	}
+
+	names := make([]string, 0, len(d.Attributes))
+	for name := range d.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, `,X-%s="%s"`, name, quotedString(d.Attributes[name]))
+	}
+	return b.String()
+}
+
+// quotedString makes a value safe for a quoted playlist attribute, which can't contain
+// double quotes or line breaks.
+func quotedString(s string) string {
+	return strings.NewReplacer(`"`, "'", "\r", " ", "\n", " ").Replace(s)
+}
+
+// formatDateTime formats a time as the ISO 8601 date-time used by EXT-X-PROGRAM-DATE-TIME and EXT-X-DATERANGE.
+func formatDateTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
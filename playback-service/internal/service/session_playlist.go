@@ -0,0 +1,121 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"path"
+	"time"
+)
+
+// mediaPlaylistFile is the name of the media playlists media-service writes, in the session
+// directory and in each simulcast rendition directory, and of ad creative playlists.
+const mediaPlaylistFile = "stream.m3u8"
+
+// rewritesPlaylist returns true if the given playlist of a session is generated per request,
+// to insert ads or to announce the session's markers.
+func (s *PlaybackService) rewritesPlaylist(filename string) bool {
+	return (s.ads != nil || s.markers != nil) && path.Base(filename) == mediaPlaylistFile
+}
+
+// serveLivePlaylist serves a live media playlist with the viewer's ad breaks as interstitials
+// and the session's markers as date ranges.
+// The playlist is stamped with program date times from the time its last segment was written,
+// which stay stable between reloads until the next segment. Breaks and markers are placed at
+// offsets from the session start parsed from the session ID.
+func (s *PlaybackService) serveLivePlaylist(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) error {
+	key := buildStorageKey(s.cfg.LivePrefix, roomID, sessionID, filename)
+	content, err := s.provider.readObject(ctx, key)
+	if err != nil {
+		return err
+	}
+	source, err := parseMediaPlaylist(bytes.NewReader(content.data))
+	if err != nil {
+		return err
+	}
+	if len(source.Segments) == 0 {
+		return s.serveStream(ctx, w, r, key)
+	}
+
+	windowEnd := content.info.LastModified
+	windowStart := windowEnd.Add(-time.Duration(source.Duration() * float64(time.Second)))
+	sessionStart, _ := parseSessionStart(sessionID)
+
+	// Ad creatives are video, the audio-only rendition plays without breaks
+	var interstitials []interstitial
+	if s.ads != nil && !isAudioRendition(filename) {
+		interstitials, err = s.liveInterstitials(ctx, r, roomID, sessionID, sessionStart, windowStart, windowEnd)
+		if err != nil {
+			return err
+		}
+	}
+	var dateRanges []dateRange
+	if s.markers != nil && !sessionStart.IsZero() {
+		dateRanges = s.markers.dateRanges(ctx, roomID, sessionID, sessionStart, windowStart)
+	}
+	if len(interstitials) == 0 && len(dateRanges) == 0 {
+		return s.serveStream(ctx, w, r, key)
+	}
+
+	playlist := encodePlaylist(source.InitSegment, source.Segments, playlistOptions{
+		MediaSequence:         source.Segments[0].Sequence,
+		DiscontinuitySequence: source.DiscontinuitySequence,
+		URIPrefix:             sessionURIPrefix("/live/", roomID, sessionID, filename),
+		URIQuery:              s.tokenQuery(r),
+		ProgramDateTime:       windowStart,
+		Interstitials:         interstitials,
+		DateRanges:            dateRanges,
+	})
+
+	setContentHeaders(w, ".m3u8")
+	w.Write(playlist)
+	return nil
+}
+
+// serveVODPlaylist serves a VOD media playlist with the viewer's ad breaks stitched in
+// and the session's markers as date ranges.
+// The content is dated from the session start, so markers line up with the recording.
+func (s *PlaybackService) serveVODPlaylist(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) error {
+	key := buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, filename)
+	data, err := s.provider.readAll(ctx, key)
+	if err != nil {
+		return err
+	}
+	source, err := parseMediaPlaylist(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if len(source.Segments) == 0 {
+		return s.serveStream(ctx, w, r, key)
+	}
+
+	var dateRanges []dateRange
+	if sessionStart, err := parseSessionStart(sessionID); err == nil && s.markers != nil {
+		dateRanges = s.markers.dateRanges(ctx, roomID, sessionID, sessionStart, time.Time{})
+		if len(dateRanges) > 0 {
+			source.Segments[0].ProgramDateTime = sessionStart.Add(time.Duration(source.Segments[0].Start * float64(time.Second)))
+		}
+	}
+
+	segments := source.Segments
+	if s.ads != nil && !isAudioRendition(filename) {
+		segments, err = s.stitchVODAds(ctx, r, roomID, sessionID, source)
+		if err != nil {
+			return err
+		}
+	}
+	if len(segments) == len(source.Segments) && len(dateRanges) == 0 {
+		return s.serveStream(ctx, w, r, key)
+	}
+
+	playlist := encodePlaylist(source.InitSegment, segments, playlistOptions{
+		Ended:      source.Ended,
+		URIPrefix:  sessionURIPrefix("/vod/", roomID, sessionID, filename),
+		URIQuery:   s.tokenQuery(r),
+		DateRanges: dateRanges,
+	})
+
+	setContentHeaders(w, ".m3u8")
+	w.Write(playlist)
+	return nil
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/pkg/storage"
+)
+
+// StorageObserver logs failover storage events and exports them as metrics.
+type StorageObserver struct{}
+
+// NewStorageObserver creates a storage observer with every backend reported up.
+func NewStorageObserver(backends ...string) *StorageObserver {
+	for _, backend := range backends {
+		storageBackendUp.WithLabelValues(backend).Set(1)
+	}
+	return &StorageObserver{}
+}
+
+// BackendHealthChanged implements storage.FailoverObserver.
+func (o *StorageObserver) BackendHealthChanged(backend string, healthy bool, err error) {
+	l := pkglog.L()
+	if healthy {
+		storageBackendUp.WithLabelValues(backend).Set(1)
+		l.Info().Str("backend", backend).Msg("storage backend recovered, back in rotation")
+		return
+	}
+	storageBackendUp.WithLabelValues(backend).Set(0)
+	l.Error().Err(err).Str("backend", backend).Msg("storage backend failing, taken out of rotation")
+}
+
+// ReadFailedOver implements storage.FailoverObserver.
+func (o *StorageObserver) ReadFailedOver(op, backend string, err error) {
+	storageFailovers.WithLabelValues(op, backend).Inc()
+	l := pkglog.L()
+	l.Warn().Err(err).Str("op", op).Str("backend", backend).Msg("storage read failed, trying next backend")
+}
+
+// ReplicationFailed implements storage.FailoverObserver.
+func (o *StorageObserver) ReplicationFailed(op, backend string, err error) {
+	storageReplicationErrors.WithLabelValues(op, backend).Inc()
+	l := pkglog.L()
+	l.Warn().Err(err).Str("op", op).Str("backend", backend).Msg("storage replication failed")
+}
+
+// Ensure StorageObserver implements storage.FailoverObserver interface
+var _ storage.FailoverObserver = (*StorageObserver)(nil)
@@ -0,0 +1,450 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/pkg/storage"
+	"github.com/weiawesome/wes-io-live/playback-service/internal/config"
+)
+
+const (
+	subtitlesDir  = "subtitles"
+	subtitlesFile = "subtitles.json"
+	subtitleGroup = "subs"
+
+	// captionCharacteristics marks a subtitle rendition as closed captions (SDH).
+	captionCharacteristics = "public.accessibility.transcribes-spoken-dialog,public.accessibility.describes-music-and-sound"
+)
+
+var (
+	// ErrSubtitleNotFound is returned when a session has no subtitle track in a language.
+	ErrSubtitleNotFound = errors.New("subtitle track not found")
+
+	// ErrInvalidSubtitle is returned when a subtitle upload is invalid.
+	ErrInvalidSubtitle = errors.New("invalid subtitle upload")
+)
+
+// languageTag matches BCP 47 language tags such as "en", "pt-BR" or "zh-Hant".
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// SubtitleTrack is a subtitle track of a VOD session.
+type SubtitleTrack struct {
+	Language  string    `json:"language"` // BCP 47 language tag
+	Name      string    `json:"name"`
+	Captions  bool      `json:"captions"` // Closed captions, also describing music and sounds
+	Cues      int       `json:"cues"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UploadSubtitleRequest describes a subtitle file to add to a VOD session.
+type UploadSubtitleRequest struct {
+	RoomID    string
+	SessionID string
+	Language  string
+	Name      string // Empty = the language tag
+	Captions  bool
+	Content   io.Reader // WebVTT or SRT
+}
+
+// SubtitleService stores subtitle tracks of VOD sessions.
+// Uploads are converted to WebVTT and kept in {vod_prefix}/room_{roomID}/{sessionID}/subtitles/{language}.vtt,
+// with the track list in subtitles.json next to the recording. Tracks are listed in the session's master
+// playlist as SUBTITLES renditions, whose playlists cut the track on the video's segment boundaries.
+type SubtitleService struct {
+	storage       storage.Storage
+	provider      *ContentProvider
+	cfg           config.PlaybackConfig
+	maxSize       int64
+	maxPerSession int
+
+	mu sync.Mutex // Serializes updates of track lists made by this instance
+}
+
+// NewSubtitleService creates a new subtitle service.
+func NewSubtitleService(store storage.Storage, provider *ContentProvider, cfg config.PlaybackConfig, subtitlesCfg config.SubtitlesConfig) *SubtitleService {
+	return &SubtitleService{
+		storage:       store,
+		provider:      provider,
+		cfg:           cfg,
+		maxSize:       int64(subtitlesCfg.MaxSizeKB) << 10,
+		maxPerSession: subtitlesCfg.MaxPerSession,
+	}
+}
+
+// Upload converts a WebVTT or SRT file and stores it as the session's track in its language,
+// replacing an earlier upload in the same language.
+func (s *SubtitleService) Upload(ctx context.Context, req UploadSubtitleRequest) (*SubtitleTrack, error) {
+	if !languageTag.MatchString(req.Language) {
+		return nil, fmt.Errorf("%w: %q is not a language tag", ErrInvalidSubtitle, req.Language)
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = req.Language
+	}
+	if len(name) > 100 {
+		return nil, fmt.Errorf("%w: name is limited to 100 characters", ErrInvalidSubtitle)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(req.Content, s.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subtitles: %w", err)
+	}
+	if int64(len(data)) > s.maxSize {
+		return nil, fmt.Errorf("%w: files are limited to %d KB", ErrInvalidSubtitle, s.maxSize>>10)
+	}
+	doc, err := parseSubtitles(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSubtitle, err)
+	}
+
+	exists, err := s.storage.Exists(ctx, s.key(req.RoomID, req.SessionID, mediaPlaylistFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check VOD existence: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: recording not found", ErrInvalidSubtitle)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tracks, err := s.Tracks(ctx, req.RoomID, req.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	track := SubtitleTrack{
+		Language:  req.Language,
+		Name:      name,
+		Captions:  req.Captions,
+		Cues:      len(doc.Cues),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	replaced := false
+	for i, t := range tracks {
+		switch {
+		case strings.EqualFold(t.Language, track.Language):
+			if t.Language != track.Language {
+				s.storage.Delete(ctx, s.key(req.RoomID, req.SessionID, subtitlesDir+"/"+t.Language+".vtt"))
+			}
+			tracks[i] = track
+			replaced = true
+		case t.Name == track.Name:
+			// Names identify renditions in players and must be unique within the group
+			return nil, fmt.Errorf("%w: track name %q is used by %s", ErrInvalidSubtitle, name, t.Language)
+		}
+	}
+	if !replaced {
+		if s.maxPerSession > 0 && len(tracks) >= s.maxPerSession {
+			return nil, fmt.Errorf("%w: sessions are limited to %d subtitle tracks", ErrInvalidSubtitle, s.maxPerSession)
+		}
+		tracks = append(tracks, track)
+	}
+
+	vtt := doc.encode(0, 0, -1)
+	key := s.key(req.RoomID, req.SessionID, subtitlesDir+"/"+track.Language+".vtt")
+	if err := s.storage.Write(ctx, key, bytes.NewReader(vtt), int64(len(vtt)), "text/vtt"); err != nil {
+		return nil, fmt.Errorf("failed to save subtitles: %w", err)
+	}
+	if err := s.saveTracks(ctx, req.RoomID, req.SessionID, tracks); err != nil {
+		return nil, err
+	}
+
+	l := pkglog.L()
+	l.Info().Str("room_id", req.RoomID).Str("session_id", req.SessionID).Str("language", track.Language).
+		Int("cues", track.Cues).Msg("subtitle track uploaded")
+
+	return &track, nil
+}
+
+// Delete removes the session's track in a language.
+func (s *SubtitleService) Delete(ctx context.Context, roomID, sessionID, language string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tracks, err := s.Tracks(ctx, roomID, sessionID)
+	if err != nil {
+		return err
+	}
+	for i, t := range tracks {
+		if !strings.EqualFold(t.Language, language) {
+			continue
+		}
+		if err := s.saveTracks(ctx, roomID, sessionID, append(tracks[:i], tracks[i+1:]...)); err != nil {
+			return err
+		}
+		if err := s.storage.Delete(ctx, s.key(roomID, sessionID, subtitlesDir+"/"+t.Language+".vtt")); err != nil {
+			return fmt.Errorf("failed to delete subtitles: %w", err)
+		}
+		return nil
+	}
+	return ErrSubtitleNotFound
+}
+
+// Tracks returns the subtitle tracks of a session.
+func (s *SubtitleService) Tracks(ctx context.Context, roomID, sessionID string) ([]SubtitleTrack, error) {
+	reader, err := s.storage.Read(ctx, s.key(roomID, sessionID, subtitlesFile))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return []SubtitleTrack{}, nil
+		}
+		return nil, fmt.Errorf("failed to read subtitle tracks: %w", err)
+	}
+	defer reader.Close()
+
+	tracks := []SubtitleTrack{}
+	if err := json.NewDecoder(reader).Decode(&tracks); err != nil {
+		return nil, fmt.Errorf("failed to decode subtitle tracks: %w", err)
+	}
+	return tracks, nil
+}
+
+// track returns the session's track in a language.
+func (s *SubtitleService) track(ctx context.Context, roomID, sessionID, language string) (*SubtitleTrack, error) {
+	tracks, err := s.Tracks(ctx, roomID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tracks {
+		if t.Language == language {
+			return &t, nil
+		}
+	}
+	return nil, ErrSubtitleNotFound
+}
+
+// saveTracks stores the track list of a session.
+func (s *SubtitleService) saveTracks(ctx context.Context, roomID, sessionID string, tracks []SubtitleTrack) error {
+	data, err := json.Marshal(tracks)
+	if err != nil {
+		return err
+	}
+	if err := s.storage.Write(ctx, s.key(roomID, sessionID, subtitlesFile), bytes.NewReader(data), int64(len(data)), "application/json"); err != nil {
+		return fmt.Errorf("failed to save subtitle tracks: %w", err)
+	}
+	return nil
+}
+
+// key returns the storage key of a file of a VOD session.
+func (s *SubtitleService) key(roomID, sessionID, filename string) string {
+	return buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, filename)
+}
+
+// ServeSubtitles serves a subtitle rendition of a VOD session. filename is relative to the
+// session's subtitles directory:
+// - {language}.m3u8 - Media playlist of the rendition, aligned with the video segments
+// - {language}/{index}.vtt - WebVTT segment with the cues of the video segment at index
+// - {language}.vtt - The whole track, for players that load sidecar files
+func (s *PlaybackService) ServeSubtitles(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) error {
+	if s.subtitles == nil {
+		return fmt.Errorf("content not found: subtitles are disabled")
+	}
+
+	dir, file := path.Split(filename)
+	dir = strings.TrimSuffix(dir, "/")
+	switch {
+	case dir == "" && path.Ext(file) == ".m3u8":
+		return s.serveSubtitlePlaylist(ctx, w, r, roomID, sessionID, strings.TrimSuffix(file, ".m3u8"))
+	case dir == "" && path.Ext(file) == ".vtt":
+		return s.provider.ProxyContent(ctx, w, r, s.subtitles.key(roomID, sessionID, subtitlesDir+"/"+file))
+	case dir != "" && !strings.Contains(dir, "/") && path.Ext(file) == ".vtt":
+		index, err := strconv.Atoi(strings.TrimSuffix(file, ".vtt"))
+		if err != nil {
+			return fmt.Errorf("content not found: %s", filename)
+		}
+		return s.serveSubtitleSegment(ctx, w, roomID, sessionID, dir, index)
+	default:
+		return fmt.Errorf("content not found: %s", filename)
+	}
+}
+
+// serveSubtitlePlaylist serves the media playlist of a subtitle rendition, with one WebVTT
+// segment per video segment so the renditions share a timeline.
+func (s *PlaybackService) serveSubtitlePlaylist(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID, language string) error {
+	if _, err := s.subtitles.track(ctx, roomID, sessionID, language); err != nil {
+		if errors.Is(err, ErrSubtitleNotFound) {
+			return fmt.Errorf("content not found: %w", err)
+		}
+		return err
+	}
+	video, err := s.readVODPlaylist(ctx, roomID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	segments := make([]playlistSegment, len(video.Segments))
+	for i, seg := range video.Segments {
+		segments[i] = playlistSegment{
+			URI:           fmt.Sprintf("%s/%d.vtt", language, i),
+			Duration:      seg.Duration,
+			Discontinuity: seg.Discontinuity,
+		}
+	}
+	playlist := encodePlaylist("", segments, playlistOptions{
+		DiscontinuitySequence: video.DiscontinuitySequence,
+		Ended:                 video.Ended,
+		URIQuery:              s.tokenQuery(r),
+	})
+
+	setContentHeaders(w, ".m3u8")
+	w.Write(playlist)
+	return nil
+}
+
+// serveSubtitleSegment serves the cues of a track overlapping the video segment at index.
+// Cue times are relative to the start of the recording, mapped to the media timestamps through
+// the wall-clock time the segment started at.
+func (s *PlaybackService) serveSubtitleSegment(ctx context.Context, w http.ResponseWriter, roomID, sessionID, language string, index int) error {
+	video, err := s.readVODPlaylist(ctx, roomID, sessionID)
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(video.Segments) {
+		return fmt.Errorf("content not found: subtitle segment %d", index)
+	}
+
+	data, err := s.provider.readAll(ctx, s.subtitles.key(roomID, sessionID, subtitlesDir+"/"+language+".vtt"))
+	if err != nil {
+		return err
+	}
+	doc, err := parseSubtitles(data)
+	if err != nil {
+		return err
+	}
+
+	seg := video.Segments[index]
+	mpegts := int64(-1)
+	if sessionStart, err := parseSessionStart(sessionID); err == nil {
+		segmentStart := sessionStart.Add(time.Duration(seg.Start * float64(time.Second)))
+		mpegts = mpegtsTimestamp(segmentStart, seg.Start)
+	}
+
+	setContentHeaders(w, ".vtt")
+	w.Write(doc.encode(seg.Start, seg.Start+seg.Duration, mpegts))
+	return nil
+}
+
+// serveVODMasterPlaylist serves the master playlist of a VOD session with its subtitle tracks as
+// SUBTITLES renditions. Sessions recorded without simulcast renditions have no stored master playlist,
+// one listing the primary stream is generated for them once they have subtitles.
+func (s *PlaybackService) serveVODMasterPlaylist(ctx context.Context, w http.ResponseWriter, r *http.Request, roomID, sessionID, filename string) error {
+	key := buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, filename)
+
+	tracks, err := s.subtitles.Tracks(ctx, roomID, sessionID)
+	if err != nil {
+		l := pkglog.L()
+		l.Warn().Err(err).Str("room_id", roomID).Str("session_id", sessionID).Msg("failed to load subtitle tracks, master playlist served without them")
+	}
+	if len(tracks) == 0 {
+		return s.serveStream(ctx, w, r, key)
+	}
+
+	exists, err := s.provider.Exists(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to check playlist existence: %w", err)
+	}
+	var master []byte
+	if exists {
+		master, err = s.provider.readAll(ctx, key)
+	} else {
+		master, err = s.primaryMasterPlaylist(ctx, roomID, sessionID)
+	}
+	if err != nil {
+		return err
+	}
+
+	playlist := addSubtitleRenditions(master, tracks)
+	if query := s.tokenQuery(r); query != "" {
+		playlist = appendManifestQuery(playlist, ".m3u8", query)
+	}
+
+	setContentHeaders(w, ".m3u8")
+	w.Write(playlist)
+	return nil
+}
+
+// primaryMasterPlaylist generates a master playlist listing only the session's primary stream.
+// BANDWIDTH is required, it is the peak segment bitrate from the stored segment sizes.
+func (s *PlaybackService) primaryMasterPlaylist(ctx context.Context, roomID, sessionID string) ([]byte, error) {
+	video, err := s.readVODPlaylist(ctx, roomID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, "")
+	files, err := s.provider.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segments: %w", err)
+	}
+	sizes := make(map[string]int64, len(files))
+	for _, f := range files {
+		sizes[strings.TrimPrefix(f.Key, prefix)] = f.Size
+	}
+
+	var bandwidth int64
+	for _, seg := range video.Segments {
+		if seg.Duration <= 0 {
+			continue
+		}
+		if b := int64(float64(sizes[seg.URI]*8) / seg.Duration); b > bandwidth {
+			bandwidth = b
+		}
+	}
+	if bandwidth == 0 {
+		return nil, fmt.Errorf("content not found: no segments uploaded for session %s", sessionID)
+	}
+
+	return []byte(fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-STREAM-INF:BANDWIDTH=%d\n%s\n", bandwidth, mediaPlaylistFile)), nil
+}
+
+// readVODPlaylist reads and parses the primary media playlist of a VOD session.
+func (s *PlaybackService) readVODPlaylist(ctx context.Context, roomID, sessionID string) (*mediaPlaylist, error) {
+	data, err := s.provider.readAll(ctx, buildStorageKey(s.cfg.VODPrefix, roomID, sessionID, mediaPlaylistFile))
+	if err != nil {
+		return nil, err
+	}
+	return parseMediaPlaylist(bytes.NewReader(data))
+}
+
+// addSubtitleRenditions lists subtitle tracks in a master playlist as EXT-X-MEDIA renditions
+// and links every variant stream to them.
+func addSubtitleRenditions(master []byte, tracks []SubtitleTrack) []byte {
+	var media bytes.Buffer
+	for _, t := range tracks {
+		media.WriteString(fmt.Sprintf(`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="%s",NAME="%s",LANGUAGE="%s",DEFAULT=NO,AUTOSELECT=YES,FORCED=NO`,
+			subtitleGroup, quotedString(t.Name), t.Language))
+		if t.Captions {
+			media.WriteString(`,CHARACTERISTICS="` + captionCharacteristics + `"`)
+		}
+		media.WriteString(`,URI="` + subtitlesDir + "/" + t.Language + `.m3u8"` + "\n")
+	}
+
+	var buf bytes.Buffer
+	written := false
+	for _, line := range strings.SplitAfter(string(master), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "#EXT-X-STREAM-INF:") {
+			if !written {
+				buf.Write(media.Bytes())
+				written = true
+			}
+			line = trimmed + `,SUBTITLES="` + subtitleGroup + `"` + "\n"
+		}
+		buf.WriteString(line)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vttCue is a timed text cue of a subtitle track.
+type vttCue struct {
+	ID       string
+	Start    float64 // seconds
+	End      float64
+	Settings string // Cue settings after the timings, e.g. "line:0 align:start"
+	Text     string
+}
+
+// vttDocument is a parsed WebVTT subtitle track.
+type vttDocument struct {
+	Header string // STYLE and REGION blocks, repeated in every segment
+	Cues   []vttCue
+}
+
+// srtFormatting matches SRT markup WebVTT has no equivalent for: font tags and ASS style overrides.
+var srtFormatting = regexp.MustCompile(`</?font[^>]*>|\{\\[^}]*\}`)
+
+// parseSubtitles parses a WebVTT or SRT subtitle file, detected from its content.
+func parseSubtitles(data []byte) (*vttDocument, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	if strings.HasPrefix(text, "WEBVTT") {
+		return parseWebVTT(text)
+	}
+	return parseSRT(text)
+}
+
+// parseWebVTT parses a WebVTT file. Comments (NOTE blocks) are dropped.
+func parseWebVTT(text string) (*vttDocument, error) {
+	blocks := splitBlocks(text)
+	doc := &vttDocument{}
+
+	var header []string
+	for _, block := range blocks[1:] { // The first block is the WEBVTT line and its metadata headers
+		lines := strings.Split(block, "\n")
+		switch {
+		case strings.HasPrefix(lines[0], "NOTE"):
+		case (strings.HasPrefix(lines[0], "STYLE") || strings.HasPrefix(lines[0], "REGION")) && len(doc.Cues) == 0:
+			header = append(header, block)
+		default:
+			cue, err := parseCue(lines, '.')
+			if err != nil {
+				return nil, err
+			}
+			doc.Cues = append(doc.Cues, cue)
+		}
+	}
+	doc.Header = strings.Join(header, "\n\n")
+
+	return doc, nil
+}
+
+// parseSRT parses a SubRip file. Cue numbers are kept as cue identifiers.
+func parseSRT(text string) (*vttDocument, error) {
+	doc := &vttDocument{}
+	for _, block := range splitBlocks(text) {
+		cue, err := parseCue(strings.Split(block, "\n"), ',')
+		if err != nil {
+			return nil, err
+		}
+		cue.Text = srtFormatting.ReplaceAllString(cue.Text, "")
+		// SRT positions cues with pixel coordinates after the timings, which WebVTT can't express
+		cue.Settings = ""
+		doc.Cues = append(doc.Cues, cue)
+	}
+	if len(doc.Cues) == 0 {
+		return nil, fmt.Errorf("no subtitle cues found")
+	}
+	return doc, nil
+}
+
+// splitBlocks splits a subtitle file into its blank line separated blocks.
+func splitBlocks(text string) []string {
+	var blocks []string
+	for _, block := range strings.Split(text, "\n\n") {
+		if block = strings.Trim(block, "\n"); strings.TrimSpace(block) != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// parseCue parses a cue block: an optional identifier line, the timings line and the cue text.
+// sep is the decimal separator of the timestamps, SRT uses a comma.
+func parseCue(lines []string, sep byte) (vttCue, error) {
+	var cue vttCue
+	if !strings.Contains(lines[0], "-->") {
+		cue.ID = strings.TrimSpace(lines[0])
+		lines = lines[1:]
+	}
+	if len(lines) == 0 {
+		return cue, fmt.Errorf("cue %q has no timings", cue.ID)
+	}
+
+	start, rest, ok := strings.Cut(lines[0], "-->")
+	if !ok {
+		return cue, fmt.Errorf("invalid cue timings %q", lines[0])
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return cue, fmt.Errorf("invalid cue timings %q", lines[0])
+	}
+
+	var err error
+	if cue.Start, err = parseCueTime(strings.TrimSpace(start), sep); err != nil {
+		return cue, err
+	}
+	if cue.End, err = parseCueTime(fields[0], sep); err != nil {
+		return cue, err
+	}
+	if cue.End < cue.Start {
+		return cue, fmt.Errorf("cue ends before it starts: %q", lines[0])
+	}
+	cue.Settings = strings.Join(fields[1:], " ")
+	cue.Text = strings.Join(lines[1:], "\n")
+
+	return cue, nil
+}
+
+// parseCueTime parses a cue timestamp ([hh:]mm:ss.ttt) into seconds.
+// Both separators are accepted, since SRT files written with a period are common.
+func parseCueTime(value string, sep byte) (float64, error) {
+	if sep != '.' {
+		value = strings.Replace(value, string(sep), ".", 1)
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid cue timestamp %q", value)
+	}
+	var seconds float64
+	for i, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 || (i < len(parts)-1 && strings.Contains(part, ".")) {
+			return 0, fmt.Errorf("invalid cue timestamp %q", value)
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds, nil
+}
+
+// encode writes the cues overlapping [start, end) seconds as a WebVTT file, every cue if end is 0.
+// Cues crossing the boundaries keep their timings, players drop the copies they already show.
+// Segments of an HLS rendition pass the MPEG-TS timestamp of cue time 0 as mpegts, announced
+// in X-TIMESTAMP-MAP so players place the cues on the timeline of the media; -1 omits the map.
+func (d *vttDocument) encode(start, end float64, mpegts int64) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("WEBVTT\n")
+	if mpegts >= 0 {
+		buf.WriteString(fmt.Sprintf("X-TIMESTAMP-MAP=MPEGTS:%d,LOCAL:00:00:00.000\n", mpegts))
+	}
+	if d.Header != "" {
+		buf.WriteString("\n" + d.Header + "\n")
+	}
+
+	for _, cue := range d.Cues {
+		if end > 0 && (cue.Start >= end || cue.End <= start) {
+			continue
+		}
+		buf.WriteString("\n")
+		if cue.ID != "" {
+			buf.WriteString(cue.ID + "\n")
+		}
+		buf.WriteString(formatVTTTime(cue.Start) + " --> " + formatVTTTime(cue.End))
+		if cue.Settings != "" {
+			buf.WriteString(" " + cue.Settings)
+		}
+		buf.WriteString("\n" + cue.Text + "\n")
+	}
+
+	return buf.Bytes()
+}
+
+// mpegtsTimestamp returns the 33-bit, 90 kHz MPEG-TS timestamp of cue time 0 for a segment that
+// started at the wall-clock time start, offset seconds into the recording. media-service muxes
+// segments with wall-clock PTS (-use_wallclock_as_timestamps).
+func mpegtsTimestamp(start time.Time, offset float64) int64 {
+	const wrap = 1 << 33
+	ts := (start.UnixMicro()*9/100 - int64(offset*90000)) % wrap
+	if ts < 0 {
+		ts += wrap
+	}
+	return ts
+}
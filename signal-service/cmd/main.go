@@ -9,7 +9,9 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/weiawesome/wes-io-live/pkg/entitlement"
 	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/pkg/playbacktoken"
 	"github.com/weiawesome/wes-io-live/pkg/pubsub"
 	"github.com/weiawesome/wes-io-live/signal-service/internal/client"
 	"github.com/weiawesome/wes-io-live/signal-service/internal/config"
@@ -66,8 +68,34 @@ func main() {
 	wsHub := hub.NewHub(cfg.WebSocket)
 	go wsHub.Run()
 
+	// Initialize viewer entitlements, restricted rooms share the pubsub Redis unless configured
+	entitlementCfg := entitlement.Config{
+		Rooms:     cfg.Entitlement.Rooms,
+		Address:   cfg.Entitlement.Address,
+		Password:  cfg.Entitlement.Password,
+		DB:        cfg.Entitlement.DB,
+		KeyPrefix: cfg.Entitlement.KeyPrefix,
+	}
+	if entitlementCfg.Address == "" {
+		entitlementCfg.Address = cfg.PubSub.Redis.Address
+		entitlementCfg.Password = cfg.PubSub.Redis.Password
+	}
+	entitlements, err := entitlement.NewChecker(entitlementCfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to initialize entitlements")
+	}
+	defer entitlements.Close()
+	if len(cfg.Entitlement.Rooms) > 0 {
+		logger.Info().Strs("rooms", cfg.Entitlement.Rooms).Msg("restricted rooms enabled")
+	}
+
+	proxies, err := playbacktoken.ParseProxies(cfg.PlaybackToken.TrustedProxies)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to parse trusted proxies")
+	}
+
 	// Initialize service
-	signalSvc := service.NewSignalService(wsHub, authClient, roomClient, ps, kafkaProducer)
+	signalSvc := service.NewSignalService(wsHub, authClient, roomClient, ps, kafkaProducer, cfg.PlaybackToken, entitlements)
 
 	// Start service (subscribes to events)
 	ctx, cancel := context.WithCancel(context.Background())
@@ -79,7 +107,7 @@ func main() {
 	defer signalSvc.Stop()
 
 	// Initialize handler
-	wsHandler := handler.NewWSHandler(wsHub, signalSvc)
+	wsHandler := handler.NewWSHandler(wsHub, signalSvc, proxies)
 
 	// Setup HTTP server
 	mux := http.NewServeMux()
@@ -16,6 +16,9 @@ type Config struct {
 	PubSub    pubsub.Config
 	Kafka     KafkaConfig
 	Log       LogConfig
+
+	PlaybackToken PlaybackTokenConfig `mapstructure:"playback_token"`
+	Entitlement   EntitlementConfig   `mapstructure:"entitlement"`
 }
 
 type KafkaConfig struct {
@@ -45,6 +48,26 @@ type RoomConfig struct {
 	CacheTTL    time.Duration `mapstructure:"cache_ttl"`
 }
 
+// PlaybackTokenConfig holds signing of the tokens playback-service requires for live and VOD content.
+type PlaybackTokenConfig struct {
+	Secret string        `mapstructure:"secret"`  // HMAC secret shared with playback-service, empty disables tokens
+	TTL    time.Duration `mapstructure:"ttl"`     // Token lifetime, clients request a new one before it expires
+	BindIP bool          `mapstructure:"bind_ip"` // Only valid from the address the viewer connected from
+
+	// Reverse proxies (addresses or CIDR ranges) whose X-Forwarded-For/X-Real-IP name the viewer, empty = none
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+// EntitlementConfig holds the restricted rooms (private rooms, subscriber-only recordings)
+// only their owner and granted users get playback tokens for.
+type EntitlementConfig struct {
+	Rooms     []string `mapstructure:"rooms"` // Restricted rooms, "*" for every room, empty = none
+	Address   string   `mapstructure:"address"`
+	Password  string   `mapstructure:"password"`
+	DB        int      `mapstructure:"db"`
+	KeyPrefix string   `mapstructure:"key_prefix"`
+}
+
 type LogConfig struct {
 	Level string
 }
@@ -75,6 +98,14 @@ func Load() (*Config, error) {
 	v.SetDefault("kafka.brokers", "localhost:9092")
 	v.SetDefault("kafka.topic", "broadcast-events")
 	v.SetDefault("kafka.partitions", 4)
+	v.SetDefault("playback_token.secret", "")
+	v.SetDefault("playback_token.ttl", "1h")
+	v.SetDefault("playback_token.bind_ip", false)
+	v.SetDefault("playback_token.trusted_proxies", []string{})
+	v.SetDefault("entitlement.rooms", []string{})
+	v.SetDefault("entitlement.address", "")
+	v.SetDefault("entitlement.db", 0)
+	v.SetDefault("entitlement.key_prefix", "entitlement:")
 	v.SetDefault("log.level", "info")
 
 	// Override from environment
@@ -88,6 +119,10 @@ func Load() (*Config, error) {
 	v.BindEnv("kafka.brokers", "KAFKA_BROKERS")
 	v.BindEnv("kafka.topic", "KAFKA_BROADCAST_TOPIC")
 	v.BindEnv("kafka.partitions", "KAFKA_BROADCAST_PARTITIONS")
+	v.BindEnv("playback_token.secret", "PLAYBACK_TOKEN_SECRET")
+	v.BindEnv("playback_token.trusted_proxies", "PLAYBACK_TRUSTED_PROXIES")
+	v.BindEnv("entitlement.rooms", "RESTRICTED_ROOMS")
+	v.BindEnv("entitlement.address", "ENTITLEMENT_REDIS_ADDRESS")
 
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
@@ -99,6 +134,7 @@ func Load() (*Config, error) {
 	cfg.WebSocket.PongWait = parseDuration(v, "websocket.pong_wait", 60*time.Second)
 	cfg.WebSocket.WriteWait = parseDuration(v, "websocket.write_wait", 10*time.Second)
 	cfg.Room.CacheTTL = parseDuration(v, "room.cache_ttl", 5*time.Minute)
+	cfg.PlaybackToken.TTL = parseDuration(v, "playback_token.ttl", time.Hour)
 
 	return &cfg, nil
 }
@@ -7,6 +7,7 @@ package domain
 type RoomState struct {
 	RoomID      string `json:"room_id"`
 	IsLive      bool   `json:"is_live"`
+	SessionID   string `json:"session_id,omitempty"`
 	HLSUrl      string `json:"hls_url,omitempty"`
 	ViewerCount int    `json:"viewer_count"`
 }
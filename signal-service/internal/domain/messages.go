@@ -11,6 +11,8 @@ const (
 	MsgTypeStopBroadcast  = "stop_broadcast"
 	MsgTypeLeaveRoom      = "leave_room"
 	MsgTypePing           = "ping"
+
+	MsgTypeRequestPlaybackToken = "request_playback_token"
 )
 
 // WebSocket message types to client.
@@ -20,8 +22,10 @@ const (
 	MsgTypeBroadcastStarted = "broadcast_started"
 	MsgTypeStreamAvailable  = "stream_available"
 	MsgTypeViewerCount      = "viewer_count"
+	MsgTypeStreamHealth     = "stream_health"
 	MsgTypeError            = "error"
 	MsgTypePong             = "pong"
+	MsgTypePlaybackToken    = "playback_token"
 )
 
 // BaseMessage is the base structure for all WebSocket messages.
@@ -69,6 +73,14 @@ type LeaveRoomMessage struct {
 	RoomID string `json:"room_id"`
 }
 
+// RequestPlaybackTokenMessage is sent by client to get a new playback token,
+// before the current one expires or to watch a recorded session.
+type RequestPlaybackTokenMessage struct {
+	Type      string `json:"type"`
+	RoomID    string `json:"room_id"`
+	SessionID string `json:"session_id,omitempty"` // VOD session, empty for the room's live stream
+}
+
 // Server -> Client messages
 
 // AuthResultMessage is sent to client after authentication.
@@ -87,7 +99,11 @@ type RoomJoinedMessage struct {
 	IsOwner     bool   `json:"is_owner"`
 	ViewerCount int    `json:"viewer_count"`
 	IsLive      bool   `json:"is_live"`
+	SessionID   string `json:"session_id,omitempty"` // Live session, the one the playback token grants
 	HLSUrl      string `json:"hls_url,omitempty"`
+
+	PlaybackToken          string `json:"playback_token,omitempty"`            // Pass as ?token= to playback-service
+	PlaybackTokenExpiresAt int64  `json:"playback_token_expires_at,omitempty"` // Unix seconds
 }
 
 // BroadcastStartedMessage is sent when broadcast is established.
@@ -99,9 +115,10 @@ type BroadcastStartedMessage struct {
 
 // StreamAvailableMessage is sent to viewers when HLS is ready.
 type StreamAvailableMessage struct {
-	Type   string `json:"type"`
-	RoomID string `json:"room_id"`
-	HLSUrl string `json:"hls_url"`
+	Type      string `json:"type"`
+	RoomID    string `json:"room_id"`
+	SessionID string `json:"session_id,omitempty"` // Request a playback token for it before playing
+	HLSUrl    string `json:"hls_url"`
 }
 
 // ViewerCountMessage is sent when viewer count changes.
@@ -111,6 +128,33 @@ type ViewerCountMessage struct {
 	Count  int    `json:"count"`
 }
 
+// StreamHealthMessage is sent to the broadcaster with the health of its ingest stream.
+type StreamHealthMessage struct {
+	Type             string   `json:"type"`
+	RoomID           string   `json:"room_id"`
+	Status           string   `json:"status"` // good, fair or poor
+	Issues           []string `json:"issues,omitempty"`
+	BitrateKbps      float64  `json:"bitrate_kbps"`
+	FPS              float64  `json:"fps"`
+	PacketLoss       float64  `json:"packet_loss"`
+	JitterMs         float64  `json:"jitter_ms"`
+	KeyframeInterval float64  `json:"keyframe_interval"`
+	EncoderSpeed     float64  `json:"encoder_speed"`
+	EncoderFPS       float64  `json:"encoder_fps"`
+	SegmentLag       float64  `json:"segment_lag"`
+	Timestamp        int64    `json:"timestamp"`
+}
+
+// PlaybackTokenMessage is sent in reply to a playback token request.
+// Token is empty when playback-service doesn't require tokens.
+type PlaybackTokenMessage struct {
+	Type      string `json:"type"`
+	RoomID    string `json:"room_id"`
+	SessionID string `json:"session_id,omitempty"`
+	Token     string `json:"token,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"` // Unix seconds
+}
+
 // ErrorMessage is sent when an error occurs.
 type ErrorMessage struct {
 	Type    string `json:"type"`
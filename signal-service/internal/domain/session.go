@@ -12,6 +12,7 @@ type Session struct {
 	Username      string
 	Email         string
 	Roles         []string
+	RemoteIP      string // Client address, binds playback tokens when enabled
 	Authenticated bool
 	CurrentRoomID string
 	IsBroadcaster bool
@@ -21,10 +22,11 @@ type Session struct {
 }
 
 // NewSession creates a new session with a unique ID.
-func NewSession(id string) *Session {
+func NewSession(id, remoteIP string) *Session {
 	now := time.Now()
 	return &Session{
 		ID:           id,
+		RemoteIP:     remoteIP,
 		CreatedAt:    now,
 		LastActiveAt: now,
 	}
@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/pkg/playbacktoken"
 	"github.com/weiawesome/wes-io-live/signal-service/internal/domain"
 	"github.com/weiawesome/wes-io-live/signal-service/internal/hub"
 	"github.com/weiawesome/wes-io-live/signal-service/internal/service"
@@ -25,13 +26,15 @@ var upgrader = websocket.Upgrader{
 type WSHandler struct {
 	hub     *hub.Hub
 	service service.SignalService
+	proxies *playbacktoken.Proxies // reverse proxies naming the client's address
 }
 
 // NewWSHandler creates a new WebSocket handler.
-func NewWSHandler(h *hub.Hub, svc service.SignalService) *WSHandler {
+func NewWSHandler(h *hub.Hub, svc service.SignalService, proxies *playbacktoken.Proxies) *WSHandler {
 	return &WSHandler{
 		hub:     h,
 		service: svc,
+		proxies: proxies,
 	}
 }
 
@@ -51,7 +54,7 @@ func (h *WSHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		Hub:     h.hub,
 		Conn:    conn,
 		Send:    make(chan []byte, 256),
-		Session: domain.NewSession(clientID),
+		Session: domain.NewSession(clientID, h.proxies.ClientIP(r)),
 	}
 
 	// Set disconnect handler to clean up broadcast state
@@ -140,6 +143,16 @@ func (h *WSHandler) handleMessage(client *hub.Client, message []byte) {
 			l.Error().Err(err).Str("client_id", client.ID).Msg("leave room failed")
 		}
 
+	case domain.MsgTypeRequestPlaybackToken:
+		var msg domain.RequestPlaybackTokenMessage
+		if err := json.Unmarshal(message, &msg); err != nil {
+			client.SendMessage(domain.NewErrorMessage(domain.ErrCodeBadRequest, "Invalid request_playback_token message"))
+			return
+		}
+		if err := h.service.HandleRequestPlaybackToken(ctx, client, msg.RoomID, msg.SessionID); err != nil {
+			l.Error().Err(err).Str("client_id", client.ID).Msg("playback token request failed")
+		}
+
 	case domain.MsgTypePing:
 		client.SendMessage(map[string]string{"type": domain.MsgTypePong})
 
@@ -24,6 +24,9 @@ type SignalService interface {
 	// HandleStopBroadcast handles a broadcaster stopping a stream.
 	HandleStopBroadcast(ctx context.Context, client *hub.Client, roomID string) error
 
+	// HandleRequestPlaybackToken issues a playback token for a room's live stream or one of its recordings.
+	HandleRequestPlaybackToken(ctx context.Context, client *hub.Client, roomID, sessionID string) error
+
 	// HandleLeaveRoom handles a client leaving a room.
 	HandleLeaveRoom(ctx context.Context, client *hub.Client, roomID string) error
 
@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/weiawesome/wes-io-live/pkg/entitlement"
 	pkglog "github.com/weiawesome/wes-io-live/pkg/log"
+	"github.com/weiawesome/wes-io-live/pkg/playbacktoken"
 	"github.com/weiawesome/wes-io-live/pkg/pubsub"
 	"github.com/weiawesome/wes-io-live/signal-service/internal/client"
+	"github.com/weiawesome/wes-io-live/signal-service/internal/config"
 	"github.com/weiawesome/wes-io-live/signal-service/internal/domain"
 	"github.com/weiawesome/wes-io-live/signal-service/internal/hub"
 	"github.com/weiawesome/wes-io-live/signal-service/internal/kafka"
@@ -21,6 +25,11 @@ type signalService struct {
 	pubsub        pubsub.PubSub
 	kafkaProducer kafka.BroadcastEventProducer
 
+	// Playback tokens for viewers, nil when disabled
+	tokens       *playbacktoken.Signer
+	tokenCfg     config.PlaybackTokenConfig
+	entitlements *entitlement.Checker
+
 	// Track active broadcasts per room
 	activeBroadcasts   map[string]string // roomID -> broadcasterClientID
 	broadcasterUserIDs map[string]string // roomID -> broadcasterUserID (for Kafka events)
@@ -37,17 +46,25 @@ func NewSignalService(
 	roomClient *client.RoomClient,
 	ps pubsub.PubSub,
 	kafkaProducer kafka.BroadcastEventProducer,
+	tokenCfg config.PlaybackTokenConfig,
+	entitlements *entitlement.Checker,
 ) SignalService {
-	return &signalService{
+	s := &signalService{
 		hub:                h,
 		authClient:         authClient,
 		roomClient:         roomClient,
 		pubsub:             ps,
 		kafkaProducer:      kafkaProducer,
+		tokenCfg:           tokenCfg,
+		entitlements:       entitlements,
 		activeBroadcasts:   make(map[string]string),
 		broadcasterUserIDs: make(map[string]string),
 		roomStates:         make(map[string]*domain.RoomState),
 	}
+	if tokenCfg.Secret != "" {
+		s.tokens, _ = playbacktoken.NewSigner(tokenCfg.Secret)
+	}
+	return s
 }
 
 func (s *signalService) HandleAuth(ctx context.Context, c *hub.Client, token string) error {
@@ -98,6 +115,15 @@ func (s *signalService) HandleJoinRoom(ctx context.Context, c *hub.Client, roomI
 		return c.SendMessage(domain.NewErrorMessage(domain.ErrCodeNotFound, "Room is not active"))
 	}
 
+	// Restricted rooms only admit their owner and granted viewers
+	allowed, err := s.entitlements.Allows(ctx, roomID, "", room.OwnerID, c.Session.GetUserID())
+	if err != nil {
+		return c.SendMessage(domain.NewErrorMessage(domain.ErrCodeInternalError, "Failed to check access"))
+	}
+	if !allowed {
+		return c.SendMessage(domain.NewErrorMessage(domain.ErrCodeForbidden, "Not allowed to watch this room"))
+	}
+
 	// Leave current room if any
 	if currentRoom := c.Session.GetCurrentRoom(); currentRoom != "" {
 		s.hub.LeaveRoom(c, currentRoom)
@@ -116,23 +142,115 @@ func (s *signalService) HandleJoinRoom(ctx context.Context, c *hub.Client, roomI
 
 	isLive := false
 	hlsUrl := ""
+	sessionID := ""
 
 	if state != nil {
 		isLive = state.IsLive
 		hlsUrl = state.HLSUrl
+		sessionID = state.SessionID
+	}
+
+	// Token of the live session only, viewers request another one when a new session starts
+	var token string
+	var expiresAt int64
+	if sessionID != "" {
+		token, expiresAt, err = s.issuePlaybackToken(c, roomID, sessionID)
+		if err != nil {
+			l := pkglog.L()
+			l.Error().Err(err).Str("room_id", roomID).Msg("failed to sign playback token")
+		}
 	}
 
 	// Note: viewer count is now handled by presence-service
 	return c.SendMessage(&domain.RoomJoinedMessage{
-		Type:        domain.MsgTypeRoomJoined,
-		RoomID:      roomID,
-		IsOwner:     isOwner,
-		ViewerCount: 0, // Viewer count is now from presence-service
-		IsLive:      isLive,
-		HLSUrl:      hlsUrl,
+		Type:                   domain.MsgTypeRoomJoined,
+		RoomID:                 roomID,
+		IsOwner:                isOwner,
+		ViewerCount:            0, // Viewer count is now from presence-service
+		IsLive:                 isLive,
+		SessionID:              sessionID,
+		HLSUrl:                 hlsUrl,
+		PlaybackToken:          token,
+		PlaybackTokenExpiresAt: expiresAt,
+	})
+}
+
+func (s *signalService) HandleRequestPlaybackToken(ctx context.Context, c *hub.Client, roomID, sessionID string) error {
+	if !c.Session.IsAuthenticated() {
+		return c.SendMessage(domain.NewErrorMessage(domain.ErrCodeUnauthorized, "Not authenticated"))
+	}
+
+	if sessionID == "" {
+		// Live stream, renewing the token issued on join for the current session
+		if c.Session.GetCurrentRoom() != roomID {
+			return c.SendMessage(domain.NewErrorMessage(domain.ErrCodeForbidden, "Not in room"))
+		}
+		s.mu.RLock()
+		if state := s.roomStates[roomID]; state != nil {
+			sessionID = state.SessionID
+		}
+		s.mu.RUnlock()
+		if sessionID == "" {
+			return c.SendMessage(domain.NewErrorMessage(domain.ErrCodeRoomNotLive, "Room is not live"))
+		}
+	}
+
+	// Live or recorded session, the room may have been closed since
+	room, err := s.roomClient.GetRoom(ctx, roomID)
+	if err != nil {
+		if err == client.ErrRoomNotFound {
+			return c.SendMessage(domain.NewErrorMessage(domain.ErrCodeNotFound, "Room not found"))
+		}
+		return c.SendMessage(domain.NewErrorMessage(domain.ErrCodeInternalError, "Failed to get room"))
+	}
+
+	allowed, err := s.entitlements.Allows(ctx, roomID, sessionID, room.OwnerID, c.Session.GetUserID())
+	if err != nil {
+		c.SendMessage(domain.NewErrorMessage(domain.ErrCodeInternalError, "Failed to check access"))
+		return err
+	}
+	if !allowed {
+		return c.SendMessage(domain.NewErrorMessage(domain.ErrCodeForbidden, "Not allowed to watch this session"))
+	}
+
+	token, expiresAt, err := s.issuePlaybackToken(c, roomID, sessionID)
+	if err != nil {
+		c.SendMessage(domain.NewErrorMessage(domain.ErrCodeInternalError, "Failed to issue playback token"))
+		return err
+	}
+
+	return c.SendMessage(&domain.PlaybackTokenMessage{
+		Type:      domain.MsgTypePlaybackToken,
+		RoomID:    roomID,
+		SessionID: sessionID,
+		Token:     token,
+		ExpiresAt: expiresAt,
 	})
 }
 
+// issuePlaybackToken signs a playback token of a session for the client, bound to its address if configured.
+// Returns an empty token when playback tokens are disabled.
+func (s *signalService) issuePlaybackToken(c *hub.Client, roomID, sessionID string) (string, int64, error) {
+	if s.tokens == nil {
+		return "", 0, nil
+	}
+
+	claims := playbacktoken.Claims{
+		RoomID:    roomID,
+		SessionID: sessionID,
+		ExpiresAt: time.Now().Add(s.tokenCfg.TTL).Unix(),
+	}
+	if s.tokenCfg.BindIP {
+		claims.IP = c.Session.RemoteIP
+	}
+
+	token, err := s.tokens.Sign(claims)
+	if err != nil {
+		return "", 0, err
+	}
+	return token, claims.ExpiresAt, nil
+}
+
 func (s *signalService) HandleStartBroadcast(ctx context.Context, c *hub.Client, roomID string, offer json.RawMessage) error {
 	if !c.Session.IsAuthenticated() {
 		return c.SendMessage(domain.NewErrorMessage(domain.ErrCodeUnauthorized, "Not authenticated"))
@@ -155,9 +273,10 @@ func (s *signalService) HandleStartBroadcast(ctx context.Context, c *hub.Client,
 		return c.SendMessage(domain.NewErrorMessage(domain.ErrCodeNotFound, "Room is not active"))
 	}
 
-	// Check if already broadcasting
+	// Check if already broadcasting. The broadcaster itself may send a new offer after its
+	// peer connection dropped, media-service resumes the session within its grace period.
 	s.mu.Lock()
-	if _, exists := s.activeBroadcasts[roomID]; exists {
+	if broadcasterID, exists := s.activeBroadcasts[roomID]; exists && broadcasterID != c.ID {
 		s.mu.Unlock()
 		return c.SendMessage(domain.NewErrorMessage(domain.ErrCodeAlreadyStreaming, "Room already has an active broadcast"))
 	}
@@ -404,6 +523,14 @@ func (s *signalService) processMediaEvent(event *pubsub.Event) {
 			return
 		}
 		s.handleStreamEnded(payload)
+
+	case pubsub.EventStreamHealth:
+		var payload pubsub.StreamHealthPayload
+		if err := event.UnmarshalPayload(&payload); err != nil {
+			l.Error().Err(err).Msg("failed to unmarshal stream health")
+			return
+		}
+		s.handleStreamHealth(payload)
 	}
 }
 
@@ -444,20 +571,48 @@ func (s *signalService) handleServerICECandidate(payload pubsub.ServerICECandida
 	})
 }
 
+func (s *signalService) handleStreamHealth(payload pubsub.StreamHealthPayload) {
+	s.mu.RLock()
+	broadcasterID, exists := s.activeBroadcasts[payload.RoomID]
+	s.mu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	s.hub.SendToClient(broadcasterID, &domain.StreamHealthMessage{
+		Type:             domain.MsgTypeStreamHealth,
+		RoomID:           payload.RoomID,
+		Status:           payload.Status,
+		Issues:           payload.Issues,
+		BitrateKbps:      payload.BitrateKbps,
+		FPS:              payload.FPS,
+		PacketLoss:       payload.PacketLoss,
+		JitterMs:         payload.JitterMs,
+		KeyframeInterval: payload.KeyframeInterval,
+		EncoderSpeed:     payload.EncoderSpeed,
+		EncoderFPS:       payload.EncoderFPS,
+		SegmentLag:       payload.SegmentLag,
+		Timestamp:        payload.Timestamp,
+	})
+}
+
 func (s *signalService) handleStreamReady(payload pubsub.StreamReadyPayload) {
 	s.mu.Lock()
 	s.roomStates[payload.RoomID] = &domain.RoomState{
-		RoomID: payload.RoomID,
-		IsLive: true,
-		HLSUrl: payload.HLSUrl,
+		RoomID:    payload.RoomID,
+		IsLive:    true,
+		SessionID: payload.SessionID,
+		HLSUrl:    payload.HLSUrl,
 	}
 	s.mu.Unlock()
 
 	// Broadcast to all viewers in the room
 	s.hub.BroadcastToRoom(payload.RoomID, &domain.StreamAvailableMessage{
-		Type:   domain.MsgTypeStreamAvailable,
-		RoomID: payload.RoomID,
-		HLSUrl: payload.HLSUrl,
+		Type:      domain.MsgTypeStreamAvailable,
+		RoomID:    payload.RoomID,
+		SessionID: payload.SessionID,
+		HLSUrl:    payload.HLSUrl,
 	}, "")
 
 	l := pkglog.L()
@@ -0,0 +1,154 @@
+/**
+ * Analytics Module - Playback QoE beacons (startup time, rebuffers, bitrate switches, watch time)
+ */
+const Analytics = {
+    BEACON_PATH: '/analytics/beacons',
+    HEARTBEAT_INTERVAL: 30000,
+
+    view: null,
+    player: null,
+    urlFilter: null,
+    handlers: null,
+    heartbeatTimer: null,
+    loadStartedAt: 0,
+    started: false,
+    stalledAt: 0,
+    playingSince: 0,
+    watchedMs: 0,
+    bitrateKbps: 0,
+
+    /**
+     * Start a view session for a player. Restarting the same room, session and mode
+     * (e.g. after a player reinit) keeps the current view.
+     * urlFilter rewrites the beacon URL, e.g. to add the playback token.
+     */
+    start(player, { roomId, sessionId = '', mode = 'live' }, urlFilter = null) {
+        if (this.view && this.view.room_id === roomId && this.view.session_id === sessionId && this.view.mode === mode) {
+            return;
+        }
+        this.end();
+
+        this.view = {
+            view_id: this.newViewId(),
+            room_id: roomId,
+            session_id: sessionId,
+            mode
+        };
+        this.player = player;
+        this.urlFilter = urlFilter;
+        this.loadStartedAt = performance.now();
+        this.started = false;
+        this.stalledAt = 0;
+        this.playingSince = 0;
+        this.watchedMs = 0;
+        this.bitrateKbps = 0;
+
+        this.handlers = {
+            playing: () => this.onPlaying(),
+            waiting: () => this.onWaiting(),
+            pause: () => this.pauseWatch(),
+            ended: () => this.pauseWatch(),
+            pagehide: () => this.end()
+        };
+        ['playing', 'waiting', 'pause', 'ended'].forEach(type => player.addEventListener(type, this.handlers[type]));
+        window.addEventListener('pagehide', this.handlers.pagehide);
+
+        this.heartbeatTimer = setInterval(() => {
+            const watchSeconds = this.takeWatchSeconds();
+            if (watchSeconds > 0) {
+                this.send([{ type: 'heartbeat', watch_seconds: watchSeconds }]);
+            }
+        }, this.HEARTBEAT_INTERVAL);
+    },
+
+    /** End the current view, reporting the remaining watch time. */
+    end() {
+        if (!this.view) return;
+
+        this.send([{ type: 'end', watch_seconds: this.takeWatchSeconds() }], true);
+
+        clearInterval(this.heartbeatTimer);
+        this.heartbeatTimer = null;
+        ['playing', 'waiting', 'pause', 'ended'].forEach(type => this.player.removeEventListener(type, this.handlers[type]));
+        window.removeEventListener('pagehide', this.handlers.pagehide);
+        this.view = null;
+        this.player = null;
+        this.handlers = null;
+    },
+
+    /** Report the bitrate of the rendition the player switched to. */
+    bitrateSwitch(kbps) {
+        if (!this.view || !kbps || kbps === this.bitrateKbps) return;
+        // The first level is the initial pick, not a switch
+        if (this.bitrateKbps) {
+            this.send([{ type: 'bitrate_switch', bitrate_kbps: kbps }]);
+        }
+        this.bitrateKbps = kbps;
+    },
+
+    onPlaying() {
+        const now = performance.now();
+        if (!this.started) {
+            this.started = true;
+            this.send([{ type: 'start', startup_ms: Math.round(now - this.loadStartedAt) }]);
+        } else if (this.stalledAt) {
+            this.send([{ type: 'rebuffer', rebuffer_ms: Math.round(now - this.stalledAt) }]);
+        }
+        this.stalledAt = 0;
+        this.playingSince = now;
+    },
+
+    onWaiting() {
+        this.pauseWatch();
+        // Stalls before the first frame count as startup time, seeks are not rebuffers
+        if (this.started && !this.stalledAt && !this.player.seeking) {
+            this.stalledAt = performance.now();
+        }
+    },
+
+    pauseWatch() {
+        if (!this.playingSince) return;
+        this.watchedMs += performance.now() - this.playingSince;
+        this.playingSince = 0;
+    },
+
+    takeWatchSeconds() {
+        if (this.playingSince) {
+            const now = performance.now();
+            this.watchedMs += now - this.playingSince;
+            this.playingSince = now;
+        }
+        const seconds = Math.round(this.watchedMs) / 1000;
+        this.watchedMs = 0;
+        return seconds;
+    },
+
+    send(events, unloading = false) {
+        if (!this.view) return;
+
+        const timestamp = Date.now();
+        const body = JSON.stringify({
+            ...this.view,
+            events: events.map(event => ({ ...event, timestamp }))
+        });
+        const url = this.urlFilter ? this.urlFilter(this.BEACON_PATH) : this.BEACON_PATH;
+
+        // sendBeacon survives page unload, fetch keepalive is the fallback
+        if (unloading && navigator.sendBeacon && navigator.sendBeacon(url, new Blob([body], { type: 'application/json' }))) {
+            return;
+        }
+        fetch(url, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body,
+            keepalive: true
+        }).catch(err => console.warn('Analytics: Failed to send beacon', err));
+    },
+
+    newViewId() {
+        if (window.crypto && typeof window.crypto.randomUUID === 'function') {
+            return window.crypto.randomUUID();
+        }
+        return `${Date.now().toString(36)}-${Math.random().toString(36).slice(2, 12)}`;
+    }
+};
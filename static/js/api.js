@@ -213,6 +213,13 @@ const API = {
             return `/live/${roomId}/${sessionId}/stream.m3u8`;
         },
 
+        /**
+         * Get Live HLS URL with a seekable DVR window
+         */
+        getDVRUrl(roomId, sessionId) {
+            return `/live/${roomId}/${sessionId}/dvr.m3u8`;
+        },
+
         /**
          * Get VOD HLS URL
          */
@@ -156,6 +156,17 @@ class SignalClient {
         });
     }
 
+    /**
+     * Request a playback token for a room's live stream, or one of its recordings with sessionId
+     */
+    requestPlaybackToken(roomId, sessionId = '') {
+        return this.send({
+            type: 'request_playback_token',
+            room_id: roomId,
+            session_id: sessionId
+        });
+    }
+
     /**
      * Leave a room
      */